@@ -0,0 +1,302 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/report"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/screener"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// applyOptions holds CLI flags for the apply command.
+type applyOptions struct {
+	fromFDupes            string
+	fromRmlint            string
+	verify                bool
+	workers               int
+	hashWorkers           int
+	noProgress            bool
+	errorsFile            string
+	maxErrors             int
+	maxRuntime            time.Duration
+	maxOpsPerSec          float64
+	verbose               int
+	dryRun                bool
+	action                string
+	symlinkFallback       bool
+	mergeSecurityXattrs   bool
+	trustDeviceBoundaries bool
+	prefer                []string
+	avoid                 []string
+	protect               []string
+	cacheFile             string
+	cacheFileSet          bool
+	noCache               bool
+	journalDir            string
+	journalDirSet         bool
+	fsync                 bool
+	tmpSuffix             string
+	stagingDir            string
+	orphanAge             time.Duration
+	targetLockWait        time.Duration
+	waitLock              bool
+	noLock                bool
+}
+
+// newApplyCmd creates the apply subcommand.
+func newApplyCmd() *cobra.Command {
+	opts := &applyOptions{
+		cacheFile:  defaultCacheFile(),
+		journalDir: defaultJournalDir(),
+	}
+
+	cmd := &cobra.Command{
+		Use:   "apply --from-fdupes FILE | --from-rmlint FILE",
+		Short: "Deduplicate groups found by another tool",
+		Long: `Reads duplicate groups from fdupes/jdupes output (--from-fdupes) or rmlint JSON
+(--from-rmlint), re-stats every file and replaces duplicates with hardlinks
+(or symlinks as fallback) using the same safety checks as dedupe.
+
+Use --verify to re-hash the groups before replacing anything; otherwise the
+other tool's comparison is trusted. FILE may be - for stdin:
+  fdupes -r /data | dupedog apply --from-fdupes - --verify`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			opts.cacheFileSet = cmd.Flags().Changed("cache-file")
+			opts.journalDirSet = cmd.Flags().Changed("journal-dir")
+			return runApply(opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.fromFDupes, "from-fdupes", "", "Read groups from fdupes/jdupes output (- for stdin)")
+	cmd.Flags().StringVar(&opts.fromRmlint, "from-rmlint", "", "Read groups from rmlint JSON output (- for stdin)")
+	cmd.Flags().BoolVar(&opts.verify, "verify", false, "Re-hash groups before replacing files")
+	cmd.Flags().IntVarP(&opts.workers, "workers", "w", 0, "Number of parallel hashing workers (0 = auto)")
+	cmd.Flags().IntVar(&opts.hashWorkers, "hash-workers", 0, "Number of parallel hashing workers (0 = --workers, else 4 per device, at most CPU count)")
+	cmd.Flags().BoolVar(&opts.noProgress, "no-progress", false, "Disable progress output")
+	cmd.Flags().StringVar(&opts.errorsFile, "errors-file", "", "Write every error to this file, one per line")
+	cmd.Flags().IntVar(&opts.maxErrors, "max-errors", 0, "Stop the run after this many errors (0 = unlimited)")
+	cmd.Flags().DurationVar(&opts.maxRuntime, "max-runtime", 0, "Stop cleanly after this long, e.g. 4h (0 = unlimited)")
+	cmd.Flags().Float64Var(&opts.maxOpsPerSec, "max-ops-per-sec", 0, "Replace at most this many files per second (0 = unlimited)")
+	cmd.Flags().CountVarP(&opts.verbose, "verbose", "v", "Show file operations; repeat for skip reasons and cache hits (-vv) and hash decisions (-vvv)")
+	cmd.Flags().BoolVarP(&opts.dryRun, "dry-run", "n", false, "Preview changes without executing")
+	cmd.Flags().StringVar(&opts.action, "action", "hardlink", "Replace duplicates with: hardlink, symlink (even on the same device), or auto (shared extents where supported, else hardlink)")
+	cmd.Flags().BoolVar(&opts.symlinkFallback, "symlink-fallback", false, "Fall back to symlinks when deduplicating files across device boundaries")
+	cmd.Flags().BoolVar(&opts.mergeSecurityXattrs, "merge-security-xattrs", false,
+		"Merge duplicates even if their security.capability or SELinux contexts differ")
+	cmd.Flags().BoolVar(&opts.trustDeviceBoundaries, "trust-device-boundaries", false,
+		"Assume devices have independent inode spaces. WARNING: Unsafe if the same filesystem is mounted at multiple paths (e.g., NFS)")
+	cmd.Flags().StringSliceVar(&opts.prefer, "prefer", nil,
+		"Preferred source path glob, ranked before originals; or tie-breaker: shortest-path, shallowest (repeatable)")
+	cmd.Flags().StringSliceVar(&opts.avoid, "avoid", nil, "Path globs never kept as source, e.g. /tmp (repeatable)")
+	cmd.Flags().StringSliceVar(&opts.protect, "protect", nil, "Glob patterns for paths that may be sources but are never replaced (repeatable)")
+	cmd.Flags().StringVar(&opts.cacheFile, "cache-file", opts.cacheFile, "Path to hash cache file (with --verify)")
+	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Disable the hash cache")
+	cmd.Flags().StringVar(&opts.journalDir, "journal-dir", opts.journalDir, "Directory of the intent log used to recover replacements interrupted by a crash (empty = disabled)")
+	cmd.Flags().BoolVar(&opts.fsync, "fsync", false, "Sync each target's directory after replacing it, so replacements survive a power loss (slower)")
+	cmd.Flags().StringVar(&opts.tmpSuffix, "tmp-suffix", ".dupedog.tmp", "Suffix of the temporary link renamed over each target; must contain \"dupedog\"")
+	cmd.Flags().StringVar(&opts.stagingDir, "staging-dir", "",
+		"Make temporary links in this directory, relative to the top of each target's filesystem, instead of next to the target")
+	cmd.Flags().DurationVar(&opts.orphanAge, "orphan-age", time.Minute, "Minimum age of a leftover temporary link before it is treated as orphaned and may be removed")
+	cmd.Flags().DurationVar(&opts.targetLockWait, "target-lock-wait", 0, "Wait up to this long for a target file locked by another program before skipping it, e.g. 5s (--wait-lock waits for other dupedog runs)")
+	cmd.Flags().BoolVar(&opts.waitLock, "wait-lock", false, "Wait for other dupedog runs on the same paths to finish instead of failing (--target-lock-wait waits for files locked by other programs)")
+	cmd.Flags().BoolVar(&opts.noLock, "no-lock", false, "Do not lock the paths against concurrent dupedog runs")
+	cmd.MarkFlagsMutuallyExclusive("from-fdupes", "from-rmlint")
+	cmd.MarkFlagsOneRequired("from-fdupes", "from-rmlint")
+
+	return cmd
+}
+
+// runApply executes the pipeline: import → stat → group → [verify] → dedupe.
+func runApply(opts *applyOptions) (err error) {
+	if err := validateWorkers(opts.workers, 0, opts.hashWorkers); err != nil {
+		return err
+	}
+	if err := validateTmpFlags(opts.tmpSuffix, opts.stagingDir, opts.orphanAge); err != nil {
+		return err
+	}
+	if opts.maxOpsPerSec < 0 {
+		return fmt.Errorf("invalid --max-ops-per-sec: must not be negative")
+	}
+	if opts.targetLockWait < 0 {
+		return fmt.Errorf("invalid --target-lock-wait: must not be negative")
+	}
+	action, err := deduper.ParseAction(opts.action)
+	if err != nil {
+		return fmt.Errorf("invalid --action: %w", err)
+	}
+	prefer, priority, err := parsePrefer(opts.prefer)
+	if err != nil {
+		return fmt.Errorf("invalid --prefer: %w", err)
+	}
+	avoid, err := absGlobs(opts.avoid)
+	if err != nil {
+		return fmt.Errorf("invalid --avoid: %w", err)
+	}
+	protect, err := protectGlobs(opts.protect)
+	if err != nil {
+		return fmt.Errorf("invalid --protect: %w", err)
+	}
+
+	imported, err := readImported(opts)
+	if err != nil {
+		return err
+	}
+
+	reporter := progress.Terminal(!opts.noProgress)
+	errLog := newErrorLog(opts.errorsFile, opts.maxErrors, opts.maxRuntime)
+	defer func() { err = cmp.Or(err, errLog.close()) }()
+	errors := errLog.ch
+
+	candidates := importedCandidates(imported, opts.trustDeviceBoundaries, errors)
+	originals, err := absRoots(imported.Originals)
+	if err != nil {
+		return err
+	}
+	if candidates.Len() > 0 {
+		lock, err := lockRoots(errLog.ctx, []string{commonDir(candidates)}, opts.waitLock, opts.noLock, opts.dryRun)
+		if err != nil {
+			return cmp.Or(errLog.abortErr(), err)
+		}
+		defer func() { _ = lock.Release() }()
+	}
+
+	var duplicates types.DuplicateGroups
+	if opts.verify && candidates.Len() > 0 {
+		// Self-cleaning covers the tree the other tool scanned, as for dedupe
+		scope := []string{commonDir(candidates)}
+		hashCache, err := openCache(&dedupeOptions{cacheFile: opts.cacheFile, cacheFileSet: opts.cacheFileSet, noCache: opts.noCache},
+			scope, 0, cache.KeyPath)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = hashCache.Close() }()
+
+		duplicates = verifier.New(candidates, verifier.Options{
+			Workers:   hashWorkers(opts.hashWorkers, opts.workers, candidates),
+			Cache:     hashCache,
+			Verbosity: opts.verbose,
+			Reporter:  reporter,
+		}, errors).RunContext(errLog.ctx)
+	} else {
+		groups := make([]types.DuplicateGroup, 0, candidates.Len())
+		for _, cg := range candidates.Items() {
+			groups = append(groups, types.NewDuplicateGroup(cg.Items()))
+		}
+		duplicates = types.NewDuplicateGroups(groups)
+	}
+
+	if !opts.mergeSecurityXattrs {
+		duplicates = deduper.SplitBySecurity(duplicates, errors)
+	}
+
+	intents, err := openJournal(opts.journalDir, opts.journalDirSet, opts.dryRun)
+	if err != nil {
+		return err
+	}
+	defer func() { err = cmp.Or(err, intents.Close()) }()
+
+	// --prefer globs, then originals marked by the tool (rmlint) are preferred as sources
+	deduper.New(duplicates, deduper.Options{
+		PathPriority:    append(priority, originals...),
+		Avoid:           avoid,
+		Prefer:          prefer,
+		Protect:         protect,
+		Journal:         intents,
+		Fsync:           opts.fsync,
+		TmpSuffix:       opts.tmpSuffix,
+		StagingDir:      opts.stagingDir,
+		OrphanAge:       opts.orphanAge,
+		LockWait:        opts.targetLockWait,
+		MaxOpsPerSec:    opts.maxOpsPerSec,
+		DryRun:          opts.dryRun,
+		Action:          action,
+		SymlinkFallback: opts.symlinkFallback,
+		Verbosity:       opts.verbose,
+		Reporter:        reporter,
+	}, errors).RunContext(errLog.ctx)
+	return nil
+}
+
+// readImported parses the list given by --from-fdupes or --from-rmlint.
+func readImported(opts *applyOptions) (*report.Imported, error) {
+	path, parse := opts.fromFDupes, report.ParseFDupes
+	if opts.fromRmlint != "" {
+		path, parse = opts.fromRmlint, report.ParseRmlint
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	imported, err := parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return imported, nil
+}
+
+// importedCandidates re-stats every imported path and groups each imported
+// group by size and inode, as the screener does for scanned files. Files
+// that vanished or are not regular are reported and left out.
+func importedCandidates(imported *report.Imported, trustDeviceBoundaries bool, errCh chan *types.Event) types.CandidateGroups {
+	var groups []types.CandidateGroup
+	for _, paths := range imported.Groups {
+		files := make([]*types.FileInfo, 0, len(paths))
+		seen := make(map[string]bool, len(paths))
+		for _, p := range paths {
+			f, err := scanner.Stat(p)
+			if err != nil {
+				errCh <- types.NewEvent(types.StageImport, p, err)
+				continue
+			}
+			if !seen[f.Path] { // Tools may list one path twice
+				seen[f.Path] = true
+				files = append(files, f)
+			}
+		}
+		groups = append(groups, screener.New(files, screener.Options{TrustDeviceBoundaries: trustDeviceBoundaries}).Run().Items()...)
+	}
+	return types.NewCandidateGroups(groups)
+}
+
+// commonDir returns the deepest directory containing every candidate file.
+func commonDir(candidates types.CandidateGroups) string {
+	dir := ""
+	for _, cg := range candidates.Items() {
+		for _, siblings := range cg.Items() {
+			for _, f := range siblings.Items() {
+				if dir == "" {
+					dir = filepath.Dir(f.Path)
+				}
+				for !isUnderDir(f.Path, dir) {
+					dir = filepath.Dir(dir)
+				}
+			}
+		}
+	}
+	return dir
+}
+
+// isUnderDir reports whether path lies beneath dir.
+func isUnderDir(path, dir string) bool {
+	return dir == "/" || strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/archives"
+	"github.com/ivoronin/dupedog/internal/mounts"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/spf13/cobra"
+)
+
+// archivesOptions holds CLI flags for the archives command.
+type archivesOptions struct {
+	minSizeStr           string
+	excludes             []string
+	includeSnapshots     bool
+	includeOverlayLayers bool
+	workers              int
+	scanWorkers          int
+	readdirBatch         int
+	noProgress           bool
+	errorsFile           string
+	maxErrors            int
+	maxRuntime           time.Duration
+}
+
+// newArchivesCmd creates the archives subcommand.
+func newArchivesCmd() *cobra.Command {
+	opts := &archivesOptions{minSizeStr: "1"}
+
+	cmd := &cobra.Command{
+		Use:   "archives [paths...]",
+		Short: "Report archive members that duplicate loose files",
+		Long: `Scans paths, reads the tar (.tar, .tar.gz, .tgz, .tar.bz2, .tbz2) and zip
+archives found, and reports every member with the same content (SHA-256) as
+a loose file, to help decide what to prune by hand.
+
+Nothing is modified, archives included:
+  dupedog archives /volume1`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runArchives(args, opts, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.minSizeStr, "min-size", "m", opts.minSizeStr, "Minimum member and file size (e.g., 100, 1K, 10M, 1G)")
+	cmd.Flags().StringSliceVarP(&opts.excludes, "exclude", "e", nil, "Glob patterns to exclude")
+	cmd.Flags().BoolVar(&opts.includeSnapshots, "include-snapshots", false, "Scan snapshot directories (.snapshot, .snapshots, .zfs/snapshot), skipped by default")
+	cmd.Flags().BoolVar(&opts.includeOverlayLayers, "include-overlay-layers", false, "Scan the merged views and layer directories of mounted overlayfs, skipped by default")
+	cmd.Flags().IntVarP(&opts.workers, "workers", "w", 0, "Number of parallel directory readers (0 = auto)")
+	cmd.Flags().IntVar(&opts.readdirBatch, "readdir-batch", scanner.DefaultReaddirBatch, "Directory entries listed at a time")
+	cmd.Flags().IntVar(&opts.scanWorkers, "scan-workers", 0, "Number of parallel directory readers (0 = --workers, else 4x CPU count)")
+	cmd.Flags().BoolVar(&opts.noProgress, "no-progress", false, "Disable progress output")
+	cmd.Flags().StringVar(&opts.errorsFile, "errors-file", "", "Write every error to this file, one per line")
+	cmd.Flags().IntVar(&opts.maxErrors, "max-errors", 0, "Stop the run after this many errors (0 = unlimited)")
+	cmd.Flags().DurationVar(&opts.maxRuntime, "max-runtime", 0, "Stop cleanly after this long, e.g. 4h (0 = unlimited)")
+
+	return cmd
+}
+
+// runArchives scans paths, matches archive members against loose files and
+// prints the matches to w.
+func runArchives(paths []string, opts *archivesOptions, w io.Writer) (err error) {
+	if err := validateWorkers(opts.workers, opts.scanWorkers, 0); err != nil {
+		return err
+	}
+	if opts.readdirBatch < 1 {
+		return fmt.Errorf("invalid --readdir-batch: must be at least 1")
+	}
+	minSize, err := parseSize(opts.minSizeStr)
+	if err != nil {
+		return fmt.Errorf("invalid --min-size: %w", err)
+	}
+	if err := validateGlobPatterns(opts.excludes); err != nil {
+		return fmt.Errorf("invalid --exclude: %w", err)
+	}
+
+	roots, err := absRoots(paths)
+	if err != nil {
+		return err
+	}
+
+	reporter := progress.Terminal(!opts.noProgress)
+	errLog := newErrorLog(opts.errorsFile, opts.maxErrors, opts.maxRuntime)
+	defer func() { err = cmp.Or(err, errLog.close()) }()
+	errors := errLog.ch
+
+	// Directories shown twice through bind mounts are scanned once
+	roots, viewExcludes := bindMountViews(roots, mounts.Entries(), os.Stderr)
+	files := scanner.New(roots, scanner.Options{
+		MinSize:      minSize,
+		Excludes:     append(scanExcludes(opts.excludes, roots, opts.includeSnapshots, opts.includeOverlayLayers), viewExcludes...),
+		Workers:      scanWorkers(opts.scanWorkers, opts.workers),
+		ReaddirBatch: opts.readdirBatch,
+		Reporter:     reporter,
+	}, errors).RunContext(errLog.ctx)
+
+	matches := archives.Find(errLog.ctx, files, minSize, reporter, errors)
+	printArchiveMatches(w, matches)
+	return errLog.abortErr()
+}
+
+// printArchiveMatches writes one line per archive member and the loose files
+// it duplicates to w, followed by the total.
+func printArchiveMatches(w io.Writer, matches []archives.Match) {
+	var total int64
+	for _, m := range matches {
+		total += m.Size
+		_, _ = fmt.Fprintf(w, "%s: %s (%s) duplicates %s\n",
+			m.Archive, m.Name, humanize.IBytes(uint64(m.Size)), strings.Join(m.Files, ", "))
+	}
+	_, _ = fmt.Fprintf(w, "%d archive members (%s) duplicate loose files\n", len(matches), humanize.IBytes(uint64(total)))
+}
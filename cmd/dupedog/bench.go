@@ -0,0 +1,157 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/bench"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/spf13/cobra"
+)
+
+// benchOptions holds CLI flags for the bench command.
+type benchOptions struct {
+	scanWorkers    int
+	readdirBatch   int
+	maxHashWorkers int
+	hashBytesStr   string
+	linkOps        int
+	maxRuntime     time.Duration
+}
+
+// newBenchCmd creates the bench subcommand.
+func newBenchCmd() *cobra.Command {
+	opts := &benchOptions{hashBytesStr: "1G", linkOps: 1000, readdirBatch: scanner.DefaultReaddirBatch}
+
+	cmd := &cobra.Command{
+		Use:   "bench [path]",
+		Short: "Measure scan, hash and link throughput on a filesystem",
+		Long: `Measures how fast the filesystem at path (default: the current directory)
+serves dupedog's workload, and suggests worker counts:
+
+  scan  files listed per second
+  hash  SHA-256 throughput of the verifier's range reads at 1, 2, 4, ...
+        workers, each round reading different files
+  link  hardlink replacements per second, on scratch files in a temporary
+        directory under path (removed afterwards)
+
+Nothing outside the temporary directory is modified. Files already in the page
+cache hash faster than the disk can read them; drop caches first for cold
+numbers:
+  dupedog bench /volume1`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
+			cmd.SilenceUsage = true // Measurement failures are not usage errors
+			return runBench(path, opts, os.Stdout)
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.scanWorkers, "scan-workers", 0, "Number of parallel directory readers (0 = 4x CPU count)")
+	cmd.Flags().IntVar(&opts.readdirBatch, "readdir-batch", opts.readdirBatch, "Directory entries listed at a time")
+	cmd.Flags().IntVar(&opts.maxHashWorkers, "max-hash-workers", 0, "Highest hashing worker count measured (0 = CPU count)")
+	cmd.Flags().StringVar(&opts.hashBytesStr, "hash-bytes", opts.hashBytesStr, "Bytes of the largest files hashed across all rounds (e.g., 512M; 0 = skip)")
+	cmd.Flags().IntVar(&opts.linkOps, "link-ops", opts.linkOps, "Link replacements measured (0 = skip)")
+	cmd.Flags().DurationVar(&opts.maxRuntime, "max-runtime", 0, "Stop cleanly after this long, e.g. 5m (0 = unlimited)")
+
+	return cmd
+}
+
+// runBench scans path, then measures hashing and link throughput, printing
+// each result to w as it completes.
+func runBench(path string, opts *benchOptions, w io.Writer) (err error) {
+	if opts.scanWorkers < 0 {
+		return fmt.Errorf("invalid --scan-workers: must not be negative")
+	}
+	if opts.maxHashWorkers < 0 {
+		return fmt.Errorf("invalid --max-hash-workers: must not be negative")
+	}
+	if opts.readdirBatch < 1 {
+		return fmt.Errorf("invalid --readdir-batch: must be at least 1")
+	}
+	if opts.linkOps < 0 {
+		return fmt.Errorf("invalid --link-ops: must not be negative")
+	}
+	hashBytes, err := parseSize(opts.hashBytesStr)
+	if err != nil {
+		return fmt.Errorf("invalid --hash-bytes: %w", err)
+	}
+
+	roots, err := absRoots([]string{path})
+	if err != nil {
+		return err
+	}
+
+	errLog := newErrorLog("", 0, opts.maxRuntime)
+	defer func() { err = cmp.Or(err, errLog.close()) }()
+
+	// Scan
+	workers := scanWorkers(opts.scanWorkers, 0)
+	scan := scanner.New(roots, scanner.Options{
+		MinSize:      1,
+		Excludes:     scanExcludes(nil, roots, false, false),
+		Workers:      workers,
+		ReaddirBatch: opts.readdirBatch,
+	}, errLog.ch)
+	start := time.Now()
+	files := scan.RunContext(errLog.ctx)
+	elapsed := time.Since(start)
+	scanned := scan.Stats().ScannedFiles
+	_, _ = fmt.Fprintf(w, "Scan: %d files in %v (%.0f files/s, %d workers)\n",
+		scanned, elapsed.Round(time.Millisecond), float64(scanned)/elapsed.Seconds(), workers)
+
+	// Hash
+	var results []bench.HashResult
+	if hashBytes > 0 {
+		counts := bench.WorkerCounts(cmp.Or(opts.maxHashWorkers, runtime.NumCPU()))
+		rounds := bench.SelectFiles(files, hashBytes, len(counts))
+		_, _ = fmt.Fprintf(w, "Hash (SHA-256, %s of the largest files per round):\n", humanize.IBytes(uint64(hashBytes/int64(len(counts)))))
+		_, _ = fmt.Fprintf(w, "  %7s  %12s  %12s\n", "workers", "throughput", "per worker")
+		for i, n := range counts {
+			if len(rounds[i]) == 0 {
+				_, _ = fmt.Fprintf(w, "  %7d  %12s\n", n, "no files left")
+				continue
+			}
+			r, err := bench.Hash(errLog.ctx, rounds[i], n)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+			results = append(results, r)
+			_, _ = fmt.Fprintf(w, "  %7d  %10s/s  %10s/s\n", n,
+				humanize.IBytes(uint64(r.BytesPerSec())), humanize.IBytes(uint64(r.BytesPerSec()/float64(n))))
+		}
+	}
+
+	// Link
+	if opts.linkOps > 0 && errLog.ctx.Err() == nil {
+		links, err := bench.Links(errLog.ctx, roots[0], opts.linkOps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: link benchmark skipped: %v\n", err)
+		} else {
+			_, _ = fmt.Fprintf(w, "Link: %d replacements in %v (%.0f ops/s)\n",
+				links.Ops, links.Elapsed.Round(time.Millisecond), links.OpsPerSec())
+		}
+	}
+
+	printBenchAdvice(w, results)
+	return nil
+}
+
+// printBenchAdvice suggests --hash-workers from the hashing results, if more
+// than one worker count was measured.
+func printBenchAdvice(w io.Writer, results []bench.HashResult) {
+	if len(results) < 2 {
+		return
+	}
+	if n := bench.Fastest(results); n > 0 {
+		_, _ = fmt.Fprintf(w, "Suggested: --hash-workers %d (more workers were not faster by 10%% or more)\n", n)
+	}
+}
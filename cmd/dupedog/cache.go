@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/spf13/cobra"
+)
+
+// errNoCacheFile is returned when no default cache location can be determined.
+var errNoCacheFile = errors.New("no default cache location; use --cache-file")
+
+// cacheOptions holds CLI flags shared by the cache subcommands.
+type cacheOptions struct {
+	cacheFile string
+	json      bool
+}
+
+// newCacheCmd creates the cache command group (export/import).
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the hash cache",
+	}
+
+	cmd.AddCommand(newCacheExportCmd(), newCacheImportCmd())
+	return cmd
+}
+
+// bindCacheFlags binds flags shared by the cache subcommands.
+func bindCacheFlags(cmd *cobra.Command, opts *cacheOptions) {
+	cmd.Flags().StringVar(&opts.cacheFile, "cache-file", defaultCacheFile(), "Path to hash cache file")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Use JSON Lines instead of the BoltDB format")
+}
+
+// newCacheExportCmd creates the cache export subcommand.
+func newCacheExportCmd() *cobra.Command {
+	opts := &cacheOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the hash cache to stdout",
+		Long: `Writes the hash cache to stdout for backup, migration, or inspection.
+
+By default the output is a BoltDB snapshot usable as a --cache-file on another host.
+With --json, each entry is written as one JSON object per line:
+  dupedog cache export --cache-file hashes.db --json | jq 'select(.size > 1e9)'`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runCacheExport(opts, os.Stdout)
+		},
+	}
+
+	bindCacheFlags(cmd, opts)
+	return cmd
+}
+
+// newCacheImportCmd creates the cache import subcommand.
+func newCacheImportCmd() *cobra.Command {
+	opts := &cacheOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Merge exported entries into the hash cache",
+		Long: `Merges entries from FILE (produced by "cache export") into the hash cache.
+
+Existing entries are kept; imported entries replace entries with the same key.
+With --json, FILE is read as JSON Lines ("-" reads stdin).
+The cache file is created if it does not exist.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runCacheImport(opts, args[0])
+		},
+	}
+
+	bindCacheFlags(cmd, opts)
+	return cmd
+}
+
+// runCacheExport writes the cache in the selected format.
+func runCacheExport(opts *cacheOptions, w io.Writer) error {
+	if opts.cacheFile == "" {
+		return errNoCacheFile
+	}
+	if opts.json {
+		if _, err := cache.ExportJSON(opts.cacheFile, w); err != nil {
+			return fmt.Errorf("export cache: %w", err)
+		}
+		return nil
+	}
+	if _, err := cache.ExportBolt(opts.cacheFile, w); err != nil {
+		return fmt.Errorf("export cache: %w", err)
+	}
+	return nil
+}
+
+// runCacheImport merges entries from src in the selected format.
+func runCacheImport(opts *cacheOptions, src string) error {
+	if opts.cacheFile == "" {
+		return errNoCacheFile
+	}
+	var n int
+	var err error
+	switch {
+	case !opts.json:
+		n, err = cache.ImportBolt(opts.cacheFile, src)
+	case src == "-":
+		n, err = cache.ImportJSON(opts.cacheFile, os.Stdin)
+	default:
+		n, err = importJSONFile(opts.cacheFile, src)
+	}
+	if err != nil {
+		return fmt.Errorf("import cache: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d entries into %s\n", n, opts.cacheFile)
+	return nil
+}
+
+// importJSONFile imports JSON Lines entries from a file.
+func importJSONFile(cacheFile, src string) (int, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return cache.ImportJSON(cacheFile, f)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/spf13/cobra"
+)
+
+// cleanupOptions holds CLI flags for the cleanup command.
+type cleanupOptions struct {
+	tmpSuffix  string
+	stagingDir string
+	orphanAge  time.Duration
+	dryRun     bool
+	errorsFile string
+}
+
+// newCleanupCmd creates the cleanup subcommand.
+func newCleanupCmd() *cobra.Command {
+	opts := &cleanupOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "cleanup [paths...]",
+		Short: "Remove temporary links left by interrupted runs",
+		Long: `Finds the temporary links (.dupedog.tmp) that runs killed mid-replacement left
+under paths, and in the --staging-dir of their filesystems, and removes those
+that are safe to delete: older than --orphan-age, and symlinks or hardlinks whose
+content has another link. Others are listed for manual action, and the exit
+status is non-zero if any are left:
+  dupedog cleanup /data`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true // Files left behind are not usage errors
+			return runCleanup(args, opts, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.tmpSuffix, "tmp-suffix", ".dupedog.tmp", "Suffix of temporary links, as given to dedupe")
+	cmd.Flags().StringVar(&opts.stagingDir, "staging-dir", "", "Staging directory of temporary links, as given to dedupe")
+	cmd.Flags().DurationVar(&opts.orphanAge, "orphan-age", time.Minute, "Only remove temporary links at least this old; younger ones may belong to a running dedupe")
+	cmd.Flags().BoolVarP(&opts.dryRun, "dry-run", "n", false, "Preview removals without executing")
+	cmd.Flags().StringVar(&opts.errorsFile, "errors-file", "", "Write every error to this file, one per line")
+
+	return cmd
+}
+
+// runCleanup removes the orphaned temporary links under paths and prints the
+// outcome for each to w.
+func runCleanup(paths []string, opts *cleanupOptions, w io.Writer) (err error) {
+	if err := validateTmpFlags(opts.tmpSuffix, opts.stagingDir, opts.orphanAge); err != nil {
+		return err
+	}
+	roots, err := absRoots(paths)
+	if err != nil {
+		return err
+	}
+
+	errLog := newErrorLog(opts.errorsFile, 0, 0)
+	defer func() { err = cmp.Or(err, errLog.close()) }()
+
+	linkOpts := deduper.LinkOptions{TmpSuffix: opts.tmpSuffix, StagingDir: opts.stagingDir, OrphanAge: opts.orphanAge}
+	orphans := deduper.CleanupOrphans(roots, linkOpts, opts.dryRun, errLog.ch)
+	if left := printOrphans(w, orphans, opts.dryRun); left > 0 {
+		return cmp.Or(errLog.abortErr(), fmt.Errorf("%d temporary files left", left))
+	}
+	return errLog.abortErr()
+}
+
+// printOrphans writes one line per temporary link to w and returns how many
+// are left.
+func printOrphans(w io.Writer, orphans []deduper.Orphan, dryRun bool) (left int) {
+	removed := "removed"
+	if dryRun {
+		removed = "would remove"
+	}
+	for _, o := range orphans {
+		if o.Removed {
+			_, _ = fmt.Fprintf(w, "%s %s\n", removed, o.Path)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s: left: %v\n", o.Path, o.Err)
+		left++
+	}
+	return left
+}
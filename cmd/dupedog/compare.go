@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// newCompareCmd creates the compare subcommand.
+func newCompareCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compare FILE1 FILE2",
+		Short: "Compare two files the way the verifier does",
+		Long: `Runs the verifier's progressive comparison (head, tail, chunks) on two files
+and prints the first range where they differ, with the first differing byte.
+
+The exit status is 0 if the files are identical, 1 if they differ, and 2 on error,
+including usage errors:
+  dupedog compare /data/a.iso /backup/a.iso && echo same`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			return usageStatus(cmd, cobra.ExactArgs(2)(cmd, args))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true // Comparison failures are not usage errors
+			cmd.SilenceErrors = true
+			identical, err := runCompare(args[0], args[1], os.Stdout)
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitStatus(2)
+			case !identical:
+				return exitStatus(1)
+			}
+			return nil
+		},
+	}
+
+	cmd.SetFlagErrorFunc(usageStatus)
+
+	return cmd
+}
+
+// usageStatus prints a usage error like cobra does and turns it into exit
+// status 2, so that scripts can tell it from "files differ".
+func usageStatus(cmd *cobra.Command, err error) error {
+	if err == nil {
+		return nil
+	}
+	cmd.SilenceErrors = true
+	cmd.PrintErrln("Error:", err.Error())
+	return exitStatus(2)
+}
+
+// runCompare compares two files and prints the outcome to w.
+func runCompare(path1, path2 string, w io.Writer) (identical bool, err error) {
+	f1, err := scanner.Stat(path1)
+	if err != nil {
+		return false, err
+	}
+	f2, err := scanner.Stat(path2)
+	if err != nil {
+		return false, err
+	}
+
+	if f1.Size != f2.Size {
+		_, _ = fmt.Fprintf(w, "%s %s differ: size %d vs %d\n", f1.Path, f2.Path, f1.Size, f2.Size)
+		return false, nil
+	}
+	if f1.Dev == f2.Dev && f1.Ino == f2.Ino {
+		_, _ = fmt.Fprintf(w, "%s %s are identical: same inode\n", f1.Path, f2.Path)
+		return true, nil
+	}
+
+	elim, err := verifier.Explain(f1, []*types.FileInfo{f2})
+	if err != nil {
+		return false, err
+	}
+	if elim == nil {
+		_, _ = fmt.Fprintf(w, "%s %s are identical (%d bytes)\n", f1.Path, f2.Path, f1.Size)
+		return true, nil
+	}
+
+	r := elim.Range
+	if elim.Offset < 0 { // Range hashes differed, but the bytes match now: a file changed meanwhile
+		_, _ = fmt.Fprintf(w, "%s %s differ: %s [%d, %d)\n", f1.Path, f2.Path, r.Name, r.Start, r.Start+r.Size)
+	} else {
+		_, _ = fmt.Fprintf(w, "%s %s differ: %s [%d, %d) at byte %d\n", f1.Path, f2.Path, r.Name, r.Start, r.Start+r.Size, elim.Offset)
+	}
+	return false, nil
+}
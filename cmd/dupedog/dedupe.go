@@ -1,14 +1,27 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/ivoronin/dupedog/internal/deduper"
 	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/ivoronin/dupedog/internal/marker"
+	"github.com/ivoronin/dupedog/internal/mounts"
+	"github.com/ivoronin/dupedog/internal/pathnorm"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/remote"
+	"github.com/ivoronin/dupedog/internal/report"
 	"github.com/ivoronin/dupedog/internal/scanner"
 	"github.com/ivoronin/dupedog/internal/screener"
+	"github.com/ivoronin/dupedog/internal/types"
 	"github.com/ivoronin/dupedog/internal/verifier"
 	"github.com/spf13/cobra"
 )
@@ -16,26 +29,93 @@ import (
 // dedupeOptions holds CLI flags for the dedupe command.
 type dedupeOptions struct {
 	minSizeStr            string
+	minSizeFor            []string
 	excludes              []string
+	includeSnapshots      bool
+	includeOverlayLayers  bool
 	workers               int
+	scanWorkers           int
+	readdirBatch          int
+	hashWorkers           int
 	noProgress            bool
-	verbose               bool
+	errorsFile            string
+	maxErrors             int
+	maxRuntime            time.Duration
+	maxOpsPerSec          float64
+	limit                 int
+	hashLargestFirst      bool
+	verbose               int
 	dryRun                bool
+	action                string
 	symlinkFallback       bool
+	symlinkWithinRoots    bool
+	balanceLinks          bool
+	mergeSecurityXattrs   bool
 	trustDeviceBoundaries bool
 	cacheFile             string
+	cacheFileSet          bool // --cache-file given explicitly (open errors are fatal)
+	noCache               bool
+	cacheMaxSizeStr       string
+	cacheMaxAge           time.Duration
+	cacheKey              string
+	journalDir            string
+	journalDirSet         bool // --journal-dir given explicitly (open errors are fatal)
+	fsync                 bool
+	tmpSuffix             string
+	stagingDir            string
+	orphanAge             time.Duration
+	targetLockWait        time.Duration
+	incremental           bool
+	indexFile             string
+	waitLock              bool
+	noLock                bool
+	reportFile            string
+	reportFormat          string
+	reportExtensions      bool
+	histogram             bool
+	references            []string
+	prefer                []string
+	keepFirstListed       bool
+	avoid                 []string
+	protect               []string
+	normalizePaths        string
+	ignoreHashFile        string
+	onlyHashFile          string
+	preHook               string
+	postHook              string
+	sampleVerifyStr       string
+	sampleWindows         int
+	trustMetadata         bool
+	explain               []string
+	print0                bool
+	summaryFile           string
+	notifyURL             string
+	notifySecretFile      string
+	notifyRetries         int
+	xattrMarkers          bool
+	sshCommand            string
+	remoteHelper          string
 }
 
 
 // newDedupeCmd creates the dedupe subcommand.
 func newDedupeCmd() *cobra.Command {
 	opts := &dedupeOptions{
-		minSizeStr: "1",
-		workers:    runtime.NumCPU(),
+		minSizeStr:      "1",
+		cacheFile:       defaultCacheFile(),
+		journalDir:      defaultJournalDir(),
+		indexFile:       defaultIndexFile(),
+		cacheMaxSizeStr: "0",
+		cacheKey:        "path",
+		reportFormat:    "json",
+		sampleVerifyStr: "0",
+		sampleWindows:   16,
+		notifyRetries:   3,
+		sshCommand:      "ssh",
 	}
 
 	cmd := &cobra.Command{
-		Use:   "dedupe [paths...]",
+		Use:   "dedupe [paths...] [[user@]host:/path...]",
 		Short: "Find and deduplicate files",
 		Long: `Scans for duplicates and replaces them with hardlinks (or symlinks as fallback).
 
@@ -44,78 +124,552 @@ When using --symlink-fallback, path order determines which location keeps actual
   dupedog dedupe /primary /secondary --symlink-fallback
 keeps files in /primary, with /secondary containing symlinks pointing to them.
 
+Paths of the form [user@]host:/path are scanned over SSH and only reported:
+local files whose content is found there are listed in the report.
+
 Use --dry-run to preview without making changes.`,
 		Args: cobra.MinimumNArgs(1),
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.cacheFileSet = cmd.Flags().Changed("cache-file")
+			opts.journalDirSet = cmd.Flags().Changed("journal-dir")
 			return runDedupe(args, opts)
 		},
 	}
 
 	// Bind flags to options
 	cmd.Flags().StringVarP(&opts.minSizeStr, "min-size", "m", opts.minSizeStr, "Minimum file size (e.g., 100, 1K, 10M, 1G)")
+	cmd.Flags().StringSliceVar(&opts.minSizeFor, "min-size-for", nil, "Minimum file size below a path, as PATH=SIZE (repeatable, overrides --min-size)")
 	cmd.Flags().StringSliceVarP(&opts.excludes, "exclude", "e", nil, "Glob patterns to exclude")
-	cmd.Flags().IntVarP(&opts.workers, "workers", "w", opts.workers, "Number of parallel workers")
+	cmd.Flags().BoolVar(&opts.includeSnapshots, "include-snapshots", false, "Scan snapshot directories (.snapshot, .snapshots, .zfs/snapshot), skipped by default")
+	cmd.Flags().BoolVar(&opts.includeOverlayLayers, "include-overlay-layers", false, "Scan the merged views and layer directories of mounted overlayfs, skipped by default")
+	cmd.Flags().IntVarP(&opts.workers, "workers", "w", 0, "Number of parallel workers for scanning and hashing (0 = auto)")
+	cmd.Flags().IntVar(&opts.readdirBatch, "readdir-batch", scanner.DefaultReaddirBatch, "Directory entries listed at a time")
+	cmd.Flags().IntVar(&opts.scanWorkers, "scan-workers", 0, "Number of parallel directory readers (0 = --workers, else 4x CPU count)")
+	cmd.Flags().IntVar(&opts.hashWorkers, "hash-workers", 0, "Number of parallel hashing workers (0 = --workers, else 4 per device, at most CPU count)")
 	cmd.Flags().BoolVar(&opts.noProgress, "no-progress", false, "Disable progress output")
-	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "Show individual file operations")
+	cmd.Flags().StringVar(&opts.errorsFile, "errors-file", "", "Write every error to this file, one per line")
+	cmd.Flags().IntVar(&opts.maxErrors, "max-errors", 0, "Stop the run after this many errors (0 = unlimited)")
+	cmd.Flags().DurationVar(&opts.maxRuntime, "max-runtime", 0, "Stop cleanly after this long, e.g. 4h (0 = unlimited)")
+	cmd.Flags().Float64Var(&opts.maxOpsPerSec, "max-ops-per-sec", 0, "Replace at most this many files per second (0 = unlimited)")
+	cmd.Flags().IntVar(&opts.limit, "limit", 0, "Only deduplicate the N groups that free the most space (0 = all)")
+	cmd.Flags().BoolVar(&opts.hashLargestFirst, "hash-largest-first", false, "Hash the largest candidate files first instead of in path order")
+	cmd.Flags().CountVarP(&opts.verbose, "verbose", "v", "Show file operations; repeat for skip reasons and cache hits (-vv) and hash decisions (-vvv)")
 	cmd.Flags().BoolVarP(&opts.dryRun, "dry-run", "n", false, "Preview changes without executing")
+	cmd.Flags().StringVar(&opts.action, "action", "hardlink", "Replace duplicates with: hardlink, symlink (even on the same device), or auto (shared extents where supported, else hardlink)")
 	cmd.Flags().BoolVar(&opts.symlinkFallback, "symlink-fallback", false, "Fall back to symlinks when deduplicating files across device boundaries")
+	cmd.Flags().BoolVar(&opts.symlinkWithinRoots, "symlink-within-roots", false,
+		"With --symlink-fallback or --action symlink, refuse symlinks whose resolved source is outside the scanned paths")
+	cmd.Flags().BoolVar(&opts.balanceLinks, "balance-links", false,
+		"Keep existing hardlink groups and spread new links across them to even out link counts")
+	cmd.Flags().BoolVar(&opts.mergeSecurityXattrs, "merge-security-xattrs", false,
+		"Merge duplicates even if their security.capability or SELinux contexts differ")
 	cmd.Flags().BoolVar(&opts.trustDeviceBoundaries, "trust-device-boundaries", false,
 		"Assume devices have independent inode spaces. WARNING: Unsafe if the same filesystem is mounted at multiple paths (e.g., NFS)")
-	cmd.Flags().StringVar(&opts.cacheFile, "cache-file", "", "Path to hash cache file (enables caching)")
+	cmd.Flags().StringVar(&opts.cacheFile, "cache-file", opts.cacheFile, "Path to hash cache file")
+	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Disable the hash cache")
+	cmd.Flags().StringVar(&opts.cacheMaxSizeStr, "cache-max-size", opts.cacheMaxSizeStr, "Evict oldest cache entries above this size (e.g., 100M; 0 = unlimited)")
+	cmd.Flags().DurationVar(&opts.cacheMaxAge, "cache-max-age", 0, "Re-hash cache entries older than this (e.g., 720h; 0 = unlimited)")
+	cmd.Flags().StringVar(&opts.cacheKey, "cache-key", opts.cacheKey, "Cache key identity: path, or inode (survives renames within a filesystem)")
+	cmd.Flags().StringVar(&opts.journalDir, "journal-dir", opts.journalDir, "Directory of the intent log used to recover replacements interrupted by a crash (empty = disabled)")
+	cmd.Flags().BoolVar(&opts.fsync, "fsync", false, "Sync each target's directory after replacing it, so replacements survive a power loss (slower)")
+	cmd.Flags().StringVar(&opts.tmpSuffix, "tmp-suffix", ".dupedog.tmp", "Suffix of the temporary link renamed over each target; must contain \"dupedog\"")
+	cmd.Flags().StringVar(&opts.stagingDir, "staging-dir", "",
+		"Make temporary links in this directory, relative to the top of each target's filesystem, instead of next to the target")
+	cmd.Flags().DurationVar(&opts.orphanAge, "orphan-age", time.Minute, "Minimum age of a leftover temporary link before it is treated as orphaned and may be removed")
+	cmd.Flags().DurationVar(&opts.targetLockWait, "target-lock-wait", 0, "Wait up to this long for a target file locked by another program before skipping it, e.g. 5s (--wait-lock waits for other dupedog runs)")
+	cmd.Flags().BoolVar(&opts.incremental, "incremental", false,
+		"Skip listing directories unchanged since the last incremental run, reusing their recorded files")
+	cmd.Flags().StringVar(&opts.indexFile, "index-file", opts.indexFile, "Path to the directory index used by --incremental")
+	cmd.Flags().BoolVar(&opts.waitLock, "wait-lock", false, "Wait for other dupedog runs on the same paths to finish instead of failing (--target-lock-wait waits for files locked by other programs)")
+	cmd.Flags().BoolVar(&opts.noLock, "no-lock", false, "Do not lock the paths against concurrent dupedog runs")
+	cmd.Flags().StringVar(&opts.reportFile, "report", "", "Write report of duplicate groups to file (- for stdout)")
+	cmd.Flags().BoolVar(&opts.histogram, "histogram", false, "Print duplicate groups and savings by file size to stderr, to help choose --min-size")
+	cmd.Flags().StringVar(&opts.summaryFile, "summary-file", "", "Write a JSON summary of the run (timings, byte counts, errors) to file (- for stdout)")
+	cmd.Flags().StringVar(&opts.notifyURL, "notify-url", "", "POST the JSON run summary to this webhook when the run ends, also if it fails or is interrupted")
+	cmd.Flags().StringVar(&opts.notifySecretFile, "notify-secret-file", "", "Sign webhook requests with HMAC-SHA256 using the key in this file (X-Dupedog-Signature header)")
+	cmd.Flags().IntVar(&opts.notifyRetries, "notify-retries", opts.notifyRetries, "Retry failed webhook deliveries this many times, with exponential backoff")
+	cmd.Flags().StringVar(&opts.reportFormat, "report-format", opts.reportFormat, "Report format: json, fdupes (input for duperemove --fdupes), rmlint-json, treemap-json, or dot (savings by directory)")
+	cmd.Flags().BoolVar(&opts.reportExtensions, "report-extensions", false, "Break duplicate bytes down by file extension in the JSON report")
+	cmd.Flags().StringSliceVar(&opts.references, "reference", nil, "Read-only root scanned as preferred source; never modified (repeatable)")
+	cmd.Flags().StringSliceVar(&opts.prefer, "prefer", nil,
+		"Preferred source path glob, ranked after --reference and before path order; or tie-breaker: shortest-path, shallowest (repeatable)")
+	cmd.Flags().BoolVar(&opts.keepFirstListed, "keep-first-listed", false,
+		"Keep the copy under the earliest path argument (references first), ignoring link counts; groups without one are left alone")
+	cmd.Flags().StringSliceVar(&opts.avoid, "avoid", nil, "Path globs never kept as source, e.g. /tmp (repeatable)")
+	cmd.Flags().StringSliceVar(&opts.protect, "protect", nil, "Glob patterns for paths that may be sources but are never replaced (repeatable)")
+	cmd.Flags().StringVar(&opts.normalizePaths, "normalize-paths", "",
+		"Compare names in this Unicode form (nfc or nfd) for --exclude, --prefer, --avoid, --protect and --trust-metadata, for trees mirrored between macOS and Linux")
+	cmd.Flags().StringVar(&opts.ignoreHashFile, "ignore-hash-file", "", "File of content digests that must never be deduplicated")
+	cmd.Flags().StringVar(&opts.onlyHashFile, "only-hash-file", "", "File of content digests; only matching files are deduplicated")
+	cmd.Flags().StringVar(&opts.sampleVerifyStr, "sample-verify", opts.sampleVerifyStr,
+		"Compare files at least this large by random windows instead of in full (e.g., 10G; 0 = disabled). WARNING: not a full comparison")
+	cmd.Flags().IntVar(&opts.sampleWindows, "sample-windows", opts.sampleWindows, "Number of 1 MiB windows compared per file with --sample-verify")
+	cmd.Flags().BoolVar(&opts.trustMetadata, "trust-metadata", false,
+		"Treat files with equal size, mtime and name as duplicates without hashing. WARNING: content is never compared")
+	cmd.Flags().BoolVar(&opts.xattrMarkers, "xattr-markers", false,
+		"Record verified digests in a user.dupedog xattr and skip hashing files whose marker still matches")
+	cmd.Flags().StringVar(&opts.preHook, "pre-hook", "", "Shell command run before each replacement; non-zero exit skips the file")
+	cmd.Flags().StringVar(&opts.postHook, "post-hook", "", "Shell command run after each replacement")
+	cmd.Flags().BoolVar(&opts.print0, "print0", false, "Print replaced (non-kept) duplicate paths to stdout, NUL-separated, e.g. for xargs -0 with --dry-run")
+	cmd.Flags().StringVar(&opts.sshCommand, "ssh-command", opts.sshCommand, "Command and options used to reach remote paths, e.g. \"ssh -p 2222\"")
+	cmd.Flags().StringVar(&opts.remoteHelper, "remote-helper", "", "Path of dupedog on the hosts of remote paths (empty = copy this executable there for the run)")
+	cmd.Flags().StringSliceVar(&opts.explain, "explain", nil, "Report where a file fell out of the pipeline and why (repeatable)")
 
 	return cmd
 }
 
-// drainErrors consumes errors from a channel and writes them to stderr.
-// Clears progress bar line before printing to avoid visual collision.
-func drainErrors(errs <-chan error) {
-	for err := range errs {
-		fmt.Fprintf(os.Stderr, "\r\033[Kerror: %v\n", err)
-	}
-}
-
 // runDedupe executes the dedupe pipeline: scan → screen → verify → dedupe.
-func runDedupe(paths []string, opts *dedupeOptions) error {
+func runDedupe(paths []string, opts *dedupeOptions) (err error) {
+	if err := validateWorkers(opts.workers, opts.scanWorkers, opts.hashWorkers); err != nil {
+		return err
+	}
+	if err := validateTmpFlags(opts.tmpSuffix, opts.stagingDir, opts.orphanAge); err != nil {
+		return err
+	}
+	if opts.readdirBatch < 1 {
+		return fmt.Errorf("invalid --readdir-batch: must be at least 1")
+	}
+	if opts.maxOpsPerSec < 0 {
+		return fmt.Errorf("invalid --max-ops-per-sec: must not be negative")
+	}
+	if opts.targetLockWait < 0 {
+		return fmt.Errorf("invalid --target-lock-wait: must not be negative")
+	}
+	if opts.limit < 0 {
+		return fmt.Errorf("invalid --limit: must not be negative")
+	}
 	minSize, err := parseSize(opts.minSizeStr)
 	if err != nil {
 		return fmt.Errorf("invalid --min-size: %w", err)
 	}
+	minSizeFor, err := parseMinSizeFor(opts.minSizeFor)
+	if err != nil {
+		return fmt.Errorf("invalid --min-size-for: %w", err)
+	}
 
-	if err := validateGlobPatterns(opts.excludes); err != nil {
-		return fmt.Errorf("invalid --exclude: %w", err)
+	if err := validatePatternFlags(opts); err != nil {
+		return err
+	}
+	if opts.print0 && (opts.verbose > 0 || opts.reportFile == "-" || opts.summaryFile == "-" || len(opts.explain) > 0) {
+		return fmt.Errorf("--print0 cannot be combined with --verbose, --explain, --report - or --summary-file -")
+	}
+	if opts.summaryFile == "-" && opts.reportFile == "-" {
+		return fmt.Errorf("--summary-file - cannot be combined with --report -")
+	}
+
+	cacheMaxSize, cacheKeyMode, err := parseCacheFlags(opts)
+	if err != nil {
+		return err
+	}
+
+	reportFormat, err := report.ParseFormat(opts.reportFormat)
+	if err != nil {
+		return fmt.Errorf("invalid --report-format: %w", err)
+	}
+	if opts.reportExtensions && (opts.reportFile == "" || reportFormat != report.FormatJSON) {
+		return fmt.Errorf("invalid --report-extensions: requires --report in json format")
 	}
 
-	showProgress := !opts.noProgress
+	ignoreDigests, onlyDigests, err := loadDigestFilters(opts)
+	if err != nil {
+		return err
+	}
+
+	sampleAbove, err := parseSize(opts.sampleVerifyStr)
+	if err != nil {
+		return fmt.Errorf("invalid --sample-verify: %w", err)
+	}
+	if sampleAbove > 0 && opts.sampleWindows < 1 {
+		return fmt.Errorf("invalid --sample-windows: must be at least 1")
+	}
+	if opts.trustMetadata && (ignoreDigests != nil || onlyDigests != nil || sampleAbove > 0) {
+		return fmt.Errorf("--trust-metadata cannot be combined with --ignore-hash-file, --only-hash-file or --sample-verify")
+	}
+
+	prefer, priority, err := parsePrefer(opts.prefer)
+	if err != nil {
+		return fmt.Errorf("invalid --prefer: %w", err)
+	}
+	action, err := deduper.ParseAction(opts.action)
+	if err != nil {
+		return fmt.Errorf("invalid --action: %w", err)
+	}
+	if action == deduper.ActionSymlink && opts.balanceLinks {
+		return fmt.Errorf("invalid --action: symlink conflicts with --balance-links")
+	}
+	if opts.symlinkWithinRoots && !opts.symlinkFallback && action != deduper.ActionSymlink {
+		return fmt.Errorf("invalid --symlink-within-roots: requires --symlink-fallback or --action symlink")
+	}
+	if opts.keepFirstListed && len(opts.prefer) > 0 {
+		return fmt.Errorf("invalid --keep-first-listed: conflicts with --prefer")
+	}
+	avoid, err := absGlobs(opts.avoid)
+	if err != nil {
+		return fmt.Errorf("invalid --avoid: %w", err)
+	}
+	protect, err := protectGlobs(opts.protect)
+	if err != nil {
+		return fmt.Errorf("invalid --protect: %w", err)
+	}
+	normalize, err := pathnorm.Parse(opts.normalizePaths)
+	if err != nil {
+		return fmt.Errorf("invalid --normalize-paths: %w", err)
+	}
+
+	references, err := absRoots(opts.references)
+	if err != nil {
+		return fmt.Errorf("invalid --reference: %w", err)
+	}
+	paths, remoteRoots := splitRemoteRoots(paths)
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one local path is required")
+	}
+	sshCmd := strings.Fields(opts.sshCommand)
+	if len(remoteRoots) > 0 && len(sshCmd) == 0 {
+		return fmt.Errorf("invalid --ssh-command: must not be empty")
+	}
+	absPaths, err := absRoots(paths)
+	if err != nil {
+		return err
+	}
+	// References are scanned first and preferred as sources
+	roots := append(append([]string(nil), references...), absPaths...)
+
+	explain, err := absRoots(opts.explain)
+	if err != nil {
+		return fmt.Errorf("invalid --explain: %w", err)
+	}
+
+	notify, err := newNotifier(opts.notifyURL, opts.notifySecretFile, opts.notifyRetries)
+	if err != nil {
+		return err
+	}
+
+	var index *scanner.Index
+	if opts.incremental {
+		if index, err = loadIndex(opts.indexFile); err != nil {
+			return err
+		}
+	}
 
-	// Create shared error channel
-	errors := make(chan error, 100)
-	go drainErrors(errors)
-	defer close(errors)
+	reporter := progress.Terminal(!opts.noProgress)
+	summary := newRunSummary(opts.dryRun)
+
+	// Create shared error channel (closed before the summary is written)
+	errLog := newErrorLog(opts.errorsFile, opts.maxErrors, opts.maxRuntime)
+	if opts.summaryFile != "" || notify != nil {
+		defer func() {
+			summary.finish(errLog, err)
+			if opts.summaryFile != "" {
+				err = cmp.Or(err, summary.write(opts.summaryFile))
+			}
+			if notify != nil {
+				err = cmp.Or(err, notify.send(summary))
+			}
+		}()
+	}
+	if opts.verbose > 0 {
+		defer summary.printPhases(os.Stderr)
+	}
+	defer func() { err = cmp.Or(err, errLog.close()) }()
+	errors := errLog.ch
+
+	// Scan results go stale if another run replaces files meanwhile
+	lock, err := lockRoots(errLog.ctx, absPaths, opts.waitLock, opts.noLock, opts.dryRun)
+	if err != nil {
+		return cmp.Or(errLog.abortErr(), err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	// Warn if the same trees were last deduplicated with another policy
+	policy, stateDir := dedupePolicy(opts), defaultStateDir()
+	checkRootStates(os.Stderr, stateDir, absPaths, policy, opts.verbose > 0)
 
 	// Phase 1: Scan filesystem
-	files := scanner.New(paths, minSize, opts.excludes, opts.workers, showProgress, errors).Run()
+	// Directories shown twice through bind mounts are scanned once
+	roots, viewExcludes := bindMountViews(roots, mounts.Entries(), os.Stderr)
+	excludes := append(scanExcludes(opts.excludes, roots, opts.includeSnapshots, opts.includeOverlayLayers), viewExcludes...)
+	if opts.stagingDir != "" {
+		// Temporary links left in staging directories are not duplicates to link
+		excludes = append(excludes, escapeGlob(filepath.Clean(opts.stagingDir)))
+	}
+	scan := scanner.New(roots, scanner.Options{
+		MinSize:      minSize,
+		MinSizeFor:   minSizeFor,
+		Excludes:     excludes,
+		Normalize:    normalize,
+		Workers:      scanWorkers(opts.scanWorkers, opts.workers),
+		ReaddirBatch: opts.readdirBatch,
+		Reporter:     reporter,
+		Index:        index,
+	}, errors)
+	trace := &pipelineTrace{scan: scan, trustMetadata: opts.trustMetadata}
+	if len(explain) > 0 {
+		defer trace.print(os.Stdout, explain)
+	}
+	files := scan.RunContext(errLog.ctx)
+	if index != nil && errLog.ctx.Err() == nil {
+		saveIndex(index, opts.indexFile)
+	}
+	trace.files = files
+	summary.scanned(scan.Stats())
+	summary.phase("scan", summary.Files.Scanned, summary.Bytes.Scanned)
+
+	// Content of local files also found on other hosts (reported only)
+	var remoteGroups []report.RemoteGroup
+	if len(remoteRoots) > 0 && len(files) > 0 {
+		// Overlay mounts are local, so remote hosts get only the pattern excludes
+		remoteExcludes := scanExcludes(opts.excludes, nil, opts.includeSnapshots, opts.includeOverlayLayers)
+		matcher := &remoteMatcher{
+			sshCmd:   sshCmd,
+			helper:   opts.remoteHelper,
+			scan:     remote.ScanRequest{MinSize: minSize, Excludes: remoteExcludes, Normalize: normalize, Workers: opts.scanWorkers},
+			workers:  cmp.Or(opts.hashWorkers, opts.workers, runtime.NumCPU()),
+			reporter: reporter,
+			errCh:    errors,
+		}
+		hashCache, err := openCache(opts, roots, cacheMaxSize, cacheKeyMode)
+		if err != nil {
+			return err
+		}
+		remoteGroups, err = matcher.match(errLog.ctx, remoteRoots, files, hashCache)
+		_ = hashCache.Close()
+		if err != nil {
+			return cmp.Or(errLog.abortErr(), err)
+		}
+		printRemoteGroups(os.Stderr, remoteGroups)
+	}
 
 	if len(files) == 0 {
-		return nil
+		return writeReport(opts.reportFile, reportFormat, types.DuplicateGroups{}, nil, opts.dryRun, opts.reportExtensions, remoteGroups)
 	}
 
 	// Phase 2: Screen for duplicate candidates
-	candidates := screener.New(files, showProgress, opts.trustDeviceBoundaries).Run()
+	candidates := screener.New(files, screener.Options{TrustDeviceBoundaries: opts.trustDeviceBoundaries, Reporter: reporter}).Run()
+	trace.candidates = candidates
+	summary.screened(candidates)
+	summary.phase("screen", summary.Files.Candidates, summary.Bytes.Candidates)
 	if candidates.Len() == 0 {
-		return nil
+		return writeReport(opts.reportFile, reportFormat, types.DuplicateGroups{}, nil, opts.dryRun, opts.reportExtensions, remoteGroups)
 	}
 
-	// Phase 3: Open cache (if enabled) and verify duplicates
-	hashCache, err := cache.Open(opts.cacheFile)
+	// Phase 3: Verify duplicates (or trust size + mtime + name with --trust-metadata)
+	var duplicates types.DuplicateGroups
+	if opts.trustMetadata {
+		duplicates = screener.MatchMetadata(candidates, normalize)
+	} else {
+		hashCache, err := openCache(opts, roots, cacheMaxSize, cacheKeyMode)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = hashCache.Close() }()
+
+		toVerify := candidates
+		var markers *marker.Resolution
+		if opts.xattrMarkers {
+			markers = marker.Resolve(candidates)
+			toVerify = markers.Verify
+		}
+		verify := verifier.New(toVerify, verifier.Options{
+			Workers:      hashWorkers(opts.hashWorkers, opts.workers, toVerify),
+			Cache:        hashCache,
+			Ignore:       ignoreDigests,
+			Only:         onlyDigests,
+			SampleAbove:  sampleAbove,
+			SampleCount:  opts.sampleWindows,
+			LargestFirst: opts.hashLargestFirst,
+			Verbosity:    opts.verbose,
+			Reporter:     reporter,
+		}, errors)
+		duplicates = verify.RunContext(errLog.ctx)
+		summary.verified(verify.Stats())
+		if markers != nil {
+			duplicates = eligibleGroups(errLog.ctx, markers.Complete(duplicates), ignoreDigests, onlyDigests, errors)
+			writeMarkers(duplicates, references, opts.dryRun, errors)
+		}
+	}
+	trace.duplicates = duplicates
+	summary.confirmed(duplicates)
+	if opts.histogram {
+		printHistogram(os.Stderr, duplicates)
+	}
+	summary.phase("verify", summary.Files.Duplicates, summary.Bytes.Verified)
+
+	// Phase 4: Execute deduplication (references, --prefer globs, then path order define
+	// source priority; references are read-only)
+	priority = append(append(append([]string(nil), references...), priority...), absPaths...)
+	var listed []string
+	if opts.keepFirstListed {
+		listed = append(append([]string(nil), references...), absPaths...)
+	}
+	var symlinkRoots []string
+	if opts.symlinkWithinRoots {
+		symlinkRoots = roots
+	}
+	toDedupe := duplicates
+	if !opts.mergeSecurityXattrs {
+		toDedupe = deduper.SplitBySecurity(duplicates, errors)
+	}
+	toDedupe = deduper.Largest(toDedupe, opts.limit)
+	intents, err := openJournal(opts.journalDir, opts.journalDirSet, opts.dryRun)
 	if err != nil {
-		return fmt.Errorf("open cache: %w", err)
+		return err
+	}
+	defer func() { err = cmp.Or(err, intents.Close()) }()
+	results := deduper.New(toDedupe, deduper.Options{
+		PathPriority:    priority,
+		Avoid:           avoid,
+		Prefer:          prefer,
+		KeepFirstListed: listed,
+		ReadOnly:        references,
+		Protect:         protect,
+		Normalize:       normalize,
+		PreHook:         opts.preHook,
+		PostHook:        opts.postHook,
+		Journal:         intents,
+		Fsync:           opts.fsync,
+		TmpSuffix:       opts.tmpSuffix,
+		StagingDir:      opts.stagingDir,
+		OrphanAge:       opts.orphanAge,
+		LockWait:        opts.targetLockWait,
+		MaxOpsPerSec:    opts.maxOpsPerSec,
+		DryRun:          opts.dryRun,
+		Action:          action,
+		SymlinkFallback: opts.symlinkFallback,
+		SymlinkRoots:    symlinkRoots,
+		BalanceLinks:    opts.balanceLinks,
+		Verbosity:       opts.verbose,
+		Reporter:        reporter,
+	}, errors).RunContext(errLog.ctx)
+	trace.results = results
+	summary.deduped(results)
+	summary.phase("dedupe", summary.Files.Replaced, summary.Bytes.Saved)
+	if !opts.dryRun {
+		saveRootStates(os.Stderr, stateDir, absPaths, policy, results)
+	}
+	if opts.print0 {
+		printPaths0(os.Stdout, results)
+	}
+
+	// Phase 5: Write report (if requested)
+	return writeReport(opts.reportFile, reportFormat, duplicates, results, opts.dryRun, opts.reportExtensions, remoteGroups)
+}
+
+// eligibleGroups drops groups filtered by --ignore-hash-file / --only-hash-file,
+// for groups confirmed by xattr markers rather than the verifier. Files that
+// cannot be read for the check are reported to errCh and their groups dropped.
+func eligibleGroups(ctx context.Context, groups types.DuplicateGroups, ignore, only verifier.DigestSet, errCh chan *types.Event) types.DuplicateGroups {
+	var eligible []types.DuplicateGroup
+	for _, group := range groups.Items() {
+		rep := group.First().First()
+		ok, err := verifier.ContentEligible(ctx, rep, rep.Digest, ignore, only)
+		if err != nil {
+			errCh <- types.NewEvent(types.StageVerify, rep.Path, err)
+		}
+		if ok {
+			eligible = append(eligible, group)
+		}
+	}
+	return types.NewDuplicateGroups(eligible)
+}
+
+// writeMarkers records the digests of confirmed groups in xattr markers
+// (--xattr-markers). Dry runs and references are never modified, not even
+// their xattrs.
+func writeMarkers(groups types.DuplicateGroups, references []string, dryRun bool, errCh chan *types.Event) {
+	if dryRun {
+		return
 	}
-	defer func() { _ = hashCache.Close() }()
+	marker.WriteGroups(groups, func(path string) bool { return underAny(path, references) }, errCh)
+}
 
-	duplicates := verifier.New(candidates, opts.workers, showProgress, errors, hashCache).Run()
+// validatePatternFlags validates --exclude and --protect glob patterns.
+func validatePatternFlags(opts *dedupeOptions) error {
+	if err := validateGlobPatterns(opts.excludes); err != nil {
+		return fmt.Errorf("invalid --exclude: %w", err)
+	}
+	if err := validateGlobPatterns(opts.protect); err != nil {
+		return fmt.Errorf("invalid --protect: %w", err)
+	}
+	return nil
+}
 
-	// Phase 4: Execute deduplication (paths define source priority)
-	deduper.New(duplicates, paths, opts.dryRun, opts.symlinkFallback, opts.verbose, showProgress, errors).Run()
+// parseCacheFlags parses --cache-max-size and --cache-key.
+func parseCacheFlags(opts *dedupeOptions) (maxSize int64, keyMode cache.KeyMode, err error) {
+	if maxSize, err = parseSize(opts.cacheMaxSizeStr); err != nil {
+		return 0, 0, fmt.Errorf("invalid --cache-max-size: %w", err)
+	}
+	if keyMode, err = cache.ParseKeyMode(opts.cacheKey); err != nil {
+		return 0, 0, fmt.Errorf("invalid --cache-key: %w", err)
+	}
+	return maxSize, keyMode, nil
+}
 
+// openCache opens the hash cache selected by --cache-file / --no-cache.
+// Failing to open the default cache is not fatal: the run continues uncached.
+// Self-cleaning is scoped to the scan roots so runs on other trees keep their entries.
+func openCache(opts *dedupeOptions, roots []string, maxSize int64, keyMode cache.KeyMode) (*cache.Cache, error) {
+	path := opts.cacheFile
+	if opts.noCache {
+		path = ""
+	}
+
+	hashCache, err := cache.Open(path, maxSize, opts.cacheMaxAge, keyMode, roots)
+	if err == nil {
+		return hashCache, nil
+	}
+	if opts.cacheFileSet {
+		return nil, fmt.Errorf("open cache: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "warning: default cache disabled: %v\n", err)
+	return cache.Open("", 0, 0, keyMode, nil)
+}
+
+// loadDigestFilters loads the --ignore-hash-file and --only-hash-file sets.
+// An unset flag yields a nil set (no filtering).
+func loadDigestFilters(opts *dedupeOptions) (ignore, only verifier.DigestSet, err error) {
+	if opts.ignoreHashFile != "" {
+		if ignore, err = verifier.LoadDigestSet(opts.ignoreHashFile); err != nil {
+			return nil, nil, fmt.Errorf("invalid --ignore-hash-file: %w", err)
+		}
+	}
+	if opts.onlyHashFile != "" {
+		if only, err = verifier.LoadDigestSet(opts.onlyHashFile); err != nil {
+			return nil, nil, fmt.Errorf("invalid --only-hash-file: %w", err)
+		}
+	}
+	return ignore, only, nil
+}
+
+// printPaths0 writes the target of every replacement (or, in a dry run, every
+// planned replacement) to w, each followed by a NUL byte.
+func printPaths0(w io.Writer, results []*deduper.DedupeResult) {
+	for _, r := range results {
+		if r.Action.Replaced() {
+			_, _ = fmt.Fprintf(w, "%s\x00", r.Target)
+		}
+	}
+}
+
+// writeReport writes the report for duplicates and deduper results if a report
+// path was given, with the breakdown by extension if extensions is set and
+// the content also found under remote roots.
+func writeReport(path string, format report.Format, duplicates types.DuplicateGroups,
+	results []*deduper.DedupeResult, dryRun, extensions bool, remoteGroups []report.RemoteGroup,
+) error {
+	if path == "" {
+		return nil
+	}
+	r := report.New(duplicates)
+	r.DryRun = dryRun
+	r.AddActions(results)
+	r.Remote = remoteGroups
+	if extensions {
+		r.AddExtensions()
+	}
+	if err := r.WriteFile(path, format); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
 	return nil
 }
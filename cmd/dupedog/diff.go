@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ivoronin/dupedog/internal/report"
+	"github.com/spf13/cobra"
+)
+
+// newDiffCmd creates the diff subcommand.
+func newDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "Compare duplicate groups between two reports",
+		Long: `Compares two JSON reports (written with --report) and prints duplicate groups
+that appeared (+), disappeared (-), or changed membership (~) between the runs.
+
+Groups are matched by content (size and digest); membership is compared by path.
+Groups without a digest (--trust-metadata) are matched by their full set of paths.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runDiff(args[0], args[1], os.Stdout)
+		},
+	}
+
+	return cmd
+}
+
+// runDiff reads both reports and prints their differences to w.
+func runDiff(oldPath, newPath string, w io.Writer) error {
+	oldReport, err := report.Read(oldPath)
+	if err != nil {
+		return fmt.Errorf("read report: %w", err)
+	}
+	newReport, err := report.Read(newPath)
+	if err != nil {
+		return fmt.Errorf("read report: %w", err)
+	}
+
+	for _, change := range report.Diff(oldReport, newReport) {
+		_, _ = fmt.Fprint(w, change)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ivoronin/dupedog/internal/doctor"
+	"github.com/spf13/cobra"
+)
+
+// newDoctorCmd creates the doctor subcommand.
+func newDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor [paths...]",
+		Short: "Show what the filesystems under paths support",
+		Long: `Probes the filesystem under each path with scratch files in a temporary
+directory (removed afterwards) and prints a capability matrix: filesystem type,
+hardlink and reflink (FICLONE) support, link count limit, case sensitivity, and
+whether flock excludes other processes. Use it to choose between hardlinks,
+--symlink-fallback and --action symlink before a run:
+  dupedog doctor /volume1 /volume2`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true // Probe failures are not usage errors
+			return runDoctor(args, os.Stdout)
+		},
+	}
+
+	return cmd
+}
+
+// runDoctor probes paths and prints the matrix to w.
+func runDoctor(paths []string, w io.Writer) error {
+	roots, err := absRoots(paths)
+	if err != nil {
+		return err
+	}
+	results := make([]doctor.Result, len(roots))
+	for i, root := range roots {
+		results[i] = doctor.Probe(root)
+	}
+	if failed := printDoctor(w, results); failed > 0 {
+		return fmt.Errorf("%d paths could not be probed", failed)
+	}
+	return nil
+}
+
+// printDoctor writes the capability matrix to w, followed by why each
+// missing capability is missing, and returns how many paths failed.
+func printDoctor(w io.Writer, results []doctor.Result) (failed int) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PATH\tFSTYPE\tHARDLINK\tREFLINK\tMAX LINKS\tCASE-SENSITIVE\tFLOCK")
+	for _, r := range results {
+		if r.Err != nil {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\t-\t-\n", r.Path, orUnknown(r.FSType))
+			continue
+		}
+		maxLinks := "?"
+		if r.MaxLinks > 0 {
+			maxLinks = strconv.FormatInt(r.MaxLinks, 10)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Path, orUnknown(r.FSType), r.Hardlink, r.Reflink, maxLinks, r.CaseSensitive, r.Flock)
+	}
+	_ = tw.Flush()
+
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			_, _ = fmt.Fprintf(w, "%s: cannot probe: %v\n", r.Path, r.Err)
+			continue
+		}
+		for _, c := range []struct {
+			name  string
+			check doctor.Check
+		}{{"hardlink", r.Hardlink}, {"reflink", r.Reflink}, {"case-sensitive", r.CaseSensitive}, {"flock", r.Flock}} {
+			if !c.check.OK && c.check.Err != nil {
+				_, _ = fmt.Fprintf(w, "%s: %s: %v\n", r.Path, c.name, c.check.Err)
+			}
+		}
+	}
+	return failed
+}
+
+// orUnknown returns s, or "?" if it is empty.
+func orUnknown(s string) string {
+	if s == "" {
+		return "?"
+	}
+	return s
+}
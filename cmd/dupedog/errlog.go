@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/color"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// maxSummaryLines caps the categories printed in the end-of-run summary.
+const maxSummaryLines = 20
+
+// errorLog drains the pipeline's event channel: each error is printed as it
+// arrives and kept for a categorized summary (and --errors-file) at the end.
+// Once maxErrors errors have arrived, or maxRuntime has passed, ctx is
+// canceled so the stages stop; SIGINT and SIGTERM cancel it too. SIGUSR1 and SIGUSR2 pause and resume the
+// stages' I/O through ctx (see withPauseSignals).
+type errorLog struct {
+	ch         chan *types.Event
+	done       chan struct{}
+	errs       []*types.Event
+	file       string        // --errors-file path ("" = none)
+	maxErrors  int           // --max-errors (0 = unlimited)
+	maxRuntime time.Duration // --max-runtime (0 = unlimited)
+
+	ctx         context.Context // Passed to the stages' RunContext
+	cancel      context.CancelFunc
+	stopSignals func()             // Stops listening for pause signals
+	stopNotify  context.CancelFunc // Stops listening for SIGINT and SIGTERM
+	stopWatch   func() bool        // Stops waiting for them, false if one arrived
+	timer       *time.Timer        // Fires at maxRuntime (nil = unlimited)
+	aborted     atomic.Bool
+	timedOut    atomic.Bool
+	interrupted atomic.Bool
+}
+
+// errTimeLimit is returned when --max-runtime stopped the run. It exits with
+// its own status so schedulers can tell a clean stop from a failure.
+var errTimeLimit = errors.New("time limit reached (--max-runtime)")
+
+// newErrorLog starts draining a new error channel.
+func newErrorLog(file string, maxErrors int, maxRuntime time.Duration) *errorLog {
+	l := &errorLog{ch: make(chan *types.Event, 100), done: make(chan struct{}), file: file, maxErrors: maxErrors, maxRuntime: maxRuntime}
+	interrupt, stopNotify := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(interrupt)
+	l.ctx, l.stopSignals = withPauseSignals(ctx)
+	l.cancel, l.stopNotify = cancel, stopNotify
+	l.stopWatch = context.AfterFunc(interrupt, func() {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s interrupted, finishing in-flight work and stopping\n", color.Stderr.Yellow("warning:"))
+		l.interrupted.Store(true)
+	})
+	if maxRuntime > 0 {
+		l.timer = time.AfterFunc(maxRuntime, func() {
+			fmt.Fprintf(os.Stderr, "\r\033[K%s %v elapsed, finishing in-flight work and stopping (--max-runtime)\n", color.Stderr.Yellow("warning:"), maxRuntime)
+			l.timedOut.Store(true)
+			l.cancel()
+		})
+	}
+	go l.drain()
+	return l
+}
+
+// abortErr returns an error if the run was aborted by --max-errors or a
+// signal, or stopped by --max-runtime.
+func (l *errorLog) abortErr() error {
+	switch {
+	case l.aborted.Load():
+		return fmt.Errorf("aborted after %d errors (--max-errors)", l.maxErrors)
+	case l.timedOut.Load():
+		return fmt.Errorf("stopped after %v: %w", l.maxRuntime, errTimeLimit)
+	case l.interrupted.Load():
+		return errors.New("aborted by SIGINT or SIGTERM")
+	default:
+		return nil
+	}
+}
+
+// drain writes each error to stderr, clearing the progress bar line first to
+// avoid visual collision.
+func (l *errorLog) drain() {
+	defer close(l.done)
+	for err := range l.ch {
+		label := color.Stderr.Red("error:")
+		if err.Stage == types.StageDedupe {
+			label = color.Stderr.Yellow("error:") // The target was skipped, nothing failed
+		}
+		fmt.Fprintf(os.Stderr, "\r\033[K%s %v\n", label, err)
+		l.errs = append(l.errs, err)
+		if l.maxErrors > 0 && len(l.errs) == l.maxErrors {
+			fmt.Fprintf(os.Stderr, "\r\033[K%s %d errors, stopping (--max-errors)\n", color.Stderr.Red("error:"), len(l.errs))
+			l.aborted.Store(true)
+			l.cancel()
+		}
+	}
+}
+
+// close stops draining, prints the summary to stderr and writes --errors-file.
+// Call it once, after every stage sending to ch has returned. Returns an error
+// if the run was aborted by --max-errors or a signal.
+func (l *errorLog) close() error {
+	close(l.ch)
+	<-l.done
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.stopSignals()
+	l.cancel()
+	if !l.stopWatch() {
+		l.interrupted.Store(true) // The watcher may still be running
+	}
+	l.stopNotify()
+	printErrorSummary(os.Stderr, l.errs)
+	if l.file != "" {
+		if err := writeErrorsFile(l.file, l.errs); err != nil {
+			fmt.Fprintf(os.Stderr, "error: write --errors-file: %v\n", err)
+		}
+	}
+	return l.abortErr()
+}
+
+// errorCategory counts errors with the same reason in the same directory.
+type errorCategory struct {
+	reason string
+	dir    string
+	count  int
+}
+
+// reasonLabels describes skip reasons in the summary.
+var reasonLabels = map[types.Reason]string{
+	types.ReasonPermission:   "permission denied",
+	types.ReasonNotFound:     "not found",
+	types.ReasonIO:           "I/O error",
+	types.ReasonLocked:       "locked by another process",
+	types.ReasonModified:     "modified since scan",
+	types.ReasonCrossDevice:  "cross-device link",
+	types.ReasonTooManyLinks: "too many links",
+	types.ReasonProtected:    "protected path",
+	types.ReasonHook:         "hook failed",
+	types.ReasonReadOnly:     "read-only filesystem",
+	types.ReasonImmutable:    "immutable or append-only",
+}
+
+// summarizeErrors groups errors by (reason, directory), most frequent first.
+// Unclassified errors are told apart by their innermost message.
+func summarizeErrors(errs []*types.Event) []errorCategory {
+	index := make(map[[2]string]int)
+	var categories []errorCategory
+	for _, e := range errs {
+		label, ok := reasonLabels[e.Reason]
+		if !ok {
+			label = innermostMessage(e.Err)
+		}
+		dir := ""
+		if e.Path != "" {
+			dir = filepath.Dir(e.Path)
+		}
+		key := [2]string{label, dir}
+		i, ok := index[key]
+		if !ok {
+			i = len(categories)
+			index[key] = i
+			categories = append(categories, errorCategory{reason: key[0], dir: key[1]})
+		}
+		categories[i].count++
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		a, b := categories[i], categories[j]
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		if a.reason != b.reason {
+			return a.reason < b.reason
+		}
+		return a.dir < b.dir
+	})
+	return categories
+}
+
+// innermostMessage returns the innermost error's message, e.g.
+// "database not open" for "cache store: database not open".
+func innermostMessage(err error) string {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err.Error()
+		}
+		err = inner
+	}
+}
+
+// printErrorSummary writes the categorized error counts, if any, to w.
+func printErrorSummary(w io.Writer, errs []*types.Event) {
+	if len(errs) == 0 {
+		return
+	}
+	categories := summarizeErrors(errs)
+	_, _ = fmt.Fprintf(w, "%d errors:\n", len(errs))
+	for i, c := range categories {
+		if i == maxSummaryLines {
+			_, _ = fmt.Fprintf(w, "  ... and %d more categories (use --errors-file for the full list)\n", len(categories)-i)
+			break
+		}
+		if c.dir == "" {
+			_, _ = fmt.Fprintf(w, "  %d %s\n", c.count, c.reason)
+		} else {
+			_, _ = fmt.Fprintf(w, "  %d %s under %s\n", c.count, c.reason, c.dir)
+		}
+	}
+}
+
+// writeErrorsFile writes every error to path, one per line as tab-separated
+// stage, reason code and message.
+func writeErrorsFile(path string, errs []*types.Event) error {
+	var b strings.Builder
+	for _, e := range errs {
+		_, _ = fmt.Fprintf(&b, "%s\t%s\t%s\n", e.Stage, e.Reason, strings.ReplaceAll(e.Error(), "\n", `\n`))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644) //nolint:gosec // not secret
+}
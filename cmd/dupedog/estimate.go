@@ -0,0 +1,179 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/ivoronin/dupedog/internal/estimate"
+	"github.com/ivoronin/dupedog/internal/mounts"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/screener"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// estimateOptions holds CLI flags for the estimate command.
+type estimateOptions struct {
+	minSizeStr            string
+	minSizeFor            []string
+	excludes              []string
+	includeSnapshots      bool
+	includeOverlayLayers  bool
+	workers               int
+	scanWorkers           int
+	readdirBatch          int
+	hashWorkers           int
+	noProgress            bool
+	errorsFile            string
+	maxErrors             int
+	maxRuntime            time.Duration
+	trustDeviceBoundaries bool
+	cacheFile             string
+	cacheFileSet          bool
+	noCache               bool
+	sample                int
+	confidence            float64
+}
+
+// newEstimateCmd creates the estimate subcommand.
+func newEstimateCmd() *cobra.Command {
+	opts := &estimateOptions{
+		minSizeStr: "1",
+		cacheFile:  defaultCacheFile(),
+		confidence: 0.95,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "estimate [paths...]",
+		Short: "Estimate deduplication savings without a full run",
+		Long: `Scans and screens for duplicate candidates, then verifies only a random sample
+of candidate groups and extrapolates the savings of a full dedupe run.
+
+Without --sample, only screening is done and the upper bound is reported.
+Nothing is modified:
+  dupedog estimate --sample 200 /data`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.cacheFileSet = cmd.Flags().Changed("cache-file")
+			return runEstimate(args, opts, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.minSizeStr, "min-size", "m", opts.minSizeStr, "Minimum file size (e.g., 100, 1K, 10M, 1G)")
+	cmd.Flags().StringSliceVar(&opts.minSizeFor, "min-size-for", nil, "Minimum file size below a path, as PATH=SIZE (repeatable, overrides --min-size)")
+	cmd.Flags().StringSliceVarP(&opts.excludes, "exclude", "e", nil, "Glob patterns to exclude")
+	cmd.Flags().BoolVar(&opts.includeSnapshots, "include-snapshots", false, "Scan snapshot directories (.snapshot, .snapshots, .zfs/snapshot), skipped by default")
+	cmd.Flags().BoolVar(&opts.includeOverlayLayers, "include-overlay-layers", false, "Scan the merged views and layer directories of mounted overlayfs, skipped by default")
+	cmd.Flags().IntVarP(&opts.workers, "workers", "w", 0, "Number of parallel workers for scanning and hashing (0 = auto)")
+	cmd.Flags().IntVar(&opts.readdirBatch, "readdir-batch", scanner.DefaultReaddirBatch, "Directory entries listed at a time")
+	cmd.Flags().IntVar(&opts.scanWorkers, "scan-workers", 0, "Number of parallel directory readers (0 = --workers, else 4x CPU count)")
+	cmd.Flags().IntVar(&opts.hashWorkers, "hash-workers", 0, "Number of parallel hashing workers (0 = --workers, else 4 per device, at most CPU count)")
+	cmd.Flags().BoolVar(&opts.noProgress, "no-progress", false, "Disable progress output")
+	cmd.Flags().StringVar(&opts.errorsFile, "errors-file", "", "Write every error to this file, one per line")
+	cmd.Flags().IntVar(&opts.maxErrors, "max-errors", 0, "Stop the run after this many errors (0 = unlimited)")
+	cmd.Flags().DurationVar(&opts.maxRuntime, "max-runtime", 0, "Stop cleanly after this long, e.g. 4h (0 = unlimited)")
+	cmd.Flags().BoolVar(&opts.trustDeviceBoundaries, "trust-device-boundaries", false,
+		"Assume devices have independent inode spaces. WARNING: Unsafe if the same filesystem is mounted at multiple paths (e.g., NFS)")
+	cmd.Flags().StringVar(&opts.cacheFile, "cache-file", opts.cacheFile, "Path to hash cache file")
+	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Disable the hash cache")
+	cmd.Flags().IntVar(&opts.sample, "sample", 0, "Number of candidate groups to verify (0 = screening only)")
+	cmd.Flags().Float64Var(&opts.confidence, "confidence", opts.confidence, "Confidence level of the estimated range (e.g., 0.9, 0.99)")
+
+	return cmd
+}
+
+// runEstimate executes the pipeline: scan → screen → verify sample → extrapolate.
+func runEstimate(paths []string, opts *estimateOptions, w io.Writer) (err error) {
+	if err := validateWorkers(opts.workers, opts.scanWorkers, opts.hashWorkers); err != nil {
+		return err
+	}
+	if opts.readdirBatch < 1 {
+		return fmt.Errorf("invalid --readdir-batch: must be at least 1")
+	}
+	minSize, err := parseSize(opts.minSizeStr)
+	if err != nil {
+		return fmt.Errorf("invalid --min-size: %w", err)
+	}
+	minSizeFor, err := parseMinSizeFor(opts.minSizeFor)
+	if err != nil {
+		return fmt.Errorf("invalid --min-size-for: %w", err)
+	}
+	if err := validateGlobPatterns(opts.excludes); err != nil {
+		return fmt.Errorf("invalid --exclude: %w", err)
+	}
+	if opts.sample < 0 {
+		return fmt.Errorf("invalid --sample: must not be negative")
+	}
+	if opts.confidence <= 0 || opts.confidence >= 1 {
+		return fmt.Errorf("invalid --confidence: must be between 0 and 1")
+	}
+
+	roots, err := absRoots(paths)
+	if err != nil {
+		return err
+	}
+
+	reporter := progress.Terminal(!opts.noProgress)
+	errLog := newErrorLog(opts.errorsFile, opts.maxErrors, opts.maxRuntime)
+	defer func() { err = cmp.Or(err, errLog.close()) }()
+	errors := errLog.ch
+
+	// Directories shown twice through bind mounts are scanned once
+	roots, viewExcludes := bindMountViews(roots, mounts.Entries(), os.Stderr)
+	files := scanner.New(roots, scanner.Options{
+		MinSize:      minSize,
+		MinSizeFor:   minSizeFor,
+		Excludes:     append(scanExcludes(opts.excludes, roots, opts.includeSnapshots, opts.includeOverlayLayers), viewExcludes...),
+		Workers:      scanWorkers(opts.scanWorkers, opts.workers),
+		ReaddirBatch: opts.readdirBatch,
+		Reporter:     reporter,
+	}, errors).RunContext(errLog.ctx)
+	candidates := screener.New(files, screener.Options{TrustDeviceBoundaries: opts.trustDeviceBoundaries, Reporter: reporter}).Run()
+
+	sample := types.NewCandidateGroups(nil)
+	duplicates := types.NewDuplicateGroups(nil)
+	if opts.sample > 0 && candidates.Len() > 0 {
+		hashCache, err := openCache(&dedupeOptions{cacheFile: opts.cacheFile, cacheFileSet: opts.cacheFileSet, noCache: opts.noCache},
+			roots, 0, cache.KeyPath)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = hashCache.Close() }()
+
+		sample = estimate.Sample(candidates, opts.sample, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))) //nolint:gosec // sampling, not security
+		duplicates = verifier.New(sample, verifier.Options{
+			Workers:  hashWorkers(opts.hashWorkers, opts.workers, sample),
+			Cache:    hashCache,
+			Reporter: reporter,
+		}, errors).RunContext(errLog.ctx)
+	}
+
+	if err := errLog.abortErr(); err != nil {
+		return err // Partial results would skew the estimate
+	}
+	printEstimate(w, estimate.New(candidates, sample, duplicates, opts.confidence))
+	return nil
+}
+
+// printEstimate writes a human-readable summary of e to w.
+func printEstimate(w io.Writer, e estimate.Estimate) {
+	_, _ = fmt.Fprintf(w, "Candidates: %d groups, up to %s reclaimable\n", e.Groups, humanize.IBytes(uint64(e.Potential)))
+	if e.Sampled == 0 {
+		_, _ = fmt.Fprintf(w, "Estimated savings: %s - %s (screening only, use --sample to narrow)\n",
+			humanize.IBytes(uint64(e.Low)), humanize.IBytes(uint64(e.High)))
+		return
+	}
+	_, _ = fmt.Fprintf(w, "Sampled %d groups: confirmed %s of %s potential\n",
+		e.Sampled, humanize.IBytes(uint64(e.SampledSavings)), humanize.IBytes(uint64(e.SampledPotential)))
+	_, _ = fmt.Fprintf(w, "Estimated savings: %s (%g%% confidence: %s - %s)\n",
+		humanize.IBytes(uint64(e.Expected)), e.Confidence*100,
+		humanize.IBytes(uint64(e.Low)), humanize.IBytes(uint64(e.High)))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+)
+
+// pipelineTrace holds each stage's output for --explain.
+type pipelineTrace struct {
+	scan          *scanner.Scanner
+	files         []*types.FileInfo
+	candidates    types.CandidateGroups
+	duplicates    types.DuplicateGroups
+	results       []*deduper.DedupeResult
+	trustMetadata bool
+}
+
+// print writes, for each path, the stage at which it fell out of the pipeline.
+func (t *pipelineTrace) print(w io.Writer, paths []string) {
+	for _, path := range paths {
+		_, _ = fmt.Fprintf(w, "explain %s: %s\n", path, t.explain(path))
+	}
+}
+
+// explain returns the stage at which path fell out of the pipeline and why,
+// or what the deduper did with it.
+func (t *pipelineTrace) explain(path string) string {
+	f := findFile(t.files, path)
+	if f == nil {
+		if reason := t.scan.Explain(path); reason != "" {
+			return "scan: " + reason
+		}
+		return "scan: not scanned (the run was aborted or a parent directory could not be read)"
+	}
+
+	group, ok := findGroup(t.candidates, path)
+	if !ok {
+		return "screen: " + noPeerReason(f, t.files)
+	}
+
+	if _, ok := findGroup(t.duplicates, path); !ok {
+		return "verify: " + t.eliminationReason(f, group)
+	}
+
+	return "dedupe: " + resultReason(path, t.results)
+}
+
+// noPeerReason explains why the screener found no candidate peer for f.
+func noPeerReason(f *types.FileInfo, files []*types.FileInfo) string {
+	for _, other := range files {
+		if other.Size == f.Size && other.Path != f.Path {
+			return fmt.Sprintf("every other file of size %d is a hardlink to it", f.Size)
+		}
+	}
+	return fmt.Sprintf("no other file of size %d", f.Size)
+}
+
+// eliminationReason replays the content comparison of f against the other
+// inodes of its candidate group.
+func (t *pipelineTrace) eliminationReason(f *types.FileInfo, group types.CandidateGroup) string {
+	if t.trustMetadata {
+		return fmt.Sprintf("no other file of size %d has the same mtime and name", f.Size)
+	}
+
+	var peers []*types.FileInfo
+	for _, siblings := range group.Items() {
+		if findFile(siblings.Items(), f.Path) == nil {
+			peers = append(peers, siblings.First())
+		}
+	}
+
+	elim, err := verifier.Explain(f, peers)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("cannot compare: %v", err)
+	case elim == nil:
+		return "content matches another file, but the group was dropped (--ignore-hash-file, --only-hash-file, or a read error during the run)"
+	case elim.Offset < 0:
+		return fmt.Sprintf("eliminated at %s [%d, %d): content changed since the run", elim.Range.Name,
+			elim.Range.Start, elim.Range.Start+elim.Range.Size)
+	default:
+		return fmt.Sprintf("eliminated at %s [%d, %d): differs from %s at byte %d", elim.Range.Name,
+			elim.Range.Start, elim.Range.Start+elim.Range.Size, elim.Peer, elim.Offset)
+	}
+}
+
+// resultReason describes what the deduper did with a confirmed duplicate.
+func resultReason(path string, results []*deduper.DedupeResult) string {
+	linked := 0
+	for _, r := range results {
+		if r.Target == path {
+			return r.String()
+		}
+		if r.Source == path && r.Action != deduper.ActionSkipped {
+			linked++
+		}
+	}
+	if linked > 0 {
+		return fmt.Sprintf("kept as source for %d files", linked)
+	}
+	return "confirmed duplicate, left unchanged (already linked to the source, under --reference, every copy matches --avoid, or its security xattrs differ from every other copy)"
+}
+
+// findFile returns the file with the given path, or nil.
+func findFile(files []*types.FileInfo, path string) *types.FileInfo {
+	for _, f := range files {
+		if f.Path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// findGroup returns the group containing a file with the given path.
+func findGroup(groups types.CandidateGroups, path string) (types.CandidateGroup, bool) {
+	for _, group := range groups.Items() {
+		for _, siblings := range group.Items() {
+			if findFile(siblings.Items(), path) != nil {
+				return group, true
+			}
+		}
+	}
+	return types.CandidateGroup{}, false
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/fixlinks"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/report"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// fixLinksOptions holds CLI flags for the fix-links command.
+type fixLinksOptions struct {
+	reports    []string
+	search     []string
+	excludes   []string
+	dryRun     bool
+	workers    int
+	noProgress bool
+	errorsFile string
+	maxErrors  int
+	maxRuntime time.Duration
+}
+
+// newFixLinksCmd creates the fix-links subcommand.
+func newFixLinksCmd() *cobra.Command {
+	opts := &fixLinksOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "fix-links [paths...] --report REPORT",
+		Short: "Repair dangling symlinks left by symlink fallback",
+		Long: `Finds dangling symlinks under paths and repairs those that JSON reports (written
+with --report) record as symlink replacements: each is pointed to a file with
+the recorded content, the old source if it has reappeared, else a file found
+under paths or --search. Other dangling links are listed for manual action,
+and the exit status is non-zero if any are left:
+  dupedog fix-links /volume2 --report dedupe.json --search /mnt/new-volume1`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true // Links left dangling are not usage errors
+			return runFixLinks(args, opts, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&opts.reports, "report", nil, "JSON report recording the symlinks made (repeatable, later wins)")
+	cmd.Flags().StringSliceVar(&opts.search, "search", nil, "Also look for moved sources under this path (repeatable)")
+	cmd.Flags().StringSliceVarP(&opts.excludes, "exclude", "e", nil, "Glob patterns to exclude from the search for sources")
+	cmd.Flags().BoolVarP(&opts.dryRun, "dry-run", "n", false, "Preview repairs without executing")
+	cmd.Flags().IntVarP(&opts.workers, "workers", "w", 0, "Number of parallel directory readers (0 = auto)")
+	cmd.Flags().BoolVar(&opts.noProgress, "no-progress", false, "Disable progress output")
+	cmd.Flags().StringVar(&opts.errorsFile, "errors-file", "", "Write every error to this file, one per line")
+	cmd.Flags().IntVar(&opts.maxErrors, "max-errors", 0, "Stop the run after this many errors (0 = unlimited)")
+	cmd.Flags().DurationVar(&opts.maxRuntime, "max-runtime", 0, "Stop cleanly after this long, e.g. 4h (0 = unlimited)")
+
+	return cmd
+}
+
+// runFixLinks repairs the dangling symlinks under paths and prints the
+// outcome for each to w.
+func runFixLinks(paths []string, opts *fixLinksOptions, w io.Writer) (err error) {
+	if err := validateWorkers(opts.workers, 0, 0); err != nil {
+		return err
+	}
+	if err := validateGlobPatterns(opts.excludes); err != nil {
+		return fmt.Errorf("invalid --exclude: %w", err)
+	}
+	roots, err := absRoots(paths)
+	if err != nil {
+		return err
+	}
+	search, err := absRoots(opts.search)
+	if err != nil {
+		return fmt.Errorf("invalid --search: %w", err)
+	}
+	var reports []*report.Report
+	for _, path := range opts.reports {
+		r, err := report.Read(path)
+		if err != nil {
+			return fmt.Errorf("read report: %w", err)
+		}
+		reports = append(reports, r)
+	}
+	records := fixlinks.Records(reports)
+
+	errLog := newErrorLog(opts.errorsFile, opts.maxErrors, opts.maxRuntime)
+	defer func() { err = cmp.Or(err, errLog.close()) }()
+	errors := errLog.ch
+
+	links := fixlinks.Dangling(roots, errors)
+
+	// Only scan for moved sources if a recorded link needs one
+	var files []*types.FileInfo
+	for _, link := range links {
+		if _, ok := records[link]; ok {
+			searchRoots := append(append([]string(nil), roots...), search...)
+			files = scanner.New(searchRoots, scanner.Options{
+				MinSize:      1,
+				Excludes:     scanExcludes(opts.excludes, searchRoots, false, false),
+				Workers:      scanWorkers(0, opts.workers),
+				ReaddirBatch: scanner.DefaultReaddirBatch,
+				Reporter:     progress.Terminal(!opts.noProgress),
+			}, errors).RunContext(errLog.ctx)
+			break
+		}
+	}
+
+	fixes := fixlinks.Repair(links, records, files, verifier.Digest, opts.dryRun)
+	if left := printFixes(w, fixes, opts.dryRun); left > 0 {
+		return cmp.Or(errLog.abortErr(), fmt.Errorf("%d dangling symlinks left", left))
+	}
+	return errLog.abortErr()
+}
+
+// printFixes writes one line per dangling link to w and returns how many are
+// left dangling.
+func printFixes(w io.Writer, fixes []fixlinks.Fix, dryRun bool) (left int) {
+	repaired := "repaired"
+	if dryRun {
+		repaired = "would repair"
+	}
+	for _, f := range fixes {
+		switch f.Status {
+		case fixlinks.StatusRepaired:
+			_, _ = fmt.Fprintf(w, "%s %s -> %s\n", repaired, f.Link, f.Source)
+			continue
+		case fixlinks.StatusNoRecord:
+			_, _ = fmt.Fprintf(w, "%s: not recorded in the reports, fix by hand\n", f.Link)
+		case fixlinks.StatusNoMatch:
+			_, _ = fmt.Fprintf(w, "%s: no file with the content of %s found, fix by hand\n", f.Link, f.Source)
+		case fixlinks.StatusFailed:
+			_, _ = fmt.Fprintf(w, "%s: repair to %s failed: %v\n", f.Link, f.Source, f.Err)
+		}
+		left++
+	}
+	return left
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// hashOptions holds CLI flags for the hash command.
+type hashOptions struct {
+	cacheFile    string
+	cacheFileSet bool
+	noCache      bool
+}
+
+// newHashCmd creates the hash subcommand.
+func newHashCmd() *cobra.Command {
+	opts := &hashOptions{cacheFile: defaultCacheFile()}
+
+	cmd := &cobra.Command{
+		Use:   "hash FILE...",
+		Short: "Print the range hashes the verifier compares",
+		Long: `Prints the hashes of each range the verifier compares (head, tail, chunks)
+and the composite digest reported for duplicates, for every FILE.
+
+Two files are duplicates exactly when all their ranges match. Hashes are read
+from and stored in the hash cache, so hashing files ahead of a run warms it:
+  dupedog hash /data/a.iso /data/b.iso`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.cacheFileSet = cmd.Flags().Changed("cache-file")
+			cmd.SilenceUsage = true // Hashing failures are not usage errors
+			return runHash(args, opts, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.cacheFile, "cache-file", opts.cacheFile, "Path to hash cache file")
+	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Disable the hash cache")
+
+	return cmd
+}
+
+// runHash hashes every file and prints its ranges to w.
+// Failing files are reported to stderr; the others are still hashed.
+func runHash(paths []string, opts *hashOptions, w io.Writer) error {
+	files := make([]*types.FileInfo, 0, len(paths))
+	var failed int
+	for _, p := range paths {
+		f, err := scanner.Stat(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			failed++
+			continue
+		}
+		files = append(files, f)
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("%d of %d files could not be hashed", failed, len(paths))
+	}
+
+	// Scope self-cleaning to the hashed files so the rest of the cache is kept
+	scope := make([]string, len(files))
+	for i, f := range files {
+		scope[i] = f.Path
+	}
+	hashCache, err := openCache(&dedupeOptions{cacheFile: opts.cacheFile, cacheFileSet: opts.cacheFileSet, noCache: opts.noCache},
+		scope, 0, cache.KeyPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = hashCache.Close() }()
+
+	for _, f := range files {
+		ranges, digest, err := verifier.HashFile(f, hashCache)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", f.Path, err)
+			failed++
+			continue
+		}
+		printRanges(w, f, ranges, digest)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be hashed", failed, len(paths))
+	}
+	return nil
+}
+
+// printRanges writes one file's range hashes and digest to w.
+func printRanges(w io.Writer, f *types.FileInfo, ranges []verifier.RangeHash, digest string) {
+	_, _ = fmt.Fprintf(w, "%s (%d bytes)\n", f.Path, f.Size)
+	for _, r := range ranges {
+		cached := ""
+		if r.Cached {
+			cached = " (cached)"
+		}
+		_, _ = fmt.Fprintf(w, "  %-10s [%d, %d) %s%s\n", r.Name, r.Start, r.Start+r.Size, r.Hash, cached)
+	}
+	_, _ = fmt.Fprintf(w, "  %-10s %s\n", "digest", digest)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// histogramBuckets are the file size buckets of --histogram, each holding
+// sizes from the previous bucket's limit up to (excluding) its own.
+var histogramBuckets = []struct {
+	label string
+	limit int64
+}{
+	{"<1K", 1 << 10},
+	{"1K-1M", 1 << 20},
+	{"1M-100M", 100 << 20},
+	{">100M", math.MaxInt64},
+}
+
+// printHistogram writes duplicate group counts and savings by file size to
+// w. The last column is the share of all savings kept by a --min-size at the
+// bucket's lower bound, i.e. in the bucket and the larger ones.
+func printHistogram(w io.Writer, groups types.DuplicateGroups) {
+	counts := make([]int, len(histogramBuckets))
+	savings := make([]int64, len(histogramBuckets))
+	var total int64
+	for _, g := range groups.Items() {
+		size := g.First().First().Size
+		i := 0
+		for size >= histogramBuckets[i].limit {
+			i++
+		}
+		counts[i]++
+		savings[i] += types.ReclaimableBytes(g)
+		total += types.ReclaimableBytes(g)
+	}
+
+	_, _ = fmt.Fprintln(w, "Duplicates by file size:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(tw, "SIZE\tGROUPS\tSAVINGS\tAT OR ABOVE\t")
+	above := total
+	for i, b := range histogramBuckets {
+		share := 0.0
+		if total > 0 {
+			share = float64(above) / float64(total) * 100
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f%%\t\n", b.label, counts[i], humanize.IBytes(uint64(savings[i])), share)
+		above -= savings[i]
+	}
+	_ = tw.Flush()
+}
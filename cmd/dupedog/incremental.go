@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ivoronin/dupedog/internal/scanner"
+)
+
+// defaultIndexFile returns the default directory index path for
+// --incremental, next to the default hash cache:
+// $XDG_CACHE_HOME/dupedog/dirs.idx. Returns "" if no cache directory can be
+// determined.
+func defaultIndexFile() string {
+	cacheFile := defaultCacheFile()
+	if cacheFile == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(cacheFile), "dirs.idx")
+}
+
+// loadIndex returns the directory index at path for --incremental. An
+// unreadable index is not fatal: the run lists every directory and records
+// a fresh one.
+func loadIndex(path string) (*scanner.Index, error) {
+	if path == "" {
+		return nil, fmt.Errorf("invalid --incremental: no --index-file given and no user cache directory")
+	}
+	index, err := scanner.LoadIndex(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: directory index ignored: %v\n", err)
+		return scanner.NewIndex(), nil
+	}
+	return index, nil
+}
+
+// saveIndex writes the directory index after a complete scan. Failing to
+// save only costs the next run its head start, so it is a warning.
+func saveIndex(index *scanner.Index, path string) {
+	if err := index.Save(path); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
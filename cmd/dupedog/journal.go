@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ivoronin/dupedog/internal/deduper"
+)
+
+// defaultJournalDir returns the default intent log directory, next to the
+// default hash cache: $XDG_CACHE_HOME/dupedog/journal. Returns "" if no cache
+// directory can be determined (journaling disabled).
+func defaultJournalDir() string {
+	cacheFile := defaultCacheFile()
+	if cacheFile == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(cacheFile), "journal")
+}
+
+// openJournal reconciles replacements interrupted by crashed runs, then
+// starts this run's intent log in dir. Dry runs and an empty dir journal
+// nothing (nil). Failing to open the default journal is not fatal: the run
+// continues without crash recovery. Failing to open an explicit --journal-dir is.
+func openJournal(dir string, dirSet, dryRun bool) (*deduper.Journal, error) {
+	if dir == "" || dryRun {
+		return nil, nil
+	}
+
+	recoveries, err := deduper.RecoverJournals(dir)
+	printRecoveries(os.Stderr, recoveries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: journal recovery: %v\n", err)
+	}
+
+	journal, err := deduper.OpenJournal(dir)
+	if err == nil {
+		return journal, nil
+	}
+	if dirSet {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "warning: default journal disabled: %v\n", err)
+	return nil, nil
+}
+
+// printRecoveries reports what was done with each interrupted replacement.
+func printRecoveries(w io.Writer, recoveries []deduper.Recovery) {
+	for _, r := range recoveries {
+		if r.Err != nil {
+			_, _ = fmt.Fprintf(w, "warning: interrupted replacement of %s: %s: %v\n", r.Target, r.Action, r.Err)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "recovered interrupted replacement of %s: %s\n", r.Target, r.Action)
+	}
+}
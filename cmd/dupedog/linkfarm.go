@@ -0,0 +1,152 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/ivoronin/dupedog/internal/linkfarm"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/screener"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// linkFarmOptions holds CLI flags for the link-farm command.
+type linkFarmOptions struct {
+	references           []string
+	excludes             []string
+	includeSnapshots     bool
+	includeOverlayLayers bool
+	workers              int
+	scanWorkers          int
+	readdirBatch         int
+	hashWorkers          int
+	noProgress           bool
+	errorsFile           string
+	maxErrors            int
+	maxRuntime           time.Duration
+	cacheFile            string
+	cacheFileSet         bool
+	noCache              bool
+}
+
+// newLinkFarmCmd creates the link-farm subcommand.
+func newLinkFarmCmd() *cobra.Command {
+	opts := &linkFarmOptions{
+		cacheFile: defaultCacheFile(),
+	}
+
+	cmd := &cobra.Command{
+		Use:   "link-farm SOURCE DEST --link-dest REF",
+		Short: "Build a deduplicated snapshot of a tree",
+		Long: `Builds DEST as a snapshot mirroring SOURCE, like rsync --link-dest.
+
+Files with identical content in a --link-dest tree are hardlinked to the reference copy;
+all other files are copied from SOURCE (cloned where the filesystem supports reflinks),
+so DEST shares no inodes with SOURCE. SOURCE and reference trees are never modified.
+DEST must be on the same filesystem as the references:
+  dupedog link-farm /data /snapshots/today --link-dest /snapshots/yesterday`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.cacheFileSet = cmd.Flags().Changed("cache-file")
+			return runLinkFarm(args[0], args[1], opts)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&opts.references, "link-dest", nil, "Reference tree to share content with (repeatable, earlier wins)")
+	cmd.Flags().StringSliceVarP(&opts.excludes, "exclude", "e", nil, "Glob patterns to exclude")
+	cmd.Flags().BoolVar(&opts.includeSnapshots, "include-snapshots", false, "Scan snapshot directories (.snapshot, .snapshots, .zfs/snapshot), skipped by default")
+	cmd.Flags().BoolVar(&opts.includeOverlayLayers, "include-overlay-layers", false, "Scan the merged views and layer directories of mounted overlayfs, skipped by default")
+	cmd.Flags().IntVarP(&opts.workers, "workers", "w", 0, "Number of parallel workers for scanning and hashing (0 = auto)")
+	cmd.Flags().IntVar(&opts.readdirBatch, "readdir-batch", scanner.DefaultReaddirBatch, "Directory entries listed at a time")
+	cmd.Flags().IntVar(&opts.scanWorkers, "scan-workers", 0, "Number of parallel directory readers (0 = --workers, else 4x CPU count)")
+	cmd.Flags().IntVar(&opts.hashWorkers, "hash-workers", 0, "Number of parallel hashing workers (0 = --workers, else 4 per device, at most CPU count)")
+	cmd.Flags().BoolVar(&opts.noProgress, "no-progress", false, "Disable progress output")
+	cmd.Flags().StringVar(&opts.errorsFile, "errors-file", "", "Write every error to this file, one per line")
+	cmd.Flags().IntVar(&opts.maxErrors, "max-errors", 0, "Stop the run after this many errors (0 = unlimited)")
+	cmd.Flags().DurationVar(&opts.maxRuntime, "max-runtime", 0, "Stop cleanly after this long, e.g. 4h (0 = unlimited)")
+	cmd.Flags().StringVar(&opts.cacheFile, "cache-file", opts.cacheFile, "Path to hash cache file")
+	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Disable the hash cache")
+	_ = cmd.MarkFlagRequired("link-dest")
+
+	return cmd
+}
+
+// runLinkFarm executes the pipeline: scan → screen → verify → link.
+func runLinkFarm(source, dest string, opts *linkFarmOptions) (err error) {
+	if err := validateWorkers(opts.workers, opts.scanWorkers, opts.hashWorkers); err != nil {
+		return err
+	}
+	if opts.readdirBatch < 1 {
+		return fmt.Errorf("invalid --readdir-batch: must be at least 1")
+	}
+	if err := validateGlobPatterns(opts.excludes); err != nil {
+		return fmt.Errorf("invalid --exclude: %w", err)
+	}
+
+	roots, err := absRoots(append([]string{source, dest}, opts.references...))
+	if err != nil {
+		return err
+	}
+	if err := checkDisjoint(roots); err != nil {
+		return err
+	}
+	source, dest, references := roots[0], roots[1], roots[2:]
+
+	reporter := progress.Terminal(!opts.noProgress)
+	errLog := newErrorLog(opts.errorsFile, opts.maxErrors, opts.maxRuntime)
+	defer func() { err = cmp.Or(err, errLog.close()) }()
+	errors := errLog.ch
+
+	// Empty files are included: every source file must appear in DEST
+	scanRoots := append([]string{source}, references...)
+	excludes := scanExcludes(opts.excludes, scanRoots, opts.includeSnapshots, opts.includeOverlayLayers)
+	sourceFiles := scanner.New([]string{source}, scanner.Options{
+		Excludes:     excludes,
+		Workers:      scanWorkers(opts.scanWorkers, opts.workers),
+		ReaddirBatch: opts.readdirBatch,
+		Reporter:     reporter,
+	}, errors).RunContext(errLog.ctx)
+	refFiles := scanner.New(references, scanner.Options{
+		Excludes:     excludes,
+		Workers:      scanWorkers(opts.scanWorkers, opts.workers),
+		ReaddirBatch: opts.readdirBatch,
+		Reporter:     reporter,
+	}, errors).RunContext(errLog.ctx)
+
+	files := append(refFiles, sourceFiles...)
+	candidates := screener.New(files, screener.Options{Reporter: reporter}).Run()
+
+	hashCache, err := openCache(&dedupeOptions{cacheFile: opts.cacheFile, cacheFileSet: opts.cacheFileSet, noCache: opts.noCache},
+		scanRoots, 0, cache.KeyPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = hashCache.Close() }()
+
+	duplicates := verifier.New(candidates, verifier.Options{
+		Workers:  hashWorkers(opts.hashWorkers, opts.workers, candidates),
+		Cache:    hashCache,
+		Reporter: reporter,
+	}, errors).RunContext(errLog.ctx)
+
+	linkfarm.New(source, dest, sourceFiles, duplicates, references, reporter, errors).RunContext(errLog.ctx)
+	return nil
+}
+
+// checkDisjoint rejects roots that are equal to or nested inside one another.
+func checkDisjoint(roots []string) error {
+	for i, a := range roots {
+		for _, b := range roots[i+1:] {
+			if a == b || strings.HasPrefix(a, b+string(os.PathSeparator)) || strings.HasPrefix(b, a+string(os.PathSeparator)) {
+				return fmt.Errorf("%s and %s overlap; source, destination and references must be separate trees", a, b)
+			}
+		}
+	}
+	return nil
+}
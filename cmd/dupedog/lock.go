@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ivoronin/dupedog/internal/runlock"
+)
+
+// defaultLockDir returns the run lock directory, next to the default hash
+// cache: $XDG_CACHE_HOME/dupedog/locks. Returns "" if no cache directory can
+// be determined (locking disabled).
+func defaultLockDir() string {
+	cacheFile := defaultCacheFile()
+	if cacheFile == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(cacheFile), "locks")
+}
+
+// lockRoots keeps other dupedog runs from modifying roots until the returned
+// lock is released (see runlock). Dry runs and --no-lock take no lock (nil).
+// Failing to create the lock directory is not fatal: the run continues
+// unlocked. A root locked by another run is fatal unless wait is set.
+func lockRoots(ctx context.Context, roots []string, wait, noLock, dryRun bool) (*runlock.Lock, error) {
+	dir := defaultLockDir()
+	if noLock || dryRun || dir == "" {
+		return nil, nil
+	}
+	onWait := func(path string) {
+		fmt.Fprintf(os.Stderr, "waiting for another dupedog run using %s to finish (--wait-lock)\n", path)
+	}
+	lock, err := runlock.Acquire(ctx, dir, roots, wait, onWait)
+	switch {
+	case errors.Is(err, runlock.ErrLocked):
+		return nil, fmt.Errorf("%w (use --wait-lock to wait for it, or --no-lock)", err)
+	case err != nil && ctx.Err() != nil:
+		return nil, err // Stopped while waiting (--max-runtime)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "warning: run lock disabled: %v\n", err)
+		return nil, nil
+	}
+	return lock, nil
+}
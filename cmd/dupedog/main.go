@@ -1,11 +1,20 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
+	"github.com/ivoronin/dupedog/internal/color"
 	"github.com/spf13/cobra"
 )
 
+// exitStatus is returned by commands whose exit status carries a result
+// (e.g. compare); the command prints its own output.
+type exitStatus int
+
+func (s exitStatus) Error() string { return fmt.Sprintf("exit status %d", int(s)) }
+
 var (
 	version = "dev"
 	commit  = "none"
@@ -16,15 +25,43 @@ func main() {
 }
 
 func run() int {
+	var noColor bool
+	var profile profileOptions
+	stopProfiling := func() error { return nil }
 	root := &cobra.Command{
 		Use:     "dupedog",
 		Short:   "Find and deduplicate files",
 		Version: version + " (" + commit + ")",
+		PersistentPreRunE: func(*cobra.Command, []string) error {
+			color.Init(noColor)
+			stop, err := startProfiling(profile)
+			if err != nil {
+				return err
+			}
+			stopProfiling = stop
+			return nil
+		},
 	}
+	root.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output (also NO_COLOR)")
+	root.PersistentFlags().StringVar(&profile.pprofAddr, "pprof-addr", "", "Serve net/http/pprof on this address, e.g. localhost:6060")
+	root.PersistentFlags().StringVar(&profile.cpuProfile, "cpuprofile", "", "Write a CPU profile to file")
+	root.PersistentFlags().StringVar(&profile.memProfile, "memprofile", "", "Write a heap profile to file when the command finishes")
+	root.PersistentFlags().StringVar(&profile.traceFile, "trace", "", "Write a Go execution trace to file")
 
-	root.AddCommand(newDedupeCmd())
+	root.AddCommand(newDedupeCmd(), newCacheCmd(), newVerifyLinksCmd(), newDiffCmd(), newLinkFarmCmd(), newEstimateCmd(), newHashCmd(), newApplyCmd(), newCompareCmd(), newBenchCmd(), newArchivesCmd(), newFixLinksCmd(), newDoctorCmd(), newManifestCmd(), newCleanupCmd(), newRemoteHelperCmd())
 
-	if err := root.Execute(); err != nil {
+	err := root.Execute()
+	if stopErr := stopProfiling(); stopErr != nil {
+		fmt.Fprintf(os.Stderr, "error: write profile: %v\n", stopErr)
+	}
+	if err != nil {
+		var status exitStatus
+		if errors.As(err, &status) {
+			return int(status)
+		}
+		if errors.Is(err, errTimeLimit) {
+			return 3
+		}
 		return 1
 	}
 	return 0
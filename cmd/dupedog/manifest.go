@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/ivoronin/dupedog/internal/manifest"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// manifestOptions holds CLI flags shared by the manifest subcommands.
+type manifestOptions struct {
+	minSizeStr   string
+	excludes     []string
+	workers      int
+	noProgress   bool
+	errorsFile   string
+	cacheFile    string
+	cacheFileSet bool
+	noCache      bool
+	keyFile      string
+	output       string
+}
+
+// newManifestCmd creates the manifest command group (export/compare).
+func newManifestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "Find duplicates across hosts with content manifests",
+	}
+
+	cmd.AddCommand(newManifestExportCmd(), newManifestCompareCmd())
+	return cmd
+}
+
+// bindManifestFlags binds flags shared by the manifest subcommands.
+func bindManifestFlags(cmd *cobra.Command, opts *manifestOptions) {
+	opts.minSizeStr = "1"
+	opts.cacheFile = defaultCacheFile()
+	cmd.Flags().StringVarP(&opts.minSizeStr, "min-size", "m", opts.minSizeStr, "Minimum file size (e.g., 100, 1K, 10M, 1G)")
+	cmd.Flags().StringSliceVarP(&opts.excludes, "exclude", "e", nil, "Glob patterns to exclude")
+	cmd.Flags().IntVarP(&opts.workers, "workers", "w", 0, "Number of parallel workers for scanning and hashing (0 = auto)")
+	cmd.Flags().BoolVar(&opts.noProgress, "no-progress", false, "Disable progress output")
+	cmd.Flags().StringVar(&opts.errorsFile, "errors-file", "", "Write every error to this file, one per line")
+	cmd.Flags().StringVar(&opts.cacheFile, "cache-file", opts.cacheFile, "Path to hash cache file")
+	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Disable the hash cache")
+	cmd.Flags().StringVar(&opts.keyFile, "key-file", "", "HMAC-SHA256 key shared by the hosts, to sign or verify manifests")
+}
+
+// newManifestExportCmd creates the manifest export subcommand.
+func newManifestExportCmd() *cobra.Command {
+	opts := &manifestOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "export PATH",
+		Short: "Write the content manifest of a tree",
+		Long: `Hashes every file under PATH and writes a JSON manifest of (relative path,
+size, digest) entries, signed with --key-file if given. Copy it to another host
+and run "manifest compare" there to find the files both hosts hold:
+  dupedog manifest export /volume1 --key-file hosts.key -o nas1.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.cacheFileSet = cmd.Flags().Changed("cache-file")
+			cmd.SilenceUsage = true // Hashing failures are not usage errors
+			return runManifestExport(args[0], opts)
+		},
+	}
+
+	bindManifestFlags(cmd, opts)
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "-", "Write the manifest to this file (- for stdout)")
+	return cmd
+}
+
+// newManifestCompareCmd creates the manifest compare subcommand.
+func newManifestCompareCmd() *cobra.Command {
+	opts := &manifestOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "compare MANIFEST PATH",
+		Short: "List files under PATH whose content is in another host's manifest",
+		Long: `Reads a manifest written by "manifest export" on another host (- for stdin)
+and prints each file under PATH with the same content as a manifest entry, as
+tab-separated local path and host:path. Only files whose size appears in the
+manifest are hashed. Nothing is modified: files on different hosts cannot be
+linked, but the list shows what one of them could drop:
+  dupedog manifest compare nas1.json /volume2 --key-file hosts.key`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.cacheFileSet = cmd.Flags().Changed("cache-file")
+			cmd.SilenceUsage = true // Hashing failures are not usage errors
+			return runManifestCompare(args[0], args[1], opts, os.Stdout)
+		},
+	}
+
+	bindManifestFlags(cmd, opts)
+	return cmd
+}
+
+// runManifestExport scans root and writes its manifest.
+func runManifestExport(root string, opts *manifestOptions) (err error) {
+	key, err := readKeyFile(opts.keyFile)
+	if err != nil {
+		return fmt.Errorf("invalid --key-file: %w", err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	files, hasher, root, done, err := scanForManifest(root, opts)
+	if err != nil {
+		return err
+	}
+	defer func() { err = cmp.Or(err, done()) }()
+
+	m := hasher.Build(host, root, files)
+	if key != nil {
+		if err := m.Sign(key); err != nil {
+			return err
+		}
+	}
+	if opts.output == "-" {
+		return m.Write(os.Stdout)
+	}
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(opts.output, buf.Bytes(), 0o644) //nolint:gosec // not secret
+}
+
+// runManifestCompare scans root and prints the files matching the manifest
+// read from manifestPath.
+func runManifestCompare(manifestPath, root string, opts *manifestOptions, w io.Writer) (err error) {
+	key, err := readKeyFile(opts.keyFile)
+	if err != nil {
+		return fmt.Errorf("invalid --key-file: %w", err)
+	}
+	m, err := readManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	switch err := m.Verify(key); {
+	case key != nil && err != nil:
+		return fmt.Errorf("%s: %w", manifestPath, err)
+	case key == nil && m.Signature != "":
+		fmt.Fprintf(os.Stderr, "warning: %s is signed, but not verified without --key-file\n", manifestPath)
+	}
+
+	files, hasher, root, done, err := scanForManifest(root, opts)
+	if err != nil {
+		return err
+	}
+	defer func() { err = cmp.Or(err, done()) }()
+
+	matches := hasher.Compare(m, files)
+	printManifestMatches(w, m, matches)
+	var bytes int64
+	for _, match := range matches {
+		bytes += match.Size
+	}
+	fmt.Fprintf(os.Stderr, "%d files (%s) under %s also on %s\n", len(matches), humanize.IBytes(uint64(bytes)), root, m.Host)
+	return nil
+}
+
+// scanForManifest scans root and returns its files, a hasher using the hash
+// cache, the absolute root, and a function that closes the cache and the
+// error log.
+func scanForManifest(root string, opts *manifestOptions) (files []*types.FileInfo, hasher *manifest.Hasher, abs string, done func() error, err error) {
+	minSize, err := parseSize(opts.minSizeStr)
+	if err != nil {
+		return nil, nil, "", nil, fmt.Errorf("invalid --min-size: %w", err)
+	}
+	if err := validateGlobPatterns(opts.excludes); err != nil {
+		return nil, nil, "", nil, fmt.Errorf("invalid --exclude: %w", err)
+	}
+	if err := validateWorkers(opts.workers, 0, 0); err != nil {
+		return nil, nil, "", nil, err
+	}
+	roots, err := absRoots([]string{root})
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	hashCache, err := openCache(&dedupeOptions{cacheFile: opts.cacheFile, cacheFileSet: opts.cacheFileSet, noCache: opts.noCache},
+		roots, 0, cache.KeyPath)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	errLog := newErrorLog(opts.errorsFile, 0, 0)
+	done = func() error {
+		_ = hashCache.Close()
+		return errLog.close()
+	}
+
+	reporter := progress.Terminal(!opts.noProgress)
+	files = scanner.New(roots, scanner.Options{
+		MinSize:      max(minSize, 1),
+		Excludes:     scanExcludes(opts.excludes, roots, false, false),
+		Workers:      scanWorkers(0, opts.workers),
+		ReaddirBatch: scanner.DefaultReaddirBatch,
+		Reporter:     reporter,
+	}, errLog.ch).RunContext(errLog.ctx)
+
+	hasher = &manifest.Hasher{
+		Digest: func(f *types.FileInfo) (string, error) {
+			_, digest, err := verifier.HashFile(f, hashCache)
+			return digest, err
+		},
+		Workers:  cmp.Or(opts.workers, runtime.NumCPU()),
+		Reporter: reporter,
+		ErrCh:    errLog.ch,
+	}
+	return files, hasher, roots[0], done, nil
+}
+
+// readManifest reads the manifest at p ("-" for stdin).
+func readManifest(p string) (*manifest.Manifest, error) {
+	if p == "-" {
+		return manifest.Read(os.Stdin)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	m, err := manifest.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return m, nil
+}
+
+// printManifestMatches writes one tab-separated line per local file and
+// remote copy.
+func printManifestMatches(w io.Writer, m *manifest.Manifest, matches []manifest.Match) {
+	for _, match := range matches {
+		for _, remote := range match.Remote {
+			_, _ = fmt.Fprintf(w, "%s\t%s:%s\n", match.Local, m.Host, path.Join(m.Root, remote))
+		}
+	}
+}
+
+// readKeyFile returns the key in path with surrounding whitespace trimmed,
+// or nil if path is empty.
+func readKeyFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := []byte(strings.TrimSpace(string(data)))
+	if len(key) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	return key, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Webhook delivery settings.
+const (
+	notifyTimeout = 30 * time.Second // Per attempt
+	notifyBackoff = 2 * time.Second  // Before the first retry, doubled for each next one
+)
+
+// notifier posts the run summary to a webhook.
+type notifier struct {
+	url     string
+	secret  []byte // HMAC-SHA256 key, nil to leave requests unsigned
+	retries int
+	backoff time.Duration
+	client  *http.Client
+}
+
+// newNotifier returns a notifier posting to rawURL, signing with the key read
+// from secretFile (if set), or nil if rawURL is empty.
+func newNotifier(rawURL, secretFile string, retries int) (*notifier, error) {
+	if rawURL == "" {
+		if secretFile != "" {
+			return nil, fmt.Errorf("invalid --notify-secret-file: requires --notify-url")
+		}
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid --notify-url: want an http or https URL")
+	}
+	if retries < 0 {
+		return nil, fmt.Errorf("invalid --notify-retries: must not be negative")
+	}
+	n := &notifier{url: rawURL, retries: retries, backoff: notifyBackoff, client: &http.Client{Timeout: notifyTimeout}}
+	if n.secret, err = readKeyFile(secretFile); err != nil {
+		return nil, fmt.Errorf("invalid --notify-secret-file: %w", err)
+	}
+	return n, nil
+}
+
+// send posts the finished summary, retrying on network errors, 429 and 5xx
+// responses.
+func (n *notifier) send(s *runSummary) error {
+	body, err := s.marshal()
+	if err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	backoff := n.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == n.retries {
+			return fmt.Errorf("notify: %w", err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (n *notifier) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dupedog/"+version)
+	if n.secret != nil {
+		mac := hmac.New(sha256.New, n.secret)
+		mac.Write(body)
+		req.Header.Set("X-Dupedog-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("%s: %s", n.url, resp.Status)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ivoronin/dupedog/internal/color"
+	"github.com/ivoronin/dupedog/internal/pause"
+)
+
+// withPauseSignals returns a copy of ctx carrying a pause.Gate that SIGUSR1
+// pauses and SIGUSR2 resumes, and a function that stops listening.
+func withPauseSignals(ctx context.Context) (context.Context, func()) {
+	gate := &pause.Gate{}
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				switch {
+				case sig == syscall.SIGUSR1 && gate.Pause():
+					fmt.Fprintf(os.Stderr, "\r\033[K%s I/O paused after in-flight reads and links (send SIGUSR2 to resume)\n", color.Stderr.Yellow("paused:"))
+				case sig == syscall.SIGUSR2 && gate.Resume():
+					fmt.Fprintf(os.Stderr, "\r\033[K%s I/O resumed\n", color.Stderr.Green("resumed:"))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return pause.NewContext(ctx, gate), func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
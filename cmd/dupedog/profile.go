@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof" //nolint:gosec // Registers /debug/pprof/ on DefaultServeMux, served only with --pprof-addr
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profileOptions holds the global profiling flags.
+type profileOptions struct {
+	pprofAddr  string // --pprof-addr: serve net/http/pprof here ("" = off)
+	cpuProfile string // --cpuprofile: write a CPU profile here
+	memProfile string // --memprofile: write a heap profile here at exit
+	traceFile  string // --trace: write an execution trace here
+}
+
+// startProfiling starts the profilers requested by opts. The returned stop
+// function flushes and closes them; call it once, when the command returns.
+// On error, profilers already started are stopped.
+func startProfiling(opts profileOptions) (stop func() error, err error) {
+	var stops []func() error
+	stopAll := func() error {
+		var errs []error
+		for i := len(stops) - 1; i >= 0; i-- {
+			errs = append(errs, stops[i]())
+		}
+		return errors.Join(errs...)
+	}
+	defer func() {
+		if err != nil {
+			_ = stopAll()
+		}
+	}()
+
+	if opts.pprofAddr != "" {
+		ln, err := net.Listen("tcp", opts.pprofAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pprof-addr: %w", err)
+		}
+		srv := &http.Server{Handler: http.DefaultServeMux} //nolint:gosec // Local debugging endpoint
+		go func() { _ = srv.Serve(ln) }()
+		fmt.Fprintf(os.Stderr, "pprof: serving on http://%s/debug/pprof/\n", ln.Addr())
+		stops = append(stops, srv.Close)
+	}
+
+	if opts.cpuProfile != "" {
+		f, err := os.Create(opts.cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --cpuprofile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("start CPU profile: %w", err)
+		}
+		stops = append(stops, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+
+	if opts.traceFile != "" {
+		f, err := os.Create(opts.traceFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --trace: %w", err)
+		}
+		if err := trace.Start(f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("start trace: %w", err)
+		}
+		stops = append(stops, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+
+	if opts.memProfile != "" {
+		f, err := os.Create(opts.memProfile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --memprofile: %w", err)
+		}
+		stops = append(stops, func() error {
+			runtime.GC() // Up-to-date live heap statistics
+			err := pprof.WriteHeapProfile(f)
+			return errors.Join(err, f.Close())
+		})
+	}
+
+	return stopAll, nil
+}
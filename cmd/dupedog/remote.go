@@ -0,0 +1,158 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/ivoronin/dupedog/internal/manifest"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/remote"
+	"github.com/ivoronin/dupedog/internal/report"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// newRemoteHelperCmd creates the hidden remote-helper subcommand, which
+// scans and hashes on a remote host for a dedupe run with remote roots.
+func newRemoteHelperCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:    "remote-helper",
+		Short:  "Scan and hash for a remote dupedog run (speaks JSON lines on stdin/stdout)",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cmd.SilenceUsage = true
+			return remote.Serve(os.Stdin, os.Stdout, runtime.NumCPU())
+		},
+	}
+}
+
+// splitRemoteRoots separates [user@]host:/path arguments from local paths.
+func splitRemoteRoots(paths []string) (local []string, remotes []remote.Root) {
+	for _, p := range paths {
+		if r, ok := remote.ParseRoot(p); ok {
+			remotes = append(remotes, r)
+		} else {
+			local = append(local, p)
+		}
+	}
+	return local, remotes
+}
+
+// remoteMatcher finds content of local files under remote roots.
+type remoteMatcher struct {
+	sshCmd   []string // ssh command and options
+	helper   string   // dupedog on the remote hosts ("" = copy this executable)
+	scan     remote.ScanRequest
+	workers  int
+	reporter progress.Reporter
+	errCh    chan *types.Event
+}
+
+// match scans the remote roots host by host and returns the content found
+// both there and in local files, largest first. Local candidates are hashed
+// with hashCache (may be nil).
+func (m *remoteMatcher) match(ctx context.Context, roots []remote.Root, local []*types.FileInfo, hashCache *cache.Cache) ([]report.RemoteGroup, error) {
+	byDest := make(map[string][]string)
+	var dests []string
+	for _, r := range roots {
+		if _, ok := byDest[r.Dest]; !ok {
+			dests = append(dests, r.Dest)
+		}
+		byDest[r.Dest] = append(byDest[r.Dest], r.Path)
+	}
+
+	hasher := &manifest.Hasher{
+		Digest: func(f *types.FileInfo) (string, error) {
+			_, digest, err := verifier.HashFile(f, hashCache)
+			return digest, err
+		},
+		Workers:  m.workers,
+		Reporter: m.reporter,
+		ErrCh:    m.errCh,
+	}
+	var groups []report.RemoteGroup
+	for _, dest := range dests {
+		manifest, err := m.remoteManifest(ctx, dest, byDest[dest], local)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, remoteGroups(manifest, hasher.Compare(manifest, local))...)
+	}
+	slices.SortFunc(groups, func(a, b report.RemoteGroup) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Digest, b.Digest), cmp.Compare(a.Remote[0], b.Remote[0]))
+	})
+	return groups, nil
+}
+
+// remoteManifest scans paths on dest and hashes the files sharing their size
+// with a local file, as a manifest rooted at "/".
+func (m *remoteMatcher) remoteManifest(ctx context.Context, dest string, paths []string, local []*types.FileInfo) (*manifest.Manifest, error) {
+	s, err := remote.Dial(ctx, m.sshCmd, dest, m.helper)
+	if err != nil {
+		return nil, err
+	}
+	req := m.scan
+	req.Roots = paths
+	files, err := s.Scan(req, m.errCh)
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	candidates := remote.Candidates(local, files)
+	digests, err := s.Hash(candidates, m.errCh)
+	if err := cmp.Or(err, s.Close()); err != nil {
+		return nil, err
+	}
+
+	mf := &manifest.Manifest{Host: dest, Root: "/"}
+	for _, f := range candidates {
+		if d, ok := digests[f.Path]; ok {
+			mf.Entries = append(mf.Entries, manifest.Entry{Path: strings.TrimPrefix(f.Path, "/"), Size: f.Size, Digest: d})
+		}
+	}
+	return mf, nil
+}
+
+// remoteGroups groups the local matches of a remote manifest by content.
+func remoteGroups(m *manifest.Manifest, matches []manifest.Match) []report.RemoteGroup {
+	byDigest := make(map[string]*report.RemoteGroup)
+	var order []string
+	for _, match := range matches {
+		g, ok := byDigest[match.Digest]
+		if !ok {
+			g = &report.RemoteGroup{Size: match.Size, Digest: match.Digest}
+			for _, p := range match.Remote {
+				g.Remote = append(g.Remote, m.Host+":/"+p)
+			}
+			byDigest[match.Digest] = g
+			order = append(order, match.Digest)
+		}
+		g.Local = append(g.Local, match.Local)
+	}
+	groups := make([]report.RemoteGroup, len(order))
+	for i, d := range order {
+		groups[i] = *byDigest[d]
+	}
+	return groups
+}
+
+// printRemoteGroups writes how much local content each remote root holds.
+func printRemoteGroups(w io.Writer, groups []report.RemoteGroup) {
+	var files int
+	var bytes int64
+	for _, g := range groups {
+		files += len(g.Remote)
+		bytes += int64(len(g.Remote)) * g.Size
+	}
+	_, _ = fmt.Fprintf(w, "%d remote files (%s) duplicate local content\n", files, humanize.IBytes(uint64(bytes)))
+}
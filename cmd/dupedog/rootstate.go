@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/rootstate"
+)
+
+// defaultStateDir returns the directory of per-root run states, next to the
+// default hash cache: $XDG_CACHE_HOME/dupedog/roots. Returns "" if no cache
+// directory can be determined (states disabled).
+func defaultStateDir() string {
+	cacheFile := defaultCacheFile()
+	if cacheFile == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(cacheFile), "roots")
+}
+
+// dedupePolicy returns the flags that decide which files a run links and
+// how, by flag name, as recorded in root states.
+func dedupePolicy(opts *dedupeOptions) map[string]string {
+	return map[string]string{
+		"action":                  opts.action,
+		"symlink-fallback":        strconv.FormatBool(opts.symlinkFallback),
+		"trust-device-boundaries": strconv.FormatBool(opts.trustDeviceBoundaries),
+		"trust-metadata":          strconv.FormatBool(opts.trustMetadata),
+		"sample-verify":           opts.sampleVerifyStr,
+		"merge-security-xattrs":   strconv.FormatBool(opts.mergeSecurityXattrs),
+		"balance-links":           strconv.FormatBool(opts.balanceLinks),
+		"keep-first-listed":       strconv.FormatBool(opts.keepFirstListed),
+		"prefer":                  strings.Join(opts.prefer, ","),
+		"reference":               strings.Join(opts.references, ","),
+		"normalize-paths":         opts.normalizePaths,
+	}
+}
+
+// checkRootStates warns about each root last deduplicated with a different
+// policy and, if verbose, prints when each root was last deduplicated and
+// what that run saved. Unreadable states are skipped.
+func checkRootStates(w io.Writer, dir string, roots []string, policy map[string]string, verbose bool) {
+	if dir == "" {
+		return
+	}
+	for _, root := range roots {
+		state, err := rootstate.Load(dir, root)
+		if err != nil || state == nil {
+			continue
+		}
+		when := state.Time.Local().Format(time.DateTime)
+		if verbose {
+			_, _ = fmt.Fprintf(w, "%s: last deduplicated %s, %d replaced, %s saved\n",
+				root, when, state.Replaced, humanize.IBytes(uint64(state.BytesSaved)))
+		}
+		for _, flag := range state.Conflicts(policy) {
+			_, _ = fmt.Fprintf(w, "warning: %s was last deduplicated %s with --%s=%q, now %q\n",
+				root, when, flag, state.Policy[flag], policy[flag])
+		}
+	}
+}
+
+// saveRootStates records the run on each root: when, with which policy, and
+// the replacements made below it. Failing to save is a warning.
+func saveRootStates(w io.Writer, dir string, roots []string, policy map[string]string, results []*deduper.DedupeResult) {
+	if dir == "" {
+		return
+	}
+	now := time.Now()
+	states := make(map[string]*rootstate.State, len(roots))
+	for _, root := range roots {
+		states[root] = &rootstate.State{Root: root, Time: now, Policy: policy}
+	}
+	for _, r := range results {
+		if !r.Action.Replaced() {
+			continue
+		}
+		// The longest root containing the target, for nested roots
+		var owner *rootstate.State
+		for _, root := range roots {
+			if underAny(r.Target, []string{root}) && (owner == nil || len(root) > len(owner.Root)) {
+				owner = states[root]
+			}
+		}
+		if owner != nil {
+			owner.Replaced++
+			owner.BytesSaved += r.BytesSaved
+		}
+	}
+	for _, root := range roots {
+		if err := rootstate.Save(dir, states[root]); err != nil {
+			_, _ = fmt.Fprintf(w, "warning: save state of %s: %v\n", root, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+)
+
+// runSummary is the machine-readable end-of-run summary written by
+// --summary-file and posted by --notify-url. Counters of phases that did not run stay zero.
+type runSummary struct {
+	DryRun       bool           `json:"dryRun"`
+	Aborted      bool           `json:"aborted"`          // Stopped by --max-errors
+	TimedOut     bool           `json:"timeLimitReached"` // Stopped by --max-runtime
+	Interrupted  bool           `json:"interrupted"`      // Aborted by SIGINT or SIGTERM
+	Seconds      float64        `json:"seconds"`
+	Phases       []phaseStats   `json:"phases"`
+	Files        summaryFiles   `json:"files"`
+	Bytes        summaryBytes   `json:"bytes"`
+	CacheHitRate float64        `json:"cacheHitRate"`    // Share of hashed bytes served from the cache
+	Errors       map[string]int `json:"errors"`          // Errors by reason code
+	Skipped      map[string]int `json:"skipped"`         // Targets not replaced, by reason code
+	Error        string         `json:"error,omitempty"` // Why the run failed
+
+	start      time.Time
+	phaseStart time.Time
+}
+
+// phaseStats is the wall-clock duration of one pipeline phase and what it
+// produced (see phaseUnits).
+type phaseStats struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Items   int64   `json:"items"`
+	Bytes   int64   `json:"bytes"`
+}
+
+// phaseUnits describes the Items and Bytes of each phase.
+var phaseUnits = map[string][2]string{
+	"scan":   {"files", "scanned"},
+	"screen": {"candidates", "candidates"},
+	"verify": {"duplicates", "read"},
+	"dedupe": {"replaced", "saved"},
+}
+
+type summaryFiles struct {
+	Scanned    int64 `json:"scanned"`
+	Matched    int64 `json:"matched"`
+	Excluded   int64 `json:"excluded"` // Scanned but matching --exclude
+	TooSmall   int64 `json:"tooSmall"` // Scanned but below --min-size
+	Symlinks   int64 `json:"symlinks"` // Skipped, not scanned
+	Special    int64 `json:"special"`  // Devices, FIFOs and sockets skipped, not scanned
+	Candidates int64 `json:"candidates"`
+	Duplicates int64 `json:"duplicates"` // Excluding one copy per set
+	Replaced   int64 `json:"replaced"`
+	Skipped    int64 `json:"skipped"`
+}
+
+type summaryBytes struct {
+	Scanned    int64 `json:"scanned"`
+	Matched    int64 `json:"matched"`
+	Excluded   int64 `json:"excluded"`
+	TooSmall   int64 `json:"tooSmall"`
+	Candidates int64 `json:"candidates"`
+	Verified   int64 `json:"verified"`   // Read and hashed
+	Cached     int64 `json:"cached"`     // Hashes taken from the cache
+	Eliminated int64 `json:"eliminated"` // Never read thanks to early elimination
+	Duplicates int64 `json:"duplicates"` // Allocated size, excluding one copy per set
+	Saved      int64 `json:"saved"`
+}
+
+// newRunSummary starts timing a run.
+func newRunSummary(dryRun bool) *runSummary {
+	now := time.Now()
+	return &runSummary{DryRun: dryRun, Errors: map[string]int{}, Skipped: map[string]int{}, start: now, phaseStart: now}
+}
+
+// phase records the time since the previous phase ended as phase name,
+// with the items and bytes it produced.
+func (s *runSummary) phase(name string, items, bytes int64) {
+	now := time.Now()
+	s.Phases = append(s.Phases, phaseStats{Name: name, Seconds: now.Sub(s.phaseStart).Seconds(), Items: items, Bytes: bytes})
+	s.phaseStart = now
+}
+
+// printPhases writes the per-phase breakdown (--verbose) to w, so users can
+// see whether scanning, hashing or linking dominated the run.
+func (s *runSummary) printPhases(w io.Writer) {
+	if len(s.Phases) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "Phases (%.1fs total):\n", time.Since(s.start).Seconds())
+	for _, p := range s.Phases {
+		units := phaseUnits[p.Name]
+		rate := ""
+		if p.Seconds > 0 {
+			rate = fmt.Sprintf(", %s/s", humanize.IBytes(uint64(float64(p.Bytes)/p.Seconds)))
+		}
+		_, _ = fmt.Fprintf(w, "  %-6s %8.2fs  %d %s, %s %s%s\n", p.Name, p.Seconds,
+			p.Items, units[0], humanize.IBytes(uint64(p.Bytes)), units[1], rate)
+	}
+}
+
+// scanned records the scanner's totals.
+func (s *runSummary) scanned(st scanner.Stats) {
+	s.Files.Scanned, s.Bytes.Scanned = st.ScannedFiles, st.ScannedBytes
+	s.Files.Matched, s.Bytes.Matched = st.MatchedFiles, st.MatchedBytes
+	s.Files.Excluded, s.Bytes.Excluded = st.ExcludedFiles, st.ExcludedBytes
+	s.Files.TooSmall, s.Bytes.TooSmall = st.SmallFiles, st.SmallBytes
+	s.Files.Symlinks, s.Files.Special = st.Symlinks, st.Special
+}
+
+// screened records the candidate files.
+func (s *runSummary) screened(candidates types.CandidateGroups) {
+	for _, group := range candidates.Items() {
+		for _, siblings := range group.Items() {
+			s.Files.Candidates += int64(siblings.Len())
+			s.Bytes.Candidates += siblings.First().Size * int64(siblings.Len())
+		}
+	}
+}
+
+// verified records the verifier's totals.
+func (s *runSummary) verified(st verifier.Stats) {
+	s.Bytes.Verified, s.Bytes.Cached, s.Bytes.Eliminated = st.VerifiedBytes, st.CachedBytes, st.SkippedBytes
+	if hashed := st.VerifiedBytes + st.CachedBytes; hashed > 0 {
+		s.CacheHitRate = float64(st.CachedBytes) / float64(hashed)
+	}
+}
+
+// confirmed records the confirmed duplicates.
+func (s *runSummary) confirmed(duplicates types.DuplicateGroups) {
+	for _, group := range duplicates.Items() {
+		for _, siblings := range group.Items()[1:] {
+			s.Files.Duplicates += int64(siblings.Len())
+			s.Bytes.Duplicates += siblings.First().DiskUsage()
+		}
+	}
+}
+
+// deduped records the deduper's results.
+func (s *runSummary) deduped(results []*deduper.DedupeResult) {
+	for _, r := range results {
+		switch {
+		case r.Action.Replaced():
+			s.Files.Replaced++
+			s.Bytes.Saved += r.BytesSaved
+		case r.Action == deduper.ActionSkipped:
+			s.Files.Skipped++
+			s.Skipped[r.Reason.String()]++
+		}
+	}
+}
+
+// finish completes the summary with the run's duration, errors, and the
+// error the run failed with, if any. Call it once, after errLog is closed.
+func (s *runSummary) finish(errLog *errorLog, runErr error) {
+	s.Seconds = time.Since(s.start).Seconds()
+	s.Aborted = errLog.aborted.Load()
+	s.TimedOut = errLog.timedOut.Load()
+	s.Interrupted = errLog.interrupted.Load()
+	for _, e := range errLog.errs {
+		s.Errors[e.Reason.String()]++
+	}
+	if runErr != nil {
+		s.Error = runErr.Error()
+	}
+}
+
+// marshal returns the summary as indented JSON.
+func (s *runSummary) marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// write writes the finished summary as JSON to path ("-" for stdout).
+func (s *runSummary) write(path string) error {
+	data, err := s.marshal()
+	if err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(path, data, 0o644) //nolint:gosec // not secret
+	}
+	if err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	return nil
+}
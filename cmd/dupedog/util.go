@@ -1,10 +1,21 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/mounts"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/types"
 )
 
 // parseSize parses a human-readable size string into bytes.
@@ -17,6 +28,31 @@ func parseSize(s string) (int64, error) {
 	return int64(bytes), nil
 }
 
+// parseMinSizeFor parses PATH=SIZE overrides into absolute paths and byte counts.
+// The size is taken after the last "=", so paths may contain "=".
+func parseMinSizeFor(specs []string) (map[string]int64, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	minSizes := make(map[string]int64, len(specs))
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q: expected PATH=SIZE", spec)
+		}
+		size, err := parseSize(spec[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", spec, err)
+		}
+		path, err := filepath.Abs(spec[:i])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", spec, err)
+		}
+		minSizes[path] = size
+	}
+	return minSizes, nil
+}
+
 // validateGlobPatterns checks that all patterns are valid filepath.Match patterns.
 func validateGlobPatterns(patterns []string) error {
 	for _, pattern := range patterns {
@@ -26,3 +62,252 @@ func validateGlobPatterns(patterns []string) error {
 	}
 	return nil
 }
+
+// scanExcludes returns the exclude patterns passed to the scanner: the user's
+// patterns, plus snapshot directories unless includeSnapshots is set, plus
+// the layer directories of mounted overlays below roots unless
+// includeOverlayLayers is set.
+func scanExcludes(excludes, roots []string, includeSnapshots, includeOverlayLayers bool) []string {
+	patterns := append([]string(nil), excludes...)
+	if !includeSnapshots {
+		patterns = append(patterns, scanner.SnapshotExcludes...)
+	}
+	return append(patterns, overlayExcludes(roots, mounts.Overlays(), includeOverlayLayers, os.Stderr)...)
+}
+
+// overlayExcludes returns exclude patterns (absolute paths, which the scanner
+// matches exactly) for the merged views and layer directories of overlays
+// below roots, and warns on w about roots that are inside either.
+// Linking in the merged view copies files up into the upper layer instead of
+// saving space, and linking inside layers changes every container using them.
+func overlayExcludes(roots []string, overlays []mounts.Overlay, includeLayers bool, w io.Writer) []string {
+	var patterns []string
+	for _, o := range overlays {
+		for _, root := range roots {
+			if underAny(root, []string{o.Point}) {
+				_, _ = fmt.Fprintf(w, "warning: %s is on overlayfs mounted at %s; replaced files are copied up into its upper layer\n", root, o.Point)
+			}
+		}
+		for _, dir := range append(o.Layers(), o.Point) {
+			for _, root := range roots {
+				switch {
+				case dir != o.Point && underAny(root, []string{dir}):
+					_, _ = fmt.Fprintf(w, "warning: %s is inside overlayfs layer %s of %s; changes show through the mounted overlay\n", root, dir, o.Point)
+				case isUnderDir(dir, root) && !includeLayers && !slices.Contains(patterns, escapeGlob(dir)):
+					patterns = append(patterns, escapeGlob(dir))
+				}
+			}
+		}
+	}
+	return patterns
+}
+
+// bindMountViews drops roots that show, through a bind mount, a directory
+// another root already covers, and returns exclude patterns for bind mounts
+// below roots that show such a directory, warning on w about each. Scanning a
+// directory twice lists every file in it under two paths: dedupe would then
+// "replace" a file with a link to itself. Roots nested by path (and thus on
+// one mount) are left to the screener, which groups their files by inode.
+func bindMountViews(roots []string, entries []mounts.Entry, w io.Writer) (kept, excludes []string) {
+	views := make([]mounts.View, len(roots))
+	known := make([]bool, len(roots))
+	for i, root := range roots {
+		views[i], known[i] = mounts.Origin(entries, root)
+	}
+
+	for j, root := range roots {
+		covering := -1
+		for i := range roots {
+			if i == j || !known[i] || !known[j] || underAny(root, roots[i:i+1]) || underAny(roots[i], roots[j:j+1]) {
+				continue
+			}
+			// Of two roots showing the same directory, the first is kept
+			if views[i].Contains(views[j]) && (views[i] != views[j] || i < j) {
+				covering = i
+				break
+			}
+		}
+		if covering < 0 {
+			kept = append(kept, root)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "warning: %s is a bind mount of a directory also scanned under %s; skipping it\n", root, roots[covering])
+	}
+
+	for _, e := range entries {
+		if slices.Contains(kept, e.Point) || !slices.ContainsFunc(kept, func(root string) bool { return isUnderDir(e.Point, root) }) {
+			continue
+		}
+		view, _ := mounts.Origin(entries, e.Point)
+		if view != (mounts.View{Dev: e.Dev, Path: e.Root}) || slices.Contains(excludes, escapeGlob(e.Point)) {
+			continue // Mounted over, or already excluded
+		}
+		for _, root := range kept {
+			if v, ok := mounts.Origin(entries, root); ok && v.Contains(view) {
+				_, _ = fmt.Fprintf(w, "warning: %s is a bind mount of a directory also scanned under %s; skipping it\n", e.Point, root)
+				excludes = append(excludes, escapeGlob(e.Point))
+				break
+			}
+		}
+	}
+	return kept, excludes
+}
+
+// escapeGlob escapes filepath.Match metacharacters so s matches literally.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// validateWorkers rejects negative --workers, --scan-workers and --hash-workers.
+func validateWorkers(workers, scan, hash int) error {
+	switch {
+	case workers < 0:
+		return fmt.Errorf("invalid --workers: must not be negative")
+	case scan < 0:
+		return fmt.Errorf("invalid --scan-workers: must not be negative")
+	case hash < 0:
+		return fmt.Errorf("invalid --hash-workers: must not be negative")
+	}
+	return nil
+}
+
+// validateTmpFlags rejects a --tmp-suffix that names another directory or
+// lacks the dupedog marker (cleanup would take other files for temporary
+// links), a non-positive --orphan-age, and a --staging-dir that is
+// absolute or leaves the filesystem's top directory.
+func validateTmpFlags(suffix, stagingDir string, orphanAge time.Duration) error {
+	switch {
+	case strings.Contains(suffix, "/"):
+		return fmt.Errorf("invalid --tmp-suffix: must not contain /")
+	case !strings.Contains(suffix, deduper.TmpMarker):
+		return fmt.Errorf("invalid --tmp-suffix: must contain %q", deduper.TmpMarker)
+	case orphanAge <= 0:
+		return fmt.Errorf("invalid --orphan-age: must be positive")
+	case stagingDir == "":
+		return nil
+	case filepath.IsAbs(stagingDir):
+		return fmt.Errorf("invalid --staging-dir: must be relative to the top of each filesystem")
+	case !filepath.IsLocal(stagingDir):
+		return fmt.Errorf("invalid --staging-dir: must stay below the top of each filesystem")
+	}
+	return nil
+}
+
+// scanWorkers returns --scan-workers, else --workers, else the default: listing
+// directories is latency-bound, so walking keeps more reads in flight than CPUs.
+func scanWorkers(scan, workers int) int {
+	return cmp.Or(scan, workers, 4*runtime.NumCPU())
+}
+
+// hashWorkers returns --hash-workers, else --workers, else the default for the
+// files in groups: hashing is bandwidth-bound, so a few readers per device
+// saturate it, capped at the CPU count.
+func hashWorkers(hash, workers int, groups types.CandidateGroups) int {
+	if n := cmp.Or(hash, workers); n > 0 {
+		return n
+	}
+	devices := make(map[uint64]struct{})
+	for _, group := range groups.Items() {
+		for _, siblings := range group.Items() {
+			devices[siblings.First().Dev] = struct{}{}
+		}
+	}
+	return max(1, min(runtime.NumCPU(), 4*len(devices)))
+}
+
+// parsePrefer splits --prefer values into a tie-breaker keyword (shortest-path
+// or shallowest) and path priority globs, made absolute in the order given.
+func parsePrefer(values []string) (deduper.Preference, []string, error) {
+	prefer := deduper.PreferDefault
+	var patterns []string
+	for _, v := range values {
+		if p, err := deduper.ParsePreference(v); err == nil && v != "" {
+			if prefer != deduper.PreferDefault && p != prefer {
+				return prefer, nil, fmt.Errorf("conflicting tie-breakers in %q", values)
+			}
+			prefer = p
+			continue
+		}
+		patterns = append(patterns, v)
+	}
+	patterns, err := absGlobs(patterns)
+	return prefer, patterns, err
+}
+
+// absGlobs validates path glob patterns and makes them absolute.
+func absGlobs(patterns []string) ([]string, error) {
+	if err := validateGlobPatterns(patterns); err != nil {
+		return nil, err
+	}
+	if patterns == nil {
+		return nil, nil
+	}
+	return absRoots(patterns)
+}
+
+// protectGlobs validates --protect patterns and normalizes those matched
+// against paths (containing '/') as absGlobs does, so relative patterns and
+// trailing slashes match. Patterns matched against path components keep
+// their form, without trailing slashes.
+func protectGlobs(patterns []string) ([]string, error) {
+	if err := validateGlobPatterns(patterns); err != nil {
+		return nil, err
+	}
+	var normalized []string
+	for _, p := range patterns {
+		if trimmed := strings.TrimRight(p, "/"); trimmed != "" && !strings.Contains(trimmed, "/") {
+			normalized = append(normalized, trimmed)
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, abs)
+	}
+	return normalized, nil
+}
+
+// absRoots converts paths to absolute, cleaned form.
+func absRoots(paths []string) ([]string, error) {
+	roots := make([]string, len(paths))
+	for i, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		roots[i] = abs
+	}
+	return roots, nil
+}
+
+// underAny reports whether path is one of roots or lies beneath one.
+func underAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || isUnderDir(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultCacheFile returns the default hash cache path:
+// $XDG_CACHE_HOME/dupedog/hashes.db, falling back to the OS user cache dir.
+// Returns "" if no cache directory can be determined (caching disabled).
+func defaultCacheFile() string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return ""
+		}
+	}
+	return filepath.Join(dir, "dupedog", "hashes.db")
+}
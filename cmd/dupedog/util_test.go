@@ -1,7 +1,37 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/archives"
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/doctor"
+	"github.com/ivoronin/dupedog/internal/fixlinks"
+	"github.com/ivoronin/dupedog/internal/manifest"
+	"github.com/ivoronin/dupedog/internal/marker"
+	"github.com/ivoronin/dupedog/internal/mounts"
+	"github.com/ivoronin/dupedog/internal/remote"
+	"github.com/ivoronin/dupedog/internal/report"
+	"github.com/ivoronin/dupedog/internal/rootstate"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
 )
 
 // =============================================================================
@@ -177,6 +207,50 @@ func TestParseSizeTerabyte(t *testing.T) {
 	}
 }
 
+// TestParseMinSizeFor tests PATH=SIZE override parsing.
+func TestParseMinSizeFor(t *testing.T) {
+	got, err := parseMinSizeFor([]string{"/photos=1MiB", "/mail/a=b=10"})
+	if err != nil {
+		t.Fatalf("parseMinSizeFor error: %v", err)
+	}
+	want := map[string]int64{"/photos": 1048576, "/mail/a=b": 10}
+	if len(got) != len(want) {
+		t.Fatalf("parseMinSizeFor = %v, want %v", got, want)
+	}
+	for path, size := range want {
+		if got[path] != size {
+			t.Errorf("parseMinSizeFor[%q] = %d, want %d", path, got[path], size)
+		}
+	}
+
+	for _, spec := range []string{"/photos", "=1M", "/photos=big"} {
+		if _, err := parseMinSizeFor([]string{spec}); err == nil {
+			t.Errorf("parseMinSizeFor(%q) expected error", spec)
+		}
+	}
+}
+
+// TestParsePrefer tests that --prefer separates tie-breakers from path globs.
+func TestParsePrefer(t *testing.T) {
+	prefer, patterns, err := parsePrefer([]string{"/archive/**", "shallowest", "/backup/"})
+	if err != nil {
+		t.Fatalf("parsePrefer error: %v", err)
+	}
+	if prefer != deduper.PreferShallowest {
+		t.Errorf("prefer = %d, want PreferShallowest", prefer)
+	}
+	// Patterns keep their order and are canonicalized
+	if len(patterns) != 2 || patterns[0] != "/archive/**" || patterns[1] != "/backup" {
+		t.Errorf("patterns = %q, want [/archive/** /backup]", patterns)
+	}
+
+	for _, values := range [][]string{{"shallowest", "shortest-path"}, {"/data/["}} {
+		if _, _, err := parsePrefer(values); err == nil {
+			t.Errorf("parsePrefer(%q) expected error", values)
+		}
+	}
+}
+
 // =============================================================================
 // Section 7.3: Glob Pattern Validation Tests
 // =============================================================================
@@ -224,3 +298,858 @@ func TestValidateGlobPatternsInvalid(t *testing.T) {
 		})
 	}
 }
+
+// TestProtectGlobs tests that path patterns given to --protect with a
+// trailing slash or relative to the working directory are made absolute,
+// while name patterns are kept.
+func TestProtectGlobs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pattern, want string
+	}{
+		{"/srv/golden/", "/srv/golden"},
+		{"/srv//golden/./", "/srv/golden"},
+		{"srv/golden", filepath.Join(wd, "srv/golden")},
+		{"./golden", filepath.Join(wd, "golden")},
+		{"golden/", "golden"},
+		{"*.sig", "*.sig"},
+		{"/", "/"},
+	}
+	for _, tt := range tests {
+		got, err := protectGlobs([]string{tt.pattern})
+		if err != nil || len(got) != 1 || got[0] != tt.want {
+			t.Errorf("protectGlobs(%q) = %v, %v; want [%s]", tt.pattern, got, err, tt.want)
+		}
+	}
+	if _, err := protectGlobs([]string{"[invalid"}); err == nil {
+		t.Error("protectGlobs([invalid) should return error")
+	}
+}
+
+// =============================================================================
+// Section 7.4: Default Cache Location Tests
+// =============================================================================
+
+// TestDefaultCacheFileXDG tests that XDG_CACHE_HOME is honored.
+func TestDefaultCacheFileXDG(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/var/cache/user")
+
+	want := filepath.Join("/var/cache/user", "dupedog", "hashes.db")
+	if got := defaultCacheFile(); got != want {
+		t.Errorf("defaultCacheFile() = %q, want %q", got, want)
+	}
+}
+
+// TestDefaultCacheFileFallback tests the fallback when XDG_CACHE_HOME is unset.
+func TestDefaultCacheFileFallback(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("HOME", "/home/user")
+
+	got := defaultCacheFile()
+	if filepath.Base(got) != "hashes.db" || filepath.Base(filepath.Dir(got)) != "dupedog" {
+		t.Errorf("defaultCacheFile() = %q, want .../dupedog/hashes.db", got)
+	}
+}
+
+// =============================================================================
+// Section 7.5: Error Summary Tests
+// =============================================================================
+
+// TestSummarizeErrors tests grouping by reason and directory, most frequent first.
+func TestSummarizeErrors(t *testing.T) {
+	denied := func(path string) *types.Event {
+		return types.NewEvent(types.StageScan, path, &fs.PathError{Op: "open", Path: path, Err: syscall.EACCES})
+	}
+	errs := []*types.Event{
+		denied("/var/lib/docker/a"),
+		{Stage: types.StageDedupe, Path: "/data/x", Reason: types.ReasonModified, Err: errors.New("file modified since scan")},
+		denied("/var/lib/docker/b"),
+		denied("/home/c"),
+		{Stage: types.StageVerify, Err: fmt.Errorf("cache store: %w", errors.New("database not open"))},
+	}
+
+	got := summarizeErrors(errs)
+	want := []errorCategory{
+		{reason: "permission denied", dir: "/var/lib/docker", count: 2},
+		{reason: "database not open", dir: "", count: 1},
+		{reason: "modified since scan", dir: "/data", count: 1},
+		{reason: "permission denied", dir: "/home", count: 1},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("summarizeErrors() = %+v, want %+v", got, want)
+	}
+
+	var b strings.Builder
+	printErrorSummary(&b, errs)
+	if !strings.Contains(b.String(), "5 errors:\n  2 permission denied under /var/lib/docker\n") {
+		t.Errorf("printErrorSummary() = %q", b.String())
+	}
+}
+
+// TestWriteErrorsFile tests that every error is written on its own line with
+// its stage and reason code.
+func TestWriteErrorsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.txt")
+	errs := []*types.Event{
+		{Stage: types.StageDedupe, Path: "/a", Reason: types.ReasonLocked, Err: errors.New("file in use")},
+		{Stage: types.StageVerify, Err: errors.New("b\nc")},
+	}
+	if err := writeErrorsFile(path, errs); err != nil {
+		t.Fatalf("writeErrorsFile() failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	want := "dedupe\tlocked\t/a: file in use\nverify\tother\tb\\nc\n"
+	if string(data) != want {
+		t.Errorf("errors file = %q, want %q", data, want)
+	}
+}
+
+// TestErrorLogMaxErrors tests that reaching --max-errors cancels the context
+// and makes close report the abort.
+func TestErrorLogMaxErrors(t *testing.T) {
+	l := newErrorLog("", 2, 0)
+	l.ch <- types.NewEvent(types.StageScan, "/a", errors.New("x"))
+	if err := l.ctx.Err(); err != nil {
+		t.Fatalf("ctx canceled after 1 error: %v", err)
+	}
+	l.ch <- types.NewEvent(types.StageScan, "/b", errors.New("x"))
+	<-l.ctx.Done() // Canceled once the second error is drained
+
+	if err := l.close(); err == nil || !strings.Contains(err.Error(), "--max-errors") {
+		t.Errorf("close() = %v, want --max-errors abort", err)
+	}
+}
+
+// TestErrorLogUnlimited tests that without --max-errors the run is never aborted.
+func TestErrorLogUnlimited(t *testing.T) {
+	l := newErrorLog("", 0, 0)
+	for range 3 {
+		l.ch <- types.NewEvent(types.StageScan, "/a", errors.New("x"))
+	}
+	if err := l.close(); err != nil {
+		t.Errorf("close() = %v, want nil", err)
+	}
+}
+
+// TestErrorLogMaxRuntime tests that reaching --max-runtime cancels the context
+// and makes close return errTimeLimit.
+func TestErrorLogMaxRuntime(t *testing.T) {
+	l := newErrorLog("", 0, 10*time.Millisecond)
+	<-l.ctx.Done()
+
+	if err := l.close(); !errors.Is(err, errTimeLimit) {
+		t.Errorf("close() = %v, want errTimeLimit", err)
+	}
+}
+
+// TestErrorLogInterrupt tests that SIGTERM cancels the context and makes
+// close report the run as aborted.
+func TestErrorLogInterrupt(t *testing.T) {
+	l := newErrorLog("", 0, 0)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	<-l.ctx.Done()
+
+	if err := l.close(); err == nil || !l.interrupted.Load() {
+		t.Errorf("close() = %v, interrupted = %v; want an error and true", err, l.interrupted.Load())
+	}
+}
+
+// =============================================================================
+// Section 7.6: Explain Tests
+// =============================================================================
+
+// TestPipelineTraceExplain tests the stage reported for files that fell out
+// after the scan.
+func TestPipelineTraceExplain(t *testing.T) {
+	single := &types.FileInfo{Path: "/d/single", Size: 10, Ino: 1}
+	link1 := &types.FileInfo{Path: "/d/link1", Size: 20, Ino: 2}
+	link2 := &types.FileInfo{Path: "/d/link2", Size: 20, Ino: 2}
+	src := &types.FileInfo{Path: "/d/src", Size: 30, Ino: 3}
+	dup := &types.FileInfo{Path: "/d/dup", Size: 30, Ino: 4}
+
+	group := types.NewCandidateGroup([]types.SiblingGroup{
+		types.NewSiblingGroup([]*types.FileInfo{src}),
+		types.NewSiblingGroup([]*types.FileInfo{dup}),
+	})
+	trace := &pipelineTrace{
+		files:      []*types.FileInfo{single, link1, link2, src, dup},
+		candidates: types.NewCandidateGroups([]types.CandidateGroup{group}),
+		duplicates: types.NewDuplicateGroups([]types.DuplicateGroup{group}),
+		results:    []*deduper.DedupeResult{{Source: src.Path, Target: dup.Path, Action: deduper.ActionHardlink}},
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{single.Path, "screen: no other file of size 10"},
+		{link1.Path, "screen: every other file of size 20 is a hardlink to it"},
+		{src.Path, "dedupe: kept as source for 1 files"},
+		{dup.Path, "dedupe: Replaced /d/dup with hardlink to /d/src"},
+	}
+	for _, tt := range tests {
+		if got := trace.explain(tt.path); got != tt.want {
+			t.Errorf("explain(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// =============================================================================
+// Section 7.7: Compare Tests
+// =============================================================================
+
+// TestRunCompare tests identical, differing and missing files.
+func TestRunCompare(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	a := write("a", "hello world")
+	b := write("b", "hello world")
+	c := write("c", "hello there")
+	d := write("d", "hello")
+
+	tests := []struct {
+		name          string
+		path1, path2  string
+		wantIdentical bool
+		wantOutput    string
+	}{
+		{"identical", a, b, true, "are identical (11 bytes)"},
+		{"same inode", a, a, true, "are identical: same inode"},
+		{"content differs", a, c, false, "differ: head [0, 11) at byte 6"},
+		{"size differs", a, d, false, "differ: size 11 vs 5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			identical, err := runCompare(tt.path1, tt.path2, &out)
+			if err != nil {
+				t.Fatalf("runCompare() failed: %v", err)
+			}
+			if identical != tt.wantIdentical || !strings.Contains(out.String(), tt.wantOutput) {
+				t.Errorf("runCompare() = %v, %q; want %v, %q", identical, out.String(), tt.wantIdentical, tt.wantOutput)
+			}
+		})
+	}
+
+	if _, err := runCompare(a, filepath.Join(root, "missing"), io.Discard); err == nil {
+		t.Error("runCompare() with missing file should return error")
+	}
+}
+
+// TestCompareExitStatus tests that usage and I/O errors exit with status 2,
+// like cmp.
+func TestCompareExitStatus(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "a")
+	if err := os.WriteFile(a, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{a}, {a, a, a}, {"--bogus", a, a}, {a, filepath.Join(root, "missing")}} {
+		cmd := newCompareCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		var status exitStatus
+		if err := cmd.Execute(); !errors.As(err, &status) || status != 2 {
+			t.Errorf("compare %v = %v, want exit status 2", args, err)
+		}
+	}
+}
+
+// =============================================================================
+// Section 7.8: NUL-Delimited Output Tests
+// =============================================================================
+
+// TestPrintPaths0 tests that only replaced targets are printed, NUL-terminated.
+func TestPrintPaths0(t *testing.T) {
+	results := []*deduper.DedupeResult{
+		{Source: "/a", Target: "/b", Action: deduper.ActionHardlink},
+		{Source: "/a", Target: "/c\nd", Action: deduper.ActionSymlink},
+		{Source: "/a", Target: "/e", Action: deduper.ActionSkipped, Err: errors.New("locked")},
+		{Source: "/a", Target: "/f", Action: deduper.ActionReflinked},
+	}
+
+	var out strings.Builder
+	printPaths0(&out, results)
+	if want := "/b\x00/c\nd\x00"; out.String() != want {
+		t.Errorf("printPaths0() = %q, want %q", out.String(), want)
+	}
+}
+
+// =============================================================================
+// Section 7.9: Worker Count Tests
+// =============================================================================
+
+// TestWorkerCounts tests that per-stage flags override --workers, which
+// overrides the CPU- and device-derived defaults.
+func TestWorkerCounts(t *testing.T) {
+	if got := scanWorkers(3, 5); got != 3 {
+		t.Errorf("scanWorkers(3, 5) = %d, want 3", got)
+	}
+	if got := scanWorkers(0, 5); got != 5 {
+		t.Errorf("scanWorkers(0, 5) = %d, want 5", got)
+	}
+	if got := scanWorkers(0, 0); got != 4*runtime.NumCPU() {
+		t.Errorf("scanWorkers(0, 0) = %d, want %d", got, 4*runtime.NumCPU())
+	}
+
+	groups := types.NewCandidateGroups([]types.CandidateGroup{
+		types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{{Path: "/a", Dev: 1, Ino: 1}}),
+			types.NewSiblingGroup([]*types.FileInfo{{Path: "/b", Dev: 1, Ino: 2}}),
+		}),
+	})
+	if got := hashWorkers(2, 5, groups); got != 2 {
+		t.Errorf("hashWorkers(2, 5) = %d, want 2", got)
+	}
+	if got := hashWorkers(0, 5, groups); got != 5 {
+		t.Errorf("hashWorkers(0, 5) = %d, want 5", got)
+	}
+	if want := min(runtime.NumCPU(), 4); hashWorkers(0, 0, groups) != want {
+		t.Errorf("hashWorkers(0, 0) on one device = %d, want %d", hashWorkers(0, 0, groups), want)
+	}
+	if got := hashWorkers(0, 0, types.NewCandidateGroups(nil)); got != 1 {
+		t.Errorf("hashWorkers(0, 0) without files = %d, want 1", got)
+	}
+
+	if err := validateWorkers(0, -1, 0); err == nil || !strings.Contains(err.Error(), "--scan-workers") {
+		t.Errorf("validateWorkers() = %v, want --scan-workers error", err)
+	}
+}
+
+// =============================================================================
+// Section 7.10: Overlayfs Tests
+// =============================================================================
+
+// TestOverlayExcludes tests that merged views and layers below the roots are
+// excluded, and that roots on or inside an overlay are warned about.
+func TestOverlayExcludes(t *testing.T) {
+	overlays := []mounts.Overlay{{
+		Point: "/var/lib/docker/overlay2/abc/merged",
+		Lower: []string{"/var/lib/docker/overlay2/l/X", "/var/lib/docker/overlay2/l/Y"},
+		Upper: "/var/lib/docker/overlay2/abc/diff",
+		Work:  "/var/lib/docker/overlay2/abc/work",
+	}}
+
+	var w strings.Builder
+	got := overlayExcludes([]string{"/var/lib/docker", "/home"}, overlays, false, &w)
+	want := []string{
+		"/var/lib/docker/overlay2/l/X", "/var/lib/docker/overlay2/l/Y", "/var/lib/docker/overlay2/abc/diff",
+		"/var/lib/docker/overlay2/abc/work", "/var/lib/docker/overlay2/abc/merged",
+	}
+	if !slices.Equal(got, want) || w.Len() != 0 {
+		t.Errorf("overlayExcludes() = %v, warnings %q; want %v and no warnings", got, w.String(), want)
+	}
+
+	if got := overlayExcludes([]string{"/var/lib/docker"}, overlays, true, io.Discard); len(got) != 0 {
+		t.Errorf("overlayExcludes(includeLayers) = %v, want none", got)
+	}
+
+	w.Reset()
+	overlayExcludes([]string{"/var/lib/docker/overlay2/abc/merged/etc", "/var/lib/docker/overlay2/l/X"}, overlays, false, &w)
+	if !strings.Contains(w.String(), "copied up") || !strings.Contains(w.String(), "inside overlayfs layer") {
+		t.Errorf("warnings = %q, want a merged-view and a layer warning", w.String())
+	}
+
+	if got := escapeGlob("/a/b[1]*"); got != `/a/b\[1]\*` {
+		t.Errorf("escapeGlob() = %q", got)
+	}
+}
+
+// =============================================================================
+// Section 7.11: Run Summary Tests
+// =============================================================================
+
+// TestRunSummary tests that the summary counts replacements, skips by reason,
+// errors by reason and the cache hit rate, and is written as JSON.
+func TestRunSummary(t *testing.T) {
+	s := newRunSummary(true)
+	s.phase("scan", 3, 300)
+	s.verified(verifier.Stats{VerifiedBytes: 300, CachedBytes: 100})
+	s.deduped([]*deduper.DedupeResult{
+		{Action: deduper.ActionHardlink, BytesSaved: 4096},
+		{Action: deduper.ActionSkipped, Reason: types.ReasonLocked},
+		{Action: deduper.ActionReflinked},
+	})
+
+	errLog := newErrorLog("", 0, 0)
+	errLog.ch <- &types.Event{Stage: types.StageDedupe, Reason: types.ReasonLocked, Err: errors.New("locked")}
+	_ = errLog.close()
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	s.finish(errLog, nil)
+	if err := s.write(path); err != nil {
+		t.Fatalf("write() failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runSummary
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("summary is not valid JSON: %v", err)
+	}
+
+	if !got.DryRun || len(got.Phases) != 1 || got.Phases[0].Name != "scan" {
+		t.Errorf("dryRun = %v, phases = %v; want true and [scan]", got.DryRun, got.Phases)
+	} else if got.Phases[0].Items != 3 || got.Phases[0].Bytes != 300 {
+		t.Errorf("scan phase = %+v, want 3 items and 300 bytes", got.Phases[0])
+	}
+
+	var out strings.Builder
+	s.printPhases(&out)
+	if !strings.Contains(out.String(), "3 files, 300 B scanned") {
+		t.Errorf("printPhases() = %q, want the scan phase's files and bytes", out.String())
+	}
+	if got.Files.Replaced != 1 || got.Files.Skipped != 1 || got.Bytes.Saved != 4096 {
+		t.Errorf("files = %+v, saved = %d; want 1 replaced, 1 skipped, 4096 saved", got.Files, got.Bytes.Saved)
+	}
+	if got.Skipped["locked"] != 1 || got.Errors["locked"] != 1 || got.CacheHitRate != 0.25 {
+		t.Errorf("skipped = %v, errors = %v, cacheHitRate = %v", got.Skipped, got.Errors, got.CacheHitRate)
+	}
+}
+
+// =============================================================================
+// Section 7.12: Profiling Tests
+// =============================================================================
+
+// TestStartProfiling tests that the requested profiles are written when
+// profiling stops, and that a bad --pprof-addr is rejected.
+func TestStartProfiling(t *testing.T) {
+	dir := t.TempDir()
+	opts := profileOptions{
+		pprofAddr:  "127.0.0.1:0",
+		cpuProfile: filepath.Join(dir, "cpu.out"),
+		memProfile: filepath.Join(dir, "mem.out"),
+		traceFile:  filepath.Join(dir, "trace.out"),
+	}
+	stop, err := startProfiling(opts)
+	if err != nil {
+		t.Fatalf("startProfiling() failed: %v", err)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("stop() failed: %v", err)
+	}
+	for _, path := range []string{opts.cpuProfile, opts.memProfile, opts.traceFile} {
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("%s: want a non-empty profile, got %v", filepath.Base(path), err)
+		}
+	}
+
+	if _, err := startProfiling(profileOptions{pprofAddr: "bad address"}); err == nil {
+		t.Error("startProfiling() should reject an invalid --pprof-addr")
+	}
+}
+
+// =============================================================================
+// Section 7.13: Bind Mount Tests
+// =============================================================================
+
+// TestBindMountViews tests that a root showing a directory another root covers
+// is dropped, that bind mounts below roots showing such a directory are
+// excluded, and that roots nested by path are kept.
+func TestBindMountViews(t *testing.T) {
+	entries := []mounts.Entry{
+		{Dev: 1, Root: "/", Point: "/"},
+		{Dev: 2, Root: "/", Point: "/volume1"},
+		{Dev: 2, Root: "/photos", Point: "/mnt/photos"},            // View of /volume1/photos
+		{Dev: 2, Root: "/photos", Point: "/volume1/backup/photos"}, // Same, inside /volume1
+		{Dev: 3, Root: "/", Point: "/volume1/usb"},                 // Another filesystem
+	}
+
+	var w strings.Builder
+	kept, excludes := bindMountViews([]string{"/volume1", "/mnt/photos", "/volume1/docs"}, entries, &w)
+	if want := []string{"/volume1", "/volume1/docs"}; !slices.Equal(kept, want) {
+		t.Errorf("kept = %v, want %v", kept, want)
+	}
+	if want := []string{"/volume1/backup/photos"}; !slices.Equal(excludes, want) {
+		t.Errorf("excludes = %v, want %v", excludes, want)
+	}
+	if got := strings.Count(w.String(), "bind mount"); got != 2 {
+		t.Errorf("warnings = %q, want 2", w.String())
+	}
+
+	// The first of two roots showing the same directory is kept
+	kept, _ = bindMountViews([]string{"/mnt/photos", "/volume1/photos"}, entries, io.Discard)
+	if want := []string{"/mnt/photos"}; !slices.Equal(kept, want) {
+		t.Errorf("kept = %v, want %v", kept, want)
+	}
+
+	// Without a mount table, nothing is dropped
+	kept, excludes = bindMountViews([]string{"/a", "/b"}, nil, io.Discard)
+	if !slices.Equal(kept, []string{"/a", "/b"}) || len(excludes) != 0 {
+		t.Errorf("bindMountViews(no entries) = %v, %v", kept, excludes)
+	}
+}
+
+// =============================================================================
+// Section 7.14: Archive Tests
+// =============================================================================
+
+// TestPrintArchiveMatches tests the archives report lines and total.
+func TestPrintArchiveMatches(t *testing.T) {
+	var b strings.Builder
+	printArchiveMatches(&b, []archives.Match{
+		{Member: archives.Member{Archive: "/d/b.tgz", Name: "x/a.jpg", Size: 2048}, Files: []string{"/d/a.jpg", "/e/a.jpg"}},
+		{Member: archives.Member{Archive: "/d/c.zip", Name: "n.txt", Size: 1024}, Files: []string{"/d/n.txt"}},
+	})
+	want := `/d/b.tgz: x/a.jpg (2.0 KiB) duplicates /d/a.jpg, /e/a.jpg
+/d/c.zip: n.txt (1.0 KiB) duplicates /d/n.txt
+2 archive members (3.0 KiB) duplicate loose files
+`
+	if b.String() != want {
+		t.Errorf("printArchiveMatches() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// =============================================================================
+// Section 7.15: Fix Links Tests
+// =============================================================================
+
+// TestPrintFixes tests the fix-links output lines and the count of links left.
+func TestPrintFixes(t *testing.T) {
+	var b strings.Builder
+	left := printFixes(&b, []fixlinks.Fix{
+		{Link: "/b/x", Source: "/c/x", Status: fixlinks.StatusRepaired},
+		{Link: "/b/y", Status: fixlinks.StatusNoRecord},
+		{Link: "/b/z", Source: "/a/z", Status: fixlinks.StatusNoMatch},
+	}, true)
+	want := `would repair /b/x -> /c/x
+/b/y: not recorded in the reports, fix by hand
+/b/z: no file with the content of /a/z found, fix by hand
+`
+	if b.String() != want || left != 2 {
+		t.Errorf("printFixes() = %d,\n%s\nwant 2,\n%s", left, b.String(), want)
+	}
+}
+
+// =============================================================================
+// Section 7.16: Doctor Tests
+// =============================================================================
+
+// TestPrintDoctor tests the capability matrix and the notes below it.
+func TestPrintDoctor(t *testing.T) {
+	var b strings.Builder
+	failed := printDoctor(&b, []doctor.Result{
+		{Path: "/a", FSType: "ext4", Hardlink: doctor.Check{OK: true}, Reflink: doctor.Check{Err: syscall.EOPNOTSUPP},
+			MaxLinks: 65000, CaseSensitive: doctor.Check{OK: true}, Flock: doctor.Check{OK: true}},
+		{Path: "/b", Err: fs.ErrNotExist},
+	})
+	want := `PATH  FSTYPE  HARDLINK  REFLINK  MAX LINKS  CASE-SENSITIVE  FLOCK
+/a    ext4    yes       no       65000      yes             yes
+/b    ?       -         -        -          -               -
+/a: reflink: operation not supported
+/b: cannot probe: file does not exist
+`
+	if b.String() != want || failed != 1 {
+		t.Errorf("printDoctor() = %d,\n%s\nwant 1,\n%s", failed, b.String(), want)
+	}
+}
+
+// =============================================================================
+// Section 7.17: Histogram Tests
+// =============================================================================
+
+// TestPrintHistogram tests the size buckets, savings and the share kept at or
+// above each bucket.
+func TestPrintHistogram(t *testing.T) {
+	group := func(size int64, copies int) types.DuplicateGroup {
+		var siblings []types.SiblingGroup
+		for i := range copies {
+			f := &types.FileInfo{Path: fmt.Sprintf("/%d/%d", size, i), Size: size, Blocks: size / 512, Ino: uint64(i)}
+			siblings = append(siblings, types.NewSiblingGroup([]*types.FileInfo{f}))
+		}
+		return types.NewDuplicateGroup(siblings)
+	}
+	var b strings.Builder
+	printHistogram(&b, types.NewDuplicateGroups([]types.DuplicateGroup{
+		group(512, 2), group(1<<20, 3), group(2<<20, 2), group(1<<30, 2),
+	}))
+	want := `Duplicates by file size:
+     SIZE  GROUPS  SAVINGS  AT OR ABOVE
+      <1K       1    512 B       100.0%
+    1K-1M       0      0 B       100.0%
+  1M-100M       2  4.0 MiB       100.0%
+    >100M       1  1.0 GiB        99.6%
+`
+	if b.String() != want {
+		t.Errorf("printHistogram() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// =============================================================================
+// Section 7.18: Webhook Notification Tests
+// =============================================================================
+
+// TestNotifierSend tests that the summary is posted with an HMAC signature
+// and that server errors are retried.
+func TestNotifierSend(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int
+	var body []byte
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Dupedog-Signature")
+	}))
+	defer srv.Close()
+
+	n, err := newNotifier(srv.URL, secretFile, 1)
+	if err != nil {
+		t.Fatalf("newNotifier() failed: %v", err)
+	}
+	n.backoff = time.Millisecond
+
+	s := newRunSummary(false)
+	errLog := newErrorLog("", 0, 0)
+	_ = errLog.close()
+	s.finish(errLog, errors.New("boom"))
+	if err := n.send(s); err != nil {
+		t.Fatalf("send() failed: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+	var got runSummary
+	if err := json.Unmarshal(body, &got); err != nil || got.Error != "boom" {
+		t.Errorf("posted summary = %s, %v; want error boom", body, err)
+	}
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+
+	// Client errors are not retried
+	attempts = 0
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	if err := n.send(s); err == nil || attempts != 1 {
+		t.Errorf("send() = %v after %d attempts, want an error after 1", err, attempts)
+	}
+}
+
+func TestNewNotifierInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		url, secretFile string
+		retries         int
+	}{
+		{"", "secret", 3},
+		{"ftp://example.com", "", 3},
+		{"https://", "", 3},
+		{"https://example.com", "", -1},
+		{"https://example.com", "/nonexistent/secret", 3},
+	} {
+		if _, err := newNotifier(tc.url, tc.secretFile, tc.retries); err == nil {
+			t.Errorf("newNotifier(%q, %q, %d) should return error", tc.url, tc.secretFile, tc.retries)
+		}
+	}
+	if n, err := newNotifier("", "", 3); n != nil || err != nil {
+		t.Errorf("newNotifier(\"\") = %v, %v; want nil, nil", n, err)
+	}
+}
+
+// =============================================================================
+// Section 7.19: Root State Tests
+// =============================================================================
+
+// TestRootStates tests that replacements are recorded under the longest root
+// containing them and that a later run with another policy is warned about.
+func TestRootStates(t *testing.T) {
+	dir := t.TempDir()
+	roots := []string{"/data", "/data/photos", "/backup"}
+	policy := dedupePolicy(&dedupeOptions{action: "hardlink", sampleVerifyStr: "0"})
+	saveRootStates(io.Discard, dir, roots, policy, []*deduper.DedupeResult{
+		{Target: "/data/a", Action: deduper.ActionHardlink, BytesSaved: 100},
+		{Target: "/data/photos/b", Action: deduper.ActionHardlink, BytesSaved: 200},
+		{Target: "/data/photos/c", Action: deduper.ActionSkipped},
+	})
+
+	for root, want := range map[string]int64{"/data": 100, "/data/photos": 200, "/backup": 0} {
+		state, err := rootstate.Load(dir, root)
+		if err != nil || state == nil {
+			t.Fatalf("Load(%s) = %v, %v", root, state, err)
+		}
+		if state.BytesSaved != want {
+			t.Errorf("%s: bytesSaved = %d, want %d", root, state.BytesSaved, want)
+		}
+	}
+
+	var b strings.Builder
+	checkRootStates(&b, dir, roots, policy, false)
+	if b.Len() != 0 {
+		t.Errorf("checkRootStates(same policy) = %q, want no output", b.String())
+	}
+	policy["trust-device-boundaries"] = "true"
+	checkRootStates(&b, dir, []string{"/backup"}, policy, true)
+	for _, want := range []string{
+		"/backup: last deduplicated ",
+		`warning: /backup was last deduplicated `,
+		`with --trust-device-boundaries="false", now "true"`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("checkRootStates() = %q, want %q", b.String(), want)
+		}
+	}
+}
+
+// =============================================================================
+// Section 7.20: Remote Root Tests
+// =============================================================================
+
+// TestSplitRemoteRoots tests that [user@]host:/path arguments are told apart
+// from local paths.
+func TestSplitRemoteRoots(t *testing.T) {
+	local, remotes := splitRemoteRoots([]string{"/data", "backup@nas1:/vol1", "./odd:/name", "nas2:/vol2"})
+	if want := []string{"/data", "./odd:/name"}; !slices.Equal(local, want) {
+		t.Errorf("local = %v, want %v", local, want)
+	}
+	if want := []remote.Root{{Dest: "backup@nas1", Path: "/vol1"}, {Dest: "nas2", Path: "/vol2"}}; !slices.Equal(remotes, want) {
+		t.Errorf("remotes = %v, want %v", remotes, want)
+	}
+}
+
+// TestRemoteGroups tests that local matches of one remote content are
+// grouped, with remote paths prefixed by the host.
+func TestRemoteGroups(t *testing.T) {
+	m := &manifest.Manifest{Host: "nas1", Root: "/"}
+	groups := remoteGroups(m, []manifest.Match{
+		{Local: "/data/a", Size: 10, Digest: "d1", Remote: []string{"vol1/a", "vol1/b"}},
+		{Local: "/data/b", Size: 10, Digest: "d1", Remote: []string{"vol1/a", "vol1/b"}},
+		{Local: "/data/c", Size: 20, Digest: "d2", Remote: []string{"vol1/c"}},
+	})
+	want := []report.RemoteGroup{
+		{Size: 10, Digest: "d1", Local: []string{"/data/a", "/data/b"}, Remote: []string{"nas1:/vol1/a", "nas1:/vol1/b"}},
+		{Size: 20, Digest: "d2", Local: []string{"/data/c"}, Remote: []string{"nas1:/vol1/c"}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("remoteGroups() = %v, want %v", groups, want)
+	}
+	for i := range want {
+		g := groups[i]
+		if g.Size != want[i].Size || g.Digest != want[i].Digest || !slices.Equal(g.Local, want[i].Local) || !slices.Equal(g.Remote, want[i].Remote) {
+			t.Errorf("group %d = %+v, want %+v", i, g, want[i])
+		}
+	}
+
+	var b strings.Builder
+	printRemoteGroups(&b, groups)
+	if want := "3 remote files (40 B) duplicate local content\n"; b.String() != want {
+		t.Errorf("printRemoteGroups() = %q, want %q", b.String(), want)
+	}
+}
+
+// =============================================================================
+// Section 7.21: Temporary Link Tests
+// =============================================================================
+
+// TestValidateTmpFlags tests that --tmp-suffix and --staging-dir cannot make
+// temporary links outside the target's directory or filesystem.
+func TestValidateTmpFlags(t *testing.T) {
+	tests := []struct {
+		suffix, stagingDir string
+		orphanAge          time.Duration
+		ok                 bool
+	}{
+		{".dupedog.tmp", "", time.Minute, true},
+		{"~dupedog", ".dupedog-staging", time.Hour, true},
+		{".dupedog-partial", "var/dupedog", time.Second, true},
+		{"", "", time.Minute, false},
+		{".bak", "", time.Minute, false},
+		{"/x.dupedog", "", time.Minute, false},
+		{".dupedog", "/staging", time.Minute, false},
+		{".dupedog", "../staging", time.Minute, false},
+		{".dupedog", "", 0, false},
+	}
+	for _, tt := range tests {
+		if err := validateTmpFlags(tt.suffix, tt.stagingDir, tt.orphanAge); (err == nil) != tt.ok {
+			t.Errorf("validateTmpFlags(%q, %q, %v) = %v, want ok=%v", tt.suffix, tt.stagingDir, tt.orphanAge, err, tt.ok)
+		}
+	}
+}
+
+// TestPrintOrphans tests that removed temporary links are listed and those
+// left are counted with the reason.
+func TestPrintOrphans(t *testing.T) {
+	orphans := []deduper.Orphan{
+		{Path: "/data/a.dupedog.tmp", Removed: true},
+		{Path: "/data/b.dupedog.tmp", Err: errors.New("nlink=1, may be only copy of data")},
+	}
+	var b strings.Builder
+	if left := printOrphans(&b, orphans, true); left != 1 {
+		t.Errorf("printOrphans() = %d left, want 1", left)
+	}
+	want := "would remove /data/a.dupedog.tmp\n/data/b.dupedog.tmp: left: nlink=1, may be only copy of data\n"
+	if b.String() != want {
+		t.Errorf("printOrphans() wrote %q, want %q", b.String(), want)
+	}
+}
+
+// =============================================================================
+// Section 7.22: Xattr Marker Tests
+// =============================================================================
+
+// TestWriteMarkersDryRun tests that dry runs leave files without markers,
+// while real runs mark them where the filesystem supports user xattrs.
+func TestWriteMarkersDryRun(t *testing.T) {
+	dir := t.TempDir()
+	var files []*types.FileInfo
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, &types.FileInfo{Path: path, Size: info.Size(), ModTime: info.ModTime(), Digest: "abc"})
+	}
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{files[0]}),
+			types.NewSiblingGroup([]*types.FileInfo{files[1]}),
+		}),
+	})
+
+	writeMarkers(groups, nil, true, nil)
+	for _, f := range files {
+		if _, ok := marker.Read(f); ok {
+			t.Errorf("%s was marked in a dry run", f.Path)
+		}
+	}
+
+	writeMarkers(groups, nil, false, nil)
+	if _, ok := marker.Read(files[0]); !ok {
+		t.Skip("no user xattr support on the temporary directory")
+	}
+	if digest, ok := marker.Read(files[1]); !ok || digest != "abc" {
+		t.Errorf("marker of %s = %q, %v; want abc", files[1].Path, digest, ok)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ivoronin/dupedog/internal/report"
+	"github.com/ivoronin/dupedog/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+// newVerifyLinksCmd creates the verify-links subcommand.
+func newVerifyLinksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-links REPORT",
+		Short: "Audit links created by a previous dedupe run",
+		Long: `Re-checks every replacement recorded in a JSON report (written with --report):
+  - hardlinked targets must still share the source's inode
+  - symlinked targets must still resolve to the source
+  - sources must still match the recorded content digest
+
+Divergences are printed to stdout; the exit status is non-zero if any are found.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true // Divergences are not usage errors
+			return runVerifyLinks(args[0], os.Stdout)
+		},
+	}
+
+	return cmd
+}
+
+// runVerifyLinks verifies the report at path and prints divergences to w.
+func runVerifyLinks(path string, w io.Writer) error {
+	r, err := report.Read(path)
+	if err != nil {
+		return fmt.Errorf("read report: %w", err)
+	}
+	if r.DryRun {
+		return fmt.Errorf("report %s was written by a dry run; nothing to verify", path)
+	}
+
+	divergences := r.VerifyLinks(verifier.Digest)
+	for _, d := range divergences {
+		_, _ = fmt.Fprintln(w, d)
+	}
+	if len(divergences) > 0 {
+		return fmt.Errorf("%d divergences found", len(divergences))
+	}
+	return nil
+}
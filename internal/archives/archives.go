@@ -0,0 +1,260 @@
+// Package archives finds members of tar and zip archives that duplicate loose
+// files, for reporting only: archives are read, never modified.
+//
+// A member is compared with the loose files of its size by SHA-256 of the
+// whole content. Members are hashed while the archive is read in one pass
+// (compressed tars cannot be seeked), loose files only if a member of their
+// size exists.
+package archives
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Member is a regular file inside an archive.
+type Member struct {
+	Archive string // Path of the archive on disk
+	Name    string // Path inside the archive
+	Size    int64
+}
+
+// Match is an archive member with the same content as one or more loose files.
+type Match struct {
+	Member
+	Files []string // Loose files with the member's content, sorted
+}
+
+// IsArchive reports whether path names an archive by its extension: .tar,
+// .tar.gz, .tgz, .tar.bz2, .tbz2, or .zip.
+func IsArchive(path string) bool {
+	return format(path) != ""
+}
+
+// format returns the archive format of path ("tar", "tar.gz", "tar.bz2" or
+// "zip"), or "" if it is not an archive.
+func format(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar.bz2"), strings.HasSuffix(lower, ".tbz2"):
+		return "tar.bz2"
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	default:
+		return ""
+	}
+}
+
+// stats tracks archive reading progress.
+type stats struct {
+	archives  int
+	members   int
+	matches   int
+	bytes     int64
+	startTime time.Time
+}
+
+// Counts implements progress.Counter: archives read and member bytes hashed.
+func (s *stats) Counts() (items, bytes int64) {
+	return int64(s.archives), s.bytes
+}
+
+func (s *stats) String() string {
+	return fmt.Sprintf("Read %d archives, hashed %d members (%s), %d duplicate loose files in %.1fs",
+		s.archives, s.members, humanize.IBytes(uint64(s.bytes)), s.matches, time.Since(s.startTime).Seconds())
+}
+
+// Find reads the archives among files and returns their members that
+// duplicate other files, by archive then member name. Members smaller than
+// minSize (and empty ones) are ignored. Unreadable archives and files are
+// reported to errCh (if not nil) and skipped. Find stops early when ctx is
+// canceled, returning the matches found so far.
+func Find(ctx context.Context, files []*types.FileInfo, minSize int64, reporter progress.Reporter, errCh chan *types.Event) []Match {
+	bar := progress.New(reporter, "archives")
+	st := &stats{startTime: time.Now()}
+	bar.Describe(st)
+
+	bySize := make(map[int64][]*types.FileInfo)
+	var archives []string
+	for _, f := range files {
+		if IsArchive(f.Path) {
+			archives = append(archives, f.Path)
+		}
+		if f.Size > 0 && f.Size >= minSize {
+			bySize[f.Size] = append(bySize[f.Size], f)
+		}
+	}
+	slices.Sort(archives)
+
+	loose := make(map[string]string) // Path → hash, of loose files hashed so far
+	var matches []Match
+	for _, archive := range archives {
+		if ctx.Err() != nil {
+			break
+		}
+		hashed, err := hashMembers(ctx, archive, func(size int64) bool { return len(bySize[size]) > 0 })
+		if err != nil {
+			sendError(errCh, types.NewEvent(types.StageArchive, archive, err))
+		}
+		st.archives++
+		for _, h := range hashed {
+			st.members++
+			st.bytes += h.Size
+			m := Match{Member: h.Member}
+			for _, f := range bySize[h.Size] {
+				if f.Path == archive {
+					continue
+				}
+				if fileHash(f.Path, loose, errCh) == h.hash {
+					m.Files = append(m.Files, f.Path)
+				}
+			}
+			if len(m.Files) > 0 {
+				slices.Sort(m.Files)
+				matches = append(matches, m)
+				st.matches += len(m.Files)
+			}
+		}
+		bar.Describe(st)
+	}
+	bar.Finish(st)
+	return matches
+}
+
+// hashedMember is a member with the SHA-256 of its content.
+type hashedMember struct {
+	Member
+	hash string
+}
+
+// hashMembers hashes the regular members of archive whose size wanted
+// accepts. Members hashed before a read error are returned with it.
+func hashMembers(ctx context.Context, archive string, wanted func(size int64) bool) ([]hashedMember, error) {
+	if format(archive) == "zip" {
+		return hashZip(ctx, archive, wanted)
+	}
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	switch format(archive) {
+	case "tar.gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	case "tar.bz2":
+		r = bzip2.NewReader(f)
+	}
+
+	var hashed []hashedMember
+	tr := tar.NewReader(r)
+	for ctx.Err() == nil {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return hashed, err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() || !wanted(hdr.Size) {
+			continue
+		}
+		hash, err := sum(tr)
+		if err != nil {
+			return hashed, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		hashed = append(hashed, hashedMember{Member{Archive: archive, Name: hdr.Name, Size: hdr.Size}, hash})
+	}
+	return hashed, nil
+}
+
+// hashZip is hashMembers for zip archives.
+func hashZip(ctx context.Context, archive string, wanted func(size int64) bool) ([]hashedMember, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = zr.Close() }()
+
+	var hashed []hashedMember
+	for _, zf := range zr.File {
+		if ctx.Err() != nil {
+			break
+		}
+		size := int64(zf.UncompressedSize64) //nolint:gosec // Sizes beyond int64 are not real files
+		if !zf.Mode().IsRegular() || !wanted(size) {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return hashed, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		hash, err := sum(rc)
+		_ = rc.Close()
+		if err != nil {
+			return hashed, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		hashed = append(hashed, hashedMember{Member{Archive: archive, Name: zf.Name, Size: size}, hash})
+	}
+	return hashed, nil
+}
+
+// fileHash returns the SHA-256 of the loose file at path, memoized in hashes.
+// An unreadable file is reported once and hashes to "" (matching nothing).
+func fileHash(path string, hashes map[string]string, errCh chan *types.Event) string {
+	if hash, ok := hashes[path]; ok {
+		return hash
+	}
+	var hash string
+	f, err := os.Open(path)
+	if err == nil {
+		hash, err = sum(f)
+		_ = f.Close()
+	}
+	if err != nil {
+		sendError(errCh, types.NewEvent(types.StageArchive, path, err))
+	}
+	hashes[path] = hash
+	return hash
+}
+
+// sum returns the hex SHA-256 of everything read from r.
+func sum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sendError sends an event to errCh if it's not nil.
+func sendError(errCh chan *types.Event, e *types.Event) {
+	if errCh != nil {
+		errCh <- e
+	}
+}
@@ -0,0 +1,171 @@
+package archives
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// writeTarGz writes a gzipped tar of members (name → content) to path.
+func writeTarGz(t *testing.T, path string, members map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedKeys(members) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(members[name])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(members[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []interface{ Close() error }{tw, gz, f} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeZip writes a zip of members (name → content) to path.
+func writeZip(t *testing.T, path string, members map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range sortedKeys(members) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(members[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// fileInfos stats paths as the scanner would report them.
+func fileInfos(t *testing.T, paths ...string) []*types.FileInfo {
+	t.Helper()
+	files := make([]*types.FileInfo, len(paths))
+	for i, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[i] = &types.FileInfo{Path: p, Size: info.Size()}
+	}
+	return files
+}
+
+// TestFind tests that members of tar.gz and zip archives are matched with
+// loose files of the same content, and not with files of the same size.
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	loose := map[string]string{
+		"photo.jpg": "jpeg content",
+		"other.jpg": "jpeg-content", // Same size, different content
+		"notes.txt": "some notes",
+	}
+	var paths []string
+	for name, content := range loose {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	tgz := filepath.Join(dir, "backup.tar.gz")
+	writeTarGz(t, tgz, map[string]string{"2024/photo.jpg": "jpeg content", "unique.bin": "only here"})
+	zipPath := filepath.Join(dir, "docs.ZIP")
+	writeZip(t, zipPath, map[string]string{"notes.txt": "some notes", "empty": ""})
+	paths = append(paths, tgz, zipPath)
+
+	errCh := make(chan *types.Event, 10)
+	matches := Find(context.Background(), fileInfos(t, paths...), 1, nil, errCh)
+	close(errCh)
+	for e := range errCh {
+		t.Errorf("unexpected error: %v", e)
+	}
+
+	want := []Match{
+		{Member{tgz, "2024/photo.jpg", 12}, []string{filepath.Join(dir, "photo.jpg")}},
+		{Member{zipPath, "notes.txt", 10}, []string{filepath.Join(dir, "notes.txt")}},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("matches = %+v, want %+v", matches, want)
+	}
+	for i := range want {
+		if matches[i].Member != want[i].Member || !slices.Equal(matches[i].Files, want[i].Files) {
+			t.Errorf("matches[%d] = %+v, want %+v", i, matches[i], want[i])
+		}
+	}
+}
+
+// TestFindCorruptArchive tests that an unreadable archive is reported and
+// the others are still read.
+func TestFindCorruptArchive(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.tgz")
+	if err := os.WriteFile(bad, []byte("not gzip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	good := filepath.Join(dir, "good.zip")
+	writeZip(t, good, map[string]string{"a": "same"})
+	loose := filepath.Join(dir, "a")
+	if err := os.WriteFile(loose, []byte("same"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan *types.Event, 10)
+	matches := Find(context.Background(), fileInfos(t, bad, good, loose), 0, nil, errCh)
+	close(errCh)
+	var errs []*types.Event
+	for e := range errCh {
+		errs = append(errs, e)
+	}
+	if len(errs) != 1 || errs[0].Stage != types.StageArchive || errs[0].Path != bad {
+		t.Errorf("errors = %v, want one archive error for %s", errs, bad)
+	}
+	if len(matches) != 1 || matches[0].Archive != good {
+		t.Errorf("matches = %+v, want the member of %s", matches, good)
+	}
+}
+
+func TestIsArchive(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/a/b.tar": true, "/a/b.TGZ": true, "/a/b.tar.gz": true, "/a/b.tbz2": true,
+		"/a/b.zip": true, "/a/b.gz": false, "/a/b.tar.xz": false, "/a/tar": false,
+	} {
+		if got := IsArchive(path); got != want {
+			t.Errorf("IsArchive(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
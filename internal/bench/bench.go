@@ -0,0 +1,192 @@
+// Package bench measures how fast a filesystem serves dupedog's three I/O
+// patterns: listing directories, hashing file ranges, and replacing files
+// with links. The results help choose --scan-workers, --hash-workers and
+// --max-ops-per-sec for a particular machine and storage.
+//
+// # Method
+//
+// Hashing is measured at doubling worker counts (1, 2, 4, ...). Each round
+// reads a different slice of the largest scanned files, so a round is not
+// sped up by the page cache filled by the previous one; files cached before
+// the benchmark started still are. Links are measured on scratch files in a
+// temporary directory, with the deduper's link-then-rename sequence.
+package bench
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+)
+
+// HashResult is the hashing throughput at one worker count.
+type HashResult struct {
+	Workers int
+	Files   int
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// BytesPerSec returns the total throughput of all workers.
+func (r HashResult) BytesPerSec() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+// LinkResult is the rate of link replacements.
+type LinkResult struct {
+	Ops     int
+	Elapsed time.Duration
+}
+
+// OpsPerSec returns the replacements per second.
+func (r LinkResult) OpsPerSec() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+// WorkerCounts returns the doubling worker counts measured up to maxWorkers,
+// ending with maxWorkers itself.
+func WorkerCounts(maxWorkers int) []int {
+	var counts []int
+	for n := 1; n < maxWorkers; n *= 2 {
+		counts = append(counts, n)
+	}
+	return append(counts, max(maxWorkers, 1))
+}
+
+// SelectFiles picks the largest files, one path per inode, until budget bytes,
+// and splits them into rounds slices of roughly equal size.
+func SelectFiles(files []*types.FileInfo, budget int64, rounds int) [][]*types.FileInfo {
+	sorted := slices.Clone(files)
+	slices.SortStableFunc(sorted, func(a, b *types.FileInfo) int { return cmp.Compare(b.Size, a.Size) })
+
+	seen := make(map[[2]uint64]bool)
+	picked := make([][]*types.FileInfo, rounds)
+	share := budget / int64(rounds)
+	var round int
+	var filled int64
+	for _, f := range sorted {
+		if round == rounds || f.Size == 0 {
+			break
+		}
+		key := [2]uint64{f.Dev, f.Ino}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		picked[round] = append(picked[round], f)
+		if filled += f.Size; filled >= share {
+			round, filled = round+1, 0
+		}
+	}
+	return picked
+}
+
+// Hash hashes files with the given number of workers, reading the same
+// ranges as the verifier, and returns the throughput.
+func Hash(ctx context.Context, files []*types.FileInfo, workers int) (HashResult, error) {
+	r := HashResult{Workers: workers}
+	var bytes atomic.Int64
+	var firstErr error
+	var once sync.Once
+
+	jobs := make(chan *types.FileInfo)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range workers {
+		wg.Go(func() {
+			for f := range jobs {
+				if _, _, err := verifier.HashFile(f, nil); err != nil {
+					once.Do(func() { firstErr = fmt.Errorf("hash %s: %w", f.Path, err) })
+					continue
+				}
+				bytes.Add(f.Size)
+			}
+		})
+	}
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- f
+		r.Files++
+	}
+	close(jobs)
+	wg.Wait()
+
+	r.Elapsed, r.Bytes = time.Since(start), bytes.Load()
+	return r, firstErr
+}
+
+// Fastest returns the smallest worker count within 10% of the best
+// throughput: more workers than that only add contention.
+func Fastest(results []HashResult) int {
+	var best float64
+	for _, r := range results {
+		best = max(best, r.BytesPerSec())
+	}
+	for _, r := range results {
+		if r.BytesPerSec() >= 0.9*best {
+			return r.Workers
+		}
+	}
+	return 0
+}
+
+// Links replaces n scratch files in a temporary directory under dir with
+// hardlinks to a common source, each as a link to a temporary name followed
+// by a rename over the target, and returns the rate. The scratch files are
+// created before timing starts and removed afterwards.
+func Links(ctx context.Context, dir string, n int) (r LinkResult, err error) {
+	tmp, err := os.MkdirTemp(dir, ".dupedog-bench-")
+	if err != nil {
+		return r, err
+	}
+	defer func() {
+		if rmErr := os.RemoveAll(tmp); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}()
+
+	source := filepath.Join(tmp, "source")
+	if err := os.WriteFile(source, []byte("dupedog bench\n"), 0o600); err != nil {
+		return r, err
+	}
+	targets := make([]string, n)
+	for i := range targets {
+		targets[i] = filepath.Join(tmp, fmt.Sprintf("target%d", i))
+		if err := os.WriteFile(targets[i], []byte("dupedog bench\n"), 0o600); err != nil {
+			return r, err
+		}
+	}
+
+	start := time.Now()
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		link := target + ".dupedog.tmp"
+		if err := os.Link(source, link); err != nil {
+			return r, err
+		}
+		if err := os.Rename(link, target); err != nil {
+			return r, err
+		}
+		r.Ops++
+	}
+	r.Elapsed = time.Since(start)
+	return r, nil
+}
@@ -0,0 +1,112 @@
+package bench
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+func TestWorkerCounts(t *testing.T) {
+	tests := []struct {
+		max  int
+		want []int
+	}{
+		{0, []int{1}},
+		{1, []int{1}},
+		{4, []int{1, 2, 4}},
+		{6, []int{1, 2, 4, 6}},
+	}
+	for _, tt := range tests {
+		if got := WorkerCounts(tt.max); !slices.Equal(got, tt.want) {
+			t.Errorf("WorkerCounts(%d) = %v, want %v", tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestSelectFiles(t *testing.T) {
+	files := []*types.FileInfo{
+		{Path: "small", Size: 10, Ino: 1},
+		{Path: "big", Size: 100, Ino: 2},
+		{Path: "big-link", Size: 100, Ino: 2}, // Same inode: hashed once
+		{Path: "mid", Size: 60, Ino: 3},
+		{Path: "mid2", Size: 50, Ino: 4},
+		{Path: "empty", Size: 0, Ino: 5},
+	}
+
+	rounds := SelectFiles(files, 200, 2)
+	var got [][]string
+	for _, round := range rounds {
+		var paths []string
+		for _, f := range round {
+			paths = append(paths, f.Path)
+		}
+		got = append(got, paths)
+	}
+	if len(got) != 2 || !slices.Equal(got[0], []string{"big"}) || !slices.Equal(got[1], []string{"mid", "mid2"}) {
+		t.Errorf("SelectFiles() = %v, want [[big] [mid mid2]]", got)
+	}
+}
+
+func TestFastest(t *testing.T) {
+	results := []HashResult{
+		{Workers: 1, Bytes: 100, Elapsed: time.Second},
+		{Workers: 2, Bytes: 190, Elapsed: time.Second},
+		{Workers: 4, Bytes: 200, Elapsed: time.Second},
+	}
+	if got := Fastest(results); got != 2 {
+		t.Errorf("Fastest() = %d, want 2", got)
+	}
+	if got := Fastest(nil); got != 0 {
+		t.Errorf("Fastest(nil) = %d, want 0", got)
+	}
+}
+
+func TestHash(t *testing.T) {
+	dir := t.TempDir()
+	var files []*types.FileInfo
+	for i, size := range []int{1 << 20, 3 << 20, 100} {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, &types.FileInfo{Path: path, Size: int64(size)})
+	}
+
+	r, err := Hash(context.Background(), files, 2)
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	if r.Files != 3 || r.Bytes != 4<<20+100 || r.Workers != 2 {
+		t.Errorf("Hash() = %+v, want 3 files, %d bytes, 2 workers", r, 4<<20+100)
+	}
+
+	files = append(files, &types.FileInfo{Path: filepath.Join(dir, "missing"), Size: 1})
+	if _, err := Hash(context.Background(), files, 1); err == nil {
+		t.Error("Hash() should report a missing file")
+	}
+}
+
+func TestLinks(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := Links(context.Background(), dir, 50)
+	if err != nil {
+		t.Fatalf("Links() error: %v", err)
+	}
+	if r.Ops != 50 || r.OpsPerSec() <= 0 {
+		t.Errorf("Links() = %+v, want 50 ops at a positive rate", r)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Links() left %d entries behind", len(entries))
+	}
+}
@@ -1,12 +1,32 @@
 // Package cache provides file-based caching for progressive hash verification.
+//
+// # Multi-Instance Sharing
+//
+// Each run writes to its own run file (<cache>.run-*), so any number of
+// instances can share one cache file. At Close, the run file is merged into the
+// main file under an exclusive lock (<cache>.lock) and the result atomically
+// replaces the main file:
+//
+//	merged = entries used by this run
+//	       + main entries written by runs that finished after this run started
+//
+// Main entries identical to the snapshot this run opened were not used by any
+// overlapping run and are dropped (self-cleaning). Self-cleaning is limited to
+// the run's scope (its scan roots), so runs on different trees can share one
+// cache file without discarding each other's entries. Inode-mode keys carry no
+// path; they are in scope if their device is one of the scan roots' devices,
+// so only runs on different filesystems keep each other's inode entries.
 package cache
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"syscall"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
@@ -17,21 +37,59 @@ import (
 const (
 	bucketName = "hashes"
 	hashSize   = 32
+	// valueSize is hash(32) + createdAt(8) + usedAt(8). Legacy values hold the hash only.
+	valueSize = hashSize + 16
 )
 
+// KeyMode selects which file identity fields make up cache keys.
+type KeyMode int
+
+const (
+	// KeyPath keys entries by (path, size, ino, mtime, range).
+	// Renaming or moving a file invalidates its entries.
+	KeyPath KeyMode = iota
+	// KeyInode keys entries by (dev, ino, size, mtime, range).
+	// Entries survive renames within a filesystem and are shared by hardlinks,
+	// but are lost if the device ID changes (e.g., NFS remounted elsewhere).
+	KeyInode
+)
+
+// ParseKeyMode parses a --cache-key value ("path" or "inode").
+func ParseKeyMode(s string) (KeyMode, error) {
+	switch s {
+	case "path":
+		return KeyPath, nil
+	case "inode":
+		return KeyInode, nil
+	default:
+		return KeyPath, fmt.Errorf("unknown cache key mode %q (want path or inode)", s)
+	}
+}
+
 // Cache provides persistent caching of file hashes using BoltDB.
 // Implements self-cleaning: each run creates a new database, only used entries survive.
+// Concurrent instances sharing the same path keep each other's entries.
+//
+// Limits are applied on top of self-cleaning:
+//   - maxAge: entries created longer ago are treated as misses (forces re-hash)
+//   - maxSize: oldest entries are evicted at Close until the data fits
 type Cache struct {
-	readDB  *bolt.DB // Existing cache (read-only)
-	writeDB *bolt.DB // New cache (write) - BoltDB locks this file
-	path    string   // Final path (for atomic swap)
+	readDB  *bolt.DB        // Snapshot of main cache at Open (read-only)
+	writeDB *bolt.DB        // Per-run cache (write) - BoltDB locks this file
+	path    string          // Main cache path (merge target)
+	maxSize int64           // Max key+value bytes kept at Close (0 = unlimited)
+	maxAge  time.Duration   // Max entry age since first hashed (0 = unlimited)
+	keyMode KeyMode         // Identity fields used in keys
+	scope   []string        // Absolute roots subject to self-cleaning (nil = everything)
+	devs    map[uint64]bool // Devices of the scope roots, for inode-mode keys
 	enabled bool
 }
 
-// Open opens existing cache for reading and creates new cache for writing.
-// BoltDB's built-in file locking on .new file prevents concurrent instances.
-// Returns disabled cache if path is empty.
-func Open(path string) (*Cache, error) {
+// Open opens existing cache for reading and creates a per-run cache for writing.
+// Run files left behind by crashed instances are removed.
+// Returns disabled cache if path is empty. Zero maxSize/maxAge mean unlimited.
+// Unused entries are only dropped for files under scope roots (nil = all files).
+func Open(path string, maxSize int64, maxAge time.Duration, keyMode KeyMode, scope []string) (*Cache, error) {
 	if path == "" {
 		return &Cache{enabled: false}, nil
 	}
@@ -40,8 +98,12 @@ func Open(path string) (*Cache, error) {
 		return nil, fmt.Errorf("create cache dir: %w", err)
 	}
 
-	c := &Cache{path: path, enabled: true}
-	var err error
+	absScope, err := absPaths(scope)
+	if err != nil {
+		return nil, fmt.Errorf("cache scope: %w", err)
+	}
+
+	c := &Cache{path: path, maxSize: maxSize, maxAge: maxAge, keyMode: keyMode, scope: absScope, devs: devices(absScope), enabled: true}
 
 	// Open existing cache for reading (if exists)
 	if _, statErr := os.Stat(path); statErr == nil {
@@ -55,12 +117,19 @@ func Open(path string) (*Cache, error) {
 		}
 	}
 
-	// Create new cache for writing - BoltDB locks this file
-	newPath := path + ".new"
-	c.writeDB, err = bolt.Open(newPath, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	// Create per-run cache for writing - BoltDB locks this file
+	removeStaleRuns(path)
+	runFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+runSuffix+"*")
 	if err != nil {
 		_ = c.Close()
-		return nil, fmt.Errorf("create new cache (locked by another instance?): %w", err)
+		return nil, fmt.Errorf("create run cache: %w", err)
+	}
+	_ = runFile.Close()
+	c.writeDB, err = bolt.Open(runFile.Name(), 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		_ = os.Remove(runFile.Name())
+		_ = c.Close()
+		return nil, fmt.Errorf("create run cache: %w", err)
 	}
 
 	// Create bucket in new cache
@@ -75,23 +144,23 @@ func Open(path string) (*Cache, error) {
 	return c, nil
 }
 
-// Close closes both databases and atomically replaces old with new.
-// Only replaces if write database closed successfully to avoid data loss.
+// Close closes both databases and merges this run's entries into the main cache.
+// Only merges if the run database closed successfully to avoid data loss.
+// The snapshot (readDB) stays open during the merge to detect concurrent writes.
 func (c *Cache) Close() error {
 	var errs []error
-	if c.readDB != nil {
-		if err := c.readDB.Close(); err != nil {
+	if c.writeDB != nil {
+		runPath := c.writeDB.Path()
+		if err := c.writeDB.Close(); err != nil {
+			errs = append(errs, err)
+		} else if err := c.merge(runPath); err != nil {
 			errs = append(errs, err)
 		}
+		_ = os.Remove(runPath)
 	}
-	if c.writeDB != nil {
-		if err := c.writeDB.Close(); err != nil {
+	if c.readDB != nil {
+		if err := c.readDB.Close(); err != nil {
 			errs = append(errs, err)
-		} else {
-			// Atomic replace: rename new → old (only if close succeeded)
-			if err := os.Rename(c.path+".new", c.path); err != nil {
-				errs = append(errs, err)
-			}
 		}
 	}
 	if len(errs) > 0 {
@@ -100,15 +169,26 @@ func (c *Cache) Close() error {
 	return nil
 }
 
-const keyVersion byte = 1 // Increment when key format changes
+// Key format versions. Increment when a key format changes.
+// Each KeyMode has its own version byte so entries of both modes never collide.
+const (
+	keyVersion      byte = 1 // KeyPath
+	keyVersionInode byte = 2 // KeyInode
+)
 
 // makeKey builds deterministic byte key for BoltDB lookup.
-// Key = ver(1) + path + NUL + fileSize(8) + ino(8) + mtime(8) + start(8) + size(8)
-func makeKey(fi *types.FileInfo, start, size int64) []byte {
+// KeyPath:  Key = ver(1) + path + NUL + fileSize(8) + ino(8) + mtime(8) + start(8) + size(8)
+// KeyInode: Key = ver(1) + dev(8) + fileSize(8) + ino(8) + mtime(8) + start(8) + size(8)
+func makeKey(mode KeyMode, fi *types.FileInfo, start, size int64) []byte {
 	buf := new(bytes.Buffer)
-	buf.WriteByte(keyVersion)
-	buf.WriteString(fi.Path)
-	buf.WriteByte(0) // NUL separator
+	if mode == KeyInode {
+		buf.WriteByte(keyVersionInode)
+		_ = binary.Write(buf, binary.BigEndian, fi.Dev)
+	} else {
+		buf.WriteByte(keyVersion)
+		buf.WriteString(fi.Path)
+		buf.WriteByte(0) // NUL separator
+	}
 	_ = binary.Write(buf, binary.BigEndian, fi.Size)
 	_ = binary.Write(buf, binary.BigEndian, fi.Ino)
 	_ = binary.Write(buf, binary.BigEndian, fi.ModTime.UnixNano())
@@ -117,27 +197,111 @@ func makeKey(fi *types.FileInfo, start, size int64) []byte {
 	return buf.Bytes()
 }
 
+// absPaths returns cleaned absolute versions of paths.
+func absPaths(paths []string) ([]string, error) {
+	var abs []string
+	for _, p := range paths {
+		a, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		abs = append(abs, a)
+	}
+	return abs, nil
+}
+
+// devices returns the device IDs of roots. Roots that cannot be stat'ed are
+// left out: no file of theirs was hashed.
+func devices(roots []string) map[uint64]bool {
+	devs := make(map[uint64]bool)
+	for _, root := range roots {
+		var st syscall.Stat_t
+		if syscall.Stat(root, &st) == nil {
+			devs[uint64(st.Dev)] = true //nolint:unconvert // platform-dependent type
+		}
+	}
+	return devs
+}
+
+// inScope reports whether an entry's key is subject to self-cleaning.
+// Inode-mode keys carry no path and are in scope on the scope roots' devices.
+func (c *Cache) inScope(key []byte) bool {
+	if c.scope == nil || len(key) == 0 {
+		return true
+	}
+	if key[0] == keyVersionInode && len(key) >= 9 {
+		return c.devs[binary.BigEndian.Uint64(key[1:9])]
+	}
+	if key[0] != keyVersion {
+		return true
+	}
+	path, _, found := bytes.Cut(key[1:], []byte{0})
+	if !found {
+		return true
+	}
+	for _, root := range c.scope {
+		if isUnder(string(path), root) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnder reports whether path equals root or lies beneath it.
+func isUnder(path, root string) bool {
+	if path == root || root == "/" {
+		return true
+	}
+	return len(path) > len(root) && path[:len(root)] == root && path[len(root)] == '/'
+}
+
+// makeValue builds the stored value: hash, creation time, and last use time.
+// The use time makes values written by different runs distinguishable.
+func makeValue(hash []byte, createdAt time.Time) []byte {
+	buf := make([]byte, valueSize)
+	copy(buf, hash)
+	binary.BigEndian.PutUint64(buf[hashSize:], uint64(createdAt.UnixNano()))
+	binary.BigEndian.PutUint64(buf[hashSize+8:], uint64(time.Now().UnixNano()))
+	return buf
+}
+
+// parseValue splits a stored value into hash and creation time.
+// Legacy hash-only values report ok with zero createdAt.
+func parseValue(data []byte) (hash []byte, createdAt time.Time, ok bool) {
+	switch len(data) {
+	case hashSize:
+		return data, time.Time{}, true
+	case valueSize:
+		return data[:hashSize], time.Unix(0, int64(binary.BigEndian.Uint64(data[hashSize:]))), true
+	default:
+		return nil, time.Time{}, false
+	}
+}
+
 // Lookup retrieves a cached hash for a byte range.
-// Key = (path, fileSize, ino, mtime, start, size) - any change = cache miss.
-// On HIT: copies entry to writeDB (self-cleaning).
+// Key = (path or dev, fileSize, ino, mtime, start, size) - any change = cache miss.
+// Entries older than maxAge are misses. Legacy entries without a creation
+// time are treated as created now.
+// On HIT: copies entry to writeDB (self-cleaning), preserving its creation time.
 // Returns (nil, nil) if not found, (nil, err) on read error.
 func (c *Cache) Lookup(fi *types.FileInfo, start, size int64) ([]byte, error) {
 	if !c.enabled || c.readDB == nil {
 		return nil, nil
 	}
 
-	key := makeKey(fi, start, size)
+	key := makeKey(c.keyMode, fi, start, size)
 	var hash []byte
+	var createdAt time.Time
 
 	err := c.readDB.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		if b == nil {
 			return nil
 		}
-		data := b.Get(key)
-		if len(data) == hashSize {
+		if h, created, ok := parseValue(b.Get(key)); ok {
 			hash = make([]byte, hashSize)
-			copy(hash, data)
+			copy(hash, h)
+			createdAt = created
 		}
 		return nil
 	})
@@ -149,24 +313,76 @@ func (c *Cache) Lookup(fi *types.FileInfo, start, size int64) ([]byte, error) {
 		return nil, nil
 	}
 
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	if c.maxAge > 0 && time.Since(createdAt) > c.maxAge {
+		return nil, nil // Expired - caller re-hashes and stores a fresh entry
+	}
+
 	// Self-cleaning: copy valid entry to new database
-	_ = c.Store(fi, start, size, hash)
+	_ = c.put(key, hash, createdAt)
 
 	return hash, nil
 }
 
 // Store saves a hash for a byte range to the new database.
 func (c *Cache) Store(fi *types.FileInfo, start, size int64, hash []byte) error {
+	return c.put(makeKey(c.keyMode, fi, start, size), hash, time.Now())
+}
+
+// put writes a hash with its creation time to the new database.
+func (c *Cache) put(key, hash []byte, createdAt time.Time) error {
 	if !c.enabled || c.writeDB == nil || len(hash) != hashSize {
 		return nil
 	}
 
 	err := c.writeDB.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
-		return b.Put(makeKey(fi, start, size), hash)
+		return b.Put(key, makeValue(hash, createdAt))
 	})
 	if err != nil {
 		return fmt.Errorf("cache store: %w", err)
 	}
 	return nil
 }
+
+// evictEntry describes one entry considered for size-based eviction.
+type evictEntry struct {
+	key       []byte
+	createdAt time.Time
+	size      int64
+}
+
+// evict deletes the oldest entries from the bucket until the total
+// key+value size fits within maxSize. The on-disk file is somewhat larger due
+// to BoltDB page overhead; freed pages are reused by subsequent runs.
+func evict(b *bolt.Bucket, maxSize int64) error {
+	if maxSize <= 0 {
+		return nil
+	}
+
+	var entries []evictEntry
+	var total int64
+	_ = b.ForEach(func(k, v []byte) error {
+		_, createdAt, _ := parseValue(v)
+		size := int64(len(k) + len(v))
+		entries = append(entries, evictEntry{key: slices.Clone(k), createdAt: createdAt, size: size})
+		total += size
+		return nil
+	})
+
+	slices.SortFunc(entries, func(a, b evictEntry) int {
+		return cmp.Compare(a.createdAt.UnixNano(), b.createdAt.UnixNano())
+	})
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		if err := b.Delete(e.key); err != nil {
+			return fmt.Errorf("cache evict: %w", err)
+		}
+		total -= e.size
+	}
+	return nil
+}
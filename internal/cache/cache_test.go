@@ -2,8 +2,10 @@ package cache
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
@@ -11,7 +13,7 @@ import (
 )
 
 func TestCacheDisabled(t *testing.T) {
-	c, err := Open("")
+	c, err := Open("", 0, 0, KeyPath, nil)
 	if err != nil {
 		t.Fatalf("Open() failed: %v", err)
 	}
@@ -38,7 +40,7 @@ func TestCacheRoundTrip(t *testing.T) {
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
 	// First run: store entries
-	c1, err := Open(cachePath)
+	c1, err := Open(cachePath, 0, 0, KeyPath, nil)
 	if err != nil {
 		t.Fatalf("Open() failed: %v", err)
 	}
@@ -62,7 +64,7 @@ func TestCacheRoundTrip(t *testing.T) {
 	}
 
 	// Second run: lookup entries
-	c2, err := Open(cachePath)
+	c2, err := Open(cachePath, 0, 0, KeyPath, nil)
 	if err != nil {
 		t.Fatalf("Open() second time failed: %v", err)
 	}
@@ -98,7 +100,7 @@ func TestCacheMissOnMtimeChange(t *testing.T) {
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
 	// Store with original mtime
-	c1, _ := Open(cachePath)
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	fi := &types.FileInfo{
 		Path:    "/test/file.txt",
 		Size:    1024,
@@ -110,7 +112,7 @@ func TestCacheMissOnMtimeChange(t *testing.T) {
 	_ = c1.Close()
 
 	// Lookup with different mtime
-	c2, _ := Open(cachePath)
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	defer func() { _ = c2.Close() }()
 
 	fiModified := &types.FileInfo{
@@ -130,13 +132,13 @@ func TestCacheMissOnSizeChange(t *testing.T) {
 	tmpDir := t.TempDir()
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
-	c1, _ := Open(cachePath)
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	fi := &types.FileInfo{Path: "/test/file.txt", Size: 1024, Ino: 12345, ModTime: time.Now()}
 	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
 	_ = c1.Store(fi, 0, 1024, hash)
 	_ = c1.Close()
 
-	c2, _ := Open(cachePath)
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	defer func() { _ = c2.Close() }()
 
 	fiDifferentSize := &types.FileInfo{Path: fi.Path, Size: 2048, Ino: fi.Ino, ModTime: fi.ModTime}
@@ -150,13 +152,13 @@ func TestCacheMissOnInodeChange(t *testing.T) {
 	tmpDir := t.TempDir()
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
-	c1, _ := Open(cachePath)
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	fi := &types.FileInfo{Path: "/test/file.txt", Size: 1024, Ino: 12345, ModTime: time.Now()}
 	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
 	_ = c1.Store(fi, 0, 1024, hash)
 	_ = c1.Close()
 
-	c2, _ := Open(cachePath)
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	defer func() { _ = c2.Close() }()
 
 	// Simulates: file deleted, new file created with same path (different inode)
@@ -171,13 +173,13 @@ func TestCacheMissOnPathChange(t *testing.T) {
 	tmpDir := t.TempDir()
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
-	c1, _ := Open(cachePath)
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	fi := &types.FileInfo{Path: "/test/original.txt", Size: 1024, Ino: 12345, ModTime: time.Now()}
 	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
 	_ = c1.Store(fi, 0, 1024, hash)
 	_ = c1.Close()
 
-	c2, _ := Open(cachePath)
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	defer func() { _ = c2.Close() }()
 
 	fiDifferentPath := &types.FileInfo{Path: "/test/renamed.txt", Size: fi.Size, Ino: fi.Ino, ModTime: fi.ModTime}
@@ -191,13 +193,13 @@ func TestCacheMissOnStartChange(t *testing.T) {
 	tmpDir := t.TempDir()
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
-	c1, _ := Open(cachePath)
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	fi := &types.FileInfo{Path: "/test/file.txt", Size: 1024, Ino: 12345, ModTime: time.Now()}
 	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
 	_ = c1.Store(fi, 0, 512, hash) // Store first 512 bytes
 	_ = c1.Close()
 
-	c2, _ := Open(cachePath)
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	defer func() { _ = c2.Close() }()
 
 	// Lookup with different start offset - should miss
@@ -211,13 +213,13 @@ func TestCacheMissOnRangeSizeChange(t *testing.T) {
 	tmpDir := t.TempDir()
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
-	c1, _ := Open(cachePath)
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	fi := &types.FileInfo{Path: "/test/file.txt", Size: 1024, Ino: 12345, ModTime: time.Now()}
 	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
 	_ = c1.Store(fi, 0, 512, hash) // Store range [0, 512)
 	_ = c1.Close()
 
-	c2, _ := Open(cachePath)
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	defer func() { _ = c2.Close() }()
 
 	// Lookup with same start but different size - should miss
@@ -232,7 +234,7 @@ func TestSelfCleaning(t *testing.T) {
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
 	// First run: store two entries
-	c1, _ := Open(cachePath)
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	fiA := &types.FileInfo{Path: "/a.txt", Size: 100, Ino: 1, ModTime: time.Now()}
 	fiB := &types.FileInfo{Path: "/b.txt", Size: 200, Ino: 2, ModTime: time.Now()}
 	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
@@ -241,13 +243,13 @@ func TestSelfCleaning(t *testing.T) {
 	_ = c1.Close()
 
 	// Second run: only lookup fiA (fiB becomes orphan)
-	c2, _ := Open(cachePath)
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	_, _ = c2.Lookup(fiA, 0, 100) // Hit - will be copied to new DB
 	// fiB is NOT looked up
 	_ = c2.Close()
 
 	// Third run: fiB should be gone (self-cleaned)
-	c3, _ := Open(cachePath)
+	c3, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	defer func() { _ = c3.Close() }()
 
 	// fiA should still exist
@@ -263,11 +265,41 @@ func TestSelfCleaning(t *testing.T) {
 	}
 }
 
+// TestCacheMergeBatches tests that merging across several transactions keeps
+// every entry.
+func TestCacheMergeBatches(t *testing.T) {
+	defer func(n int) { mergeBatchSize = n }(mergeBatchSize)
+	mergeBatchSize = 2
+
+	cachePath := filepath.Join(t.TempDir(), "cache.db")
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	files := make([]*types.FileInfo, 5)
+	for i := range files {
+		files[i] = &types.FileInfo{Path: fmt.Sprintf("/f%d", i), Size: 100, Ino: uint64(i), ModTime: time.Unix(1609459200, 0)}
+	}
+
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	for _, fi := range files {
+		_ = c1.Store(fi, 0, 100, hash)
+	}
+	if err := c1.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	defer func() { _ = c2.Close() }()
+	for _, fi := range files {
+		if got, _ := c2.Lookup(fi, 0, 100); got == nil {
+			t.Errorf("Lookup(%s) = nil after batched merge", fi.Path)
+		}
+	}
+}
+
 func TestInvalidHashSize(t *testing.T) {
 	tmpDir := t.TempDir()
 	cachePath := filepath.Join(tmpDir, "cache.db")
 
-	c, _ := Open(cachePath)
+	c, _ := Open(cachePath, 0, 0, KeyPath, nil)
 	defer func() { _ = c.Close() }()
 
 	fi := &types.FileInfo{Path: "/test.txt", Size: 100, Ino: 1, ModTime: time.Now()}
@@ -290,8 +322,8 @@ func TestMakeKeyDeterministic(t *testing.T) {
 		ModTime: time.Unix(1609459200, 123456789),
 	}
 
-	key1 := makeKey(fi, 0, 512)
-	key2 := makeKey(fi, 0, 512)
+	key1 := makeKey(KeyPath, fi, 0, 512)
+	key2 := makeKey(KeyPath, fi, 0, 512)
 
 	if !bytes.Equal(key1, key2) {
 		t.Error("makeKey() not deterministic")
@@ -302,7 +334,7 @@ func TestCacheDirCreation(t *testing.T) {
 	tmpDir := t.TempDir()
 	nestedPath := filepath.Join(tmpDir, "a", "b", "c", "cache.db")
 
-	c, err := Open(nestedPath)
+	c, err := Open(nestedPath, 0, 0, KeyPath, nil)
 	if err != nil {
 		t.Fatalf("Open() failed with nested path: %v", err)
 	}
@@ -313,3 +345,345 @@ func TestCacheDirCreation(t *testing.T) {
 		t.Error("Cache directory was not created")
 	}
 }
+
+func TestCacheInodeKeySurvivesRename(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	fi := &types.FileInfo{Path: "/test/original.txt", Size: 1024, Dev: 7, Ino: 12345, ModTime: time.Unix(1609459200, 0)}
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+
+	c1, _ := Open(cachePath, 0, 0, KeyInode, nil)
+	_ = c1.Store(fi, 0, 1024, hash)
+	_ = c1.Close()
+
+	c2, _ := Open(cachePath, 0, 0, KeyInode, nil)
+	defer func() { _ = c2.Close() }()
+
+	renamed := &types.FileInfo{Path: "/other/renamed.txt", Size: fi.Size, Dev: fi.Dev, Ino: fi.Ino, ModTime: fi.ModTime}
+	if result, _ := c2.Lookup(renamed, 0, 1024); !bytes.Equal(result, hash) {
+		t.Errorf("Lookup() after rename = %v, want cached hash", result)
+	}
+
+	otherDev := &types.FileInfo{Path: fi.Path, Size: fi.Size, Dev: 8, Ino: fi.Ino, ModTime: fi.ModTime}
+	if result, _ := c2.Lookup(otherDev, 0, 1024); result != nil {
+		t.Errorf("Lookup() with different device returned %v, want nil", result)
+	}
+}
+
+func TestCacheKeyModesDoNotCollide(t *testing.T) {
+	fi := &types.FileInfo{Path: "", Size: 1024, Dev: 0, Ino: 12345, ModTime: time.Unix(1609459200, 0)}
+
+	if bytes.Equal(makeKey(KeyPath, fi, 0, 512), makeKey(KeyInode, fi, 0, 512)) {
+		t.Error("makeKey() produced identical keys for path and inode modes")
+	}
+}
+
+func TestParseKeyMode(t *testing.T) {
+	for input, want := range map[string]KeyMode{"path": KeyPath, "inode": KeyInode} {
+		got, err := ParseKeyMode(input)
+		if err != nil || got != want {
+			t.Errorf("ParseKeyMode(%q) = %v, %v; want %v, nil", input, got, err, want)
+		}
+	}
+	if _, err := ParseKeyMode("content"); err == nil {
+		t.Error("ParseKeyMode(\"content\") should return error")
+	}
+}
+
+func TestCacheMaxAgeExpires(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	fi := &types.FileInfo{Path: "/test/file.txt", Size: 1024, Ino: 12345, ModTime: time.Unix(1609459200, 0)}
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	_ = c1.Store(fi, 0, 1024, hash)
+	_ = c1.Close()
+
+	// Generous max age: entry is still valid
+	c2, _ := Open(cachePath, 0, time.Hour, KeyPath, nil)
+	if result, _ := c2.Lookup(fi, 0, 1024); result == nil {
+		t.Error("Lookup() within max age returned nil, want hash")
+	}
+	_ = c2.Close()
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Tiny max age: entry expired, and is not carried over to the new database
+	c3, _ := Open(cachePath, 0, time.Millisecond, KeyPath, nil)
+	if result, _ := c3.Lookup(fi, 0, 1024); result != nil {
+		t.Errorf("Lookup() past max age returned %v, want nil", result)
+	}
+	_ = c3.Close()
+
+	c4, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	defer func() { _ = c4.Close() }()
+	if result, _ := c4.Lookup(fi, 0, 1024); result != nil {
+		t.Error("expired entry should have been dropped from the cache")
+	}
+}
+
+func TestCacheMaxAgePreservedAcrossRuns(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	fi := &types.FileInfo{Path: "/test/file.txt", Size: 1024, Ino: 12345, ModTime: time.Unix(1609459200, 0)}
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	_ = c1.Store(fi, 0, 1024, hash)
+	_ = c1.Close()
+
+	time.Sleep(20 * time.Millisecond)
+
+	// A hit copies the entry but must NOT refresh its creation time
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	_, _ = c2.Lookup(fi, 0, 1024)
+	_ = c2.Close()
+
+	c3, _ := Open(cachePath, 0, 10*time.Millisecond, KeyPath, nil)
+	defer func() { _ = c3.Close() }()
+	if result, _ := c3.Lookup(fi, 0, 1024); result != nil {
+		t.Error("cache hit refreshed entry age; want original creation time preserved")
+	}
+}
+
+func TestCacheMaxSizeEvictsOldest(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	files := []*types.FileInfo{
+		{Path: "/oldest.txt", Size: 100, Ino: 1, ModTime: time.Unix(1609459200, 0)},
+		{Path: "/middle.txt", Size: 100, Ino: 2, ModTime: time.Unix(1609459200, 0)},
+		{Path: "/newest.txt", Size: 100, Ino: 3, ModTime: time.Unix(1609459200, 0)},
+	}
+	entrySize := int64(len(makeKey(KeyPath, files[0], 0, 100)) + valueSize)
+
+	// Room for exactly two entries
+	c1, _ := Open(cachePath, 2*entrySize, 0, KeyPath, nil)
+	for _, fi := range files {
+		_ = c1.Store(fi, 0, 100, hash)
+		time.Sleep(time.Millisecond) // Distinct creation times
+	}
+	if err := c1.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	c2, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	defer func() { _ = c2.Close() }()
+
+	if result, _ := c2.Lookup(files[0], 0, 100); result != nil {
+		t.Error("oldest entry should have been evicted")
+	}
+	for _, fi := range files[1:] {
+		if result, _ := c2.Lookup(fi, 0, 100); result == nil {
+			t.Errorf("%s should have survived eviction", fi.Path)
+		}
+	}
+}
+
+func TestCacheConcurrentInstances(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	fiOld := &types.FileInfo{Path: "/old.txt", Size: 100, Ino: 1, ModTime: time.Unix(1609459200, 0)}
+	fiA := &types.FileInfo{Path: "/tree-a/a.txt", Size: 100, Ino: 2, ModTime: time.Unix(1609459200, 0)}
+	fiB := &types.FileInfo{Path: "/tree-b/b.txt", Size: 100, Ino: 3, ModTime: time.Unix(1609459200, 0)}
+
+	// Previous run left one entry in the main cache
+	c0, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	_ = c0.Store(fiOld, 0, 100, hash)
+	_ = c0.Close()
+
+	// Two overlapping runs on different trees
+	cA, err := Open(cachePath, 0, 0, KeyPath, nil)
+	if err != nil {
+		t.Fatalf("Open() first instance failed: %v", err)
+	}
+	cB, err := Open(cachePath, 0, 0, KeyPath, nil)
+	if err != nil {
+		t.Fatalf("Open() second instance failed: %v", err)
+	}
+
+	_ = cA.Store(fiA, 0, 100, hash)
+	_, _ = cA.Lookup(fiOld, 0, 100) // Run A still uses the old entry
+	_ = cB.Store(fiB, 0, 100, hash)
+
+	if err := cA.Close(); err != nil {
+		t.Fatalf("Close() first instance failed: %v", err)
+	}
+	if err := cB.Close(); err != nil {
+		t.Fatalf("Close() second instance failed: %v", err)
+	}
+
+	c, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	defer func() { _ = c.Close() }()
+
+	for _, fi := range []*types.FileInfo{fiOld, fiA, fiB} {
+		if result, _ := c.Lookup(fi, 0, 100); result == nil {
+			t.Errorf("%s missing after concurrent runs", fi.Path)
+		}
+	}
+
+	// Only the main file, its lock, and the current run file remain
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 3 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("cache dir contains %v, want cache.db, cache.db.lock and one run file", names)
+	}
+}
+
+func TestCacheConcurrentSelfCleaning(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	fiStale := &types.FileInfo{Path: "/stale.txt", Size: 100, Ino: 1, ModTime: time.Unix(1609459200, 0)}
+	fiA := &types.FileInfo{Path: "/a.txt", Size: 100, Ino: 2, ModTime: time.Unix(1609459200, 0)}
+
+	c0, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	_ = c0.Store(fiStale, 0, 100, hash)
+	_ = c0.Close()
+
+	// Neither overlapping run uses the stale entry
+	cA, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	cB, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	_ = cA.Store(fiA, 0, 100, hash)
+	_ = cA.Close()
+	_ = cB.Close()
+
+	c, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	defer func() { _ = c.Close() }()
+
+	if result, _ := c.Lookup(fiStale, 0, 100); result != nil {
+		t.Error("entry unused by all overlapping runs should have been cleaned")
+	}
+	if result, _ := c.Lookup(fiA, 0, 100); result == nil {
+		t.Error("entry stored by first run was lost by second run's merge")
+	}
+}
+
+func TestRemoveStaleRuns(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	stale := cachePath + runSuffix + "crashed"
+	fresh := cachePath + runSuffix + "starting"
+	for _, p := range []string{stale, fresh} {
+		if err := os.WriteFile(p, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleRunMinAge)
+	_ = os.Chtimes(stale, old, old)
+
+	// A live instance holds a run file lock
+	live, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	livePath := live.writeDB.Path()
+	_ = os.Chtimes(livePath, old, old)
+
+	removeStaleRuns(cachePath)
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale unlocked run file should have been removed")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Error("recently created run file should be kept")
+	}
+	if _, err := os.Stat(livePath); err != nil {
+		t.Error("locked run file of a live instance should be kept")
+	}
+	_ = live.Close()
+}
+
+func TestSelfCleaningLimitedToScope(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	fiA := &types.FileInfo{Path: "/tree-a/file.txt", Size: 100, Ino: 1, ModTime: time.Unix(1609459200, 0)}
+	fiB := &types.FileInfo{Path: "/tree-b/file.txt", Size: 100, Ino: 2, ModTime: time.Unix(1609459200, 0)}
+	fiPrefix := &types.FileInfo{Path: "/tree-a-other/file.txt", Size: 100, Ino: 3, ModTime: time.Unix(1609459200, 0)}
+
+	c1, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	for _, fi := range []*types.FileInfo{fiA, fiB, fiPrefix} {
+		_ = c1.Store(fi, 0, 100, hash)
+	}
+	_ = c1.Close()
+
+	// Run on /tree-a uses nothing: only /tree-a entries are cleaned
+	c2, _ := Open(cachePath, 0, 0, KeyPath, []string{"/tree-a"})
+	_ = c2.Close()
+
+	c3, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	defer func() { _ = c3.Close() }()
+
+	if result, _ := c3.Lookup(fiA, 0, 100); result != nil {
+		t.Error("unused in-scope entry should have been cleaned")
+	}
+	if result, _ := c3.Lookup(fiB, 0, 100); result == nil {
+		t.Error("entry outside scan roots should be kept")
+	}
+	if result, _ := c3.Lookup(fiPrefix, 0, 100); result == nil {
+		t.Error("entry under sibling directory sharing a name prefix should be kept")
+	}
+}
+
+func TestInodeSelfCleaningLimitedToScopeDevices(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+	info, err := os.Stat(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := uint64(info.Sys().(*syscall.Stat_t).Dev) //nolint:unconvert // platform-dependent type
+
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	fiHere := &types.FileInfo{Dev: dev, Size: 100, Ino: 1, ModTime: time.Unix(1609459200, 0)}
+	fiOther := &types.FileInfo{Dev: dev + 1, Size: 100, Ino: 2, ModTime: time.Unix(1609459200, 0)}
+
+	c1, _ := Open(cachePath, 0, 0, KeyInode, nil)
+	for _, fi := range []*types.FileInfo{fiHere, fiOther} {
+		_ = c1.Store(fi, 0, 100, hash)
+	}
+	_ = c1.Close()
+
+	// Run on tmpDir uses nothing: only entries on its device are cleaned
+	c2, _ := Open(cachePath, 0, 0, KeyInode, []string{tmpDir})
+	_ = c2.Close()
+
+	c3, _ := Open(cachePath, 0, 0, KeyInode, nil)
+	defer func() { _ = c3.Close() }()
+
+	if result, _ := c3.Lookup(fiHere, 0, 100); result != nil {
+		t.Error("unused entry on a scanned device should have been cleaned")
+	}
+	if result, _ := c3.Lookup(fiOther, 0, 100); result == nil {
+		t.Error("entry on another device should be kept")
+	}
+}
+
+func TestIsUnder(t *testing.T) {
+	tests := []struct {
+		path, root string
+		want       bool
+	}{
+		{"/data", "/data", true},
+		{"/data/a.txt", "/data", true},
+		{"/data2/a.txt", "/data", false},
+		{"/dat", "/data", false},
+		{"/anything", "/", true},
+	}
+	for _, tt := range tests {
+		if got := isUnder(tt.path, tt.root); got != tt.want {
+			t.Errorf("isUnder(%q, %q) = %v, want %v", tt.path, tt.root, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Entry is the portable (JSON) representation of one cache entry.
+// Key fields are decoded so exports can be inspected and filtered with jq.
+type Entry struct {
+	Mode      string    `json:"mode"`           // Key mode: "path" or "inode"
+	Path      string    `json:"path,omitempty"` // File path (path mode only)
+	Dev       uint64    `json:"dev,omitempty"`  // Device ID (inode mode only)
+	Size      int64     `json:"size"`           // File size
+	Ino       uint64    `json:"ino"`            // Inode number
+	ModTime   int64     `json:"mtime"`          // Modification time (Unix nanoseconds)
+	Start     int64     `json:"start"`          // Range offset
+	Length    int64     `json:"length"`         // Range size
+	Hash      string    `json:"hash"`           // SHA-256 of the range (hex)
+	CreatedAt time.Time `json:"created,omitzero"`
+}
+
+// ExportJSON writes every entry of the cache at path as JSON Lines.
+// Returns the number of entries written.
+func ExportJSON(path string, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+
+	err := viewBucket(path, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			entry, ok := decodeEntry(k, v)
+			if !ok {
+				return nil // Unknown key version or corrupt value
+			}
+			n++
+			return enc.Encode(entry)
+		})
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// ExportBolt writes a consistent BoltDB snapshot of the cache at path.
+// Safe while other instances use the cache. Returns the number of bytes written.
+func ExportBolt(path string, w io.Writer) (int64, error) {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = db.Close() }()
+
+	var n int64
+	err = db.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// ImportJSON merges JSON Lines entries into the cache at path.
+// Existing entries are kept; imported entries replace entries with the same key.
+// Returns the number of entries imported.
+func ImportJSON(path string, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	return importEntries(path, func(put func(k, v []byte) error) (int, error) {
+		n := 0
+		for {
+			var entry Entry
+			if err := dec.Decode(&entry); err == io.EOF {
+				return n, nil
+			} else if err != nil {
+				return n, fmt.Errorf("entry %d: %w", n+1, err)
+			}
+			k, v, err := encodeEntry(&entry)
+			if err != nil {
+				return n, fmt.Errorf("entry %d: %w", n+1, err)
+			}
+			if err := put(k, v); err != nil {
+				return n, err
+			}
+			n++
+		}
+	})
+}
+
+// ImportBolt merges entries from another BoltDB cache file into the cache at path.
+// Returns the number of entries imported.
+func ImportBolt(path, srcPath string) (int, error) {
+	return importEntries(path, func(put func(k, v []byte) error) (int, error) {
+		n := 0
+		err := viewBucket(srcPath, func(b *bolt.Bucket) error {
+			return b.ForEach(func(k, v []byte) error {
+				if _, _, ok := parseValue(v); !ok {
+					return nil
+				}
+				n++
+				return put(slices.Clone(k), slices.Clone(v))
+			})
+		})
+		return n, err
+	})
+}
+
+// importEntries opens the cache, carries over all existing entries, adds new
+// ones via add, and merges the result on Close (safe with concurrent instances).
+func importEntries(path string, add func(put func(k, v []byte) error) (int, error)) (int, error) {
+	c, err := Open(path, 0, 0, KeyPath, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	err = c.writeDB.Update(func(tx *bolt.Tx) error {
+		dst := tx.Bucket([]byte(bucketName))
+		if c.readDB != nil {
+			if err := c.readDB.View(func(snapTx *bolt.Tx) error {
+				return copyBucket(dst, snapTx.Bucket([]byte(bucketName)))
+			}); err != nil {
+				return err
+			}
+		}
+		n, err = add(dst.Put)
+		return err
+	})
+	if err != nil {
+		_ = c.Close()
+		return 0, fmt.Errorf("import: %w", err)
+	}
+	return n, c.Close()
+}
+
+// copyBucket copies all entries from src into dst. A nil src is empty.
+func copyBucket(dst, src *bolt.Bucket) error {
+	if src == nil {
+		return nil
+	}
+	return src.ForEach(func(k, v []byte) error {
+		return dst.Put(slices.Clone(k), slices.Clone(v))
+	})
+}
+
+// viewBucket runs fn on the hashes bucket of a cache file opened read-only.
+func viewBucket(path string, fn func(b *bolt.Bucket) error) error {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return nil
+		}
+		return fn(b)
+	})
+}
+
+// openReadOnly opens an existing cache file without creating it.
+func openReadOnly(path string) (*bolt.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{ReadOnly: true, Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open cache: %w", err)
+	}
+	return db, nil
+}
+
+// decodeEntry converts a stored key/value pair into an Entry.
+// Returns ok=false for unknown key versions or malformed data.
+func decodeEntry(k, v []byte) (entry Entry, ok bool) {
+	hash, createdAt, ok := parseValue(v)
+	if !ok || len(k) == 0 {
+		return Entry{}, false
+	}
+
+	rest := k[1:]
+	switch k[0] {
+	case keyVersion:
+		i := bytes.IndexByte(rest, 0)
+		if i < 0 {
+			return Entry{}, false
+		}
+		entry.Mode, entry.Path, rest = "path", string(rest[:i]), rest[i+1:]
+	case keyVersionInode:
+		if len(rest) < 8 {
+			return Entry{}, false
+		}
+		entry.Mode, entry.Dev, rest = "inode", binary.BigEndian.Uint64(rest), rest[8:]
+	default:
+		return Entry{}, false
+	}
+
+	if len(rest) != 5*8 {
+		return Entry{}, false
+	}
+	entry.Size = int64(binary.BigEndian.Uint64(rest[0:]))
+	entry.Ino = binary.BigEndian.Uint64(rest[8:])
+	entry.ModTime = int64(binary.BigEndian.Uint64(rest[16:]))
+	entry.Start = int64(binary.BigEndian.Uint64(rest[24:]))
+	entry.Length = int64(binary.BigEndian.Uint64(rest[32:]))
+	entry.Hash = hex.EncodeToString(hash)
+	entry.CreatedAt = createdAt
+	return entry, true
+}
+
+// encodeEntry converts an Entry back into a stored key/value pair.
+// Entries without a creation time are treated as created now.
+func encodeEntry(entry *Entry) (k, v []byte, err error) {
+	mode, err := ParseKeyMode(entry.Mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash, err := hex.DecodeString(entry.Hash)
+	if err != nil || len(hash) != hashSize {
+		return nil, nil, fmt.Errorf("invalid hash %q", entry.Hash)
+	}
+
+	fi := &types.FileInfo{
+		Path:    entry.Path,
+		Dev:     entry.Dev,
+		Size:    entry.Size,
+		Ino:     entry.Ino,
+		ModTime: time.Unix(0, entry.ModTime),
+	}
+	createdAt := entry.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	return makeKey(mode, fi, entry.Start, entry.Length), makeValue(hash, createdAt), nil
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+func TestExportImportJSONRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "src.db")
+	dstPath := filepath.Join(tmpDir, "dst.db")
+
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	fiInode := &types.FileInfo{Path: "/data/b.txt", Size: 2048, Dev: 9, Ino: 2, ModTime: time.Unix(1609459200, 456)}
+
+	ci, _ := Open(srcPath, 0, 0, KeyInode, nil)
+	_ = ci.Store(fiInode, 1024, 1024, hash)
+	_ = ci.Close()
+
+	var buf bytes.Buffer
+	n, err := ExportJSON(srcPath, &buf)
+	if err != nil {
+		t.Fatalf("ExportJSON() failed: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("ExportJSON() exported %d entries, want 1", n)
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("exported line is not JSON: %v", err)
+	}
+	if entry.Mode != "inode" || entry.Dev != 9 || entry.Ino != 2 || entry.Start != 1024 || entry.Length != 1024 {
+		t.Errorf("exported entry = %+v, want inode entry dev=9 ino=2 range [1024,2048)", entry)
+	}
+
+	if _, err := ImportJSON(dstPath, &buf); err != nil {
+		t.Fatalf("ImportJSON() failed: %v", err)
+	}
+
+	c, _ := Open(dstPath, 0, 0, KeyInode, nil)
+	defer func() { _ = c.Close() }()
+	renamed := &types.FileInfo{Path: "/moved.txt", Size: 2048, Dev: 9, Ino: 2, ModTime: fiInode.ModTime}
+	if result, _ := c.Lookup(renamed, 1024, 1024); !bytes.Equal(result, hash) {
+		t.Errorf("Lookup() after import = %v, want hash", result)
+	}
+}
+
+func TestImportKeepsExistingEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache.db")
+
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	existing := &types.FileInfo{Path: "/existing.txt", Size: 100, Ino: 1, ModTime: time.Unix(1609459200, 0)}
+
+	c0, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	_ = c0.Store(existing, 0, 100, hash)
+	_ = c0.Close()
+
+	line := `{"mode":"path","path":"/imported.txt","size":100,"ino":2,"mtime":0,"start":0,"length":100,` +
+		`"hash":"6162636465666768696a6b6c6d6e6f707172737475767778797a303132333435"}`
+	n, err := ImportJSON(cachePath, strings.NewReader(line+"\n"))
+	if err != nil || n != 1 {
+		t.Fatalf("ImportJSON() = %d, %v; want 1, nil", n, err)
+	}
+
+	c, _ := Open(cachePath, 0, 0, KeyPath, nil)
+	defer func() { _ = c.Close() }()
+	imported := &types.FileInfo{Path: "/imported.txt", Size: 100, Ino: 2, ModTime: time.Unix(0, 0)}
+	for _, fi := range []*types.FileInfo{existing, imported} {
+		if result, _ := c.Lookup(fi, 0, 100); !bytes.Equal(result, hash) {
+			t.Errorf("Lookup(%s) = %v, want hash", fi.Path, result)
+		}
+	}
+}
+
+func TestImportJSONInvalid(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.db")
+
+	for name, input := range map[string]string{
+		"bad json":  `{"mode":`,
+		"bad mode":  `{"mode":"content","hash":"00"}`,
+		"bad hash":  `{"mode":"path","hash":"zz"}`,
+		"short sum": `{"mode":"path","hash":"abcd"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ImportJSON(cachePath, strings.NewReader(input)); err == nil {
+				t.Errorf("ImportJSON(%q) should return error", input)
+			}
+		})
+	}
+}
+
+func TestExportImportBolt(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "src.db")
+	backupPath := filepath.Join(tmpDir, "backup.db")
+	dstPath := filepath.Join(tmpDir, "dst.db")
+
+	hash := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	fi := &types.FileInfo{Path: "/a.txt", Size: 100, Ino: 1, ModTime: time.Unix(1609459200, 0)}
+
+	c0, _ := Open(srcPath, 0, 0, KeyPath, nil)
+	_ = c0.Store(fi, 0, 100, hash)
+	_ = c0.Close()
+
+	f, err := os.Create(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExportBolt(srcPath, f); err != nil {
+		t.Fatalf("ExportBolt() failed: %v", err)
+	}
+	_ = f.Close()
+
+	n, err := ImportBolt(dstPath, backupPath)
+	if err != nil || n != 1 {
+		t.Fatalf("ImportBolt() = %d, %v; want 1, nil", n, err)
+	}
+
+	c, _ := Open(dstPath, 0, 0, KeyPath, nil)
+	defer func() { _ = c.Close() }()
+	if result, _ := c.Lookup(fi, 0, 100); !bytes.Equal(result, hash) {
+		t.Errorf("Lookup() after bolt import = %v, want hash", result)
+	}
+}
+
+func TestExportMissingCache(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.db")
+	if _, err := ExportJSON(missing, &bytes.Buffer{}); err == nil {
+		t.Error("ExportJSON() on missing cache should return error")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Error("ExportJSON() must not create a missing cache file")
+	}
+}
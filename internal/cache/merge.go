@@ -0,0 +1,205 @@
+//go:build unix
+
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// runSuffix marks per-run cache files: <cache>.run-<random>
+	runSuffix = ".run-"
+	// staleRunMinAge protects run files that were just created but not yet
+	// locked by BoltDB from being mistaken for leftovers of a crashed instance.
+	staleRunMinAge = 1 * time.Minute
+	// mergeLockTimeout bounds how long Close waits for another instance's merge.
+	mergeLockTimeout = 1 * time.Minute
+	// lockPollInterval is the retry interval while waiting for the merge lock.
+	lockPollInterval = 50 * time.Millisecond
+)
+
+// mergeBatchSize is the number of entries written per merge transaction.
+// BoltDB keeps a transaction's dirty pages in memory until commit, so one
+// transaction for the whole cache would need memory proportional to its size.
+var mergeBatchSize = 10000
+
+// merge combines this run's entries with entries written by concurrent runs
+// and atomically replaces the main cache file.
+//
+// Runs under an exclusive lock so two instances closing at the same time
+// cannot overwrite each other's results. Eviction is applied to the merged set.
+func (c *Cache) merge(runPath string) error {
+	lock, err := acquireLock(c.path+".lock", mergeLockTimeout)
+	if err != nil {
+		return fmt.Errorf("lock cache for merge: %w", err)
+	}
+	defer func() { _ = lock.Close() }() // Closing releases the flock
+
+	mergePath := c.path + ".merge"
+	_ = os.Remove(mergePath) // Leftover from a crashed merge (safe: we hold the lock)
+
+	out, err := bolt.Open(mergePath, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return fmt.Errorf("create merged cache: %w", err)
+	}
+
+	err = out.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		return err
+	})
+	if err == nil {
+		err = c.copyConcurrent(out)
+	}
+	if err == nil {
+		err = copyEntries(out, runPath, nil)
+	}
+	if err == nil {
+		err = out.Update(func(tx *bolt.Tx) error {
+			return evict(tx.Bucket([]byte(bucketName)), c.maxSize)
+		})
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(mergePath)
+		return fmt.Errorf("merge cache: %w", err)
+	}
+
+	return os.Rename(mergePath, c.path)
+}
+
+// copyConcurrent copies main cache entries written by runs that finished after
+// this run opened its snapshot, plus all entries outside this run's scope.
+// In-scope entries identical to the snapshot are stale.
+func (c *Cache) copyConcurrent(dst *bolt.DB) error {
+	if _, err := os.Stat(c.path); err != nil {
+		return nil // No main cache yet
+	}
+
+	if c.readDB == nil {
+		return copyEntries(dst, c.path, nil) // No snapshot: everything is new to us
+	}
+
+	return c.readDB.View(func(snapTx *bolt.Tx) error {
+		snap := snapTx.Bucket([]byte(bucketName))
+		return copyEntries(dst, c.path, func(k, v []byte) bool {
+			return snap == nil || !bytes.Equal(snap.Get(k), v) || !c.inScope(k)
+		})
+	})
+}
+
+// copyEntries copies entries from the cache file at srcPath into dst's bucket,
+// committing every mergeBatchSize entries.
+// If keep is non-nil, only entries for which it returns true are copied.
+func copyEntries(dst *bolt.DB, srcPath string, keep func(k, v []byte) bool) error {
+	src, err := bolt.Open(srcPath, 0o600, &bolt.Options{ReadOnly: true, Timeout: 1 * time.Second})
+	if err != nil {
+		return fmt.Errorf("open %s: %w", filepath.Base(srcPath), err)
+	}
+	defer func() { _ = src.Close() }()
+
+	var batch [][2][]byte
+	flush := func() error {
+		err := dst.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(bucketName))
+			for _, kv := range batch {
+				if err := b.Put(kv[0], kv[1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		batch = batch[:0]
+		return err
+	}
+
+	err = src.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if keep != nil && !keep(k, v) {
+				return nil
+			}
+			// Source memory is only valid during its transaction
+			batch = append(batch, [2][]byte{slices.Clone(k), slices.Clone(v)})
+			if len(batch) < mergeBatchSize {
+				return nil
+			}
+			return flush()
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// acquireLock takes an exclusive flock on path, retrying until timeout.
+// The lock file itself is never removed (removal would race with waiters).
+func acquireLock(path string, timeout time.Duration) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			_ = f.Close()
+			return nil, err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// removeStaleRuns deletes run files left behind by crashed instances.
+// A live instance holds BoltDB's exclusive flock on its run file.
+func removeStaleRuns(path string) {
+	dir, prefix := filepath.Dir(path), filepath.Base(path)+runSuffix
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-staleRunMinAge)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		removeIfUnlocked(filepath.Join(dir, entry.Name()))
+	}
+}
+
+// removeIfUnlocked removes path if no process holds a flock on it.
+func removeIfUnlocked(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	if syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) == nil {
+		_ = os.Remove(path)
+	}
+}
@@ -0,0 +1,59 @@
+// Package color adds ANSI colors to human-readable output.
+//
+// Colors are used only when the stream is a terminal, --no-color is not given,
+// NO_COLOR (https://no-color.org) is unset or empty and TERM is not "dumb", so logs and
+// pipes stay free of escape codes.
+package color
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ANSI color codes.
+const (
+	red    = "31"
+	green  = "32"
+	yellow = "33"
+)
+
+// Palette colors strings written to one stream. The zero value is disabled.
+type Palette struct {
+	enabled bool
+}
+
+// Stdout and Stderr color output written to the respective stream.
+// Both are disabled until Init is called.
+var Stdout, Stderr Palette
+
+// Init enables the palettes of streams that support color, unless noColor.
+func Init(noColor bool) {
+	Stdout = Palette{enabled: !noColor && supported(os.Stdout)}
+	Stderr = Palette{enabled: !noColor && supported(os.Stderr)}
+}
+
+// supported reports whether f is a color-capable terminal and color is not
+// disabled by the environment.
+func supported(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd())) //nolint:gosec // fd fits in int
+}
+
+// Red colors errors.
+func (p Palette) Red(s string) string { return p.paint(red, s) }
+
+// Green colors successful changes.
+func (p Palette) Green(s string) string { return p.paint(green, s) }
+
+// Yellow colors skipped files.
+func (p Palette) Yellow(s string) string { return p.paint(yellow, s) }
+
+func (p Palette) paint(code, s string) string {
+	if !p.enabled {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
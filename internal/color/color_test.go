@@ -0,0 +1,47 @@
+package color
+
+import (
+	"os"
+	"testing"
+)
+
+// TestPalette tests that only enabled palettes add escape codes.
+func TestPalette(t *testing.T) {
+	if got := (Palette{}).Red("x"); got != "x" {
+		t.Errorf("disabled Red() = %q, want %q", got, "x")
+	}
+	on := Palette{enabled: true}
+	tests := []struct {
+		got, want string
+	}{
+		{on.Red("x"), "\033[31mx\033[0m"},
+		{on.Green("x"), "\033[32mx\033[0m"},
+		{on.Yellow("x"), "\033[33mx\033[0m"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
+// TestSupported tests that NO_COLOR, TERM=dumb and non-terminals disable color.
+func TestSupported(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm")
+	if supported(f) {
+		t.Error("supported() = true for a regular file")
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	Init(false)
+	if Stdout.enabled || Stderr.enabled {
+		t.Error("Init() enabled color with NO_COLOR set")
+	}
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package deduper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/ivoronin/dupedog/internal/types"
+	"golang.org/x/sys/unix"
+)
+
+// dedupeRangeChunk is the length deduplicated per FIDEDUPERANGE call; some
+// filesystems (btrfs) cap a single request at 16 MiB.
+const dedupeRangeChunk = 16 << 20
+
+// ShareExtents makes target share source's extents in place with
+// FIDEDUPERANGE. The kernel compares both files under lock and shares only
+// identical ranges, so target keeps its inode, metadata and content.
+// Filesystems without extent sharing fail with an error matching
+// errors.ErrUnsupported, EINVAL or ENOTTY (see extentSharingUnsupported).
+func ShareExtents(source, target string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+	dst, err := os.OpenFile(target, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dst.Close() }()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	size := uint64(info.Size()) //nolint:gosec // File sizes are never negative
+	for offset := uint64(0); offset < size; {
+		r := unix.FileDedupeRange{
+			Src_offset: offset,
+			Src_length: min(dedupeRangeChunk, size-offset),
+			Info:       []unix.FileDedupeRangeInfo{{Dest_fd: int64(dst.Fd()), Dest_offset: offset}},
+		}
+		if err := unix.IoctlFileDedupeRange(int(src.Fd()), &r); err != nil {
+			return err
+		}
+		switch status := r.Info[0].Status; {
+		case status < 0:
+			return syscall.Errno(-status)
+		case status == unix.FILE_DEDUPE_RANGE_DIFFERS:
+			return fmt.Errorf("%w: content differs from %s at offset %d", types.ErrModifiedSinceScan, source, offset)
+		}
+		if r.Info[0].Bytes_deduped == 0 {
+			return errors.New("no bytes deduplicated")
+		}
+		offset += r.Info[0].Bytes_deduped
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package deduper
+
+import "errors"
+
+// ShareExtents is not supported outside Linux.
+func ShareExtents(string, string) error {
+	return errors.ErrUnsupported
+}
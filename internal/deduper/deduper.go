@@ -10,19 +10,38 @@
 //
 //	Input: types.DuplicateGroups (confirmed duplicate sibling groups)
 //	    │
-//	    ├──► For each DuplicateGroup:
+//	    ├──► For each DuplicateGroup, largest savings first:
 //	    │        │
 //	    │        ├──► Select source file (searching ALL paths in ALL sibling groups)
 //	    │        │
 //	    │        ├──► Skip source's sibling group (already hardlinked)
 //	    │        │
+//	    │        ├──► With balancing: keep every existing hardlink group as a
+//	    │        │    source and spread the other targets across them
+//	    │        │
 //	    │        └──► For each file in other sibling groups (targets):
 //	    │                 │
+//	    │                 ├──► Skip files under read-only (reference) roots
+//	    │                 │
+//	    │                 ├──► Refuse protected paths (reported as skipped)
+//	    │                 │
+//	    │                 ├──► Skip targets on read-only mounts (reported as skipped)
+//	    │                 │
+//	    │                 ├──► Skip immutable and append-only files (chattr +i / +a)
+//	    │                 │
 //	    │                 ├──► Verify mtime unchanged (safety check)
 //	    │                 │
+//	    │                 ├──► Leave alone if already sharing all extents (FIEMAP)
+//	    │                 │
+//	    │                 ├──► Run --pre-hook (non-zero exit skips the target)
+//	    │                 │
+//	    │                 ├──► Wait for --max-ops-per-sec
+//	    │                 │
 //	    │                 ├──► Try hardlink (atomic replace)
 //	    │                 │
-//	    │                 └──► If EXDEV and --symlink-fallback: try symlink
+//	    │                 ├──► If EXDEV and --symlink-fallback: try symlink
+//	    │                 │
+//	    │                 └──► Run --post-hook (failure is reported, not fatal)
 //	    │
 //	    └──► Output: stats (sets deduplicated, bytes saved)
 //
@@ -32,11 +51,25 @@
 // The deduper skips the source's sibling group entirely - no redundant work.
 // Path priority searches ALL paths in ALL sibling groups for correct selection.
 //
+// # Link Balancing
+//
+// By default every target is linked to the one source, so a group that already
+// holds several hardlink groups (e.g. from earlier rsync --link-dest runs) is
+// merged into a single inode. With balancing, each existing hardlink group
+// (nlink > 1) and the source's sibling group are kept as hubs, and each
+// remaining sibling group is linked to the hub with the lowest nlink at that
+// moment. This keeps link counts even and below filesystem limits (e.g.
+// 65000 on ext4), at the cost of keeping one inode per hub.
+//
 // # Safety Mechanisms
 //
 //   - Mtime verification prevents replacing files modified during scan
+//   - Files already sharing extents (reflinks) are left alone and not counted as savings
 //   - Atomic replacement via rename (write temp → rename over target)
 //   - Path priority allows preserving preferred copies (e.g., backups)
+//   - Read-only roots are never replaced or relinked
+//   - Protected paths may be sources but never targets
+//   - Targets on read-only mounts are skipped up front, without trying to link
 //   - Dry-run mode for previewing changes
 //
 // # Why This Design?
@@ -49,14 +82,21 @@
 package deduper
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/color"
+	"github.com/ivoronin/dupedog/internal/mounts"
+	"github.com/ivoronin/dupedog/internal/pathnorm"
+	"github.com/ivoronin/dupedog/internal/pause"
 	"github.com/ivoronin/dupedog/internal/progress"
 	"github.com/ivoronin/dupedog/internal/types"
 )
@@ -66,31 +106,93 @@ import (
 // The deduper is designed for single-use: create with New(), call Run() once.
 type Deduper struct {
 	// Config (immutable, set by New)
-	groups       types.DuplicateGroups // Confirmed duplicate groups to process
-	pathPriority []string              // Preferred source paths (first match wins)
-	dryRun       bool                  // Preview mode (don't modify files)
-	symlinkFallback bool               // Fall back to symlinks across device boundaries
-	verbose      bool                  // Print each replacement to stdout
-	showProgress bool                  // Whether to display progress bar
-	errCh        chan error            // Non-fatal errors (permission denied, etc.)
+	groups          types.DuplicateGroups // Confirmed duplicate groups to process
+	pathPriority    []string              // Preferred source path globs (first match wins)
+	avoid           []string              // Path globs never chosen as sources
+	prefer          Preference            // Tie-breaker among equally preferred sources
+	keepFirstListed []string              // Roots in argument order; if set, the only source criterion
+	readOnly        []string              // Absolute roots whose files are never targets
+	protect         []string              // Glob patterns for paths that are never targets
+	normalize       pathnorm.Form         // Unicode form paths and patterns are compared in
+	preHook         string                // Shell command run before each replacement (empty = none)
+	postHook        string                // Shell command run after each replacement (empty = none)
+	journal         *Journal              // Intent log of replacements (nil = none)
+	link            LinkOptions           // Temporary link placement and syncing
+	lockWait        time.Duration         // How long to wait for a target's lock (0 = skip locked targets at once)
+	dryRun          bool                  // Preview mode (don't modify files)
+	action          ActionType            // ActionHardlink, ActionSymlink to always symlink, or ActionAuto
+	reflinkDevs     map[uint64]bool       // ActionAuto: devices probed for extent sharing
+	symlinkFallback bool                  // Fall back to symlinks across device boundaries
+	symlinkRoots    []string              // If set, symlink sources must resolve under one of these roots
+	balanceLinks    bool                  // Spread targets across existing hardlink groups
+	limiter         *rateLimiter          // Spaces replacements (--max-ops-per-sec)
+	verbosity       int                   // 1: print each replacement to stdout, 2: and each skip
+	reporter        progress.Reporter     // Receives progress (nil = none)
+	errCh           chan *types.Event     // Non-fatal errors (permission denied, etc.)
+}
+
+// Options configures a Deduper. The zero value replaces every target with a
+// hardlink, choosing sources by PreferDefault.
+type Options struct {
+	PathPriority    []string          // Preferred source path globs (first match wins)
+	Avoid           []string          // Path globs never chosen as sources
+	Prefer          Preference        // Tie-breaker among equally preferred sources
+	KeepFirstListed []string          // If set, keep the file under the earliest of these roots, ignoring PathPriority, Prefer and nlink
+	ReadOnly        []string          // Absolute roots whose files are never targets
+	Protect         []string          // Glob patterns for paths that are never targets
+	Normalize       pathnorm.Form     // Unicode form of paths and patterns when matching PathPriority, Avoid and Protect (default: as is)
+	PreHook         string            // Shell command run before each replacement (empty = none)
+	PostHook        string            // Shell command run after each replacement (empty = none)
+	Journal         *Journal          // Records each replacement before it is made (nil = none)
+	Fsync           bool              // Sync each target's directory after its rename, so replacements survive a power loss
+	TmpSuffix       string            // Suffix of temporary links ("" = .dupedog.tmp)
+	StagingDir      string            // Make temporary links in this directory at the top of each target's filesystem (empty = next to the target)
+	OrphanAge       time.Duration     // Minimum age of a leftover temporary link before it may be removed (0 = 1 minute)
+	LockWait        time.Duration     // Wait up to this long for a locked target before skipping it (0 = skip at once)
+	MaxOpsPerSec    float64           // Caps replacements per second (0 = unlimited)
+	DryRun          bool              // Preview mode (don't modify files)
+	Action          ActionType        // ActionSymlink replaces targets with symlinks even on the same device, ActionAuto picks per target (default ActionHardlink)
+	SymlinkFallback bool              // Fall back to symlinks across device boundaries
+	SymlinkRoots    []string          // If set, refuse symlinks to sources that resolve outside these roots
+	BalanceLinks    bool              // Spread targets across existing hardlink groups
+	Verbosity       int               // 1: print every replacement (in a dry run, every group), 2: and every skipped target
+	Reporter        progress.Reporter // Receives progress (nil = none)
 }
 
 // New creates a Deduper for replacing duplicates with links.
-func New(groups types.DuplicateGroups, pathPriority []string, dryRun, symlinkFallback, verbose, showProgress bool, errCh chan error) *Deduper {
+// Non-fatal errors are sent to errCh.
+func New(groups types.DuplicateGroups, opts Options, errCh chan *types.Event) *Deduper {
 	return &Deduper{
 		groups:          groups,
-		pathPriority:    pathPriority,
-		dryRun:          dryRun,
-		symlinkFallback: symlinkFallback,
-		verbose:      verbose,
-		showProgress: showProgress,
-		errCh:        errCh,
+		pathPriority:    opts.Normalize.ApplyAll(canonicalPatterns(opts.PathPriority)),
+		avoid:           opts.Normalize.ApplyAll(canonicalPatterns(opts.Avoid)),
+		prefer:          opts.Prefer,
+		keepFirstListed: opts.KeepFirstListed,
+		readOnly:        opts.ReadOnly,
+		protect:         opts.Normalize.ApplyAll(opts.Protect),
+		normalize:       opts.Normalize,
+		preHook:         opts.PreHook,
+		postHook:        opts.PostHook,
+		journal:         opts.Journal,
+		link:            LinkOptions{TmpSuffix: opts.TmpSuffix, StagingDir: opts.StagingDir, Fsync: opts.Fsync, OrphanAge: opts.OrphanAge},
+		lockWait:        opts.LockWait,
+		dryRun:          opts.DryRun,
+		action:          opts.Action,
+		reflinkDevs:     make(map[uint64]bool),
+		symlinkFallback: opts.SymlinkFallback,
+		symlinkRoots:    opts.SymlinkRoots,
+		balanceLinks:    opts.BalanceLinks,
+		limiter:         newRateLimiter(opts.MaxOpsPerSec),
+		verbosity:       opts.Verbosity,
+		reporter:        opts.Reporter,
+		errCh:           errCh,
 	}
 }
 
 // stats tracks deduplication progress.
 type stats struct {
 	totalFiles     int
+	doneFiles      int // Attempted targets, including skipped ones
 	processedFiles int
 	totalSets      int
 	processedSets  int
@@ -98,81 +200,250 @@ type stats struct {
 	startTime      time.Time
 }
 
+// Counts implements progress.Counter: targets attempted and bytes saved.
+func (s *stats) Counts() (items, bytes int64) {
+	return int64(s.doneFiles), s.savedBytes
+}
+
 func (s *stats) String() string {
 	pct := 0.0
 	if s.totalFiles > 0 {
 		pct = float64(s.processedFiles) / float64(s.totalFiles) * 100
 	}
-	return fmt.Sprintf("Deduplicated %d/%d files in %d/%d sets (%.0f%%), saved %s in %.1fs",
+	elapsed := time.Since(s.startTime).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(s.doneFiles) / elapsed
+	}
+	return fmt.Sprintf("Deduplicated %d/%d files in %d/%d sets (%.0f%%), saved %s in %.1fs (%.0f files/s)",
 		s.processedFiles, s.totalFiles,
 		s.processedSets, s.totalSets,
 		pct,
 		humanize.IBytes(uint64(s.savedBytes)),
-		time.Since(s.startTime).Seconds())
+		elapsed, rate)
 }
 
-// countTargetFiles counts the total number of files to be deduplicated.
-// This excludes source files (one sibling group per duplicate group).
+// countTargetFiles counts the files Run attempts to replace: every planned
+// target outside the read-only roots, in groups with a source.
 func (d *Deduper) countTargetFiles() int {
 	total := 0
 	for _, dupeGroup := range d.groups.Items() {
 		if dupeGroup.Len() < 2 {
 			continue
 		}
-		for _, siblings := range dupeGroup.Items() {
-			total += siblings.Len()
+		source := d.pickSource(dupeGroup)
+		if source == nil {
+			continue
+		}
+		for _, l := range d.plan(dupeGroup, source) {
+			for _, f := range l.targets.Items() {
+				if !d.isReadOnly(f.Path) {
+					total++
+				}
+			}
 		}
-		total -= dupeGroup.First().Len() // Subtract source sibling group (approximate)
 	}
 	return total
 }
 
-// Run executes deduplication on all duplicate groups.
+// Run executes deduplication on all duplicate groups and returns the outcome
+// of every attempted replacement (including skipped ones).
 //
 // Processing sequence:
 //  1. For each duplicate group, select source file (searching all sibling groups)
 //  2. Skip source's sibling group (already hardlinked)
 //  3. For each file in other sibling groups, verify unchanged and replace with link
 //  4. Track bytes saved and report stats
-func (d *Deduper) Run() {
-	bar := progress.New(d.showProgress, -1)
+func (d *Deduper) Run() []*DedupeResult {
+	return d.RunContext(context.Background())
+}
+
+// RunContext is Run that stops early when ctx is canceled. Cancellation is
+// checked between replacements, so no target is left half-replaced.
+func (d *Deduper) RunContext(ctx context.Context) []*DedupeResult {
+	var results []*DedupeResult
 	st := &stats{totalFiles: d.countTargetFiles(), totalSets: d.groups.Len(), startTime: time.Now()}
-	bar.Describe(st) // Render progress bar immediately
+	bar := progress.NewCounter(d.reporter, "dedupe", int64(st.totalFiles), "files")
+	bar.Describe(st)                       // Render progress bar immediately
+	listing := d.dryRun && d.verbosity > 0 // Print whole groups instead of single replacements
+	var listed int
 
-	for _, dupeGroup := range d.groups.Items() {
+	// Largest savings first, so an interrupted run has freed the most space
+	for _, dupeGroup := range bySavings(d.groups) {
+		if ctx.Err() != nil {
+			break
+		}
 		if dupeGroup.Len() < 2 {
 			continue
 		}
 
-		source := selectSource(dupeGroup, d.pathPriority)
-
-		for _, targetSiblings := range dupeGroup.Items() {
-			// Skip source's sibling group - files are already hardlinked to each other
-			if containsFile(targetSiblings, source) {
-				continue
+		source := d.pickSource(dupeGroup)
+		if source == nil {
+			if d.keepFirstListed != nil && !underListed(dupeGroup, d.keepFirstListed) {
+				d.sendError(&types.Event{Stage: types.StageDedupe, Path: dupeGroup.First().First().Path, Err: errNotListed})
 			}
+			st.processedSets++ // Every copy is under --avoid (or unlisted): keep them all
+			continue
+		}
 
-			for _, target := range targetSiblings.Items() {
-				result := d.dedupeFile(source, target)
+		var planned []plannedTarget
+		for _, l := range d.plan(dupeGroup, source) {
+			for _, target := range l.targets.Items() {
+				if d.isReadOnly(target.Path) {
+					continue // Reference copies are never replaced
+				}
+				if pause.Wait(ctx) != nil || ctx.Err() != nil {
+					break
+				}
+				result := d.dedupeFile(l.source, target)
+				results = append(results, result)
+				st.doneFiles++
+				bar.Describe(st)
+				if listing {
+					planned = append(planned, plannedTarget{file: target, result: result})
+				}
+				if !listing && (d.verbosity > 1 || d.verbosity > 0 && result.Err == nil) {
+					fmt.Fprintf(os.Stderr, "\r\033[K") // Clear progress line
+					_, _ = fmt.Fprintln(os.Stdout, result.Colored(color.Stdout))
+				}
 				if result.Err != nil {
-					d.sendError(fmt.Errorf("%s: %w", target.Path, result.Err))
+					d.sendError(result.Event())
 					continue
 				}
 				st.savedBytes += result.BytesSaved
 				st.processedFiles++
-				if d.verbose {
-					fmt.Fprintf(os.Stderr, "\r\033[K") // Clear progress line
-					_, _ = fmt.Fprintln(os.Stdout, result)
-				}
 				bar.Describe(st)
 			}
 		}
 
+		if len(planned) > 0 {
+			listed++
+			fmt.Fprintf(os.Stderr, "\r\033[K") // Clear progress line
+			printGroupPlan(os.Stdout, color.Stdout, listed, source, planned)
+		}
+
 		st.processedSets++
 		bar.Describe(st)
 	}
 
 	bar.Finish(st)
+	return results
+}
+
+// plannedTarget is a target of a dry-run group listing and what would be done
+// with it.
+type plannedTarget struct {
+	file   *types.FileInfo
+	result *DedupeResult
+}
+
+// printGroupPlan writes group n of a --dry-run --verbose listing to w: the
+// source kept, every target with its action, the nlink counts of all of them
+// and the space the group would free. Targets linked to a hub other than
+// source (--balance-links) name it.
+func printGroupPlan(w io.Writer, p color.Palette, n int, source *types.FileInfo, planned []plannedTarget) {
+	var saved int64
+	for _, t := range planned {
+		saved += t.result.BytesSaved
+	}
+	_, _ = fmt.Fprintf(w, "Group %d: %d files of %s, would save %s\n",
+		n, len(planned)+1, humanize.IBytes(uint64(source.Size)), humanize.IBytes(uint64(saved)))
+	_, _ = fmt.Fprintf(w, "  %-9s %s (nlink %d)\n", "keep", escapePath(source.Path), source.Nlink)
+	for _, t := range planned {
+		line := fmt.Sprintf("  %-9s %s (nlink %d)", t.result.Action, escapePath(t.file.Path), t.file.Nlink)
+		switch {
+		case t.result.Err != nil:
+			line += fmt.Sprintf(": %v", t.result.Err)
+		case t.result.Source != source.Path:
+			line += " -> " + escapePath(t.result.Source)
+		}
+		if t.result.Action.Replaced() {
+			line = p.Green(line)
+		} else {
+			line = p.Yellow(line)
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
+
+// link pairs a sibling group to be replaced with the file it is linked to.
+type link struct {
+	source  *types.FileInfo
+	targets types.SiblingGroup
+}
+
+// plan assigns every sibling group of dupeGroup except the source's to a
+// source file. Without balancing, all of them are linked to source. With
+// balancing, source's sibling group and every other sibling group with
+// nlink > 1 whose files are not all avoided are kept as hubs, and each
+// remaining sibling group is linked to the hub with the lowest nlink so far
+// (ties go to source, then to the first hub in group order).
+func (d *Deduper) plan(dupeGroup types.DuplicateGroup, source *types.FileInfo) []link {
+	type hub struct {
+		source *types.FileInfo
+		nlink  int
+	}
+	hubs := []*hub{{source: source, nlink: int(source.Nlink)}}
+	var rest []types.SiblingGroup
+	for _, siblings := range dupeGroup.Items() {
+		if containsFile(siblings, source) {
+			continue // Already hardlinked to source
+		}
+		if d.balanceLinks && siblings.First().Nlink > 1 {
+			only := types.NewDuplicateGroup([]types.SiblingGroup{siblings})
+			if s := d.pickSource(only); s != nil {
+				hubs = append(hubs, &hub{source: s, nlink: int(s.Nlink)})
+				continue
+			}
+		}
+		rest = append(rest, siblings)
+	}
+
+	links := make([]link, 0, len(rest))
+	for _, siblings := range rest {
+		best := hubs[0]
+		for _, h := range hubs[1:] {
+			if h.nlink < best.nlink {
+				best = h
+			}
+		}
+		if d.balanceLinks {
+			best.nlink += siblings.Len()
+		}
+		links = append(links, link{source: best.source, targets: siblings})
+	}
+	return links
+}
+
+// isReadOnly reports whether path is under one of the read-only roots.
+func (d *Deduper) isReadOnly(path string) bool {
+	for _, root := range d.readOnly {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchProtected reports whether path matches any protect pattern.
+//
+// Patterns containing '/' are matched against the path and each of its parent
+// directories, so "/data/golden" protects everything below it. Other patterns
+// are matched against each path component, so "golden" protects any directory
+// (or file) of that name.
+func matchProtected(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		for p := path; p != "/" && p != "."; p = filepath.Dir(p) {
+			name := p
+			if !strings.Contains(pattern, "/") {
+				name = filepath.Base(p)
+			}
+			if matched, _ := filepath.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // containsFile checks if a sibling group contains the given file (by inode).
@@ -185,17 +456,68 @@ func containsFile(siblings types.SiblingGroup, f *types.FileInfo) bool {
 	return false
 }
 
+// lockPollInterval is the retry interval while waiting for a target's lock.
+const lockPollInterval = 50 * time.Millisecond
+
+// lockTarget takes an exclusive flock on f, retrying for up to wait while
+// another process holds it. Scanners and antivirus software often hold a
+// file only briefly.
+func lockTarget(f *os.File, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EWOULDBLOCK) || !time.Now().Before(deadline) {
+			return err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// readOnlyDevice reports whether a device is mounted read-only (a variable so
+// tests can stub it).
+var readOnlyDevice = func(dev uint64) bool {
+	m, ok := mounts.Lookup(dev)
+	return ok && m.ReadOnly
+}
+
 // dedupeFile replaces target with a link to source.
 //
 // Safety checks:
-//   - Acquires exclusive advisory lock on target (skips if file in use)
+//   - Refuses protected targets
+//   - Skips targets on read-only mounts
+//   - Acquires exclusive advisory lock on target (skips if file in use,
+//     after waiting up to lockWait)
+//   - Skips immutable and append-only targets
 //   - Verifies target mtime unchanged since scan
 //   - Returns skip result if file was modified or locked
+//   - Leaves target alone if it already shares all extents with source
+//   - Runs pre/post hooks around the replacement (see replace)
 //
 // Link strategy:
 //   - Tries hardlink first (preferred)
 //   - Falls back to symlink if EXDEV and symlinkFallback enabled
+//   - Symlinks outright with ActionSymlink
+//   - Shares extents in place with ActionAuto where supported
 func (d *Deduper) dedupeFile(source, target *types.FileInfo) *DedupeResult {
+	if matchProtected(d.normalize.Apply(target.Path), d.protect) {
+		return &DedupeResult{
+			Source: source.Path,
+			Target: target.Path,
+			Action: ActionSkipped,
+			Reason: types.ReasonProtected,
+			Err:    errors.New("protected path"),
+		}
+	}
+	if readOnlyDevice(target.Dev) {
+		return &DedupeResult{
+			Source: source.Path,
+			Target: target.Path,
+			Action: ActionSkipped,
+			Reason: types.ReasonReadOnly,
+			Err:    fmt.Errorf("read-only filesystem: %s", mounts.Describe(target.Dev)),
+		}
+	}
+
 	// Open target file to acquire advisory lock.
 	// This prevents race conditions with other processes modifying the file.
 	f, err := os.Open(target.Path)
@@ -204,23 +526,36 @@ func (d *Deduper) dedupeFile(source, target *types.FileInfo) *DedupeResult {
 			Source: source.Path,
 			Target: target.Path,
 			Action: ActionSkipped,
+			Reason: types.ReasonOf(err),
 			Err:    err,
 		}
 	}
 	defer func() { _ = f.Close() }()
 
-	// Try to acquire exclusive non-blocking lock.
-	// If file is in use by another process, skip it rather than wait.
-	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+	// Try to acquire exclusive lock.
+	// If file is still in use by another process after lockWait, skip it.
+	if err := lockTarget(f, d.lockWait); err != nil {
 		return &DedupeResult{
 			Source: source.Path,
 			Target: target.Path,
 			Action: ActionSkipped,
-			Err:    errors.New("file in use (locked by another process)"),
+			Reason: types.ReasonLocked,
+			Err:    types.ErrFileLocked,
 		}
 	}
 	// Lock released automatically when file is closed (deferred above)
 
+	// Renaming over an immutable or append-only file fails with EPERM
+	if attr := protectedAttribute(f); attr != "" {
+		return &DedupeResult{
+			Source: source.Path,
+			Target: target.Path,
+			Action: ActionSkipped,
+			Reason: types.ReasonImmutable,
+			Err:    fmt.Errorf("file is %s", attr),
+		}
+	}
+
 	// Check if mtime changed since scan
 	info, err := f.Stat()
 	if err != nil {
@@ -228,6 +563,7 @@ func (d *Deduper) dedupeFile(source, target *types.FileInfo) *DedupeResult {
 			Source: source.Path,
 			Target: target.Path,
 			Action: ActionSkipped,
+			Reason: types.ReasonOf(err),
 			Err:    err,
 		}
 	}
@@ -236,7 +572,18 @@ func (d *Deduper) dedupeFile(source, target *types.FileInfo) *DedupeResult {
 			Source: source.Path,
 			Target: target.Path,
 			Action: ActionSkipped,
-			Err:    errors.New("file modified since scan"),
+			Reason: types.ReasonModified,
+			Err:    types.ErrModifiedSinceScan,
+		}
+	}
+
+	// Extents already shared with source (reflinks) are not reclaimed by linking
+	shared := sharedBytes(source.Path, target.Path)
+	if target.DiskUsage() > 0 && shared >= target.DiskUsage() {
+		return &DedupeResult{
+			Source: source.Path,
+			Target: target.Path,
+			Action: ActionReflinked,
 		}
 	}
 
@@ -244,19 +591,147 @@ func (d *Deduper) dedupeFile(source, target *types.FileInfo) *DedupeResult {
 		return &DedupeResult{
 			Source:     source.Path,
 			Target:     target.Path,
-			Action:     ActionHardlink,
-			BytesSaved: target.Size,
+			Action:     d.dryRunAction(source, target),
+			BytesSaved: reclaimable(target, shared),
+		}
+	}
+
+	result := d.replace(source, target)
+	if result.Err == nil {
+		result.BytesSaved = reclaimable(target, shared)
+	}
+	return result
+}
+
+// reclaimable returns the disk space freed by replacing target: its allocated
+// size (so holes and compression don't inflate savings) minus extents already
+// shared with the source.
+func reclaimable(target *types.FileInfo, shared int64) int64 {
+	return max(target.DiskUsage()-shared, 0)
+}
+
+// replace runs the hooks around linkFile. A failing pre-hook skips the target;
+// a failing post-hook is reported but does not undo the replacement.
+func (d *Deduper) replace(source, target *types.FileInfo) *DedupeResult {
+	if d.preHook != "" {
+		planned := &DedupeResult{Source: source.Path, Target: target.Path, Action: d.plannedAction(source, target)}
+		if err := runHook(d.preHook, "pre", planned, target.Size); err != nil {
+			return &DedupeResult{
+				Source: source.Path,
+				Target: target.Path,
+				Action: ActionSkipped,
+				Reason: types.ReasonHook,
+				Err:    fmt.Errorf("pre-hook: %w", err),
+			}
+		}
+	}
+
+	d.limiter.wait()
+	tmp, err := d.link.TmpPath(target.Path)
+	if err != nil {
+		return &DedupeResult{Source: source.Path, Target: target.Path, Action: ActionSkipped, Reason: types.ReasonOf(err), Err: err}
+	}
+	id, err := d.journal.begin(source.Path, target.Path, tmp)
+	if err != nil {
+		// Without the intent on disk a crash could not be recovered from
+		return &DedupeResult{Source: source.Path, Target: target.Path, Action: ActionSkipped, Reason: types.ReasonOf(err), Err: err}
+	}
+	result := d.linkFile(source, target)
+	d.journal.end(id)
+
+	if d.postHook != "" {
+		if err := runHook(d.postHook, "post", result, target.Size); err != nil {
+			d.sendError(&types.Event{Stage: types.StageDedupe, Path: target.Path, Reason: types.ReasonHook, Err: fmt.Errorf("post-hook: %w", err)})
+		}
+	}
+	return result
+}
+
+// plannedAction predicts the link type for hooks: symlink with
+// ActionSymlink or across devices (when allowed), reflink with ActionAuto on
+// a device that shares extents, hardlink otherwise.
+func (d *Deduper) plannedAction(source, target *types.FileInfo) ActionType {
+	if d.action == ActionSymlink || d.symlinkFallback && source.Dev != target.Dev {
+		return ActionSymlink
+	}
+	if d.action == ActionAuto && source.Dev == target.Dev && d.sharesExtents(target.Dev) {
+		return ActionReflink
+	}
+	return ActionHardlink
+}
+
+// dryRunAction is the action reported for target in a dry run: the one
+// predicted with ActionAuto, the configured one otherwise.
+func (d *Deduper) dryRunAction(source, target *types.FileInfo) ActionType {
+	if d.action == ActionAuto {
+		return d.plannedAction(source, target)
+	}
+	return d.action
+}
+
+// cowFilesystems are the filesystem types expected to share extents, used
+// to predict ActionAuto before a device is probed.
+var cowFilesystems = map[string]bool{"btrfs": true, "xfs": true, "bcachefs": true, "ocfs2": true}
+
+// sharesExtents reports whether dev was found to share extents, or, until it
+// has been tried, whether its filesystem type is expected to.
+func (d *Deduper) sharesExtents(dev uint64) bool {
+	if ok, probed := d.reflinkDevs[dev]; probed {
+		return ok
+	}
+	m, _ := mounts.Lookup(dev)
+	return cowFilesystems[m.FSType]
+}
+
+// extentSharingUnsupported reports whether err from ShareExtents means the
+// filesystem cannot share extents at all, rather than failing for this file.
+func extentSharingUnsupported(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.EXDEV)
+}
+
+// linkFile replaces target with a hardlink to source, falling back to a
+// symlink on EXDEV if enabled, or with a symlink outright with ActionSymlink.
+// With ActionAuto, targets on the source's device share its extents instead
+// where the filesystem supports it.
+// BytesSaved is filled in by dedupeFile.
+func (d *Deduper) linkFile(source, target *types.FileInfo) *DedupeResult {
+	if d.action == ActionSymlink {
+		return d.symlinkFile(source, target)
+	}
+	if d.action == ActionAuto && source.Dev == target.Dev {
+		// Every device is tried once; those that fail are hardlinked from then on
+		if ok, probed := d.reflinkDevs[target.Dev]; ok || !probed {
+			err := ShareExtents(source.Path, target.Path)
+			if err == nil {
+				d.reflinkDevs[target.Dev] = true
+				return &DedupeResult{
+					Source: source.Path,
+					Target: target.Path,
+					Action: ActionReflink,
+				}
+			}
+			if !extentSharingUnsupported(err) {
+				return &DedupeResult{
+					Source: source.Path,
+					Target: target.Path,
+					Action: ActionSkipped,
+					Reason: types.ReasonOf(err),
+					Err:    err,
+				}
+			}
+			d.reflinkDevs[target.Dev] = false
 		}
 	}
 
 	// Try hardlink first
-	err = CreateHardlink(source.Path, target.Path)
-	if err == nil {
+	err := CreateHardlink(source.Path, target.Path, d.link)
+	if err == nil || errors.Is(err, ErrNotSynced) {
+		d.reportNotSynced(target.Path, err)
 		return &DedupeResult{
-			Source:     source.Path,
-			Target:     target.Path,
-			Action:     ActionHardlink,
-			BytesSaved: target.Size,
+			Source: source.Path,
+			Target: target.Path,
+			Action: ActionHardlink,
 		}
 	}
 
@@ -267,43 +742,157 @@ func (d *Deduper) dedupeFile(source, target *types.FileInfo) *DedupeResult {
 				Source: source.Path,
 				Target: target.Path,
 				Action: ActionSkipped,
-				Err:    errors.New("cannot hardlink across device boundaries (use --symlink-fallback)"),
+				Reason: types.ReasonCrossDevice,
+				Err: fmt.Errorf("%w: %s is on %s, %s is on %s (use --symlink-fallback)",
+					types.ErrCrossDevice, source.Path, mounts.Describe(source.Dev), target.Path, mounts.Describe(target.Dev)),
 			}
 		}
 
 		// Try symlink as fallback
-		err = CreateSymlink(source.Path, target.Path)
-		if err == nil {
-			return &DedupeResult{
-				Source:     source.Path,
-				Target:     target.Path,
-				Action:     ActionSymlink,
-				BytesSaved: target.Size,
-			}
+		return d.symlinkFile(source, target)
+	}
+
+	// Other errors (EMLINK, EACCES, etc.) - skip and continue
+	return &DedupeResult{
+		Source: source.Path,
+		Target: target.Path,
+		Action: ActionSkipped,
+		Reason: types.ReasonOf(err),
+		Err:    err,
+	}
+}
+
+// errOutsideRoots is reported for targets left alone because their source
+// resolves outside the roots given by SymlinkRoots.
+var errOutsideRoots = errors.New("symlink source resolves outside the scanned roots")
+
+// symlinkFile replaces target with a symlink to source, unless the source
+// resolves outside symlinkRoots.
+func (d *Deduper) symlinkFile(source, target *types.FileInfo) *DedupeResult {
+	// A link into an unrelated filesystem breaks when it is unmounted
+	if d.symlinkRoots != nil && !withinRoots(source.Path, d.symlinkRoots) {
+		return &DedupeResult{
+			Source: source.Path,
+			Target: target.Path,
+			Action: ActionSkipped,
+			Reason: types.ReasonOther,
+			Err:    fmt.Errorf("%w: %s", errOutsideRoots, source.Path),
 		}
+	}
+
+	err := CreateSymlink(source.Path, target.Path, d.link)
+	d.reportNotSynced(target.Path, err)
+	if err != nil && !errors.Is(err, ErrNotSynced) {
 		return &DedupeResult{
 			Source: source.Path,
 			Target: target.Path,
 			Action: ActionSkipped,
+			Reason: types.ReasonOf(err),
 			Err:    err,
 		}
 	}
-
-	// Other errors (EMLINK, EACCES, etc.) - skip and continue
 	return &DedupeResult{
 		Source: source.Path,
 		Target: target.Path,
-		Action: ActionSkipped,
-		Err:    err,
+		Action: ActionSymlink,
 	}
 }
 
+// reportNotSynced reports a replacement of target that is done but may not
+// survive a power loss (err wraps ErrNotSynced); other errors are left to the
+// caller.
+func (d *Deduper) reportNotSynced(target string, err error) {
+	if errors.Is(err, ErrNotSynced) {
+		d.sendError(types.NewEvent(types.StageDedupe, target, err))
+	}
+}
+
+// withinRoots reports whether path, with symlinks resolved, is under one of
+// roots (resolved as well). Paths that cannot be resolved are not.
+func withinRoots(path string, roots []string) bool {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	for _, root := range roots {
+		if r, err := filepath.EvalSymlinks(root); err == nil && underRoot(resolved, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// errNotListed is reported for a group left alone because no copy is under a
+// path argument, with --keep-first-listed.
+var errNotListed = errors.New("no copy under a listed path (--keep-first-listed), group left alone")
+
+// pickSource chooses the source of dupeGroup: by argument order alone with
+// keepFirstListed, otherwise by path priority and preference.
+func (d *Deduper) pickSource(dupeGroup types.DuplicateGroup) *types.FileInfo {
+	if d.keepFirstListed != nil {
+		return selectFirstListed(dupeGroup, d.keepFirstListed, d.avoid, d.normalize)
+	}
+	return selectSource(dupeGroup, d.pathPriority, d.avoid, d.prefer, d.normalize)
+}
+
+// selectFirstListed chooses the source by argument order alone: the
+// lexicographically first file under the earliest of roots, skipping files
+// under an avoid pattern. nlink, path priority and tie-breakers play no part.
+// Paths are put in form norm before matching avoid. Returns nil if no file
+// qualifies.
+func selectFirstListed(dupeGroup types.DuplicateGroup, roots, avoid []string, norm pathnorm.Form) *types.FileInfo {
+	for _, root := range roots {
+		var best *types.FileInfo
+		for _, siblings := range dupeGroup.Items() {
+			for _, f := range siblings.Items() {
+				if !underRoot(f.Path, root) || matchAny(norm.Apply(f.Path), avoid) {
+					continue
+				}
+				if best == nil || f.Path < best.Path {
+					best = f
+				}
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return nil
+}
+
+// underListed reports whether any file of dupeGroup is under one of roots.
+func underListed(dupeGroup types.DuplicateGroup, roots []string) bool {
+	for _, siblings := range dupeGroup.Items() {
+		for _, f := range siblings.Items() {
+			for _, root := range roots {
+				if underRoot(f.Path, root) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// underRoot reports whether path is root or below it. Unlike matchPriority,
+// root is a literal path, not a pattern.
+func underRoot(path, root string) bool {
+	return path == root || root == "/" || strings.HasPrefix(path, root+"/")
+}
+
 // selectSource chooses which file to keep as the source for hardlinks.
 //
 // Selection priority:
-//  1. First file matching any pathPriority prefix (searching ALL sibling groups)
-//  2. Sibling group with highest nlink count (preserves existing hardlink groups)
-//  3. Falls back to lexicographically first path if tie
+//  1. Files under an avoid pattern are never chosen; if every file is, there
+//     is no source (nil) and the group is left alone
+//  2. Files matching the first pathPriority pattern that matches any file
+//     (searching ALL sibling groups); without a match, every file
+//  3. Among those, the best file by prefer:
+//     - PreferDefault: first matching file, or without a path match, the
+//     sibling group with highest nlink count (preserves existing hardlink
+//     groups), then the lexicographically first path
+//     - PreferShortestPath / PreferShallowest: the shortest path or the one
+//     fewest directories deep, then the lexicographically first path
 //
 // The nlink preference ensures that when a standalone duplicate is found
 // alongside files that are already hardlinked, the existing hardlink group
@@ -312,35 +901,95 @@ func (d *Deduper) dedupeFile(source, target *types.FileInfo) *DedupeResult {
 // By searching across ALL sibling groups, path priority works correctly even
 // when the preferred path is in a sibling group with other hardlinks.
 //
+// Paths are put in form norm before they are matched against the patterns,
+// which New has already put in that form.
+//
 // Note: No explicit sorting needed here - DuplicateGroup and SiblingGroup
 // maintain sorted order by construction (via types.NewDuplicateGroup/NewSiblingGroup).
-func selectSource(dupeGroup types.DuplicateGroup, pathPriority []string) *types.FileInfo {
+func selectSource(dupeGroup types.DuplicateGroup, pathPriority, avoid []string, prefer Preference, norm pathnorm.Form) *types.FileInfo {
 	// Check path priority across ALL files in ALL sibling groups
 	for _, pref := range pathPriority {
+		var best *types.FileInfo
 		for _, siblings := range dupeGroup.Items() {
 			for _, f := range siblings.Items() {
-				if strings.HasPrefix(f.Path, pref) {
+				if path := norm.Apply(f.Path); !matchPriority(path, pref) || matchAny(path, avoid) {
+					continue
+				}
+				if prefer == PreferDefault {
 					return f
 				}
+				if best == nil || prefer.less(f, best) {
+					best = f
+				}
 			}
 		}
+		if best != nil {
+			return best
+		}
 	}
 
-	// Prefer sibling group with highest nlink (most existing hardlinks)
-	// On tie, prefer lexicographically first path for determinism
+	// Without a path match, compare every file (PreferDefault: one per sibling
+	// group, as all siblings share the same nlink count)
 	var best *types.FileInfo
 	for _, siblings := range dupeGroup.Items() {
-		rep := siblings.First() // All siblings share same nlink count
-		if best == nil || rep.Nlink > best.Nlink || (rep.Nlink == best.Nlink && rep.Path < best.Path) {
-			best = rep
+		for _, f := range siblings.Items() {
+			if matchAny(norm.Apply(f.Path), avoid) {
+				continue
+			}
+			if best == nil || prefer.less(f, best) {
+				best = f
+			}
+			if prefer == PreferDefault {
+				break
+			}
 		}
 	}
 	return best
 }
 
-// sendError sends an error to the errors channel if it's not nil.
-func (d *Deduper) sendError(err error) {
+// matchAny reports whether path matches any path priority pattern.
+func matchAny(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchPriority(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPriority reports whether path is at or below a path priority pattern.
+//
+// Patterns are canonical absolute paths (see canonicalPatterns) and may hold
+// glob metacharacters; they are matched against the path and each of its
+// parent directories, so "/archive" and "/archive/*" never match "/archive2".
+// A trailing "/**" means "everything below" and is equivalent to the bare
+// directory.
+func matchPriority(path, pattern string) bool {
+	pattern = strings.TrimSuffix(pattern, "/**")
+	if pattern == "" || pattern == "/" {
+		return true // Root matches everything
+	}
+	for p := filepath.Clean(path); p != "/" && p != "."; p = filepath.Dir(p) {
+		if matched, _ := filepath.Match(pattern, p); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalPatterns cleans path priority patterns so trailing slashes and
+// "." or ".." components do not defeat matching.
+func canonicalPatterns(patterns []string) []string {
+	clean := make([]string, len(patterns))
+	for i, p := range patterns {
+		clean[i] = filepath.Clean(p)
+	}
+	return clean
+}
+
+// sendError sends an event to the errors channel if it's not nil.
+func (d *Deduper) sendError(e *types.Event) {
 	if d.errCh != nil {
-		d.errCh <- err
+		d.errCh <- e
 	}
 }
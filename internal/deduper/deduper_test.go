@@ -4,12 +4,20 @@ package deduper
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/ivoronin/dupedog/internal/color"
+	"github.com/ivoronin/dupedog/internal/pathnorm"
 	"github.com/ivoronin/dupedog/internal/types"
 )
 
@@ -29,13 +37,13 @@ func TestSelectSourceWithPathPriority(t *testing.T) {
 	})
 
 	// Prefer /archive
-	source := selectSource(dupeGroup, []string{"/archive"})
+	source := selectSource(dupeGroup, []string{"/archive"}, nil, PreferDefault, pathnorm.None)
 	if source.Path != "/archive/file.txt" {
 		t.Errorf("expected /archive/file.txt, got %s", source.Path)
 	}
 
 	// Prefer /backup
-	source = selectSource(dupeGroup, []string{"/backup"})
+	source = selectSource(dupeGroup, []string{"/backup"}, nil, PreferDefault, pathnorm.None)
 	if source.Path != "/backup/file.txt" {
 		t.Errorf("expected /backup/file.txt, got %s", source.Path)
 	}
@@ -52,7 +60,7 @@ func TestSelectSourceByNlink(t *testing.T) {
 		}),
 	})
 
-	source := selectSource(dupeGroup, nil)
+	source := selectSource(dupeGroup, nil, nil, PreferDefault, pathnorm.None)
 	if source.Path != "/b.txt" {
 		t.Errorf("expected /b.txt (higher nlink), got %s", source.Path)
 	}
@@ -69,7 +77,7 @@ func TestSelectSourceFallbackToPath(t *testing.T) {
 		}),
 	})
 
-	source := selectSource(dupeGroup, nil)
+	source := selectSource(dupeGroup, nil, nil, PreferDefault, pathnorm.None)
 	if source.Path != "/a.txt" {
 		t.Errorf("expected /a.txt (lexicographic first), got %s", source.Path)
 	}
@@ -87,12 +95,189 @@ func TestSelectSourcePathPriorityOverridesNlink(t *testing.T) {
 	})
 
 	// Path priority should override nlink preference
-	source := selectSource(dupeGroup, []string{"/archive"})
+	source := selectSource(dupeGroup, []string{"/archive"}, nil, PreferDefault, pathnorm.None)
 	if source.Path != "/archive/file.txt" {
 		t.Errorf("expected /archive/file.txt (path priority), got %s", source.Path)
 	}
 }
 
+// TestSelectSourcePreference tests the --prefer tie-breakers among files
+// matching the same path priority, and among all files without a match.
+func TestSelectSourcePreference(t *testing.T) {
+	dupeGroup := types.NewDuplicateGroup([]types.SiblingGroup{
+		types.NewSiblingGroup([]*types.FileInfo{
+			{Path: "/data/a/b/c/x", Size: 100, Nlink: 3},
+		}),
+		types.NewSiblingGroup([]*types.FileInfo{
+			{Path: "/data/a/long-name", Size: 100, Nlink: 1},
+		}),
+		types.NewSiblingGroup([]*types.FileInfo{
+			{Path: "/other/y", Size: 100, Nlink: 1},
+		}),
+	})
+
+	tests := []struct {
+		prefer   Preference
+		priority []string
+		want     string
+	}{
+		{PreferDefault, []string{"/data"}, "/data/a/b/c/x"},
+		{PreferShortestPath, []string{"/data"}, "/data/a/b/c/x"},
+		{PreferShallowest, []string{"/data"}, "/data/a/long-name"},
+		{PreferDefault, nil, "/data/a/b/c/x"}, // Highest nlink
+		{PreferShortestPath, nil, "/other/y"},
+		{PreferShallowest, nil, "/other/y"},
+	}
+	for _, tt := range tests {
+		if got := selectSource(dupeGroup, tt.priority, nil, tt.prefer, pathnorm.None).Path; got != tt.want {
+			t.Errorf("selectSource(%v, %d) = %s, want %s", tt.priority, tt.prefer, got, tt.want)
+		}
+	}
+
+	if _, err := ParsePreference("longest"); err == nil {
+		t.Error("ParsePreference(\"longest\") should return error")
+	}
+}
+
+// TestSelectSourceAvoid tests that avoided paths are never chosen, even when
+// they match path priority or hold the most links.
+func TestSelectSourceAvoid(t *testing.T) {
+	dupeGroup := types.NewDuplicateGroup([]types.SiblingGroup{
+		types.NewSiblingGroup([]*types.FileInfo{
+			{Path: "/download/a", Size: 100, Nlink: 2},
+			{Path: "/home/a", Size: 100, Nlink: 2},
+		}),
+		types.NewSiblingGroup([]*types.FileInfo{
+			{Path: "/tmp/b", Size: 100, Nlink: 5},
+		}),
+	})
+	avoid := []string{"/tmp", "/download/**"}
+
+	if got := selectSource(dupeGroup, []string{"/tmp"}, avoid, PreferDefault, pathnorm.None); got.Path != "/home/a" {
+		t.Errorf("selectSource(priority /tmp) = %s, want /home/a", got.Path)
+	}
+	if got := selectSource(dupeGroup, nil, avoid, PreferDefault, pathnorm.None); got.Path != "/home/a" {
+		t.Errorf("selectSource() = %s, want /home/a", got.Path)
+	}
+	if got := selectSource(dupeGroup, nil, []string{"/"}, PreferDefault, pathnorm.None); got != nil {
+		t.Errorf("selectSource(avoid all) = %s, want nil", got.Path)
+	}
+}
+
+// TestSelectFirstListed tests that --keep-first-listed picks by argument
+// order alone, ignoring link counts, and finds no source outside the roots.
+func TestSelectFirstListed(t *testing.T) {
+	dupeGroup := types.NewDuplicateGroup([]types.SiblingGroup{
+		types.NewSiblingGroup([]*types.FileInfo{
+			{Path: "/backup/b", Size: 100, Nlink: 5}, // Highest nlink
+			{Path: "/backup2/a", Size: 100, Nlink: 5},
+		}),
+		types.NewSiblingGroup([]*types.FileInfo{
+			{Path: "/photos/z", Size: 100, Nlink: 1},
+			{Path: "/photos/y", Size: 100, Nlink: 1},
+		}),
+	})
+
+	tests := []struct {
+		roots, avoid []string
+		want         string
+	}{
+		{[]string{"/photos", "/backup"}, nil, "/photos/y"},
+		{[]string{"/backup", "/photos"}, nil, "/backup/b"},                 // Not /backup2
+		{[]string{"/photos", "/backup"}, []string{"/photos"}, "/backup/b"}, // Avoided root skipped
+		{[]string{"/music", "/backup2"}, nil, "/backup2/a"},
+		{[]string{"/"}, nil, "/backup/b"},
+	}
+	for _, tt := range tests {
+		if got := selectFirstListed(dupeGroup, tt.roots, tt.avoid, pathnorm.None); got == nil || got.Path != tt.want {
+			t.Errorf("selectFirstListed(%v, %v) = %v, want %s", tt.roots, tt.avoid, got, tt.want)
+		}
+	}
+	if got := selectFirstListed(dupeGroup, []string{"/music"}, nil, pathnorm.None); got != nil {
+		t.Errorf("selectFirstListed(/music) = %s, want nil", got.Path)
+	}
+}
+
+// TestSelectSourceNormalize tests that path priority and avoid patterns match
+// names written in another Unicode form once paths are normalized.
+func TestSelectSourceNormalize(t *testing.T) {
+	dupeGroup := types.NewDuplicateGroup([]types.SiblingGroup{
+		types.NewSiblingGroup([]*types.FileInfo{{Path: "/a/photo.jpg", Size: 100, Nlink: 1}}),
+		types.NewSiblingGroup([]*types.FileInfo{{Path: "/cafe\u0301/photo.jpg", Size: 100, Nlink: 1}}), // NFD, as written by macOS
+	})
+	priority := []string{"/caf\u00e9"} // NFC, as typed on Linux
+
+	if got := selectSource(dupeGroup, priority, nil, PreferDefault, pathnorm.None); got.Path != "/a/photo.jpg" {
+		t.Errorf("selectSource(none) = %s, want /a/photo.jpg", got.Path)
+	}
+	if got := selectSource(dupeGroup, priority, nil, PreferDefault, pathnorm.NFC); got.Path != "/cafe\u0301/photo.jpg" {
+		t.Errorf("selectSource(nfc) = %s, want the NFD path", got.Path)
+	}
+	if got := selectSource(dupeGroup, nil, []string{"/a", "/caf\u00e9"}, PreferDefault, pathnorm.NFC); got != nil {
+		t.Errorf("selectSource(nfc, avoid all) = %s, want nil", got.Path)
+	}
+}
+
+// TestKeepFirstListedUnlisted tests that a group without a copy under a
+// listed root is left alone and reported.
+func TestKeepFirstListedUnlisted(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "source.txt")
+	targetPath := filepath.Join(root, "target.txt")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, targetPath, []byte("content"))
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, targetPath)}),
+		}),
+	})
+
+	errCh := make(chan *types.Event, 10)
+	results := New(groups, Options{KeepFirstListed: []string{filepath.Join(root, "elsewhere")}}, errCh).Run()
+	close(errCh)
+
+	if len(results) != 0 || sameInode(t, sourcePath, targetPath) {
+		t.Errorf("unlisted group deduplicated: %v", results)
+	}
+	var events []*types.Event
+	for e := range errCh {
+		events = append(events, e)
+	}
+	if len(events) != 1 || !errors.Is(events[0].Err, errNotListed) {
+		t.Errorf("events = %v, want one errNotListed", events)
+	}
+}
+
+// TestMatchPriority tests path priority glob matching at component boundaries.
+func TestMatchPriority(t *testing.T) {
+	tests := []struct {
+		path, pattern string
+		want          bool
+	}{
+		{"/archive/a/file", "/archive", true},
+		{"/archive/a/file", "/archive/**", true},
+		{"/archive/a/file", "/archive/*", true},
+		{"/archive/a/file", "/arch*", true},
+		{"/archive/a/file", "/**", true},
+		{"/archive2/file", "/archive", false}, // Not a plain string prefix
+		{"/archive2/file", "/archive/**", false},
+		{"/data/x/archive/file", "/*/*/archive", true},
+		{"/data/archive/file", "/*/*/archive", false},
+	}
+	for _, tt := range tests {
+		if got := matchPriority(tt.path, tt.pattern); got != tt.want {
+			t.Errorf("matchPriority(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+		}
+	}
+
+	// Non-canonical patterns are cleaned by New
+	if got := canonicalPatterns([]string{"/archive/", "/data/../srv/./x"}); got[0] != "/archive" || got[1] != "/srv/x" {
+		t.Errorf("canonicalPatterns() = %q, want [/archive /srv/x]", got)
+	}
+}
+
 // TestCreateHardlink tests atomic hardlink creation.
 func TestCreateHardlink(t *testing.T) {
 	root := t.TempDir()
@@ -108,7 +293,7 @@ func TestCreateHardlink(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := CreateHardlink(source, target); err != nil {
+	if err := CreateHardlink(source, target, LinkOptions{}); err != nil {
 		t.Fatalf("CreateHardlink failed: %v", err)
 	}
 
@@ -129,6 +314,67 @@ func TestCreateHardlink(t *testing.T) {
 	}
 }
 
+// TestCreateLinksFsync tests that links are created with fsync, and that a
+// failed directory sync is reported as ErrNotSynced.
+func TestCreateLinksFsync(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source.txt")
+	writeFile(t, source, []byte("content"))
+	for i, create := range []func(source, target string, opts LinkOptions) error{CreateHardlink, CreateSymlink} {
+		target := filepath.Join(root, fmt.Sprintf("target%d.txt", i))
+		writeFile(t, target, []byte("content"))
+		if err := create(source, target, LinkOptions{Fsync: true}); err != nil {
+			t.Errorf("create(fsync) failed: %v", err)
+		}
+	}
+
+	if err := syncDir(filepath.Join(root, "missing")); !errors.Is(err, ErrNotSynced) {
+		t.Errorf("syncDir(missing) = %v, want ErrNotSynced", err)
+	}
+}
+
+// TestCreateLinksStaging tests that temporary links are made in a staging
+// directory at the top of the target's filesystem, with the configured
+// suffix, and that links made there resolve from the target.
+func TestCreateLinksStaging(t *testing.T) {
+	root := t.TempDir()
+	top, err := filesystemTop(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := LinkOptions{TmpSuffix: ".dupedog-partial", StagingDir: filepath.Base(root) + "-staging"}
+	staging := filepath.Join(top, opts.StagingDir)
+	if err := os.Mkdir(staging, 0o700); err != nil {
+		t.Skipf("cannot create a staging dir at the top of the filesystem: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(staging) })
+
+	source := filepath.Join(root, "source.txt")
+	target := filepath.Join(root, "sub", "target.txt")
+	writeFile(t, source, []byte("content"))
+	if err := os.Mkdir(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, target, []byte("content"))
+
+	tmp, err := opts.TmpPath(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(tmp) != staging || !strings.HasSuffix(tmp, ".dupedog-partial") {
+		t.Errorf("TmpPath() = %s, want a .dupedog-partial file in %s", tmp, staging)
+	}
+	if err := CreateSymlink(source, target, opts); err != nil {
+		t.Fatalf("CreateSymlink failed: %v", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "content" {
+		t.Errorf("target = %q, %v; want the source content", data, err)
+	}
+	if names, _ := os.ReadDir(staging); len(names) != 0 {
+		t.Errorf("staging dir holds %d files after the rename, want none", len(names))
+	}
+}
+
 // TestCreateSymlink tests atomic symlink creation.
 func TestCreateSymlink(t *testing.T) {
 	root := t.TempDir()
@@ -144,7 +390,7 @@ func TestCreateSymlink(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := CreateSymlink(source, target); err != nil {
+	if err := CreateSymlink(source, target, LinkOptions{}); err != nil {
 		t.Fatalf("CreateSymlink failed: %v", err)
 	}
 
@@ -191,7 +437,7 @@ func TestDryRunMode(t *testing.T) {
 	})
 
 	// Run in dry-run mode
-	d := New(groups, nil, true, false, false, false, nil)
+	d := New(groups, Options{DryRun: true}, nil)
 	d.Run()
 
 	// Files should still be different inodes
@@ -203,6 +449,30 @@ func TestDryRunMode(t *testing.T) {
 	}
 }
 
+// TestRunContextCanceled tests that a canceled run replaces nothing.
+func TestRunContextCanceled(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "source.txt")
+	targetPath := filepath.Join(root, "target.txt")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, targetPath, []byte("content"))
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, targetPath)}),
+		}),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := New(groups, Options{}, nil).RunContext(ctx)
+
+	if len(results) != 0 || sameInode(t, sourcePath, targetPath) {
+		t.Errorf("canceled run replaced files: %v", results)
+	}
+}
+
 // TestDedupeFileBasic tests basic file deduplication.
 func TestDedupeFileBasic(t *testing.T) {
 	root := t.TempDir()
@@ -228,7 +498,7 @@ func TestDedupeFileBasic(t *testing.T) {
 		}),
 	})
 
-	d := New(groups, nil, false, false, false, false, nil)
+	d := New(groups, Options{}, nil)
 	d.Run()
 
 	// Verify files are now hardlinked
@@ -264,7 +534,7 @@ func TestMtimeVerification(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	errCh := make(chan error, 10)
+	errCh := make(chan *types.Event, 10)
 	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
 		types.NewDuplicateGroup([]types.SiblingGroup{
 			types.NewSiblingGroup([]*types.FileInfo{sourceInfo}),
@@ -272,14 +542,20 @@ func TestMtimeVerification(t *testing.T) {
 		}),
 	})
 
-	d := New(groups, nil, false, false, false, false, errCh)
+	d := New(groups, Options{}, errCh)
 	d.Run()
 	close(errCh)
 
 	// Should report an error (file changed)
 	var errCount int
-	for range errCh {
+	for e := range errCh {
 		errCount++
+		if e.Stage != types.StageDedupe || e.Reason != types.ReasonModified || e.Path != targetPath {
+			t.Errorf("event = {%s %s %s}, want {dedupe modified %s}", e.Stage, e.Reason, e.Path, targetPath)
+		}
+		if !errors.Is(e, types.ErrModifiedSinceScan) {
+			t.Errorf("event %v does not match ErrModifiedSinceScan", e)
+		}
 	}
 	if errCount == 0 {
 		t.Error("expected error for modified file")
@@ -294,6 +570,94 @@ func TestMtimeVerification(t *testing.T) {
 	}
 }
 
+// TestPreHookRejectSkips tests that a failing pre-hook leaves the target untouched.
+func TestPreHookRejectSkips(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "source.txt")
+	targetPath := filepath.Join(root, "target.txt")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, targetPath, []byte("content"))
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, targetPath)}),
+		}),
+	})
+
+	errCh := make(chan *types.Event, 10)
+	results := New(groups, Options{PreHook: "exit 1"}, errCh).Run()
+
+	if len(results) != 1 || results[0].Action != ActionSkipped {
+		t.Fatalf("results = %v, want one skipped result", results)
+	}
+	if sameInode(t, sourcePath, targetPath) {
+		t.Error("target should not be replaced when pre-hook fails")
+	}
+}
+
+// TestHooksEnvironment tests that hooks receive the operation in DUPEDOG_* variables.
+func TestHooksEnvironment(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "a.txt")
+	targetPath := filepath.Join(root, "b.txt")
+	logPath := filepath.Join(t.TempDir(), "hooks.log")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, targetPath, []byte("content"))
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, targetPath)}),
+		}),
+	})
+
+	hook := `echo "$DUPEDOG_HOOK $DUPEDOG_ACTION $DUPEDOG_BYTES $DUPEDOG_SOURCE $DUPEDOG_TARGET" >> ` + logPath
+	New(groups, Options{PreHook: hook, PostHook: hook}, nil).Run()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("hook log not written: %v", err)
+	}
+	want := "pre hardlink 7 " + sourcePath + " " + targetPath + "\n" +
+		"post hardlink 7 " + sourcePath + " " + targetPath + "\n"
+	if string(data) != want {
+		t.Errorf("hook log = %q, want %q", data, want)
+	}
+	if !sameInode(t, sourcePath, targetPath) {
+		t.Error("files should be hardlinked after deduplication")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := time.Unix(0, 0)
+	var slept time.Duration
+	l := newRateLimiter(4)
+	l.now = func() time.Time { return clock }
+	l.sleep = func(d time.Duration) { slept += d; clock = clock.Add(d) }
+
+	for range 3 {
+		l.wait()
+	}
+	// The first operation starts at once, the next two wait 250ms each.
+	if slept != 500*time.Millisecond {
+		t.Errorf("slept %v, want 500ms", slept)
+	}
+
+	// Time spent between operations counts towards the interval.
+	clock = clock.Add(time.Second)
+	slept = 0
+	l.wait()
+	if slept != 0 {
+		t.Errorf("slept %v after an idle second, want 0", slept)
+	}
+
+	unlimited := newRateLimiter(0)
+	unlimited.sleep = func(time.Duration) { t.Fatal("unlimited limiter slept") }
+	unlimited.wait()
+	unlimited.wait()
+}
+
 // =============================================================================
 // Section 6.2: Deduper Error Scenarios
 // =============================================================================
@@ -321,7 +685,7 @@ func TestSourceDeletedBeforeDedup(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	errCh := make(chan error, 10)
+	errCh := make(chan *types.Event, 10)
 	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
 		types.NewDuplicateGroup([]types.SiblingGroup{
 			types.NewSiblingGroup([]*types.FileInfo{sourceInfo}),
@@ -329,7 +693,7 @@ func TestSourceDeletedBeforeDedup(t *testing.T) {
 		}),
 	})
 
-	d := New(groups, nil, false, false, false, false, errCh)
+	d := New(groups, Options{}, errCh)
 	d.Run()
 	close(errCh)
 
@@ -366,7 +730,7 @@ func TestTargetDeletedBeforeDedup(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	errCh := make(chan error, 10)
+	errCh := make(chan *types.Event, 10)
 	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
 		types.NewDuplicateGroup([]types.SiblingGroup{
 			types.NewSiblingGroup([]*types.FileInfo{sourceInfo}),
@@ -374,7 +738,7 @@ func TestTargetDeletedBeforeDedup(t *testing.T) {
 		}),
 	})
 
-	d := New(groups, nil, false, false, false, false, errCh)
+	d := New(groups, Options{}, errCh)
 	d.Run()
 	close(errCh)
 
@@ -388,6 +752,114 @@ func TestTargetDeletedBeforeDedup(t *testing.T) {
 	}
 }
 
+// TestJournalRecovery tests that intents without a done record are rolled
+// back by removing the temporary link left behind, also when the target
+// was deleted after the crash (it is not brought back), that foreign
+// temporary files are left alone, and that live journals are not touched.
+func TestJournalRecovery(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "journal")
+	source := filepath.Join(root, "source")
+	if err := os.WriteFile(source, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := func(name string) string { return filepath.Join(root, name) }
+	for _, name := range []string{"rolled-back", "foreign", "done"} {
+		if err := os.WriteFile(path(name), []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Crashed after linking, before renaming
+	if err := os.Link(source, path("rolled-back")+tmpSuffix); err != nil {
+		t.Fatal(err)
+	}
+	// Crashed after linking; the target was removed after the crash
+	if err := os.Symlink("source", path("deleted")+tmpSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("foreign")+tmpSuffix, []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Same in a staging directory: the relative symlink is made for the target's directory
+	staged := filepath.Join(root, "staging", "1"+tmpSuffix)
+	if err := os.Mkdir(filepath.Dir(staged), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("source", staged); err != nil {
+		t.Fatal(err)
+	}
+
+	crashed, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"rolled-back", "deleted", "foreign", "done", "staged"} {
+		tmp := path(name) + tmpSuffix
+		if name == "staged" {
+			tmp = staged
+		}
+		id, err := crashed.begin(source, path(name), tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "done" {
+			crashed.end(id)
+		}
+	}
+	_ = crashed.f.Close() // Releases the lock but keeps the file, like a crash
+
+	live, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.begin(source, path("live"), path("live")+tmpSuffix); err != nil {
+		t.Fatal(err)
+	}
+
+	recoveries, err := RecoverJournals(dir)
+	if err != nil {
+		t.Fatalf("RecoverJournals() failed: %v", err)
+	}
+	got := make(map[string]RecoveryAction)
+	for _, r := range recoveries {
+		got[filepath.Base(r.Target)] = r.Action
+	}
+	want := map[string]RecoveryAction{"rolled-back": RecoveryRemovedTmp, "deleted": RecoveryTargetGone, "foreign": RecoveryLeft, "staged": RecoveryTargetGone}
+	if len(got) != len(want) {
+		t.Errorf("recoveries = %v, want %v", got, want)
+	}
+	for name, action := range want {
+		if got[name] != action {
+			t.Errorf("%s: action = %v, want %v", name, got[name], action)
+		}
+	}
+
+	for _, tmp := range []string{path("rolled-back") + tmpSuffix, path("deleted") + tmpSuffix, staged} {
+		if _, err := os.Lstat(tmp); !os.IsNotExist(err) {
+			t.Errorf("temporary link %s was not removed", tmp)
+		}
+	}
+	for _, name := range []string{"deleted", "staged"} {
+		if _, err := os.Lstat(path(name)); !os.IsNotExist(err) {
+			t.Errorf("deleted target %s was brought back", name)
+		}
+	}
+	if _, err := os.Stat(path("foreign") + tmpSuffix); err != nil {
+		t.Errorf("foreign temporary file was removed: %v", err)
+	}
+
+	// Only the live journal remains, and it is removed on Close
+	if names, _ := filepath.Glob(filepath.Join(dir, "*"+journalExt)); len(names) != 1 || names[0] != live.path {
+		t.Errorf("journals after recovery = %v, want only the live one", names)
+	}
+	if err := live.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 0 {
+		t.Errorf("journals after Close = %v, want none", names)
+	}
+}
+
 // =============================================================================
 // Section 6.3: Deduper Filesystem Edge Cases
 // =============================================================================
@@ -413,7 +885,7 @@ func TestSymlinkRelativePath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := CreateSymlink(source, target); err != nil {
+	if err := CreateSymlink(source, target, LinkOptions{}); err != nil {
 		t.Fatalf("CreateSymlink failed: %v", err)
 	}
 
@@ -429,6 +901,120 @@ func TestSymlinkRelativePath(t *testing.T) {
 	}
 }
 
+// TestActionSymlink tests that ActionSymlink replaces a same-device target
+// with a symlink, and that symlinks to sources outside SymlinkRoots are refused.
+func TestActionSymlink(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "source.txt")
+	targetPath := filepath.Join(root, "target.txt")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, targetPath, []byte("content"))
+	groups := func() types.DuplicateGroups {
+		return types.NewDuplicateGroups([]types.DuplicateGroup{
+			types.NewDuplicateGroup([]types.SiblingGroup{
+				types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+				types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, targetPath)}),
+			}),
+		})
+	}
+
+	results := New(groups(), Options{Action: ActionSymlink, SymlinkRoots: []string{t.TempDir()}}, nil).Run()
+	if len(results) != 1 || results[0].Action != ActionSkipped || !errors.Is(results[0].Err, errOutsideRoots) {
+		t.Errorf("results = %v, want one skip outside SymlinkRoots", results)
+	}
+
+	results = New(groups(), Options{Action: ActionSymlink, SymlinkRoots: []string{root}}, nil).Run()
+	if len(results) != 1 || results[0].Action != ActionSymlink {
+		t.Fatalf("results = %v, want one symlink", results)
+	}
+	if link, err := os.Readlink(targetPath); err != nil || link != "source.txt" {
+		t.Errorf("Readlink(target) = %q, %v, want source.txt", link, err)
+	}
+
+	if _, err := ParseAction("reflink"); err == nil {
+		t.Error("ParseAction(\"reflink\") should return error")
+	}
+}
+
+// TestActionAuto tests that ActionAuto shares extents on filesystems that
+// support it and falls back to a hardlink on the others, probing the device
+// only once.
+func TestActionAuto(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "source.txt")
+	targets := []string{filepath.Join(root, "t1.txt"), filepath.Join(root, "t2.txt")}
+	writeFile(t, sourcePath, []byte("content"))
+	siblings := []types.SiblingGroup{types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)})}
+	for _, p := range targets {
+		writeFile(t, p, []byte("content"))
+		siblings = append(siblings, types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, p)}))
+	}
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{types.NewDuplicateGroup(siblings)})
+
+	d := New(groups, Options{Action: ActionAuto}, nil)
+	results := d.Run()
+	if len(results) != 2 {
+		t.Fatalf("results = %v, want 2", results)
+	}
+	for i, r := range results {
+		switch r.Action {
+		case ActionHardlink:
+			if !sameInode(t, sourcePath, targets[i]) {
+				t.Errorf("%s not hardlinked", targets[i])
+			}
+		case ActionReflink:
+			if sameInode(t, sourcePath, targets[i]) {
+				t.Errorf("%s hardlinked, want shared extents", targets[i])
+			}
+		default:
+			t.Errorf("results[%d] = %v, want hardlink or reflink", i, r)
+		}
+	}
+	if results[0].Action != results[1].Action || len(d.reflinkDevs) != 1 {
+		t.Errorf("actions %v, %v and probes %v, want one probe deciding both", results[0].Action, results[1].Action, d.reflinkDevs)
+	}
+
+	if a, err := ParseAction("auto"); err != nil || a != ActionAuto {
+		t.Errorf("ParseAction(\"auto\") = %v, %v", a, err)
+	}
+	if !extentSharingUnsupported(syscall.EOPNOTSUPP) || extentSharingUnsupported(syscall.EACCES) {
+		t.Error("extentSharingUnsupported() misclassifies errors")
+	}
+}
+
+// TestWithinRoots tests that symlink sources are checked with symlinks
+// resolved, both in the source path and in the roots.
+func TestWithinRoots(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), []byte("a"))
+	writeFile(t, filepath.Join(outside, "b.txt"), []byte("b"))
+	if err := os.Symlink(outside, filepath.Join(root, "usb")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(outside, "root")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(root, "a.txt"), true},
+		{filepath.Join(root, "usb", "b.txt"), false}, // Resolves into outside
+		{filepath.Join(outside, "root", "a.txt"), true},
+		{filepath.Join(root, "missing.txt"), false},
+	}
+	for _, tt := range tests {
+		if got := withinRoots(tt.path, []string{root}); got != tt.want {
+			t.Errorf("withinRoots(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if !withinRoots(filepath.Join(root, "usb", "b.txt"), []string{filepath.Join(root, "usb")}) {
+		t.Error("withinRoots() = false for a root that is a symlink, want true")
+	}
+}
+
 // TestContainsFile tests the containsFile helper.
 func TestContainsFile(t *testing.T) {
 	file1 := &types.FileInfo{Path: "/a.txt", Dev: 1, Ino: 100}
@@ -448,6 +1034,166 @@ func TestContainsFile(t *testing.T) {
 	}
 }
 
+// TestCountTargetFiles tests that the progress total excludes the selected
+// source's siblings, read-only files and groups without a source.
+func TestCountTargetFiles(t *testing.T) {
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{{Path: "/a/1", Ino: 1, Nlink: 1}}),
+			types.NewSiblingGroup([]*types.FileInfo{{Path: "/b/1", Ino: 2, Nlink: 2}, {Path: "/b/2", Ino: 2, Nlink: 2}}),
+			types.NewSiblingGroup([]*types.FileInfo{{Path: "/ref/1", Ino: 3, Nlink: 1}}),
+		}),
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{{Path: "/tmp/1", Ino: 4, Nlink: 1}}),
+			types.NewSiblingGroup([]*types.FileInfo{{Path: "/tmp/2", Ino: 5, Nlink: 1}}),
+		}),
+	})
+
+	// Source /b/1 (highest nlink): /a/1 is the only target, /ref is read-only, /tmp is avoided
+	d := New(groups, Options{Avoid: []string{"/tmp"}, ReadOnly: []string{"/ref"}, DryRun: true}, nil)
+	if got := d.countTargetFiles(); got != 1 {
+		t.Errorf("countTargetFiles() = %d, want 1", got)
+	}
+}
+
+// TestPlanBalanceLinks tests that balancing keeps existing hardlink groups and
+// links each standalone file to the hub with the lowest nlink so far.
+func TestPlanBalanceLinks(t *testing.T) {
+	group := types.NewDuplicateGroup([]types.SiblingGroup{
+		types.NewSiblingGroup([]*types.FileInfo{{Path: "/a/1", Ino: 1, Nlink: 5}}),
+		types.NewSiblingGroup([]*types.FileInfo{{Path: "/b/1", Ino: 2, Nlink: 2}, {Path: "/b/2", Ino: 2, Nlink: 2}}),
+		types.NewSiblingGroup([]*types.FileInfo{{Path: "/c/1", Ino: 3, Nlink: 1}}),
+		types.NewSiblingGroup([]*types.FileInfo{{Path: "/c/2", Ino: 4, Nlink: 1}}),
+		types.NewSiblingGroup([]*types.FileInfo{{Path: "/c/3", Ino: 5, Nlink: 1}}),
+		types.NewSiblingGroup([]*types.FileInfo{{Path: "/c/4", Ino: 6, Nlink: 1}}),
+	})
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{group})
+	source := selectSource(group, nil, nil, PreferDefault, pathnorm.None)
+
+	assigned := func(links []link) map[string]string {
+		m := make(map[string]string)
+		for _, l := range links {
+			m[l.targets.First().Path] = l.source.Path
+		}
+		return m
+	}
+
+	// Default: everything, including the /b hardlink group, is linked to /a/1
+	got := assigned(New(groups, Options{DryRun: true}, nil).plan(group, source))
+	if len(got) != 5 || got["/b/1"] != "/a/1" || got["/c/4"] != "/a/1" {
+		t.Errorf("plan() = %v, want every sibling group linked to /a/1", got)
+	}
+
+	// Balanced: /b (nlink 2) takes new links until it catches up with /a (nlink 5)
+	got = assigned(New(groups, Options{DryRun: true, BalanceLinks: true}, nil).plan(group, source))
+	want := map[string]string{"/c/1": "/b/1", "/c/2": "/b/1", "/c/3": "/b/1", "/c/4": "/a/1"}
+	if len(got) != len(want) {
+		t.Fatalf("plan() = %v, want %v", got, want)
+	}
+	for target, src := range want {
+		if got[target] != src {
+			t.Errorf("plan() links %s to %s, want %s", target, got[target], src)
+		}
+	}
+}
+
+// TestSparseSavingsUseAllocatedSize tests that holes are not counted as bytes saved.
+func TestSparseSavingsUseAllocatedSize(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "source.img")
+	targetPath := filepath.Join(root, "target.img")
+	for _, p := range []string{sourcePath, targetPath} {
+		f, err := os.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteAt([]byte("data"), 8<<20); err != nil { // 8 MiB hole, then data
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	target := getFileInfo(t, targetPath)
+	if target.DiskUsage() >= target.Size {
+		t.Skip("filesystem does not support sparse files")
+	}
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{target}),
+		}),
+	})
+
+	results := New(groups, Options{DryRun: true}, nil).Run()
+
+	if len(results) != 1 || results[0].BytesSaved != target.DiskUsage() {
+		t.Errorf("results = %v, want BytesSaved = %d (allocated, not %d logical)", results, target.DiskUsage(), target.Size)
+	}
+}
+
+// TestReadOnlyMountSkipped tests that targets on read-only mounts are skipped
+// with ReasonReadOnly before any link is attempted, even in dry-run mode.
+func TestReadOnlyMountSkipped(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "a.txt")
+	targetPath := filepath.Join(root, "b.txt")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, targetPath, []byte("content"))
+	target := getFileInfo(t, targetPath)
+
+	orig := readOnlyDevice
+	readOnlyDevice = func(dev uint64) bool { return dev == target.Dev }
+	defer func() { readOnlyDevice = orig }()
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{target}),
+		}),
+	})
+
+	errCh := make(chan *types.Event, 10)
+	results := New(groups, Options{PathPriority: []string{sourcePath}, DryRun: true}, errCh).Run()
+
+	if len(results) != 1 || results[0].Action != ActionSkipped || results[0].Reason != types.ReasonReadOnly {
+		t.Fatalf("results = %v, want one skipped result on a read-only mount", results)
+	}
+	if len(errCh) != 1 {
+		t.Errorf("expected read-only target to be reported, got %d errors", len(errCh))
+	}
+}
+
+// TestImmutableTargetSkipped tests that immutable targets are skipped with
+// ReasonImmutable instead of failing the link with EPERM.
+func TestImmutableTargetSkipped(t *testing.T) {
+	root := t.TempDir()
+	sourcePath := filepath.Join(root, "a.txt")
+	targetPath := filepath.Join(root, "b.txt")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, targetPath, []byte("content"))
+	if out, err := exec.Command("chattr", "+i", targetPath).CombinedOutput(); err != nil {
+		t.Skipf("chattr +i not supported: %v: %s", err, out)
+	}
+	t.Cleanup(func() { _ = exec.Command("chattr", "-i", targetPath).Run() })
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, targetPath)}),
+		}),
+	})
+
+	errCh := make(chan *types.Event, 10)
+	results := New(groups, Options{PathPriority: []string{sourcePath}}, errCh).Run()
+
+	if len(results) != 1 || results[0].Reason != types.ReasonImmutable {
+		t.Fatalf("results = %v, want one skipped result for an immutable file", results)
+	}
+	if sameInode(t, sourcePath, targetPath) {
+		t.Error("immutable file must not be replaced")
+	}
+}
+
 // =============================================================================
 // Section 6.4: Deduper Selection Edge Cases
 // =============================================================================
@@ -467,7 +1213,7 @@ func TestSelectSourceAllNlink1(t *testing.T) {
 	})
 
 	// With all nlink=1, should fall back to lexicographic order
-	source := selectSource(dupeGroup, nil)
+	source := selectSource(dupeGroup, nil, nil, PreferDefault, pathnorm.None)
 	if source.Path != "/a.txt" {
 		t.Errorf("expected /a.txt (lexicographic first), got %s", source.Path)
 	}
@@ -485,7 +1231,7 @@ func TestSelectSourceEmptyPathPriority(t *testing.T) {
 	})
 
 	// Empty path priority should use nlink
-	source := selectSource(dupeGroup, []string{})
+	source := selectSource(dupeGroup, []string{}, nil, PreferDefault, pathnorm.None)
 	if source.Path != "/b.txt" {
 		t.Errorf("expected /b.txt (higher nlink), got %s", source.Path)
 	}
@@ -525,7 +1271,7 @@ func TestSiblingGroupSkipped(t *testing.T) {
 		}),
 	})
 
-	d := New(groups, nil, false, false, false, false, nil)
+	d := New(groups, Options{}, nil)
 	d.Run()
 
 	// Only target should be changed, not sourceLink
@@ -535,6 +1281,157 @@ func TestSiblingGroupSkipped(t *testing.T) {
 	}
 }
 
+// TestReadOnlyRootsNeverTargets tests that files under read-only roots are never replaced.
+func TestReadOnlyRootsNeverTargets(t *testing.T) {
+	root := t.TempDir()
+	refDir := filepath.Join(root, "ref")
+	dataDir := filepath.Join(root, "data")
+	for _, dir := range []string{refDir, dataDir} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ref1 := filepath.Join(refDir, "a.txt")
+	ref2 := filepath.Join(refDir, "b.txt")
+	data := filepath.Join(dataDir, "a.txt")
+	for _, p := range []string{ref1, ref2, data} {
+		writeFile(t, p, []byte("content"))
+	}
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, ref1)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, ref2)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, data)}),
+		}),
+	})
+
+	readOnly := []string{refDir}
+	results := New(groups, Options{PathPriority: []string{refDir, dataDir}, ReadOnly: readOnly}, nil).Run()
+
+	if len(results) != 1 || results[0].Target != data {
+		t.Fatalf("results = %v, want only %s replaced", results, data)
+	}
+	if !sameInode(t, ref1, data) {
+		t.Error("writable duplicate should be linked to the reference copy")
+	}
+	if sameInode(t, ref1, ref2) {
+		t.Error("reference files must never be relinked")
+	}
+}
+
+// TestProtectedTargetsSkipped tests that protected paths are reported, not replaced.
+func TestProtectedTargetsSkipped(t *testing.T) {
+	root := t.TempDir()
+	golden := filepath.Join(root, "golden")
+	if err := os.Mkdir(golden, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sourcePath := filepath.Join(root, "a.txt")
+	protectedPath := filepath.Join(golden, "b.txt")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, protectedPath, []byte("content"))
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, protectedPath)}),
+		}),
+	})
+
+	errCh := make(chan *types.Event, 10)
+	results := New(groups, Options{PathPriority: []string{sourcePath}, Protect: []string{"golden"}}, errCh).Run()
+
+	if len(results) != 1 || results[0].Action != ActionSkipped || results[0].Reason != types.ReasonProtected {
+		t.Fatalf("results = %v, want one skipped result for a protected path", results)
+	}
+	if len(errCh) != 1 {
+		t.Errorf("expected protected violation to be reported, got %d errors", len(errCh))
+	}
+	if sameInode(t, sourcePath, protectedPath) {
+		t.Error("protected file must not be replaced")
+	}
+}
+
+func TestMatchProtected(t *testing.T) {
+	tests := []struct {
+		path     string
+		patterns []string
+		want     bool
+	}{
+		{"/data/golden/a.iso", []string{"golden"}, true},
+		{"/data/golden/a.iso", []string{"/data/golden"}, true},
+		{"/data/golden/a.iso", []string{"/data/*/a.iso"}, true},
+		{"/data/golden/a.iso", []string{"*.iso"}, true},
+		{"/data/goldenx/a.iso", []string{"golden"}, false},
+		{"/data/other/a.iso", []string{"/data/golden"}, false},
+		{"/data/other/a.iso", nil, false},
+	}
+	for _, tt := range tests {
+		if got := matchProtected(tt.path, tt.patterns); got != tt.want {
+			t.Errorf("matchProtected(%q, %v) = %v, want %v", tt.path, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+// TestLargest tests that --limit keeps the groups freeing the most space.
+func TestLargest(t *testing.T) {
+	group := func(name string, blocks int64, copies int) types.DuplicateGroup {
+		var siblings []types.SiblingGroup
+		for i := range copies {
+			siblings = append(siblings, types.NewSiblingGroup([]*types.FileInfo{
+				{Path: fmt.Sprintf("/%s/%d", name, i), Blocks: blocks},
+			}))
+		}
+		return types.NewDuplicateGroup(siblings)
+	}
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		group("a", 8, 2),   // Frees 8 blocks
+		group("b", 100, 2), // 100
+		group("c", 8, 10),  // 72
+	})
+
+	var got []string
+	for _, g := range Largest(groups, 2).Items() {
+		got = append(got, g.First().First().Path)
+	}
+	if want := []string{"/b/0", "/c/0"}; !slices.Equal(got, want) {
+		t.Errorf("Largest(2) = %v, want %v", got, want)
+	}
+	if Largest(groups, 0).Len() != 3 || Largest(groups, 5).Len() != 3 {
+		t.Error("Largest() with n = 0 or n >= len should keep every group")
+	}
+}
+
+// TestProtectNormalize tests that protect patterns match directory names in
+// another Unicode form with Normalize.
+func TestProtectNormalize(t *testing.T) {
+	root := t.TempDir()
+	golden := filepath.Join(root, "Cafe\u0301") // NFD
+	if err := os.Mkdir(golden, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sourcePath := filepath.Join(root, "a.txt")
+	protectedPath := filepath.Join(golden, "b.txt")
+	writeFile(t, sourcePath, []byte("content"))
+	writeFile(t, protectedPath, []byte("content"))
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, sourcePath)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, protectedPath)}),
+		}),
+	})
+
+	errCh := make(chan *types.Event, 10)
+	opts := Options{PathPriority: []string{sourcePath}, Protect: []string{"Caf\u00e9"}, Normalize: pathnorm.NFC, DryRun: true}
+	results := New(groups, opts, errCh).Run()
+
+	if len(results) != 1 || results[0].Reason != types.ReasonProtected {
+		t.Fatalf("results = %v, want one skipped result for a protected path", results)
+	}
+}
+
 // =============================================================================
 // Section 7.4: Output Tests (types.go)
 // =============================================================================
@@ -562,6 +1459,32 @@ func TestEscapePath(t *testing.T) {
 	}
 }
 
+// TestPrintGroupPlan tests the --dry-run --verbose group listing: source,
+// targets with actions, nlink counts, hubs and group savings.
+func TestPrintGroupPlan(t *testing.T) {
+	source := &types.FileInfo{Path: "/a/keep", Size: 4096, Nlink: 2}
+	planned := []plannedTarget{
+		{&types.FileInfo{Path: "/b/dup", Nlink: 1}, &DedupeResult{Source: "/a/keep", Action: ActionHardlink, BytesSaved: 4096}},
+		{&types.FileInfo{Path: "/c/dup", Nlink: 1}, &DedupeResult{Source: "/d/hub", Action: ActionHardlink, BytesSaved: 4096}},
+		{&types.FileInfo{Path: "/e/dup", Nlink: 1}, &DedupeResult{
+			Source: "/a/keep", Action: ActionSkipped, Err: errors.New("file modified since scan"),
+		}},
+	}
+
+	var buf bytes.Buffer
+	printGroupPlan(&buf, color.Palette{}, 7, source, planned)
+
+	want := `Group 7: 4 files of 4.0 KiB, would save 8.0 KiB
+  keep      /a/keep (nlink 2)
+  hardlink  /b/dup (nlink 1)
+  hardlink  /c/dup (nlink 1) -> /d/hub
+  skipped   /e/dup (nlink 1): file modified since scan
+`
+	if buf.String() != want {
+		t.Errorf("printGroupPlan() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
 // =============================================================================
 // P0 Critical Bug Test: Temp File Collision
 // =============================================================================
@@ -588,7 +1511,7 @@ func TestTempFileCollisionFresh(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err := CreateHardlink(source, target)
+	err := CreateHardlink(source, target, LinkOptions{})
 
 	// Expected: error because tmp file is too recent to be cleaned
 	if err == nil {
@@ -633,7 +1556,7 @@ func TestTempFileCollisionOldNlink1(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err := CreateHardlink(source, target)
+	err := CreateHardlink(source, target, LinkOptions{})
 
 	// Expected: error because nlink=1, we won't delete potential data
 	if err == nil {
@@ -666,7 +1589,7 @@ func TestTempFileCollisionOldNlinkGT1(t *testing.T) {
 	// Set mtime to 2 minutes ago (older than orphanedTmpMaxAge)
 	setMtime(t, tmpFile, time.Now().Add(-2*time.Minute))
 
-	err := CreateHardlink(source, target)
+	err := CreateHardlink(source, target, LinkOptions{})
 
 	// Expected: SUCCESS because old tmp with nlink>1 was cleaned up
 	if err != nil {
@@ -679,6 +1602,97 @@ func TestTempFileCollisionOldNlinkGT1(t *testing.T) {
 	}
 }
 
+// TestCleanupOrphans tests that only old temporary links whose content has
+// another link are removed, and that a dry run removes nothing.
+func TestCleanupOrphans(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-2 * time.Minute)
+	path := func(name string) string { return filepath.Join(root, name) }
+
+	writeFile(t, path("a.txt"), []byte("a"))
+	mustLink(t, path("a.txt"), path("a.txt.dupedog.tmp"))
+	setMtime(t, path("a.txt"), old)
+	writeFile(t, path("only.txt.dupedog.tmp"), []byte("only copy"))
+	setMtime(t, path("only.txt.dupedog.tmp"), old)
+	writeFile(t, path("fresh.txt"), []byte("fresh"))
+	mustLink(t, path("fresh.txt"), path("fresh.txt.dupedog.tmp"))
+
+	for _, dryRun := range []bool{true, false} {
+		orphans := CleanupOrphans([]string{root}, LinkOptions{}, dryRun, nil)
+		var removed []string
+		for _, o := range orphans {
+			if o.Removed {
+				removed = append(removed, filepath.Base(o.Path))
+			}
+		}
+		if len(orphans) != 3 || !slices.Equal(removed, []string{"a.txt.dupedog.tmp"}) {
+			t.Errorf("dry run %v: orphans = %v, want 3 with only a.txt.dupedog.tmp removed", dryRun, orphans)
+		}
+		_, err := os.Lstat(path("a.txt.dupedog.tmp"))
+		if exists := err == nil; exists != dryRun {
+			t.Errorf("dry run %v: a.txt.dupedog.tmp exists = %v", dryRun, exists)
+		}
+	}
+	for _, name := range []string{"a.txt", "only.txt.dupedog.tmp", "fresh.txt.dupedog.tmp"} {
+		if _, err := os.Lstat(path(name)); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+}
+
+// TestIsTmpName tests that only names of the form TmpPath gives are taken
+// for temporary links.
+func TestIsTmpName(t *testing.T) {
+	opts := LinkOptions{TmpSuffix: "~dupedog"}
+	tests := []struct {
+		name   string
+		staged bool
+		want   bool
+	}{
+		{"a.txt~dupedog", false, true},
+		{"~dupedog", false, false},
+		{"a.txt.dupedog.tmp", false, false},
+		{"0123456789abcdef~dupedog", true, true},
+		{"a.txt~dupedog", true, false},
+		{"0123456789abcdeg~dupedog", true, false},
+	}
+	for _, tt := range tests {
+		if got := opts.isTmpName(tt.name, tt.staged); got != tt.want {
+			t.Errorf("isTmpName(%q, %v) = %v, want %v", tt.name, tt.staged, got, tt.want)
+		}
+	}
+	tmp, err := LinkOptions{TmpSuffix: "~dupedog", StagingDir: "staging"}.TmpPath(filepath.Join(t.TempDir(), "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.isTmpName(filepath.Base(tmp), true) {
+		t.Errorf("isTmpName(%q, true) = false for a staged TmpPath", filepath.Base(tmp))
+	}
+}
+
+// TestOrphanAge tests that a longer orphan age keeps temporary links that
+// the default age would remove, both on collision and in CleanupOrphans.
+func TestOrphanAge(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source.txt")
+	target := filepath.Join(root, "target.txt")
+	writeFile(t, source, []byte("content"))
+	writeFile(t, target, []byte("content"))
+	mustLink(t, source, target+tmpSuffix)
+	setMtime(t, source, time.Now().Add(-2*time.Minute))
+
+	opts := LinkOptions{OrphanAge: time.Hour}
+	if err := CreateHardlink(source, target, opts); err == nil {
+		t.Error("CreateHardlink should fail on a temporary link younger than OrphanAge")
+	}
+	if orphans := CleanupOrphans([]string{root}, opts, false, nil); len(orphans) != 1 || orphans[0].Removed {
+		t.Errorf("CleanupOrphans() = %v, want the temporary link left", orphans)
+	}
+	if err := CreateHardlink(source, target, LinkOptions{OrphanAge: time.Second}); err != nil {
+		t.Errorf("CreateHardlink with a shorter OrphanAge failed: %v", err)
+	}
+}
+
 // =============================================================================
 // File Locking Tests
 // =============================================================================
@@ -709,7 +1723,7 @@ func TestFileLockedSkipped(t *testing.T) {
 	}
 
 	// Try to dedupe - should skip because file is locked
-	errCh := make(chan error, 10)
+	errCh := make(chan *types.Event, 10)
 	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
 		types.NewDuplicateGroup([]types.SiblingGroup{
 			types.NewSiblingGroup([]*types.FileInfo{sourceInfo}),
@@ -717,14 +1731,17 @@ func TestFileLockedSkipped(t *testing.T) {
 		}),
 	})
 
-	d := New(groups, nil, false, false, false, false, errCh)
+	d := New(groups, Options{}, errCh)
 	d.Run()
 	close(errCh)
 
 	// Verify error was reported (user should know file was skipped)
 	var errCount int
-	for range errCh {
+	for e := range errCh {
 		errCount++
+		if e.Reason != types.ReasonLocked || !errors.Is(e, types.ErrFileLocked) {
+			t.Errorf("event reason = %s, want locked", e.Reason)
+		}
 	}
 	if errCount == 0 {
 		t.Error("expected error to be reported when file is locked")
@@ -736,6 +1753,55 @@ func TestFileLockedSkipped(t *testing.T) {
 	}
 }
 
+// TestLockWait tests that a target locked briefly by another process is
+// replaced once the lock is released within LockWait.
+func TestLockWait(t *testing.T) {
+	root := t.TempDir()
+
+	content := []byte("test content")
+	source := filepath.Join(root, "source.txt")
+	target := filepath.Join(root, "target.txt")
+
+	writeFile(t, source, content)
+	writeFile(t, target, content)
+
+	sourceInfo := getFileInfo(t, source)
+	targetInfo := getFileInfo(t, target)
+
+	f, err := os.Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}()
+
+	errCh := make(chan *types.Event, 10)
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{sourceInfo}),
+			types.NewSiblingGroup([]*types.FileInfo{targetInfo}),
+		}),
+	})
+
+	d := New(groups, Options{LockWait: 5 * time.Second}, errCh)
+	d.Run()
+	close(errCh)
+
+	for e := range errCh {
+		t.Errorf("unexpected error: %v", e)
+	}
+	if !sameInode(t, source, target) {
+		t.Error("target should be deduplicated once its lock is released")
+	}
+}
+
 // =============================================================================
 // Symlink Source Existence Tests
 // =============================================================================
@@ -749,7 +1815,7 @@ func TestSymlinkSourceMissing(t *testing.T) {
 
 	writeFile(t, target, []byte("target content"))
 
-	err := CreateSymlink(source, target)
+	err := CreateSymlink(source, target, LinkOptions{})
 	if err == nil {
 		t.Error("CreateSymlink should fail when source is missing")
 	}
@@ -782,6 +1848,7 @@ func getFileInfo(t *testing.T, path string) *types.FileInfo {
 		Dev:     uint64(stat.Dev), //nolint:unconvert // platform-dependent type
 		Ino:     stat.Ino,
 		Nlink:   uint32(stat.Nlink),
+		Blocks:  stat.Blocks,
 	}
 }
 
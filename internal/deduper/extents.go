@@ -0,0 +1,51 @@
+package deduper
+
+import (
+	"cmp"
+	"slices"
+)
+
+// extent is a physical byte range of a file on its device.
+type extent struct {
+	physical uint64
+	length   uint64
+}
+
+// sharedBytes returns how many bytes of target already share physical extents
+// with source (e.g. after a reflink copy or a previous extent-dedupe run).
+// Returns 0 if extents cannot be mapped (unsupported filesystem or platform).
+func sharedBytes(source, target string) int64 {
+	srcExtents, err := fileExtents(source)
+	if err != nil {
+		return 0
+	}
+	tgtExtents, err := fileExtents(target)
+	if err != nil {
+		return 0
+	}
+	return int64(overlap(srcExtents, tgtExtents))
+}
+
+// overlap returns the number of physical bytes covered by both extent lists.
+// Each list is assumed free of internal overlaps (true for a single file's mapping).
+func overlap(a, b []extent) uint64 {
+	byPhysical := func(x, y extent) int { return cmp.Compare(x.physical, y.physical) }
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.SortFunc(a, byPhysical)
+	slices.SortFunc(b, byPhysical)
+
+	var total uint64
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		aEnd, bEnd := a[i].physical+a[i].length, b[j].physical+b[j].length
+		lo, hi := max(a[i].physical, b[j].physical), min(aEnd, bEnd)
+		if hi > lo {
+			total += hi - lo
+		}
+		if aEnd < bEnd {
+			i++
+		} else {
+			j++
+		}
+	}
+	return total
+}
@@ -0,0 +1,51 @@
+package deduper
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverlap(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []extent
+		want uint64
+	}{
+		{"disjoint", []extent{{0, 10}}, []extent{{10, 10}}, 0},
+		{"identical", []extent{{0, 10}, {100, 5}}, []extent{{100, 5}, {0, 10}}, 15},
+		{"partial", []extent{{0, 10}}, []extent{{5, 10}}, 5},
+		{"spanning", []extent{{0, 100}}, []extent{{10, 5}, {50, 5}}, 10},
+		{"empty", nil, []extent{{0, 10}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlap(tt.a, tt.b); got != tt.want {
+				t.Errorf("overlap() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSharedBytes checks FIEMAP results: hardlinks share every extent, copies none.
+// Filesystems without FIEMAP report 0 for both, which skips the hardlink check.
+func TestSharedBytes(t *testing.T) {
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	a := filepath.Join(root, "a")
+	aLink := filepath.Join(root, "a_link")
+	b := filepath.Join(root, "b")
+	writeFile(t, a, content)
+	writeFile(t, b, content)
+	mustLink(t, a, aLink)
+
+	if got := sharedBytes(a, b); got != 0 {
+		t.Errorf("sharedBytes(copy) = %d, want 0", got)
+	}
+	if _, err := fileExtents(a); err != nil {
+		t.Skipf("FIEMAP not supported: %v", err)
+	}
+	if got := sharedBytes(a, aLink); got < int64(len(content)) {
+		t.Errorf("sharedBytes(hardlink) = %d, want >= %d", got, len(content))
+	}
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package deduper
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// FIEMAP ioctl interface (linux/fiemap.h).
+const (
+	fsIocFiemap            = 0xC020660B // _IOWR('f', 11, struct fiemap)
+	fiemapFlagSync         = 0x1        // Flush delayed allocation before mapping
+	fiemapExtentLast       = 0x1        // Last extent of the file
+	fiemapExtentUnknown    = 0x2        // Physical location unknown
+	fiemapExtentDelalloc   = 0x4        // Delayed allocation (no physical location yet)
+	fiemapExtentDataInline = 0x200      // Data stored inline with metadata
+	fiemapBatch            = 256        // Extents requested per ioctl
+)
+
+// fiemapHeader mirrors struct fiemap without the trailing extent array.
+type fiemapHeader struct {
+	start         uint64
+	length        uint64
+	flags         uint32
+	mappedExtents uint32
+	extentCount   uint32
+	reserved      uint32
+}
+
+// fiemapExtent mirrors struct fiemap_extent.
+type fiemapExtent struct {
+	logical    uint64
+	physical   uint64
+	length     uint64
+	reserved64 [2]uint64
+	flags      uint32
+	reserved   [3]uint32
+}
+
+// fileExtents returns the physical extents of a file.
+// Extents without a stable physical location (unknown, delayed, inline) are omitted.
+func fileExtents(path string) ([]extent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var extents []extent
+	buf := make([]byte, unsafe.Sizeof(fiemapHeader{})+fiemapBatch*unsafe.Sizeof(fiemapExtent{}))
+	hdr := (*fiemapHeader)(unsafe.Pointer(&buf[0]))
+	batch := unsafe.Slice((*fiemapExtent)(unsafe.Pointer(&buf[unsafe.Sizeof(fiemapHeader{})])), fiemapBatch)
+
+	var start uint64
+	for {
+		*hdr = fiemapHeader{start: start, length: ^uint64(0), flags: fiemapFlagSync, extentCount: fiemapBatch}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&buf[0]))); errno != 0 {
+			return nil, errno
+		}
+		if hdr.mappedExtents == 0 {
+			return extents, nil
+		}
+
+		for _, e := range batch[:hdr.mappedExtents] {
+			if e.flags&(fiemapExtentUnknown|fiemapExtentDelalloc|fiemapExtentDataInline) == 0 {
+				extents = append(extents, extent{physical: e.physical, length: e.length})
+			}
+			if e.flags&fiemapExtentLast != 0 {
+				return extents, nil
+			}
+			start = e.logical + e.length
+		}
+	}
+}
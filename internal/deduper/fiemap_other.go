@@ -0,0 +1,11 @@
+//go:build !linux
+
+package deduper
+
+import "errors"
+
+// fileExtents is not supported outside Linux; callers treat the error as
+// "no shared extents".
+func fileExtents(string) ([]extent, error) {
+	return nil, errors.ErrUnsupported
+}
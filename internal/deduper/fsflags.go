@@ -0,0 +1,58 @@
+package deduper
+
+import "os"
+
+// Inode attribute flags that forbid replacing a file (linux/fs.h).
+const (
+	fsImmutableFl = 0x10 // chattr +i: no rename, unlink or link
+	fsAppendFl    = 0x20 // chattr +a: writes may only append
+)
+
+// File flags in st_flags that forbid replacing a file (BSD and macOS
+// sys/stat.h, set with chflags). User flags can be set by the owner, system
+// flags by root only.
+const (
+	ufImmutable = 0x2      // uchg
+	ufAppend    = 0x4      // uappnd
+	ufNoUnlink  = 0x10     // uunlnk (FreeBSD)
+	sfImmutable = 0x20000  // schg
+	sfAppend    = 0x40000  // sappnd
+	sfNoUnlink  = 0x100000 // sunlnk (FreeBSD, macOS)
+)
+
+// chflagsToInode converts BSD st_flags to the Linux inode flags understood
+// by attributeName. A file that cannot be unlinked cannot be renamed over
+// either, so no-unlink counts as immutable.
+func chflagsToInode(flags uint32) uint32 {
+	var inode uint32
+	if flags&(ufImmutable|sfImmutable|ufNoUnlink|sfNoUnlink) != 0 {
+		inode |= fsImmutableFl
+	}
+	if flags&(ufAppend|sfAppend) != 0 {
+		inode |= fsAppendFl
+	}
+	return inode
+}
+
+// protectedAttribute returns "immutable" or "append-only" if f carries a flag
+// that makes replacing it fail with EPERM, or "" otherwise (including when
+// the flags cannot be read).
+func protectedAttribute(f *os.File) string {
+	flags, err := inodeFlags(f)
+	if err != nil {
+		return ""
+	}
+	return attributeName(flags)
+}
+
+// attributeName names the replacement-blocking flag in flags, if any.
+func attributeName(flags uint32) string {
+	switch {
+	case flags&fsImmutableFl != 0:
+		return "immutable"
+	case flags&fsAppendFl != 0:
+		return "append-only"
+	default:
+		return ""
+	}
+}
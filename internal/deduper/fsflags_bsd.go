@@ -0,0 +1,18 @@
+//go:build darwin || freebsd || netbsd || openbsd
+
+package deduper
+
+import (
+	"os"
+	"syscall"
+)
+
+// inodeFlags returns the file flags of an open file (chflags), as Linux
+// inode flags.
+func inodeFlags(f *os.File) (uint32, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &st); err != nil {
+		return 0, err
+	}
+	return chflagsToInode(st.Flags), nil
+}
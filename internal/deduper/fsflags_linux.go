@@ -0,0 +1,21 @@
+//go:build linux
+
+package deduper
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// FS_IOC_GETFLAGS ioctl interface (linux/fs.h).
+const fsIocGetflags = 0x80086601 // _IOR('f', 1, long); the kernel copies an int
+
+// inodeFlags returns the inode attribute flags of an open file (chattr/lsattr).
+func inodeFlags(f *os.File) (uint32, error) {
+	var flags int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocGetflags, uintptr(unsafe.Pointer(&flags))); errno != 0 {
+		return 0, errno
+	}
+	return uint32(flags), nil
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package deduper
+
+import (
+	"errors"
+	"os"
+)
+
+// inodeFlags is not supported on this platform; callers treat the error as
+// "no flags set".
+func inodeFlags(*os.File) (uint32, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,43 @@
+package deduper
+
+import "testing"
+
+func TestAttributeName(t *testing.T) {
+	tests := []struct {
+		flags uint32
+		want  string
+	}{
+		{0, ""},
+		{0x80000, ""}, // FS_EXTENT_FL
+		{fsImmutableFl, "immutable"},
+		{fsAppendFl, "append-only"},
+		{fsImmutableFl | fsAppendFl | 0x80000, "immutable"},
+	}
+	for _, tt := range tests {
+		if got := attributeName(tt.flags); got != tt.want {
+			t.Errorf("attributeName(%#x) = %q, want %q", tt.flags, got, tt.want)
+		}
+	}
+}
+
+func TestChflagsToInode(t *testing.T) {
+	tests := []struct {
+		flags uint32
+		want  string
+	}{
+		{0, ""},
+		{0x1, ""}, // UF_NODUMP
+		{ufImmutable, "immutable"},
+		{sfImmutable, "immutable"},
+		{ufNoUnlink, "immutable"},
+		{sfNoUnlink, "immutable"},
+		{ufAppend, "append-only"},
+		{sfAppend | 0x1, "append-only"},
+		{sfImmutable | ufAppend, "immutable"},
+	}
+	for _, tt := range tests {
+		if got := attributeName(chflagsToInode(tt.flags)); got != tt.want {
+			t.Errorf("attributeName(chflagsToInode(%#x)) = %q, want %q", tt.flags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package deduper
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// runHook runs a user command via "sh -c" for one replacement.
+//
+// The operation is described in environment variables:
+//
+//	DUPEDOG_HOOK    pre or post
+//	DUPEDOG_SOURCE  path kept
+//	DUPEDOG_TARGET  path replaced
+//	DUPEDOG_ACTION  hardlink, symlink, or skipped (planned action for pre)
+//	DUPEDOG_BYTES   file size in bytes
+//	DUPEDOG_ERROR   skip reason (post only, empty on success)
+//
+// Hook output goes to stderr so stdout stays clean for reports.
+func runHook(command, phase string, r *DedupeResult, size int64) error {
+	errMsg := ""
+	if r.Err != nil {
+		errMsg = r.Err.Error()
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"DUPEDOG_HOOK="+phase,
+		"DUPEDOG_SOURCE="+r.Source,
+		"DUPEDOG_TARGET="+r.Target,
+		"DUPEDOG_ACTION="+r.Action.String(),
+		"DUPEDOG_BYTES="+strconv.FormatInt(size, 10),
+		"DUPEDOG_ERROR="+errMsg,
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,277 @@
+//go:build unix
+
+package deduper
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Journal is a write-ahead intent log of replacements. Before a target is
+// replaced, an intent record naming source and target is appended and synced;
+// once the replacement finished (or failed cleanly), a done record follows.
+// An intent without a done record marks a replacement interrupted by a crash,
+// which RecoverJournals reconciles on the next run.
+//
+// Each run writes its own file in the journal directory and holds an
+// exclusive flock on it while running, so recovery never touches the journal
+// of a run that is still alive. A nil *Journal records nothing.
+type Journal struct {
+	path string
+	f    *os.File
+	enc  *json.Encoder
+	next uint64
+}
+
+// journalRecord is one line of a journal file: an intent (Source, Target and
+// Tmp set) or the completion of intent ID (Done set).
+type journalRecord struct {
+	ID     uint64 `json:"id"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	Tmp    string `json:"tmp,omitempty"` // Temporary link path (empty in older journals: TARGET.dupedog.tmp)
+	Done   bool   `json:"done,omitempty"`
+}
+
+// journalExt is the extension of journal files. Files are created under a
+// temporary name and renamed once locked, so recovery never sees a journal
+// before its owner holds the lock.
+const journalExt = ".journal"
+
+// OpenJournal creates and locks a new journal file in dir.
+func OpenJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "run-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, fmt.Errorf("lock journal: %w", err)
+	}
+	path := strings.TrimSuffix(f.Name(), ".tmp") + journalExt
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return &Journal{path: path, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// begin records the intent to replace target with a link to source, made as
+// tmp, and syncs it to disk. It returns the intent's ID for end.
+func (j *Journal) begin(source, target, tmp string) (uint64, error) {
+	if j == nil {
+		return 0, nil
+	}
+	j.next++
+	if err := j.enc.Encode(journalRecord{ID: j.next, Source: source, Target: target, Tmp: tmp}); err != nil {
+		return 0, fmt.Errorf("journal: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return 0, fmt.Errorf("journal: %w", err)
+	}
+	return j.next, nil
+}
+
+// end records that intent id is no longer in flight. It is not synced: a lost
+// done record only makes recovery re-check a replacement that completed.
+func (j *Journal) end(id uint64) {
+	if j == nil {
+		return
+	}
+	_ = j.enc.Encode(journalRecord{ID: id, Done: true})
+}
+
+// Close removes the journal file: after a clean exit nothing is in flight.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	err := os.Remove(j.path)
+	return errors.Join(err, j.f.Close())
+}
+
+// RecoveryAction is what RecoverJournals did with an interrupted replacement.
+type RecoveryAction int
+
+const (
+	// RecoveryRemovedTmp means the temporary link was removed; the target
+	// still held its original content.
+	RecoveryRemovedTmp RecoveryAction = iota
+	// RecoveryTargetGone means the target was missing and the temporary link
+	// was removed: the target was deleted after the crash, not by it.
+	RecoveryTargetGone
+	// RecoveryLeft means the temporary file was left in place, see Err.
+	RecoveryLeft
+)
+
+// String returns a description for output.
+func (a RecoveryAction) String() string {
+	switch a {
+	case RecoveryRemovedTmp:
+		return "removed temporary link"
+	case RecoveryTargetGone:
+		return "target was deleted, removed temporary link"
+	default:
+		return "left temporary file"
+	}
+}
+
+// Recovery describes one replacement interrupted by a crash that left a
+// temporary file behind.
+type Recovery struct {
+	Source string
+	Target string
+	Action RecoveryAction
+	Err    error // Why the temporary file was left (RecoveryLeft only)
+}
+
+// RecoverJournals reconciles the journals in dir left by runs that are no
+// longer alive and removes them. Interrupted replacements whose temporary
+// link is gone need nothing; the others are returned. A missing dir is not an
+// error.
+func RecoverJournals(dir string) ([]Recovery, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+journalExt))
+	if err != nil {
+		return nil, err
+	}
+	var recoveries []Recovery
+	var errs []error
+	for _, path := range paths {
+		r, err := recoverJournal(path)
+		recoveries = append(recoveries, r...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return recoveries, errors.Join(errs...)
+}
+
+// recoverJournal reconciles the journal at path unless its run still holds
+// the lock, then removes it.
+func recoverJournal(path string) ([]Recovery, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil // Recovered by a concurrent run
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, nil // The run is still alive
+		}
+		return nil, err
+	}
+
+	pending, err := readIntents(f)
+	if err != nil {
+		return nil, err
+	}
+	var recoveries []Recovery
+	for _, rec := range pending {
+		if r, ok := reconcile(rec.Source, rec.Target, cmp.Or(rec.Tmp, rec.Target+tmpSuffix)); ok {
+			recoveries = append(recoveries, r)
+		}
+	}
+	return recoveries, os.Remove(path)
+}
+
+// readIntents returns the intents without a done record, in journal order.
+// A truncated last line (crash mid-write) is ignored: its intent was never
+// synced, so the replacement never started.
+func readIntents(f *os.File) ([]journalRecord, error) {
+	var intents []journalRecord
+	done := make(map[uint64]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var rec journalRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			continue
+		}
+		if rec.Done {
+			done[rec.ID] = true
+		} else {
+			intents = append(intents, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	var pending []journalRecord
+	for _, rec := range intents {
+		if !done[rec.ID] {
+			pending = append(pending, rec)
+		}
+	}
+	return pending, nil
+}
+
+// reconcile finishes or rolls back one interrupted replacement. The link is
+// made as tmp and renamed over the target, so a crash leaves either no
+// temporary file (nothing to do) or one beside the original target, which is
+// removed. The rename is atomic, so a missing target was deleted after the
+// crash; its temporary link is removed too rather than bringing back a file
+// the user deleted. A temporary file that is not
+// a link to source was not made by this replacement and is left alone. ok is
+// false when there was nothing to do.
+func reconcile(source, target, tmp string) (r Recovery, ok bool) {
+	r = Recovery{Source: source, Target: target, Action: RecoveryLeft}
+	tmpInfo, err := os.Lstat(tmp)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, false
+	}
+	if err != nil {
+		r.Err = err
+		return r, true
+	}
+	if !linksTo(tmp, tmpInfo, source, filepath.Dir(target)) {
+		r.Err = fmt.Errorf("%s is not a link to %s", tmp, source)
+		return r, true
+	}
+
+	action := RecoveryRemovedTmp
+	if _, err := os.Lstat(target); errors.Is(err, os.ErrNotExist) {
+		action = RecoveryTargetGone
+	}
+	if r.Err = os.Remove(tmp); r.Err == nil {
+		r.Action = action
+	}
+	return r, true
+}
+
+// linksTo reports whether tmp (with Lstat info) is a hardlink to source, or a
+// symlink resolving to it. Relative symlinks are made for the target's
+// directory dir, which need not be tmp's.
+func linksTo(tmp string, info os.FileInfo, source, dir string) bool {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		dest, err := os.Readlink(tmp)
+		if err != nil {
+			return false
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(dir, dest)
+		}
+		if info, err = os.Stat(dest); err != nil {
+			return false
+		}
+	}
+	return os.SameFile(info, sourceInfo)
+}
@@ -0,0 +1,28 @@
+package deduper
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Largest returns the n groups that free the most space (see
+// types.ReclaimableBytes), for --limit. Ties keep path order. n <= 0 or at
+// least the number of groups returns groups unchanged.
+func Largest(groups types.DuplicateGroups, n int) types.DuplicateGroups {
+	if n <= 0 || n >= groups.Len() {
+		return groups
+	}
+	return types.NewDuplicateGroups(bySavings(groups)[:n])
+}
+
+// bySavings returns groups ordered by the space they free, most first. Ties
+// keep path order.
+func bySavings(groups types.DuplicateGroups) []types.DuplicateGroup {
+	sorted := slices.Clone(groups.Items())
+	slices.SortStableFunc(sorted, func(a, b types.DuplicateGroup) int {
+		return cmp.Compare(types.ReclaimableBytes(b), types.ReclaimableBytes(a))
+	})
+	return sorted
+}
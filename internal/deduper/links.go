@@ -3,28 +3,132 @@
 package deduper
 
 import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// TmpMarker must appear in every temporary link suffix, so that files
+// removed as orphaned temporary links are never ones dupedog did not create.
+const TmpMarker = "dupedog"
+
 const (
-	// orphanedTmpMaxAge is the minimum age for a .dupedog.tmp file to be considered orphaned.
-	// Files younger than this are assumed to be from an active operation.
+	// tmpSuffix names the temporary link renamed over a target.
+	tmpSuffix = ".dupedog.tmp"
+
+	// orphanedTmpMaxAge is the default minimum age for a .dupedog.tmp file to be considered
+	// orphaned (see LinkOptions.OrphanAge). Files younger than this are assumed to be from an
+	// active operation.
 	orphanedTmpMaxAge = 1 * time.Minute
 )
 
+// LinkOptions configures how CreateHardlink and CreateSymlink replace a
+// target. The zero value makes the temporary link next to the target, as
+// TARGET.dupedog.tmp, and does not sync.
+type LinkOptions struct {
+	TmpSuffix  string        // Suffix of temporary links, containing TmpMarker ("" = .dupedog.tmp)
+	StagingDir string        // If set, temporary links are made in this directory, relative to the top of each target's filesystem, instead of next to the target
+	Fsync      bool          // Sync the target's directory after the rename (see syncDir)
+	OrphanAge  time.Duration // Minimum age of a leftover temporary link before it may be removed (0 = orphanedTmpMaxAge)
+}
+
+// orphanAge returns the minimum age of orphaned temporary links.
+func (o LinkOptions) orphanAge() time.Duration {
+	return cmp.Or(o.OrphanAge, orphanedTmpMaxAge)
+}
+
+// TmpPath returns the path of the temporary link renamed over target.
+//
+// In a staging directory, the link is named after a hash of target, so the
+// link of one target always has the same name and orphans are found again.
+// The staging directory is on the target's filesystem, as rename requires.
+func (o LinkOptions) TmpPath(target string) (string, error) {
+	suffix := cmp.Or(o.TmpSuffix, tmpSuffix)
+	if o.StagingDir == "" {
+		return target + suffix, nil
+	}
+	top, err := filesystemTop(filepath.Dir(target))
+	if err != nil {
+		return "", fmt.Errorf("staging dir: %w", err)
+	}
+	sum := sha256.Sum256([]byte(target))
+	return filepath.Join(top, o.StagingDir, hex.EncodeToString(sum[:stagedNameLen/2])+suffix), nil
+}
+
+// stagedNameLen is the length of the hex name of staged temporary links,
+// before the suffix.
+const stagedNameLen = 16
+
+// isTmpName reports whether name has the form of the temporary links that
+// TmpPath makes: the suffix after a target's name, or after a hex hash of
+// one in a staging directory.
+func (o LinkOptions) isTmpName(name string, staged bool) bool {
+	base, ok := strings.CutSuffix(name, cmp.Or(o.TmpSuffix, tmpSuffix))
+	if !ok || base == "" {
+		return false
+	}
+	if !staged {
+		return true
+	}
+	_, err := hex.DecodeString(base)
+	return len(base) == stagedNameLen && err == nil
+}
+
+// filesystemTop returns the topmost directory at or above dir on the same
+// device as dir: the mount point of its filesystem, as seen through the
+// path (or of its subvolume, on btrfs).
+func filesystemTop(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return "", &os.PathError{Op: "stat", Path: dir, Err: err}
+	}
+	for dir != "/" {
+		var parent syscall.Stat_t
+		if err := syscall.Stat(filepath.Dir(dir), &parent); err != nil || parent.Dev != st.Dev {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return dir, nil
+}
+
+// prepareTmp returns the temporary link path of target, creating the
+// staging directory if there is one.
+func (o LinkOptions) prepareTmp(target string) (string, error) {
+	tmp, err := o.TmpPath(target)
+	if err != nil {
+		return "", err
+	}
+	if o.StagingDir != "" {
+		if err := os.MkdirAll(filepath.Dir(tmp), 0o700); err != nil {
+			return "", fmt.Errorf("staging dir: %w", err)
+		}
+	}
+	return tmp, nil
+}
+
 // CreateHardlink creates a hardlink atomically by linking to a temp file then renaming.
 // If the temp file exists and is orphaned (old + safe to delete), it will be cleaned up and retried.
-func CreateHardlink(source, target string) error {
-	tmp := target + ".dupedog.tmp"
+func CreateHardlink(source, target string, opts LinkOptions) error {
+	tmp, err := opts.prepareTmp(target)
+	if err != nil {
+		return err
+	}
 
-	err := os.Link(source, tmp)
+	err = os.Link(source, tmp)
 	if errors.Is(err, syscall.EEXIST) {
-		if cleanupErr := tryCleanupOrphanedTmp(tmp, orphanedTmpMaxAge); cleanupErr != nil {
+		if cleanupErr := tryCleanupOrphanedTmp(tmp, opts.orphanAge()); cleanupErr != nil {
 			return fmt.Errorf("tmp file exists and cannot be cleaned: %w", cleanupErr)
 		}
 		// Retry after cleanup
@@ -38,19 +142,25 @@ func CreateHardlink(source, target string) error {
 		_ = os.Remove(tmp) // cleanup on failure
 		return err
 	}
+	if opts.Fsync {
+		return syncDir(filepath.Dir(target))
+	}
 	return nil
 }
 
 // CreateSymlink creates a symlink atomically by linking to a temp file then renaming.
 // If the temp file exists and is orphaned (old + safe to delete), it will be cleaned up and retried.
-func CreateSymlink(source, target string) error {
+func CreateSymlink(source, target string, opts LinkOptions) error {
 	// Verify source exists before creating a symlink to it.
 	// This prevents creating dangling symlinks if source was deleted after verification.
 	if _, err := os.Stat(source); err != nil {
 		return fmt.Errorf("source missing before symlink creation: %w", err)
 	}
 
-	tmp := target + ".dupedog.tmp"
+	tmp, err := opts.prepareTmp(target)
+	if err != nil {
+		return err
+	}
 
 	// For symlinks, we need the relative path from target's perspective
 	relPath, err := filepath.Rel(filepath.Dir(target), source)
@@ -60,7 +170,7 @@ func CreateSymlink(source, target string) error {
 
 	err = os.Symlink(relPath, tmp)
 	if errors.Is(err, syscall.EEXIST) {
-		if cleanupErr := tryCleanupOrphanedTmp(tmp, orphanedTmpMaxAge); cleanupErr != nil {
+		if cleanupErr := tryCleanupOrphanedTmp(tmp, opts.orphanAge()); cleanupErr != nil {
 			return fmt.Errorf("tmp file exists and cannot be cleaned: %w", cleanupErr)
 		}
 		// Retry after cleanup
@@ -74,6 +184,28 @@ func CreateSymlink(source, target string) error {
 		_ = os.Remove(tmp) // cleanup on failure
 		return err
 	}
+	if opts.Fsync {
+		return syncDir(filepath.Dir(target))
+	}
+	return nil
+}
+
+// ErrNotSynced is returned by CreateHardlink and CreateSymlink when the
+// target was replaced but its directory could not be synced.
+var ErrNotSynced = errors.New("replaced, but not synced to disk")
+
+// syncDir flushes the entries of dir to disk. A rename is only durable once
+// its directory is: filesystems that delay metadata writes can otherwise
+// bring the old target back after a power loss.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotSynced, err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("%w: fsync %s: %w", ErrNotSynced, dir, err)
+	}
 	return nil
 }
 
@@ -86,6 +218,15 @@ func CreateSymlink(source, target string) error {
 //
 // If nlink == 1, the file is NOT deleted as it may be the only copy of data.
 func tryCleanupOrphanedTmp(path string, maxAge time.Duration) error {
+	if err := checkOrphanedTmp(path, maxAge); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// checkOrphanedTmp returns why tryCleanupOrphanedTmp would leave path alone,
+// or nil if it would remove it.
+func checkOrphanedTmp(path string, maxAge time.Duration) error {
 	info, err := os.Lstat(path)
 	if err != nil {
 		return fmt.Errorf("lstat: %w", err)
@@ -94,7 +235,7 @@ func tryCleanupOrphanedTmp(path string, maxAge time.Duration) error {
 	// Safety check 1: Age
 	cutoff := time.Now().Add(-maxAge)
 	if info.ModTime().After(cutoff) {
-		return fmt.Errorf("file too recent (mtime %v, cutoff %v)", info.ModTime(), cutoff)
+		return fmt.Errorf("file too recent (modified %v ago, minimum age %v)", time.Since(info.ModTime()).Round(time.Second), maxAge)
 	}
 
 	// Safety check 2: Type and nlink
@@ -102,7 +243,7 @@ func tryCleanupOrphanedTmp(path string, maxAge time.Duration) error {
 
 	// Symlinks are always safe - they don't contain actual data
 	if mode&os.ModeSymlink != 0 {
-		return os.Remove(path)
+		return nil
 	}
 
 	// For regular files, check nlink
@@ -121,5 +262,5 @@ func tryCleanupOrphanedTmp(path string, maxAge time.Duration) error {
 		return fmt.Errorf("nlink=%d, may be only copy of data", stat.Nlink)
 	}
 
-	return os.Remove(path)
+	return nil
 }
@@ -0,0 +1,79 @@
+//go:build unix
+
+package deduper
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Orphan is a temporary link found by CleanupOrphans.
+type Orphan struct {
+	Path    string
+	Removed bool  // Removed (in a dry run: would be removed)
+	Err     error // Why it was left, if not removed
+}
+
+// CleanupOrphans removes the temporary links that interrupted runs left
+// under roots (files named with the suffix of opts after a non-empty name)
+// and in the staging directory of opts at the top of each root's filesystem
+// (files named as TmpPath names them there). Only links that
+// tryCleanupOrphanedTmp would remove on a collision are removed: older than
+// the orphan age of opts, and symlinks or files with other links. In a dry run,
+// nothing is removed. Orphans are returned sorted by path; directories that
+// cannot be read are reported to errCh (if not nil) and skipped.
+func CleanupOrphans(roots []string, opts LinkOptions, dryRun bool, errCh chan *types.Event) []Orphan {
+	report := func(path string, err error) {
+		if errCh != nil {
+			errCh <- types.NewEvent(types.StageScan, path, err)
+		}
+	}
+	var paths []string
+	walk := func(dir string, staged bool) {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				report(path, err)
+				return nil
+			}
+			if !d.IsDir() && opts.isTmpName(d.Name(), staged) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+	}
+	for _, root := range roots {
+		walk(root, false)
+	}
+	if opts.StagingDir != "" {
+		staged := make(map[string]bool)
+		for _, root := range roots {
+			top, err := filesystemTop(root)
+			if err != nil {
+				report(root, err)
+				continue
+			}
+			if dir := filepath.Join(top, opts.StagingDir); !staged[dir] {
+				staged[dir] = true
+				if _, err := os.Lstat(dir); err == nil {
+					walk(dir, true)
+				}
+			}
+		}
+	}
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	orphans := make([]Orphan, 0, len(paths))
+	for _, path := range paths {
+		err := checkOrphanedTmp(path, opts.orphanAge())
+		if err == nil && !dryRun {
+			err = os.Remove(path)
+		}
+		orphans = append(orphans, Orphan{Path: path, Removed: err == nil, Err: err})
+	}
+	return orphans
+}
@@ -0,0 +1,34 @@
+package deduper
+
+import "time"
+
+// rateLimiter spaces operations at least 1/perSec apart. It is not safe for
+// concurrent use; the deduper replaces files sequentially.
+type rateLimiter struct {
+	interval time.Duration // 0 = unlimited
+	next     time.Time     // Earliest start of the next operation
+	now      func() time.Time
+	sleep    func(time.Duration)
+}
+
+// newRateLimiter creates a limiter for perSec operations per second (0 = unlimited).
+func newRateLimiter(perSec float64) *rateLimiter {
+	l := &rateLimiter{now: time.Now, sleep: time.Sleep}
+	if perSec > 0 {
+		l.interval = time.Duration(float64(time.Second) / perSec)
+	}
+	return l
+}
+
+// wait blocks until the next operation may start.
+func (l *rateLimiter) wait() {
+	if l.interval == 0 {
+		return
+	}
+	now := l.now()
+	if d := l.next.Sub(now); d > 0 {
+		l.sleep(d)
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+}
@@ -0,0 +1,48 @@
+package deduper
+
+import (
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// securityXattrs are the extended attributes that hardlinking would collapse:
+// all links share one inode, so every replaced path would take on the source's
+// file capabilities and SELinux context.
+var securityXattrs = []string{"security.capability", "security.selinux"}
+
+// SplitBySecurity splits each duplicate group into subgroups whose inodes
+// carry identical security xattrs (see securityXattrs), so files with
+// different capabilities or SELinux contexts are never merged. Subgroups of a
+// single inode are dropped. Inodes whose attributes cannot be read are
+// reported to errCh and left out.
+func SplitBySecurity(groups types.DuplicateGroups, errCh chan *types.Event) types.DuplicateGroups {
+	return splitByLabel(groups, securityLabel, errCh)
+}
+
+// splitByLabel splits groups by label(first file of each sibling group),
+// keeping subgroups in order of their first sibling group.
+func splitByLabel(groups types.DuplicateGroups, label func(path string) (string, error), errCh chan *types.Event) types.DuplicateGroups {
+	var result []types.DuplicateGroup
+	for _, group := range groups.Items() {
+		var labels []string
+		byLabel := make(map[string][]types.SiblingGroup)
+		for _, siblings := range group.Items() {
+			l, err := label(siblings.First().Path)
+			if err != nil {
+				if errCh != nil {
+					errCh <- types.NewEvent(types.StageDedupe, siblings.First().Path, err)
+				}
+				continue
+			}
+			if _, seen := byLabel[l]; !seen {
+				labels = append(labels, l)
+			}
+			byLabel[l] = append(byLabel[l], siblings)
+		}
+		for _, l := range labels {
+			if len(byLabel[l]) > 1 {
+				result = append(result, types.NewDuplicateGroup(byLabel[l]))
+			}
+		}
+	}
+	return types.NewDuplicateGroups(result)
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package deduper
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// securityLabel returns the values of securityXattrs on path, joined by NUL.
+// Missing attributes, and filesystems without xattrs, yield empty values.
+func securityLabel(path string) (string, error) {
+	values := make([]string, len(securityXattrs))
+	for i, name := range securityXattrs {
+		value, err := getxattr(path, name)
+		if err != nil && !errors.Is(err, syscall.ENODATA) && !errors.Is(err, syscall.ENOTSUP) {
+			return "", &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+		}
+		values[i] = value
+	}
+	return strings.Join(values, "\x00"), nil
+}
+
+// getxattr reads an extended attribute, sizing the buffer first.
+func getxattr(path, name string) (string, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return "", err
+		}
+		buf := make([]byte, size)
+		n, err := syscall.Getxattr(path, name, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue // Grew between the calls
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+}
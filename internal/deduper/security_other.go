@@ -0,0 +1,9 @@
+//go:build !linux
+
+package deduper
+
+// securityLabel is empty outside Linux, where file capabilities and SELinux
+// contexts do not exist.
+func securityLabel(string) (string, error) {
+	return "", nil
+}
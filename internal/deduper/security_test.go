@@ -0,0 +1,87 @@
+package deduper
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// TestSplitByLabel tests that only inodes with equal security labels stay
+// together, that singleton subgroups are dropped and unreadable inodes are
+// reported and left out.
+func TestSplitByLabel(t *testing.T) {
+	labels := map[string]string{
+		"/a": "", "/b": "cap", "/c": "", "/d": "cap", "/e": "ctx",
+	}
+	label := func(path string) (string, error) {
+		l, ok := labels[path]
+		if !ok {
+			return "", errors.New("unreadable")
+		}
+		return l, nil
+	}
+	var siblings []types.SiblingGroup
+	for i, path := range []string{"/a", "/b", "/c", "/d", "/e", "/f"} {
+		siblings = append(siblings, types.NewSiblingGroup([]*types.FileInfo{{Path: path, Ino: uint64(i + 1)}}))
+	}
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{types.NewDuplicateGroup(siblings)})
+
+	errCh := make(chan *types.Event, 10)
+	got := splitByLabel(groups, label, errCh)
+
+	var paths [][]string
+	for _, g := range got.Items() {
+		var p []string
+		for _, s := range g.Items() {
+			p = append(p, s.First().Path)
+		}
+		paths = append(paths, p)
+	}
+	if len(paths) != 2 || len(paths[0]) != 2 || len(paths[1]) != 2 ||
+		paths[0][0] != "/a" || paths[0][1] != "/c" || paths[1][0] != "/b" || paths[1][1] != "/d" {
+		t.Errorf("splitByLabel() = %v, want [[/a /c] [/b /d]]", paths)
+	}
+	if len(errCh) != 1 {
+		t.Errorf("expected 1 error for /f, got %d", len(errCh))
+	}
+}
+
+// TestSecurityLabelPlainFiles tests that files without security xattrs read
+// without error and get equal labels.
+func TestSecurityLabelPlainFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, p := range []string{a, b} {
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	la, errA := securityLabel(a)
+	lb, errB := securityLabel(b)
+	if errA != nil || errB != nil || la != lb {
+		t.Errorf("securityLabel() = %q, %v and %q, %v; want equal labels", la, errA, lb, errB)
+	}
+}
+
+// TestSecurityLabelCapability tests that a file capability changes the label.
+func TestSecurityLabelCapability(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, p := range []string{a, b} {
+		if err := os.WriteFile(p, []byte("x"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := exec.Command("setcap", "cap_net_raw+ep", b).CombinedOutput(); err != nil {
+		t.Skipf("setcap not supported: %v: %s", err, out)
+	}
+	la, _ := securityLabel(a)
+	lb, err := securityLabel(b)
+	if err != nil || la == lb {
+		t.Errorf("securityLabel() = %q, %v; want a label different from %q", lb, err, la)
+	}
+}
@@ -2,25 +2,133 @@ package deduper
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
+
+	"github.com/ivoronin/dupedog/internal/color"
+	"github.com/ivoronin/dupedog/internal/types"
 )
 
 // ActionType describes the action taken during deduplication.
 type ActionType int
 
 const (
-	ActionHardlink ActionType = iota
-	ActionSymlink             // Fallback for cross-device
-	ActionSkipped             // Skipped due to error
+	ActionHardlink  ActionType = iota
+	ActionSymlink              // Fallback for cross-device, or with --action symlink
+	ActionSkipped              // Skipped due to error
+	ActionReflinked            // Left alone: already shares all extents with source
+	ActionReflink              // Extents shared with source in place (--action auto)
+	ActionAuto                 // Options.Action only: reflink, hardlink or symlink per target
+)
+
+// String returns the lowercase action name used in reports.
+func (a ActionType) String() string {
+	switch a {
+	case ActionHardlink:
+		return "hardlink"
+	case ActionSymlink:
+		return "symlink"
+	case ActionSkipped:
+		return "skipped"
+	case ActionReflinked:
+		return "reflinked"
+	case ActionReflink:
+		return "reflink"
+	case ActionAuto:
+		return "auto"
+	default:
+		return "unknown"
+	}
+}
+
+// Replaced reports whether the target was replaced with a link or made to
+// share the source's extents.
+func (a ActionType) Replaced() bool {
+	return a == ActionHardlink || a == ActionSymlink || a == ActionReflink
+}
+
+// ParseAction parses an --action value: hardlink, symlink or auto.
+func ParseAction(s string) (ActionType, error) {
+	switch s {
+	case "", "hardlink":
+		return ActionHardlink, nil
+	case "symlink":
+		return ActionSymlink, nil
+	case "auto":
+		return ActionAuto, nil
+	default:
+		return ActionHardlink, fmt.Errorf("unknown action %q (want hardlink, symlink or auto)", s)
+	}
+}
+
+// Preference breaks ties between source candidates of equal path priority.
+type Preference int
+
+const (
+	PreferDefault      Preference = iota // Highest nlink, then lexicographically first path
+	PreferShortestPath                   // Shortest path, then lexicographically first
+	PreferShallowest                     // Fewest directory levels, then shortest path
 )
 
+// ParsePreference parses a --prefer value.
+func ParsePreference(s string) (Preference, error) {
+	switch s {
+	case "", "default":
+		return PreferDefault, nil
+	case "shortest-path":
+		return PreferShortestPath, nil
+	case "shallowest":
+		return PreferShallowest, nil
+	default:
+		return PreferDefault, fmt.Errorf("unknown preference %q (want shortest-path or shallowest)", s)
+	}
+}
+
+// less reports whether a is a better source than b under this preference.
+func (p Preference) less(a, b *types.FileInfo) bool {
+	switch p {
+	case PreferShortestPath:
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) < len(b.Path)
+		}
+	case PreferShallowest:
+		if da, db := depth(a.Path), depth(b.Path); da != db {
+			return da < db
+		}
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) < len(b.Path)
+		}
+	default:
+		if a.Nlink != b.Nlink {
+			return a.Nlink > b.Nlink
+		}
+	}
+	return a.Path < b.Path
+}
+
+// depth returns the number of directory levels in path.
+func depth(path string) int {
+	return strings.Count(path, string(filepath.Separator))
+}
+
 // DedupeResult describes the outcome of a single dedupe operation.
 type DedupeResult struct {
-	Source     string     // Path kept
-	Target     string     // Path replaced
-	Action     ActionType // Hardlink, Symlink, or Skipped
-	BytesSaved int64      // Bytes reclaimed (0 if skipped)
-	Err        error      // Non-nil if skipped
+	Source     string       // Path kept
+	Target     string       // Path replaced
+	Action     ActionType   // Hardlink, Symlink, Reflink, Skipped, or Reflinked
+	BytesSaved int64        // Bytes reclaimed, excluding already-shared extents (0 if skipped)
+	Reason     types.Reason // Why the target was skipped
+	Err        error        // Non-nil if skipped
+}
+
+// Event returns the skip as an event carrying the target path and the dedupe
+// stage, for matching with errors.Is and errors.As. Returns nil if the target
+// was not skipped.
+func (r *DedupeResult) Event() *types.Event {
+	if r.Err == nil {
+		return nil
+	}
+	return &types.Event{Stage: types.StageDedupe, Path: r.Target, Reason: r.Reason, Err: r.Err}
 }
 
 // String formats the dedupe result for display.
@@ -30,13 +138,26 @@ func (r *DedupeResult) String() string {
 		return fmt.Sprintf("Replaced %s with hardlink to %s", escapePath(r.Target), escapePath(r.Source))
 	case ActionSymlink:
 		return fmt.Sprintf("Replaced %s with symlink to %s", escapePath(r.Target), escapePath(r.Source))
+	case ActionReflink:
+		return fmt.Sprintf("Shared extents of %s with %s", escapePath(r.Target), escapePath(r.Source))
 	case ActionSkipped:
 		return fmt.Sprintf("skipped %s: %v", escapePath(r.Target), r.Err)
+	case ActionReflinked:
+		return fmt.Sprintf("Kept %s: already shares extents with %s", escapePath(r.Target), escapePath(r.Source))
 	default:
 		return fmt.Sprintf("Unknown action for %s", escapePath(r.Target))
 	}
 }
 
+// Colored formats the result like String, green if the target was replaced
+// and yellow if it was kept or skipped.
+func (r *DedupeResult) Colored(p color.Palette) string {
+	if r.Action.Replaced() {
+		return p.Green(r.String())
+	}
+	return p.Yellow(r.String())
+}
+
 // escapePath escapes special characters in paths for safe terminal output.
 func escapePath(path string) string {
 	r := strings.NewReplacer(
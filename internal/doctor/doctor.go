@@ -0,0 +1,145 @@
+//go:build unix
+
+// Package doctor probes what the filesystem under a path supports, so users
+// can choose how to deduplicate (hardlinks, symlinks, reflinks) before a run.
+//
+// Probes work on scratch files in a temporary directory created under the
+// path and removed afterwards, so the path must be a writable directory.
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Check is the outcome of one probe.
+type Check struct {
+	OK  bool
+	Err error // Why the capability is missing; ErrNotProbed if it cannot be probed on this platform
+}
+
+// ErrNotProbed marks capabilities that are not probed on this platform.
+var ErrNotProbed = errors.New("not probed on this platform")
+
+// String returns "yes", "no", or "n/a" (not probed on this platform).
+func (c Check) String() string {
+	switch {
+	case c.OK:
+		return "yes"
+	case errors.Is(c.Err, ErrNotProbed):
+		return "n/a"
+	default:
+		return "no"
+	}
+}
+
+// Result describes the capabilities of the filesystem under Path.
+type Result struct {
+	Path          string
+	FSType        string // From the mount table (statfs on BSD and macOS), "" if unknown
+	Hardlink      Check
+	Reflink       Check // FICLONE
+	MaxLinks      int64 // Link count limit of FSType, 0 if unknown
+	CaseSensitive Check
+	Flock         Check // An exclusive flock keeps other opens of the file from locking it
+	Err           error // Path could not be probed at all
+}
+
+// maxLinks are the link count limits of common filesystems.
+var maxLinks = map[string]int64{
+	"ext2":  32000,
+	"ext3":  32000,
+	"ext4":  65000,
+	"xfs":   2147483647,
+	"btrfs": 65535,
+	"ntfs":  1024,
+	"ntfs3": 1024,
+	"ufs":   32767, // FreeBSD
+	"ffs":   32767, // OpenBSD, NetBSD
+}
+
+// scratchSize is the size of the probe file: one block, so that filesystems
+// that clone whole blocks only can reflink it.
+const scratchSize = 4096
+
+// Probe checks the filesystem under the directory path.
+func Probe(path string) Result {
+	r := Result{Path: path}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		r.Err = err
+		return r
+	}
+	r.FSType = fsType(path, uint64(st.Dev)) //nolint:unconvert // platform-dependent type
+	r.MaxLinks = maxLinks[r.FSType]
+
+	dir, err := os.MkdirTemp(path, ".dupedog-doctor-*")
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	scratch := filepath.Join(dir, "Scratch")
+	if err := os.WriteFile(scratch, make([]byte, scratchSize), 0o600); err != nil {
+		r.Err = err
+		return r
+	}
+	r.Hardlink = check(os.Link(scratch, filepath.Join(dir, "link")))
+	r.Reflink = check(reflink(scratch, filepath.Join(dir, "clone")))
+	r.CaseSensitive = caseSensitive(scratch)
+	r.Flock = flockExcludes(scratch)
+	return r
+}
+
+// check turns the error of a probe into a Check.
+func check(err error) Check {
+	return Check{OK: err == nil, Err: err}
+}
+
+// caseSensitive reports whether path can't be reached with its base name in
+// upper case.
+func caseSensitive(path string) Check {
+	upper := filepath.Join(filepath.Dir(path), "SCRATCH")
+	_, err := os.Lstat(upper)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return Check{OK: true}
+	case err != nil:
+		return check(err)
+	default:
+		return Check{Err: fmt.Errorf("%s names %s", filepath.Base(upper), filepath.Base(path))}
+	}
+}
+
+// flockExcludes reports whether an exclusive flock on path keeps a second
+// open file from locking it, as the deduper relies on to skip files in use.
+// Some network filesystems accept every lock without enforcing any.
+func flockExcludes(path string) Check {
+	f1, err := os.Open(path)
+	if err != nil {
+		return check(err)
+	}
+	defer func() { _ = f1.Close() }()
+	f2, err := os.Open(path)
+	if err != nil {
+		return check(err)
+	}
+	defer func() { _ = f2.Close() }()
+
+	if err := syscall.Flock(int(f1.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return check(err)
+	}
+	err = syscall.Flock(int(f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	switch {
+	case errors.Is(err, syscall.EWOULDBLOCK):
+		return Check{OK: true}
+	case err != nil:
+		return check(err)
+	default:
+		return Check{Err: errors.New("a second exclusive lock was granted")}
+	}
+}
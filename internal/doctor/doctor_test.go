@@ -0,0 +1,42 @@
+//go:build unix
+
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestProbe tests the probes on the test's temporary directory, which
+// supports hardlinks and flock and is case-sensitive on Linux, and that no
+// scratch files are left behind.
+func TestProbe(t *testing.T) {
+	dir := t.TempDir()
+	r := Probe(dir)
+	if r.Err != nil {
+		t.Fatalf("Probe() error = %v", r.Err)
+	}
+	if !r.Hardlink.OK || !r.Flock.OK {
+		t.Errorf("Probe() = %+v, want hardlink and flock support", r)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("ReadDir() = %v, %v, want empty", entries, err)
+	}
+
+	if r := Probe(filepath.Join(dir, "missing")); r.Err == nil {
+		t.Error("Probe(missing) error = nil")
+	}
+}
+
+func TestCheckString(t *testing.T) {
+	for c, want := range map[Check]string{
+		{OK: true}:              "yes",
+		{Err: os.ErrPermission}: "no",
+		{Err: ErrNotProbed}:     "n/a",
+	} {
+		if got := c.String(); got != want {
+			t.Errorf("%+v.String() = %s, want %s", c, got, want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package doctor
+
+import "golang.org/x/sys/unix"
+
+// fsType returns the filesystem type of path from statvfs.
+func fsType(path string, _ uint64) string {
+	var fs unix.Statvfs_t
+	if err := unix.Statvfs(path, &fs); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(fs.Fstypename[:])
+}
@@ -0,0 +1,12 @@
+package doctor
+
+import "golang.org/x/sys/unix"
+
+// fsType returns the filesystem type of path from statfs.
+func fsType(path string, _ uint64) string {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(fs.F_fstypename[:])
+}
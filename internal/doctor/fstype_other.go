@@ -0,0 +1,13 @@
+//go:build unix && !(darwin || freebsd || netbsd || openbsd)
+
+package doctor
+
+import "github.com/ivoronin/dupedog/internal/mounts"
+
+// fsType returns the filesystem type of device dev from the mount table.
+func fsType(_ string, dev uint64) string {
+	if m, ok := mounts.Lookup(dev); ok {
+		return m.FSType
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package doctor
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones src into a new file dst with FICLONE.
+func reflink(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	return errors.Join(unix.IoctlFileClone(int(out.Fd()), int(in.Fd())), out.Close())
+}
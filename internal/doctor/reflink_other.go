@@ -0,0 +1,8 @@
+//go:build unix && !linux
+
+package doctor
+
+// reflink is not probed outside Linux.
+func reflink(string, string) error {
+	return ErrNotProbed
+}
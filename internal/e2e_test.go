@@ -3,6 +3,7 @@
 package internal
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/ivoronin/dupedog/internal/testfs"
@@ -401,3 +402,179 @@ func TestE2EExcludePattern(t *testing.T) {
 	h.Assert(expected)
 }
 
+
+// =============================================================================
+// Section 9.5: Real Filesystem E2E Tests
+// =============================================================================
+
+// TestE2ERealFilesystems tests deduplication on loop-mounted filesystem images.
+func TestE2ERealFilesystems(t *testing.T) {
+	for _, fsType := range []string{"ext4", "xfs", "btrfs"} {
+		t.Run(fsType, func(t *testing.T) {
+			spec := testfs.FileTree{
+				Volumes: []testfs.Volume{
+					{
+						MountPoint: "/data",
+						FSType:     fsType,
+						Files: []testfs.File{
+							{Path: []string{"a.bin"}, Chunks: []testfs.Chunk{{Random: true, Seed: 1, Size: "3MiB"}}},
+							{Path: []string{"b.bin"}, Chunks: []testfs.Chunk{{Random: true, Seed: 1, Size: "3MiB"}}},
+							{Path: []string{"c.bin"}, Chunks: []testfs.Chunk{{Random: true, Seed: 2, Size: "3MiB"}}},
+						},
+					},
+				},
+			}
+
+			h := testfs.New(t, spec)
+			h.RunDupedog("dedupe", "/data")
+
+			expected := testfs.FileTree{
+				ExitCode: 0,
+				Volumes: []testfs.Volume{
+					{
+						MountPoint: "/data",
+						Files: []testfs.File{
+							{Path: []string{"a.bin", "b.bin"}},
+							{Path: []string{"c.bin"}},
+						},
+					},
+				},
+			}
+			h.Assert(expected)
+		})
+	}
+}
+
+// TestE2EReflinkedCopiesLeftAlone tests that a copy already sharing all
+// extents with its source (cp --reflink) is not replaced by a hardlink.
+func TestE2EReflinkedCopiesLeftAlone(t *testing.T) {
+	spec := testfs.FileTree{
+		Volumes: []testfs.Volume{
+			{
+				MountPoint: "/data",
+				FSType:     "btrfs",
+				Files: []testfs.File{
+					{Path: []string{"a.bin"}, Chunks: []testfs.Chunk{{Random: true, Seed: 1, Size: "3MiB"}}},
+				},
+			},
+		},
+	}
+
+	h := testfs.New(t, spec)
+	if r := h.Exec("cp", "--reflink=always", "/data/a.bin", "/data/b.bin"); r.ExitCode != 0 {
+		t.Fatalf("cp --reflink failed: %s", r.Stderr)
+	}
+	h.Exec("sync")
+	h.RunDupedog("dedupe", "/data")
+
+	expected := testfs.FileTree{
+		ExitCode: 0,
+		Volumes: []testfs.Volume{
+			{
+				MountPoint: "/data",
+				Files: []testfs.File{
+					{Path: []string{"a.bin"}},
+					{Path: []string{"b.bin"}},
+				},
+			},
+		},
+	}
+	h.Assert(expected)
+}
+
+// TestE2ECrossFilesystemNestedImages tests symlink fallback between a tmpfs
+// volume and an ext4 image nested inside it.
+func TestE2ECrossFilesystemNestedImages(t *testing.T) {
+	spec := testfs.FileTree{
+		Volumes: []testfs.Volume{
+			{
+				MountPoint: "/data",
+				Files: []testfs.File{
+					{Path: []string{"a.bin"}, Chunks: []testfs.Chunk{{Pattern: 'A', Size: "1MiB"}}},
+				},
+			},
+			{
+				MountPoint: "/data/ext4",
+				FSType:     "ext4",
+				Files: []testfs.File{
+					{Path: []string{"a.bin"}, Chunks: []testfs.Chunk{{Pattern: 'A', Size: "1MiB"}}},
+				},
+			},
+		},
+	}
+
+	h := testfs.New(t, spec)
+	h.RunDupedog("dedupe", "--symlink-fallback", "/data")
+
+	expected := testfs.FileTree{
+		ExitCode: 0,
+		Volumes: []testfs.Volume{
+			{
+				MountPoint: "/data",
+				Files:      []testfs.File{{Path: []string{"a.bin"}}},
+			},
+			{
+				MountPoint: "/data/ext4",
+				Symlinks:   []testfs.Symlink{{Path: "a.bin", Target: "../a.bin"}},
+			},
+		},
+	}
+	h.Assert(expected)
+}
+
+// =============================================================================
+// Section 9.6: Non-Root E2E Tests
+// =============================================================================
+
+// TestE2EUnprivilegedPermissionDenied tests that an unprivileged run links
+// the files it may replace, and skips and reports the rest.
+func TestE2EUnprivilegedPermissionDenied(t *testing.T) {
+	user := testfs.ID(1000) // UID of testfs.UnprivilegedUser
+	spec := testfs.FileTree{
+		Volumes: []testfs.Volume{
+			{
+				MountPoint: "/data",
+				Files: []testfs.File{
+					// Owned by the user in its own directory: replaceable
+					{Path: []string{"own/a.bin"}, Chunks: []testfs.Chunk{{Pattern: 'O', Size: "64KiB"}}, UID: user, GID: user},
+					{Path: []string{"own/b.bin"}, Chunks: []testfs.Chunk{{Pattern: 'O', Size: "64KiB"}}, UID: user, GID: user},
+					// Unreadable by the user: cannot be verified
+					{Path: []string{"own/secret.bin"}, Chunks: []testfs.Chunk{{Pattern: 'O', Size: "64KiB"}}, Mode: 0o600},
+					// Readable, but in a directory the user cannot write: cannot be replaced
+					{Path: []string{"root/c.bin"}, Chunks: []testfs.Chunk{{Pattern: 'R', Size: "64KiB"}}},
+					{Path: []string{"root/d.bin"}, Chunks: []testfs.Chunk{{Pattern: 'R', Size: "64KiB"}}},
+				},
+				Dirs: []testfs.Dir{
+					{Path: "own", UID: user, GID: user},
+					{Path: "root", Mode: 0o755},
+				},
+			},
+		},
+	}
+
+	h := testfs.New(t, spec)
+	h.RunDupedogAs(testfs.UnprivilegedUser, "dedupe", "--no-cache", "--errors-file", "/tmp/errors.tsv", "/data")
+
+	expected := testfs.FileTree{
+		ExitCode: 0,
+		Volumes: []testfs.Volume{
+			{
+				MountPoint: "/data",
+				Files: []testfs.File{
+					{Path: []string{"own/a.bin", "own/b.bin"}},
+					{Path: []string{"own/secret.bin"}},
+					{Path: []string{"root/c.bin"}},
+					{Path: []string{"root/d.bin"}},
+				},
+			},
+		},
+	}
+	h.Assert(expected)
+
+	errors := h.Exec("cat", "/tmp/errors.tsv").Stdout
+	for _, want := range []string{"verify\tperm\t", "dedupe\tperm\t"} {
+		if !strings.Contains(errors, want) {
+			t.Errorf("errors file should report %q, got:\n%s", want, errors)
+		}
+	}
+}
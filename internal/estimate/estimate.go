@@ -0,0 +1,146 @@
+// Package estimate extrapolates deduplication savings from screening results
+// and an optional random sample of verified candidate groups.
+//
+// # Method
+//
+// Screening alone yields an upper bound: the savings if every candidate turned
+// out to be a duplicate. Verifying a uniform random sample of candidate groups
+// gives the fraction of potential savings that is real. The total is estimated
+// with a ratio estimator:
+//
+//	R = Σ confirmed / Σ potential        (over sampled groups)
+//	estimate = R × total potential
+//
+// The confidence interval uses the ratio estimator's standard error with a
+// finite population correction, and is clamped to [confirmed, potential]:
+// savings cannot be below what the sample confirmed or above the upper bound.
+package estimate
+
+import (
+	"math"
+	"math/rand/v2"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Estimate holds the extrapolated savings for a set of candidate groups.
+// All byte counts are allocated sizes (see types.FileInfo.DiskUsage).
+type Estimate struct {
+	Groups    int   // Candidate groups
+	Potential int64 // Upper bound: savings if every candidate is a duplicate
+
+	Sampled          int   // Candidate groups verified
+	SampledPotential int64 // Potential savings of the sampled groups
+	SampledSavings   int64 // Savings confirmed in the sampled groups
+
+	Expected   int64   // Point estimate
+	Low, High  int64   // Confidence interval bounds
+	Confidence float64 // Confidence level of [Low, High], 0 if not sampled
+}
+
+// Sample picks up to n candidate groups uniformly at random.
+func Sample(candidates types.CandidateGroups, n int, rng *rand.Rand) types.CandidateGroups {
+	items := candidates.Items()
+	if n >= len(items) {
+		return candidates
+	}
+	picked := make([]types.CandidateGroup, n)
+	for i, j := range rng.Perm(len(items))[:n] {
+		picked[i] = items[j]
+	}
+	return types.NewCandidateGroups(picked)
+}
+
+// New computes the estimate for candidates, given the duplicate groups found
+// by verifying sample (a subset of candidates). With an empty sample only the
+// upper bound is known, and the range spans [0, Potential].
+func New(candidates, sample types.CandidateGroups, duplicates types.DuplicateGroups, confidence float64) Estimate {
+	e := Estimate{Groups: candidates.Len(), Sampled: sample.Len()}
+	for _, g := range candidates.Items() {
+		e.Potential += savings(g.Items())
+	}
+	if e.Sampled == 0 {
+		e.High = e.Potential
+		return e
+	}
+
+	// Confirmed savings per sampled group: verification may split a candidate
+	// group into several duplicate groups, matched back via their files' paths.
+	index := make(map[string]int)
+	for i, g := range sample.Items() {
+		for _, sg := range g.Items() {
+			index[sg.First().Path] = i
+		}
+	}
+	confirmed := make([]int64, e.Sampled)
+	for _, d := range duplicates.Items() {
+		if i, ok := index[d.First().First().Path]; ok {
+			confirmed[i] += savings(d.Items())
+		}
+	}
+
+	potential := make([]int64, e.Sampled)
+	for i, g := range sample.Items() {
+		potential[i] = savings(g.Items())
+		e.SampledPotential += potential[i]
+		e.SampledSavings += confirmed[i]
+	}
+	if e.SampledPotential == 0 {
+		e.Expected, e.Low, e.High, e.Confidence = 0, 0, e.Potential, confidence
+		return e
+	}
+
+	ratio := float64(e.SampledSavings) / float64(e.SampledPotential)
+	total := float64(e.Potential)
+	e.Expected = int64(ratio * total)
+	e.Low, e.High, e.Confidence = e.SampledSavings, e.Potential, confidence
+
+	if stdErr, ok := ratioStdErr(potential, confirmed, ratio, e.Groups); ok {
+		margin := z(confidence) * total * stdErr
+		e.Low = clamp(int64(ratio*total-margin), e.SampledSavings, e.Potential)
+		e.High = clamp(int64(ratio*total+margin), e.SampledSavings, e.Potential)
+	}
+	return e
+}
+
+// ratioStdErr returns the standard error of the ratio estimator for a sample
+// of n groups out of population, with x potential and y confirmed savings.
+// Returns false if a single group out of many gives no variance estimate.
+func ratioStdErr(x, y []int64, ratio float64, population int) (float64, bool) {
+	n := len(x)
+	if n >= population {
+		return 0, true // Full census: exact
+	}
+	if n < 2 {
+		return 0, false
+	}
+	var sumX, sumSq float64
+	for i := range x {
+		sumX += float64(x[i])
+		r := float64(y[i]) - ratio*float64(x[i])
+		sumSq += r * r
+	}
+	meanX := sumX / float64(n)
+	fpc := 1 - float64(n)/float64(population)
+	return math.Sqrt(fpc*sumSq/float64(n-1)/float64(n)) / meanX, true
+}
+
+// z returns the two-sided standard normal quantile for a confidence level.
+func z(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+// savings returns the bytes reclaimed by linking every sibling group to the
+// first: the allocated size of all but one inode.
+func savings(siblings []types.SiblingGroup) int64 {
+	var n int64
+	for _, sg := range siblings[1:] {
+		n += sg.First().DiskUsage()
+	}
+	return n
+}
+
+// clamp limits v to [lo, hi].
+func clamp(v, lo, hi int64) int64 {
+	return max(lo, min(v, hi))
+}
@@ -0,0 +1,91 @@
+package estimate
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// group builds a candidate group of n inodes with the given allocated size,
+// named by id so paths are unique across groups.
+func group(id string, n int, blocks int64) types.CandidateGroup {
+	siblings := make([]types.SiblingGroup, n)
+	for i := range siblings {
+		f := &types.FileInfo{Path: fmt.Sprintf("/%s/%d", id, i), Size: blocks * 512, Blocks: blocks, Ino: uint64(i)}
+		siblings[i] = types.NewSiblingGroup([]*types.FileInfo{f})
+	}
+	return types.NewCandidateGroup(siblings)
+}
+
+// TestEstimateScreeningOnly tests that without a sample the range is [0, upper bound].
+func TestEstimateScreeningOnly(t *testing.T) {
+	candidates := types.NewCandidateGroups([]types.CandidateGroup{group("a", 3, 2), group("b", 2, 4)})
+
+	e := New(candidates, types.NewCandidateGroups(nil), types.NewDuplicateGroups(nil), 0.95)
+
+	// a: 2 extra inodes × 1024 bytes, b: 1 extra inode × 2048 bytes
+	if e.Groups != 2 || e.Potential != 4096 {
+		t.Errorf("Groups, Potential = %d, %d, want 2, 4096", e.Groups, e.Potential)
+	}
+	if e.Low != 0 || e.High != 4096 || e.Confidence != 0 {
+		t.Errorf("range = [%d, %d] @ %g, want [0, 4096] @ 0", e.Low, e.High, e.Confidence)
+	}
+}
+
+// TestEstimateFullCensus tests that verifying every group yields an exact result.
+func TestEstimateFullCensus(t *testing.T) {
+	a, b := group("a", 3, 2), group("b", 2, 4)
+	candidates := types.NewCandidateGroups([]types.CandidateGroup{a, b})
+
+	// Only two of a's three inodes are real duplicates; b is not a duplicate
+	duplicates := types.NewDuplicateGroups([]types.DuplicateGroup{types.NewDuplicateGroup(a.Items()[:2])})
+
+	e := New(candidates, candidates, duplicates, 0.95)
+	if e.SampledSavings != 1024 || e.SampledPotential != 4096 {
+		t.Errorf("sampled = %d of %d, want 1024 of 4096", e.SampledSavings, e.SampledPotential)
+	}
+	if e.Expected != 1024 || e.Low != 1024 || e.High != 1024 {
+		t.Errorf("estimate = %d [%d, %d], want 1024 [1024, 1024]", e.Expected, e.Low, e.High)
+	}
+}
+
+// TestEstimateSampleExtrapolates tests that the estimate scales the sample's
+// ratio to the population and the range stays within [confirmed, potential].
+func TestEstimateSampleExtrapolates(t *testing.T) {
+	var groups []types.CandidateGroup
+	for i := range 100 {
+		groups = append(groups, group(fmt.Sprintf("g%d", i), 2, 2))
+	}
+	candidates := types.NewCandidateGroups(groups)
+
+	sample := Sample(candidates, 20, rand.New(rand.NewPCG(1, 2)))
+	if sample.Len() != 20 {
+		t.Fatalf("Sample returned %d groups, want 20", sample.Len())
+	}
+
+	// Half of the sampled groups are confirmed duplicates
+	var dups []types.DuplicateGroup
+	for i, g := range sample.Items() {
+		if i%2 == 0 {
+			dups = append(dups, types.NewDuplicateGroup(g.Items()))
+		}
+	}
+
+	e := New(candidates, sample, types.NewDuplicateGroups(dups), 0.95)
+	if e.Potential != 100*1024 || e.Expected != 50*1024 {
+		t.Errorf("Potential, Expected = %d, %d, want %d, %d", e.Potential, e.Expected, 100*1024, 50*1024)
+	}
+	if e.Low < e.SampledSavings || e.Low >= e.Expected || e.High <= e.Expected || e.High > e.Potential {
+		t.Errorf("range [%d, %d] not around %d within [%d, %d]", e.Low, e.High, e.Expected, e.SampledSavings, e.Potential)
+	}
+}
+
+// TestSampleLargerThanPopulation tests that oversized samples return all groups.
+func TestSampleLargerThanPopulation(t *testing.T) {
+	candidates := types.NewCandidateGroups([]types.CandidateGroup{group("a", 2, 1)})
+	if got := Sample(candidates, 5, rand.New(rand.NewPCG(1, 2))).Len(); got != 1 {
+		t.Errorf("Sample returned %d groups, want 1", got)
+	}
+}
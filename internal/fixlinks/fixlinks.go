@@ -0,0 +1,172 @@
+//go:build unix
+
+// Package fixlinks repairs dangling symlinks, such as those made by symlink
+// fallback whose source volume has since moved or been remounted elsewhere.
+//
+// A dangling link is repaired only if a JSON report recorded it as a symlink
+// replacement: the report gives the size and digest of the content the link
+// stood for, and a file with that digest (the recorded source if it has
+// reappeared, else any scanned file of the same size) becomes its new source.
+// Links without a record or a match are reported for manual action.
+package fixlinks
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/report"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Record is what a symlink made by a dedupe run stood for.
+type Record struct {
+	Source string // Path the link pointed to
+	Size   int64
+	Digest string // Composite digest, empty if the group was sampled
+}
+
+// Records collects the symlink replacements performed in reports, by link
+// path. Later reports win.
+func Records(reports []*report.Report) map[string]Record {
+	records := make(map[string]Record)
+	for _, r := range reports {
+		if r.DryRun {
+			continue
+		}
+		for _, a := range r.Actions {
+			if a.Action == deduper.ActionSymlink.String() {
+				records[a.Target] = Record{Source: a.Source, Size: a.Size, Digest: a.Digest}
+			}
+		}
+	}
+	return records
+}
+
+// Dangling returns the symlinks under roots whose target does not exist,
+// sorted. Directories that cannot be read are reported to errCh (if not nil)
+// and skipped.
+func Dangling(roots []string, errCh chan *types.Event) []string {
+	var links []string
+	for _, root := range roots {
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				sendError(errCh, types.NewEvent(types.StageScan, path, err))
+				return nil
+			}
+			if d.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+			if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+				links = append(links, path)
+			}
+			return nil
+		})
+	}
+	slices.Sort(links)
+	return slices.Compact(links)
+}
+
+// Status is the outcome of repairing one link.
+type Status int
+
+const (
+	StatusRepaired Status = iota // Pointed to a file with the recorded content
+	StatusNoRecord               // Not a symlink replacement recorded in the reports
+	StatusNoMatch                // No file with the recorded content found
+	StatusFailed                 // Replacing the link failed, see Err
+)
+
+// Fix is the outcome for one dangling link.
+type Fix struct {
+	Link   string
+	Source string // New source (Repaired), or the recorded one (NoMatch, Failed)
+	Status Status
+	Err    error
+}
+
+// Repair points each dangling link to a file with the content recorded for
+// it: the recorded source if it exists again, else the first of files (by
+// path) with the same size and digest. Records without a digest only accept
+// the recorded source. In a dry run, links are left as they are and the
+// fixes that would be made are returned.
+func Repair(links []string, records map[string]Record, files []*types.FileInfo, digest report.DigestFunc, dryRun bool) []Fix {
+	bySize := make(map[int64][]string)
+	for _, f := range files {
+		bySize[f.Size] = append(bySize[f.Size], f.Path)
+	}
+	for _, paths := range bySize {
+		slices.Sort(paths)
+	}
+	m := &matcher{digest: digest, digests: make(map[string]string)}
+
+	fixes := make([]Fix, 0, len(links))
+	for _, link := range links {
+		rec, ok := records[link]
+		if !ok {
+			fixes = append(fixes, Fix{Link: link, Status: StatusNoRecord})
+			continue
+		}
+		source := m.find(rec, bySize[rec.Size])
+		if source == "" {
+			fixes = append(fixes, Fix{Link: link, Source: rec.Source, Status: StatusNoMatch})
+			continue
+		}
+		fix := Fix{Link: link, Source: source, Status: StatusRepaired}
+		if !dryRun {
+			if err := deduper.CreateSymlink(source, link, deduper.LinkOptions{}); err != nil {
+				fix.Status, fix.Err = StatusFailed, err
+			}
+		}
+		fixes = append(fixes, fix)
+	}
+	return fixes
+}
+
+// matcher finds files with recorded content, hashing each file once.
+type matcher struct {
+	digest  report.DigestFunc
+	digests map[string]string // Path → digest ("" if unreadable)
+}
+
+// find returns the recorded source if it exists with the recorded size and
+// digest, else the first of candidates with that digest, or "".
+func (m *matcher) find(rec Record, candidates []string) string {
+	if info, err := os.Stat(rec.Source); err == nil && info.Mode().IsRegular() && info.Size() == rec.Size {
+		if rec.Digest == "" || m.sum(rec.Source) == rec.Digest {
+			return rec.Source
+		}
+	}
+	if rec.Digest == "" {
+		return ""
+	}
+	for _, path := range candidates {
+		if m.sum(path) == rec.Digest {
+			return path
+		}
+	}
+	return ""
+}
+
+// sum returns the memoized digest of path.
+func (m *matcher) sum(path string) string {
+	if d, ok := m.digests[path]; ok {
+		return d
+	}
+	d, err := m.digest(path)
+	if err != nil {
+		d = ""
+	}
+	m.digests[path] = d
+	return d
+}
+
+// sendError sends an event to errCh if it's not nil.
+func sendError(errCh chan *types.Event, e *types.Event) {
+	if errCh != nil {
+		errCh <- e
+	}
+}
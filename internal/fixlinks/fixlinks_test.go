@@ -0,0 +1,139 @@
+//go:build unix
+
+package fixlinks
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/report"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// fakeDigest returns a digest derived from file content for testing.
+func fakeDigest(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return "d-" + string(data), nil
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	reports := []*report.Report{
+		{Actions: []report.Action{
+			{Source: "/a/old", Target: "/b/x", Action: "symlink", Size: 1, Digest: "d1"},
+			{Source: "/a/y", Target: "/b/y", Action: "hardlink"},
+		}},
+		{DryRun: true, Actions: []report.Action{{Source: "/a/z", Target: "/b/z", Action: "symlink"}}},
+		{Actions: []report.Action{{Source: "/a/new", Target: "/b/x", Action: "symlink", Size: 1, Digest: "d1"}}},
+	}
+	records := Records(reports)
+	want := map[string]Record{"/b/x": {Source: "/a/new", Size: 1, Digest: "d1"}}
+	if len(records) != len(want) || records["/b/x"] != want["/b/x"] {
+		t.Errorf("Records() = %v, want %v", records, want)
+	}
+}
+
+func TestDangling(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "file"), "x")
+	symlink(t, "file", filepath.Join(dir, "ok"))
+	symlink(t, "missing", filepath.Join(dir, "sub", "broken"))
+	symlink(t, "/nonexistent/vol1/file", filepath.Join(dir, "abs"))
+
+	got := Dangling([]string{dir, filepath.Join(dir, "sub")}, nil)
+	want := []string{filepath.Join(dir, "abs"), filepath.Join(dir, "sub", "broken")}
+	if !slices.Equal(got, want) {
+		t.Errorf("Dangling() = %v, want %v", got, want)
+	}
+}
+
+// TestRepair tests that links are pointed to the recorded source when it
+// reappears, else to a scanned file with the recorded content, and reported
+// otherwise.
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	restored := filepath.Join(dir, "vol1", "restored")
+	moved := filepath.Join(dir, "new", "moved")
+	sameSize := filepath.Join(dir, "new", "a-other")
+	writeFile(t, restored, "restored")
+	writeFile(t, moved, "moved")
+	writeFile(t, sameSize, "MOVED") // Same size, different content
+
+	links := []string{
+		filepath.Join(dir, "vol2", "l1"),
+		filepath.Join(dir, "vol2", "l2"),
+		filepath.Join(dir, "vol2", "l3"),
+		filepath.Join(dir, "vol2", "l4"),
+	}
+	for _, l := range links {
+		symlink(t, "/nonexistent", l)
+	}
+	records := map[string]Record{
+		links[0]: {Source: restored, Size: 8, Digest: "d-restored"},
+		links[1]: {Source: filepath.Join(dir, "vol1", "gone"), Size: 5, Digest: "d-moved"},
+		links[2]: {Source: filepath.Join(dir, "vol1", "lost"), Size: 4, Digest: "d-lost"},
+	}
+	files := []*types.FileInfo{{Path: moved, Size: 5}, {Path: sameSize, Size: 5}, {Path: restored, Size: 8}}
+
+	fixes := Repair(links, records, files, fakeDigest, false)
+	want := []Fix{
+		{Link: links[0], Source: restored, Status: StatusRepaired},
+		{Link: links[1], Source: moved, Status: StatusRepaired},
+		{Link: links[2], Source: filepath.Join(dir, "vol1", "lost"), Status: StatusNoMatch},
+		{Link: links[3], Status: StatusNoRecord},
+	}
+	if len(fixes) != len(want) {
+		t.Fatalf("Repair() = %+v, want %+v", fixes, want)
+	}
+	for i := range want {
+		if fixes[i] != want[i] {
+			t.Errorf("fixes[%d] = %+v, want %+v", i, fixes[i], want[i])
+		}
+	}
+	for i, content := range []string{"restored", "moved"} {
+		if data, err := os.ReadFile(links[i]); err != nil || string(data) != content {
+			t.Errorf("ReadFile(%s) = %q, %v, want %q", links[i], data, err, content)
+		}
+	}
+}
+
+func TestRepairDryRun(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	link := filepath.Join(dir, "link")
+	writeFile(t, source, "x")
+	symlink(t, "/nonexistent", link)
+
+	records := map[string]Record{link: {Source: source, Size: 1, Digest: "d-x"}}
+	fixes := Repair([]string{link}, records, nil, fakeDigest, true)
+	if len(fixes) != 1 || fixes[0].Status != StatusRepaired {
+		t.Errorf("Repair() = %+v, want one repair", fixes)
+	}
+	if target, _ := os.Readlink(link); target != "/nonexistent" {
+		t.Errorf("dry run changed link to %s", target)
+	}
+}
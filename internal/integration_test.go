@@ -9,7 +9,6 @@ import (
 	"syscall"
 	"testing"
 
-	"github.com/ivoronin/dupedog/internal/cache"
 	"github.com/ivoronin/dupedog/internal/deduper"
 	"github.com/ivoronin/dupedog/internal/scanner"
 	"github.com/ivoronin/dupedog/internal/screener"
@@ -17,9 +16,6 @@ import (
 	"github.com/ivoronin/dupedog/internal/verifier"
 )
 
-// noCache is a disabled cache for tests (cache.Open("") returns no-op cache).
-var noCache, _ = cache.Open("")
-
 // =============================================================================
 // Section 8.1: Full Pipeline Integration Tests
 // =============================================================================
@@ -189,7 +185,7 @@ func TestFullPipelineExcludePatterns(t *testing.T) {
 	h := testfs.New(t, spec)
 
 	// Run pipeline excluding *.bak
-	s := scanner.New([]string{filepath.Join(h.Root(), "data")}, 0, []string{"*.bak"}, 2, false, nil)
+	s := scanner.New([]string{filepath.Join(h.Root(), "data")}, scanner.Options{Excludes: []string{"*.bak"}, Workers: 2}, nil)
 	files := s.Run()
 
 	// Should only find .txt files
@@ -264,13 +260,13 @@ func TestFullPipelineEmptyScenarios(t *testing.T) {
 			h := testfs.New(t, tt.spec)
 
 			// Run pipeline - should complete without errors
-			s := scanner.New([]string{filepath.Join(h.Root(), "data")}, 0, nil, 2, false, nil)
+			s := scanner.New([]string{filepath.Join(h.Root(), "data")}, scanner.Options{Workers: 2}, nil)
 			files := s.Run()
 
-			sc := screener.New(files, false, false)
+			sc := screener.New(files, screener.Options{})
 			candidates := sc.Run()
 
-			v := verifier.New(candidates, 2, false, nil, noCache)
+			v := verifier.New(candidates, verifier.Options{Workers: 2}, nil)
 			duplicates := v.Run()
 
 			// No duplicates expected in these scenarios
@@ -368,6 +364,53 @@ func TestDataIntegrityOriginalDataPreserved(t *testing.T) {
 	}
 }
 
+// TestDataIntegritySparseDuplicates tests that a sparse file and a fully
+// allocated file with the same content (holes read as zeros) are linked, and
+// that the content survives.
+func TestDataIntegritySparseDuplicates(t *testing.T) {
+	sparse := []testfs.Chunk{{Pattern: 'S', Size: "64KiB"}, {Hole: true, Size: "2MiB"}, {Pattern: 'T', Size: "64KiB"}}
+	dense := []testfs.Chunk{{Pattern: 'S', Size: "64KiB"}, {Pattern: 0, Size: "2MiB"}, {Pattern: 'T', Size: "64KiB"}}
+	given := testfs.FileTree{
+		Volumes: []testfs.Volume{
+			{
+				MountPoint: "/data",
+				Files: []testfs.File{
+					{Path: []string{"sparse1.bin"}, Chunks: sparse},
+					{Path: []string{"sparse2.bin"}, Chunks: sparse},
+					{Path: []string{"dense.bin"}, Chunks: dense},
+				},
+			},
+		},
+	}
+	then := testfs.FileTree{
+		Volumes: []testfs.Volume{
+			{
+				MountPoint: "/data",
+				Files: []testfs.File{
+					{Path: []string{"sparse1.bin", "sparse2.bin", "dense.bin"}},
+				},
+			},
+		},
+	}
+
+	h := testfs.New(t, given)
+	before, err := os.ReadFile(filepath.Join(h.Root(), "data", "dense.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runPipeline(t, h.Root(), nil, 0, false)
+	h.Assert(then)
+
+	after, err := os.ReadFile(filepath.Join(h.Root(), "data", "sparse1.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("content should be preserved after deduplicating sparse files")
+	}
+}
+
 // =============================================================================
 // Section 8.5: Progressive Checksum Tests
 // =============================================================================
@@ -520,6 +563,28 @@ func TestProgressiveChecksumLargeChunks(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// Section 8.6: Property-Based Pipeline Fuzzing
+// =============================================================================
+
+// FuzzPipelineInvariants runs the full pipeline over random FileTrees and
+// checks the safety invariants: no content changed, hardlinks kept, only
+// identical files linked, and no space lost. The seed corpus runs with
+// `go test`; explore further with `make fuzz`.
+func FuzzPipelineInvariants(f *testing.F) {
+	for seed := range uint64(16) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed uint64) {
+		given := testfs.Generate(seed, "/data")
+		h := testfs.New(t, given)
+		oracle := testfs.NewOracle(t, h.Root(), given)
+
+		runPipeline(t, h.Root(), nil, 0, false)
+		oracle.Check()
+	})
+}
+
 // =============================================================================
 // Helper Functions
 // =============================================================================
@@ -530,19 +595,19 @@ func runPipeline(t *testing.T, root string, exclude []string, minSize int64, dry
 	dataDir := filepath.Join(root, "data")
 
 	// Scanner
-	s := scanner.New([]string{dataDir}, minSize, exclude, 2, false, nil)
+	s := scanner.New([]string{dataDir}, scanner.Options{MinSize: minSize, Excludes: exclude, Workers: 2}, nil)
 	files := s.Run()
 
 	// Screener
-	sc := screener.New(files, false, false)
+	sc := screener.New(files, screener.Options{})
 	candidates := sc.Run()
 
 	// Verifier
-	v := verifier.New(candidates, 2, false, nil, noCache)
+	v := verifier.New(candidates, verifier.Options{Workers: 2}, nil)
 	duplicates := v.Run()
 
 	// Deduper
-	d := deduper.New(duplicates, nil, dryRun, false, false, false, nil)
+	d := deduper.New(duplicates, deduper.Options{DryRun: dryRun}, nil)
 	d.Run()
 }
 
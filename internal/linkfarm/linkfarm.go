@@ -0,0 +1,227 @@
+// Package linkfarm builds a deduplicated snapshot of a tree, sharing
+// unchanged files with earlier snapshots through hardlinks.
+//
+// # Overview
+//
+// Like rsync --link-dest, every regular file under the source root appears in
+// the destination at the same relative path. If a reference tree holds a file
+// with identical content, it is hardlinked to the reference file; otherwise it
+// is copied from the source (cloned where the filesystem supports reflinks),
+// so the snapshot never shares an inode with live data. The source and
+// reference trees are never modified.
+//
+//	source/a.txt ─┐                       dest/a.txt ──► ref/a.txt (same content, hardlink)
+//	source/b.txt ─┼─► scan → screen → ──► dest/b.txt     copy of source/b.txt (new content)
+//	ref/a.txt ────┘   verify
+//
+// The destination must be on the same filesystem as the reference trees.
+// Source files linked to each other are copied once and linked in the
+// destination alike. Empty directories and non-regular files are not
+// reproduced.
+package linkfarm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/pause"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Builder links or copies source files into the destination tree.
+//
+// The builder is designed for single-use: create with New(), call Run() once.
+type Builder struct {
+	// Config (immutable, set by New)
+	source     string                // Absolute source root
+	dest       string                // Absolute destination root
+	files      []*types.FileInfo     // Scanned files under the source root
+	duplicates types.DuplicateGroups // Confirmed groups across source and reference files
+	references []string              // Absolute reference roots, in priority order
+	reporter   progress.Reporter     // Receives progress (nil = none)
+	errCh      chan *types.Event     // Non-fatal errors (link failures, etc.)
+}
+
+// New creates a Builder. files must come from scanning source; duplicates from
+// verifying source and reference files together.
+func New(source, dest string, files []*types.FileInfo, duplicates types.DuplicateGroups, references []string,
+	reporter progress.Reporter, errCh chan *types.Event,
+) *Builder {
+	return &Builder{
+		source:     source,
+		dest:       dest,
+		files:      files,
+		duplicates: duplicates,
+		references: references,
+		reporter:   reporter,
+		errCh:      errCh,
+	}
+}
+
+// Stats summarizes a completed build.
+type Stats struct {
+	Linked      int   // Files hardlinked to a reference tree
+	Copied      int   // Files copied from the source
+	SharedBytes int64 // Allocated bytes shared with reference trees
+	startTime   time.Time
+}
+
+// Counts implements progress.Counter: files created and bytes shared.
+func (s *Stats) Counts() (items, bytes int64) {
+	return int64(s.Linked + s.Copied), s.SharedBytes
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("Linked %d files to reference (%s shared), copied %d in %.1fs",
+		s.Linked, humanize.IBytes(uint64(s.SharedBytes)), s.Copied, time.Since(s.startTime).Seconds())
+}
+
+// Run creates one file in the destination per source file.
+// Failures are sent to the error channel and do not stop the build.
+func (b *Builder) Run() Stats {
+	return b.RunContext(context.Background())
+}
+
+// RunContext is Run that stops early when ctx is canceled.
+func (b *Builder) RunContext(ctx context.Context) Stats {
+	bar := progress.New(b.reporter, "link-farm")
+	st := &Stats{startTime: time.Now()}
+	bar.Describe(st)
+
+	refOf := b.referenceMap()
+	copies := make(map[[2]uint64]string) // Source inode → its first copy in the destination
+	for _, f := range b.files {
+		if pause.Wait(ctx) != nil || ctx.Err() != nil {
+			break
+		}
+		out, err := b.destPath(f.Path)
+		if err != nil {
+			b.sendError(types.NewEvent(types.StageLinkFarm, f.Path, err))
+			continue
+		}
+		inode := [2]uint64{f.Dev, f.Ino}
+		ref, shared := refOf[f.Path]
+		switch {
+		case shared:
+			err = os.Link(ref, out)
+		case copies[inode] != "":
+			err = os.Link(copies[inode], out)
+		default:
+			err = copyFile(f.Path, out)
+		}
+		if err != nil {
+			b.sendError(types.NewEvent(types.StageLinkFarm, f.Path, err))
+			continue
+		}
+		if shared {
+			st.Linked++
+			st.SharedBytes += f.DiskUsage()
+		} else {
+			st.Copied++
+			copies[inode] = cmp.Or(copies[inode], out)
+		}
+		bar.Describe(st)
+	}
+
+	bar.Finish(st)
+	return *st
+}
+
+// referenceMap maps each source path to the reference file it should link to.
+// Within a group, the first file under the highest-priority reference root wins.
+func (b *Builder) referenceMap() map[string]string {
+	refOf := make(map[string]string)
+	for _, group := range b.duplicates.Items() {
+		ref := b.selectReference(group)
+		if ref == "" {
+			continue
+		}
+		for _, siblings := range group.Items() {
+			for _, f := range siblings.Items() {
+				if isUnder(f.Path, b.source) {
+					refOf[f.Path] = ref
+				}
+			}
+		}
+	}
+	return refOf
+}
+
+// selectReference returns the preferred reference path in a group, or "" if none.
+func (b *Builder) selectReference(group types.DuplicateGroup) string {
+	for _, root := range b.references {
+		for _, siblings := range group.Items() {
+			for _, f := range siblings.Items() {
+				if isUnder(f.Path, root) {
+					return f.Path
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// destPath returns dest/<path relative to source>, creating its directory.
+func (b *Builder) destPath(path string) (string, error) {
+	rel, err := filepath.Rel(b.source, path)
+	if err != nil {
+		return "", err
+	}
+	out := filepath.Join(b.dest, rel)
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// copyFile copies src to the new file dst, cloning its extents where the
+// filesystem supports it, and keeps its permissions and modification time.
+// A partial copy is removed.
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+	if reflink(out, in) != nil {
+		_, err = io.Copy(out, in)
+	}
+	if err = errors.Join(err, out.Close()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// sendError sends an event to the errors channel if it's not nil.
+func (b *Builder) sendError(e *types.Event) {
+	if b.errCh != nil {
+		b.errCh <- e
+	}
+}
+
+// isUnder reports whether path is root or inside it.
+func isUnder(path, root string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/")
+}
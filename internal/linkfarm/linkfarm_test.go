@@ -0,0 +1,143 @@
+package linkfarm
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+func TestRun(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	ref := filepath.Join(root, "ref")
+	dest := filepath.Join(root, "dest")
+
+	srcA := writeFile(t, filepath.Join(source, "a.txt"), "shared")
+	srcB := writeFile(t, filepath.Join(source, "sub", "b.txt"), "new")
+	refA := writeFile(t, filepath.Join(ref, "old", "a.txt"), "shared")
+
+	duplicates := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{srcA}),
+			types.NewSiblingGroup([]*types.FileInfo{refA}),
+		}),
+	})
+
+	stats := New(source, dest, []*types.FileInfo{srcA, srcB}, duplicates, []string{ref}, nil, nil).Run()
+
+	if stats.Linked != 1 || stats.Copied != 1 || stats.SharedBytes != srcA.DiskUsage() {
+		t.Errorf("stats = %+v, want 1 linked (%d bytes shared), 1 copied", stats, srcA.DiskUsage())
+	}
+	if !sameInode(t, filepath.Join(dest, "a.txt"), refA.Path) {
+		t.Error("dest/a.txt should link to the reference copy")
+	}
+	destB := filepath.Join(dest, "sub", "b.txt")
+	if sameInode(t, destB, srcB.Path) {
+		t.Error("dest/sub/b.txt must be a copy, not a link to the live source file")
+	}
+	if data, err := os.ReadFile(destB); err != nil || string(data) != "new" {
+		t.Errorf("dest/sub/b.txt = %q, %v; want the source content", data, err)
+	}
+	if info, err := os.Stat(destB); err != nil || !info.ModTime().Equal(srcB.ModTime) {
+		t.Errorf("dest/sub/b.txt mtime = %v, want the source mtime %v", info.ModTime(), srcB.ModTime)
+	}
+	if sameInode(t, srcA.Path, refA.Path) {
+		t.Error("source tree must not be modified")
+	}
+}
+
+// TestRunSourceHardlinks tests that source files linked to each other are
+// copied once and linked alike in the destination.
+func TestRunSourceHardlinks(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+
+	srcA := writeFile(t, filepath.Join(source, "a.txt"), "content")
+	if err := os.Link(srcA.Path, filepath.Join(source, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	srcB := *srcA
+	srcB.Path = filepath.Join(source, "b.txt")
+
+	stats := New(source, dest, []*types.FileInfo{srcA, &srcB}, types.DuplicateGroups{}, nil, nil, nil).Run()
+
+	if stats.Copied != 2 {
+		t.Errorf("Copied = %d, want 2", stats.Copied)
+	}
+	if !sameInode(t, filepath.Join(dest, "a.txt"), filepath.Join(dest, "b.txt")) {
+		t.Error("dest/a.txt and dest/b.txt should be one copy")
+	}
+	if sameInode(t, filepath.Join(dest, "a.txt"), srcA.Path) {
+		t.Error("destination must not link to the source")
+	}
+}
+
+func TestRunExistingDestFile(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	dest := filepath.Join(root, "dest")
+
+	srcA := writeFile(t, filepath.Join(source, "a.txt"), "content")
+	writeFile(t, filepath.Join(dest, "a.txt"), "other")
+
+	errCh := make(chan *types.Event, 10)
+	stats := New(source, dest, []*types.FileInfo{srcA}, types.DuplicateGroups{}, nil, nil, errCh).Run()
+	close(errCh)
+
+	if stats.Copied != 0 {
+		t.Errorf("Copied = %d, want 0", stats.Copied)
+	}
+	if len(errCh) != 1 {
+		t.Errorf("expected 1 error for existing destination file, got %d", len(errCh))
+	}
+}
+
+func TestIsUnder(t *testing.T) {
+	tests := []struct {
+		path, root string
+		want       bool
+	}{
+		{"/a/b", "/a", true},
+		{"/a", "/a", true},
+		{"/ab", "/a", false},
+		{"/a/b", "/", true},
+	}
+	for _, tt := range tests {
+		if got := isUnder(tt.path, tt.root); got != tt.want {
+			t.Errorf("isUnder(%q, %q) = %v, want %v", tt.path, tt.root, got, tt.want)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) *types.FileInfo {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	return &types.FileInfo{Path: path, Size: info.Size(), ModTime: info.ModTime(), Dev: uint64(stat.Dev), Ino: stat.Ino, Blocks: stat.Blocks} //nolint:unconvert // platform-dependent type
+}
+
+func sameInode(t *testing.T, path1, path2 string) bool {
+	t.Helper()
+	info1, err := os.Stat(path1)
+	if err != nil {
+		t.Fatalf("failed to stat %s: %v", path1, err)
+	}
+	info2, err := os.Stat(path2)
+	if err != nil {
+		t.Fatalf("failed to stat %s: %v", path2, err)
+	}
+	return os.SameFile(info1, info2)
+}
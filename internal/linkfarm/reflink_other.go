@@ -0,0 +1,13 @@
+//go:build !linux
+
+package linkfarm
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is not supported outside Linux; files are copied instead.
+func reflink(_, _ *os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,237 @@
+// Package manifest lists the content of a tree as (relative path, size,
+// digest) entries, so trees on different hosts can be compared without
+// access to each other's files.
+//
+// Digests are the verifier's composite whole-file digests: two files with
+// the same size and digest are duplicates, as they would be within one run.
+// Manifests can be signed with an HMAC-SHA256 key shared by the hosts, so a
+// manifest copied between them can be checked for tampering.
+package manifest
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/progress"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// formatVersion is bumped when the schema or the digest algorithm changes.
+const formatVersion = 1
+
+var (
+	// ErrUnsigned is returned by Verify for manifests without a signature.
+	ErrUnsigned = errors.New("manifest is not signed")
+	// ErrBadSignature is returned by Verify if the signature does not match.
+	ErrBadSignature = errors.New("manifest signature does not match")
+)
+
+// Manifest is the content list of one tree.
+type Manifest struct {
+	Version   int       `json:"version"`
+	Host      string    `json:"host"`
+	Root      string    `json:"root"`
+	Created   time.Time `json:"created"`
+	Entries   []Entry   `json:"entries"`
+	Signature string    `json:"signature,omitempty"` // Hex HMAC-SHA256 of the manifest without signature
+}
+
+// Entry is one file of the tree.
+type Entry struct {
+	Path   string `json:"path"` // Relative to Root, "/"-separated
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// DigestFunc computes the composite whole-file digest of a file.
+type DigestFunc func(f *types.FileInfo) (string, error)
+
+// Hasher digests files in parallel.
+type Hasher struct {
+	Digest   DigestFunc
+	Workers  int               // Files hashed at a time (0 = 1)
+	Reporter progress.Reporter // Receives progress (nil = none)
+	ErrCh    chan *types.Event // Files that cannot be hashed (nil = dropped silently)
+}
+
+// Build returns the manifest of the files found under root on host, sorted
+// by path. Files that cannot be hashed are reported and left out.
+func (h *Hasher) Build(host, root string, files []*types.FileInfo) *Manifest {
+	digests := h.digestAll(files)
+	m := &Manifest{Version: formatVersion, Host: host, Root: root, Created: time.Now().UTC(), Entries: []Entry{}}
+	for i, f := range files {
+		if digests[i] == "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, f.Path)
+		if err != nil {
+			continue
+		}
+		m.Entries = append(m.Entries, Entry{Path: filepath.ToSlash(rel), Size: f.Size, Digest: digests[i]})
+	}
+	slices.SortFunc(m.Entries, func(a, b Entry) int { return cmp.Compare(a.Path, b.Path) })
+	return m
+}
+
+// Match is a local file with the content of remote entries.
+type Match struct {
+	Local  string
+	Size   int64
+	Digest string
+	Remote []string // Paths relative to the remote root
+}
+
+// Compare returns the local files whose content appears in m, by local path.
+// Only files whose size appears in m are hashed.
+func (h *Hasher) Compare(m *Manifest, files []*types.FileInfo) []Match {
+	bySize := make(map[int64]bool)
+	byDigest := make(map[string][]string)
+	for _, e := range m.Entries {
+		bySize[e.Size] = true
+		key := contentKey(e.Size, e.Digest)
+		byDigest[key] = append(byDigest[key], e.Path)
+	}
+
+	var candidates []*types.FileInfo
+	for _, f := range files {
+		if bySize[f.Size] {
+			candidates = append(candidates, f)
+		}
+	}
+	digests := h.digestAll(candidates)
+
+	var matches []Match
+	for i, f := range candidates {
+		if remote := byDigest[contentKey(f.Size, digests[i])]; digests[i] != "" && len(remote) > 0 {
+			matches = append(matches, Match{Local: f.Path, Size: f.Size, Digest: digests[i], Remote: remote})
+		}
+	}
+	slices.SortFunc(matches, func(a, b Match) int { return cmp.Compare(a.Local, b.Local) })
+	return matches
+}
+
+// contentKey identifies content by size and digest.
+func contentKey(size int64, digest string) string {
+	return fmt.Sprintf("%d:%s", size, digest)
+}
+
+// hashStats tracks hashing progress.
+type hashStats struct {
+	files     atomic.Int64
+	bytes     atomic.Int64
+	startTime time.Time
+}
+
+// Counts implements progress.Counter: files and bytes hashed.
+func (s *hashStats) Counts() (items, bytes int64) {
+	return s.files.Load(), s.bytes.Load()
+}
+
+func (s *hashStats) String() string {
+	return fmt.Sprintf("Hashed %d files (%s) in %.1fs",
+		s.files.Load(), humanize.IBytes(uint64(s.bytes.Load())), time.Since(s.startTime).Seconds())
+}
+
+// digestAll returns the digest of each file, "" for files that failed.
+func (h *Hasher) digestAll(files []*types.FileInfo) []string {
+	digests := make([]string, len(files))
+	stats := &hashStats{startTime: time.Now()}
+	bar := progress.NewCounter(h.Reporter, "hash", int64(len(files)), "files")
+	sem := types.NewSemaphore(max(h.Workers, 1))
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+			digest, err := h.Digest(f)
+			if err != nil {
+				if h.ErrCh != nil {
+					h.ErrCh <- types.NewEvent(types.StageVerify, f.Path, err)
+				}
+				return
+			}
+			digests[i] = digest
+			stats.files.Add(1)
+			stats.bytes.Add(f.Size)
+			bar.Describe(stats)
+		}()
+	}
+	wg.Wait()
+	bar.Finish(stats)
+	return digests
+}
+
+// Sign sets the signature of m, keyed with key.
+func (m *Manifest) Sign(key []byte) error {
+	mac, err := m.mac(key)
+	if err != nil {
+		return err
+	}
+	m.Signature = hex.EncodeToString(mac)
+	return nil
+}
+
+// Verify checks the signature of m against key.
+func (m *Manifest) Verify(key []byte) error {
+	if m.Signature == "" {
+		return ErrUnsigned
+	}
+	got, err := hex.DecodeString(m.Signature)
+	if err != nil {
+		return ErrBadSignature
+	}
+	want, err := m.mac(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(got, want) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// mac returns the HMAC-SHA256 of the JSON encoding of m without signature.
+func (m *Manifest) mac(key []byte) ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// Write writes m as JSON to w.
+func (m *Manifest) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// Read parses a manifest written by Write.
+func Read(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if m.Version != formatVersion {
+		return nil, fmt.Errorf("manifest version %d is not supported (want %d)", m.Version, formatVersion)
+	}
+	return &m, nil
+}
@@ -0,0 +1,97 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// fakeDigest derives a digest from the last character of the path, so files
+// ending in the same character have the same content ("!" is unreadable).
+func fakeDigest(f *types.FileInfo) (string, error) {
+	last := f.Path[len(f.Path)-1:]
+	if last == "!" {
+		return "", errors.New("unreadable")
+	}
+	return "d-" + last, nil
+}
+
+func TestBuildAndCompare(t *testing.T) {
+	remote := []*types.FileInfo{
+		{Path: "/vol1/b/a", Size: 10},
+		{Path: "/vol1/a/a", Size: 10},
+		{Path: "/vol1/c", Size: 20},
+		{Path: "/vol1/!", Size: 30},
+	}
+	errCh := make(chan *types.Event, 10)
+	m := (&Hasher{Digest: fakeDigest, Workers: 2, ErrCh: errCh}).Build("nas1", "/vol1", remote)
+	want := []Entry{{"a/a", 10, "d-a"}, {"b/a", 10, "d-a"}, {"c", 20, "d-c"}}
+	if len(m.Entries) != len(want) {
+		t.Fatalf("Entries = %v, want %v", m.Entries, want)
+	}
+	for i := range want {
+		if m.Entries[i] != want[i] {
+			t.Errorf("Entries[%d] = %v, want %v", i, m.Entries[i], want[i])
+		}
+	}
+	if len(errCh) != 1 {
+		t.Errorf("%d errors reported, want 1 (unreadable file)", len(errCh))
+	}
+
+	local := []*types.FileInfo{
+		{Path: "/vol2/a", Size: 10}, // Same content as two remote files
+		{Path: "/vol2/c", Size: 10}, // Same size, other content
+		{Path: "/vol2/d", Size: 20}, // Same size, other content
+		{Path: "/vol2/e", Size: 99}, // Size not in the manifest: not hashed
+	}
+	hashed := 0
+	h := &Hasher{Digest: func(f *types.FileInfo) (string, error) {
+		hashed++
+		return fakeDigest(f)
+	}}
+	matches := h.Compare(m, local)
+	if len(matches) != 1 || matches[0].Local != "/vol2/a" || len(matches[0].Remote) != 2 {
+		t.Errorf("Compare() = %+v, want /vol2/a matching a/a and b/a", matches)
+	}
+	if hashed != 3 {
+		t.Errorf("hashed %d files, want 3", hashed)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	m := (&Hasher{Digest: fakeDigest}).Build("nas1", "/vol1", []*types.FileInfo{{Path: "/vol1/a", Size: 1}})
+	if err := m.Verify([]byte("key")); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("Verify(unsigned) = %v, want ErrUnsigned", err)
+	}
+	if err := m.Sign([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature survives a round trip through Write and Read
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if err := got.Verify([]byte("key")); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+	if err := got.Verify([]byte("other")); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify(other key) = %v, want ErrBadSignature", err)
+	}
+	got.Entries[0].Digest = "tampered"
+	if err := got.Verify([]byte("key")); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify(tampered) = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestReadVersion(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte(`{"version": 99}`))); err == nil {
+		t.Error("Read() of an unknown version should return error")
+	}
+}
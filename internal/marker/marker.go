@@ -0,0 +1,180 @@
+// Package marker records verified content digests on the files themselves, in
+// a user.dupedog extended attribute, so later runs can skip hashing files that
+// have not changed since. Unlike the hash cache, markers travel with the file
+// (cp -a, rsync -X, tar --xattrs) and need no central database.
+//
+// A marker is "1 <mtime ns> <size> <digest>" and is only trusted while the
+// file's size and mtime still match.
+package marker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Name is the extended attribute holding the marker.
+const Name = "user.dupedog"
+
+// version is the first field of the marker. Increment when the format changes.
+const version = "1"
+
+// encode formats the marker for f's current size, mtime and digest.
+func encode(f *types.FileInfo) string {
+	return fmt.Sprintf("%s %d %d %s", version, f.ModTime.UnixNano(), f.Size, f.Digest)
+}
+
+// decode returns the digest in value if it is a current marker for f.
+func decode(value string, f *types.FileInfo) (digest string, ok bool) {
+	fields := strings.Fields(value)
+	if len(fields) != 4 || fields[0] != version {
+		return "", false
+	}
+	mtime, err1 := strconv.ParseInt(fields[1], 10, 64)
+	size, err2 := strconv.ParseInt(fields[2], 10, 64)
+	if err1 != nil || err2 != nil || mtime != f.ModTime.UnixNano() || size != f.Size {
+		return "", false
+	}
+	return fields[3], true
+}
+
+// Read returns the digest recorded on f, if its marker is still current.
+func Read(f *types.FileInfo) (digest string, ok bool) {
+	value, err := getxattr(f.Path, Name)
+	if err != nil {
+		return "", false
+	}
+	return decode(value, f)
+}
+
+// Write records f.Digest on f's inode, unless a current marker with the same
+// digest is already present.
+func Write(f *types.FileInfo) error {
+	if digest, ok := Read(f); ok && digest == f.Digest {
+		return nil
+	}
+	return setxattr(f.Path, Name, encode(f))
+}
+
+// Resolution splits candidate groups into what markers already confirm and
+// what still needs verification.
+type Resolution struct {
+	// Verify holds, per candidate group with unmarked files, the unmarked
+	// sibling groups plus one representative per marker digest.
+	Verify types.CandidateGroups
+
+	buckets []*bucket // Marked sibling groups sharing a digest
+	byRep   map[*types.FileInfo]*bucket
+}
+
+// bucket is a set of marked sibling groups with the same digest.
+type bucket struct {
+	digest   string
+	siblings []types.SiblingGroup // siblings[0] represents the bucket in Verify
+	merged   bool                 // Joined a verified group
+}
+
+// Resolve reads the markers of every inode in groups. Marked inodes with the
+// same digest are duplicates without hashing; each digest is represented by
+// one of them when unmarked files of the same size still need verifying.
+func Resolve(groups types.CandidateGroups) *Resolution {
+	r := &Resolution{byRep: make(map[*types.FileInfo]*bucket)}
+	var verify []types.CandidateGroup
+	for _, group := range groups.Items() {
+		byDigest := make(map[string]*bucket)
+		var pending []types.SiblingGroup
+		for _, siblings := range group.Items() {
+			digest, ok := Read(siblings.First())
+			if !ok {
+				pending = append(pending, siblings)
+				continue
+			}
+			b := byDigest[digest]
+			if b == nil {
+				b = &bucket{digest: digest}
+				byDigest[digest] = b
+				r.buckets = append(r.buckets, b)
+				r.byRep[siblings.First()] = b
+			}
+			b.siblings = append(b.siblings, siblings)
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		for _, b := range byDigest {
+			pending = append(pending, b.siblings[0])
+		}
+		if len(pending) >= 2 {
+			verify = append(verify, types.NewCandidateGroup(pending))
+		}
+	}
+	r.Verify = types.NewCandidateGroups(verify)
+	return r
+}
+
+// Complete returns the verified groups, each extended by the marked peers of
+// its representatives, plus the groups confirmed by markers alone.
+func (r *Resolution) Complete(verified types.DuplicateGroups) types.DuplicateGroups {
+	var groups []types.DuplicateGroup
+	for _, group := range verified.Items() {
+		siblings := group.Items()
+		for _, sibs := range group.Items() {
+			b := r.byRep[sibs.First()]
+			if b == nil {
+				continue
+			}
+			b.merged = true
+			for _, peer := range b.siblings[1:] {
+				recordDigest(peer, sibs.First().Digest)
+				siblings = append(siblings, peer)
+			}
+		}
+		groups = append(groups, types.NewDuplicateGroup(siblings))
+	}
+	for _, b := range r.buckets {
+		if b.merged || len(b.siblings) < 2 {
+			continue
+		}
+		for _, sibs := range b.siblings {
+			recordDigest(sibs, b.digest)
+		}
+		groups = append(groups, types.NewDuplicateGroup(b.siblings))
+	}
+	return types.NewDuplicateGroups(groups)
+}
+
+// recordDigest stores digest on every file of a sibling group.
+func recordDigest(siblings types.SiblingGroup, digest string) {
+	for _, f := range siblings.Items() {
+		f.Digest = digest
+	}
+}
+
+// WriteGroups marks one file per inode of confirmed groups. Files confirmed by
+// sampling only, and paths for which skip returns true, are left unmarked.
+// Markers are best-effort: filesystems without user xattrs and files the user
+// may not modify are skipped silently; other failures are sent to errCh.
+func WriteGroups(groups types.DuplicateGroups, skip func(path string) bool, errCh chan *types.Event) {
+	for _, group := range groups.Items() {
+		for _, siblings := range group.Items() {
+			f := siblings.First()
+			if f.Sampled || f.Digest == "" || skip(f.Path) {
+				continue
+			}
+			if err := Write(f); err != nil && !ignorable(err) && errCh != nil {
+				errCh <- types.NewEvent(types.StageVerify, f.Path, fmt.Errorf("write xattr marker: %w", err))
+			}
+		}
+	}
+}
+
+// ignorable reports whether a marker write failure is expected: no xattr
+// support, or no permission to modify the file.
+func ignorable(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.ENOTSUP) ||
+		errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EROFS)
+}
@@ -0,0 +1,96 @@
+package marker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+func TestDecode(t *testing.T) {
+	f := &types.FileInfo{Size: 100, ModTime: time.Unix(1609459200, 5)}
+	f.Digest = "abc"
+	value := encode(f)
+
+	if digest, ok := decode(value, f); !ok || digest != "abc" {
+		t.Errorf("decode(%q) = %q, %v; want abc, true", value, digest, ok)
+	}
+
+	stale := []*types.FileInfo{
+		{Size: 101, ModTime: f.ModTime},
+		{Size: 100, ModTime: f.ModTime.Add(time.Nanosecond)},
+	}
+	for _, g := range stale {
+		if _, ok := decode(value, g); ok {
+			t.Errorf("decode() accepted marker for size %d, mtime %v", g.Size, g.ModTime)
+		}
+	}
+	for _, bad := range []string{"", "2 1 100 abc", "1 x 100 abc", "1 1 100"} {
+		if _, ok := decode(bad, f); ok {
+			t.Errorf("decode(%q) = ok, want rejected", bad)
+		}
+	}
+}
+
+// TestResolveComplete tests that marked inodes are confirmed without hashing,
+// that unmarked files are verified against one representative per digest, and
+// that Complete merges the representative's peers into verified groups.
+func TestResolveComplete(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]*types.FileInfo{}
+	for i, name := range []string{"a", "b", "c", "d"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("same"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = &types.FileInfo{Path: path, Size: info.Size(), ModTime: info.ModTime(), Ino: uint64(i + 1)}
+	}
+
+	// a and b are marked, c and d are not
+	for _, name := range []string{"a", "b"} {
+		files[name].Digest = "digest"
+		if err := Write(files[name]); err != nil {
+			if errors.Is(err, syscall.ENOTSUP) {
+				t.Skip("user xattrs not supported on this filesystem")
+			}
+			t.Fatal(err)
+		}
+		files[name].Digest = ""
+	}
+
+	siblings := func(names ...string) []types.SiblingGroup {
+		var groups []types.SiblingGroup
+		for _, n := range names {
+			groups = append(groups, types.NewSiblingGroup([]*types.FileInfo{files[n]}))
+		}
+		return groups
+	}
+
+	// Fully marked group: confirmed without verification
+	r := Resolve(types.NewCandidateGroups([]types.CandidateGroup{types.NewCandidateGroup(siblings("a", "b"))}))
+	if r.Verify.Len() != 0 {
+		t.Errorf("Verify has %d groups, want 0", r.Verify.Len())
+	}
+	if got := r.Complete(types.NewDuplicateGroups(nil)); got.Len() != 1 || got.First().Len() != 2 || files["a"].Digest != "digest" {
+		t.Errorf("Complete() = %d groups, want one group of a, b with the marker digest", got.Len())
+	}
+
+	// Mixed group: c and d are verified against a, which stands for b
+	r = Resolve(types.NewCandidateGroups([]types.CandidateGroup{types.NewCandidateGroup(siblings("a", "b", "c", "d"))}))
+	if r.Verify.Len() != 1 || r.Verify.First().Len() != 3 {
+		t.Fatalf("Verify = %d groups, want one group of c, d and a representative", r.Verify.Len())
+	}
+	verified := types.NewDuplicateGroups([]types.DuplicateGroup{types.NewDuplicateGroup(r.Verify.First().Items())})
+	got := r.Complete(verified)
+	if got.Len() != 1 || got.First().Len() != 4 {
+		t.Errorf("Complete() = %d groups of %d, want one group of 4", got.Len(), got.First().Len())
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package marker
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxValueSize bounds marker values: "1 <mtime> <size> <64 hex digits>".
+const maxValueSize = 256
+
+func getxattr(path, name string) (string, error) {
+	buf := make([]byte, maxValueSize)
+	n, err := syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return "", &os.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+	return string(buf[:n]), nil
+}
+
+func setxattr(path, name, value string) error {
+	if err := syscall.Setxattr(path, name, []byte(value), 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
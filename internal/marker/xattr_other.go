@@ -0,0 +1,10 @@
+//go:build !linux
+
+package marker
+
+import "errors"
+
+// Extended attributes are only supported on Linux; files are never marked.
+func getxattr(string, string) (string, error) { return "", errors.ErrUnsupported }
+
+func setxattr(string, string, string) error { return errors.ErrUnsupported }
@@ -0,0 +1,281 @@
+// Package mounts maps device IDs to the filesystems mounted on them, so
+// reports and error messages can name a mount point instead of a bare st_dev.
+//
+// The table is read from /proc/self/mountinfo on Linux; on other platforms it
+// is empty and devices are described by number only.
+package mounts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Mount describes the filesystem behind a device ID.
+type Mount struct {
+	Point    string // Mount point (shortest one if mounted several times)
+	FSType   string // Filesystem type (ext4, xfs, nfs4, ...)
+	ReadOnly bool   // Mounted read-only at every mount point
+}
+
+// Table maps device IDs (st_dev) to their mounts.
+type Table map[uint64]Mount
+
+// Entry is one mount: directory Root of the filesystem on device Dev, mounted
+// at Point. A bind mount shows a directory of a filesystem that is mounted
+// elsewhere too, so one directory can be reached under several paths.
+type Entry struct {
+	Dev   uint64
+	Root  string // Directory of the filesystem shown at Point ("/" for a whole filesystem)
+	Point string
+}
+
+// View is a directory as the filesystem sees it: Path within the filesystem
+// on device Dev, whatever path it is reached under.
+type View struct {
+	Dev  uint64
+	Path string
+}
+
+// Contains reports whether v is o or a directory above it.
+func (v View) Contains(o View) bool {
+	return v.Dev == o.Dev && (v.Path == o.Path || v.Path == "/" || strings.HasPrefix(o.Path, v.Path+"/"))
+}
+
+// Origin returns the view of path (absolute and clean) through the mount it
+// is on: the mount with the longest point above it, the last one of equal
+// points (mounted over the others). ok is false if no entry covers path.
+func Origin(entries []Entry, path string) (v View, ok bool) {
+	var best *Entry
+	for i := range entries {
+		e := &entries[i]
+		if path != e.Point && e.Point != "/" && !strings.HasPrefix(path, e.Point+"/") {
+			continue
+		}
+		if best == nil || len(e.Point) >= len(best.Point) {
+			best = e
+		}
+	}
+	if best == nil {
+		return View{}, false
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(path, best.Point), "/")
+	return View{Dev: best.Dev, Path: filepath.Join(best.Root, rel)}, true
+}
+
+// Overlay describes a mounted overlayfs and the directories it is layered from.
+type Overlay struct {
+	Point string   // Mount point of the merged view
+	Lower []string // Lower (read-only) layer directories, topmost first
+	Upper string   // Upper (writable) layer directory ("" if read-only overlay)
+	Work  string   // Work directory ("" if read-only overlay)
+}
+
+// Layers returns every directory the overlay is built from.
+func (o Overlay) Layers() []string {
+	layers := append([]string(nil), o.Lower...)
+	for _, dir := range []string{o.Upper, o.Work} {
+		if dir != "" {
+			layers = append(layers, dir)
+		}
+	}
+	return layers
+}
+
+// ParseOverlays reads the overlayfs mounts from a mountinfo file (see proc(5))
+// and their lowerdir, upperdir and workdir options. Malformed lines are skipped.
+func ParseOverlays(r io.Reader) ([]Overlay, error) {
+	var overlays []Overlay
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		sep := slices.Index(fields, "-")
+		if len(fields) < 5 || sep < 0 || sep+3 >= len(fields) || fields[sep+1] != "overlay" {
+			continue
+		}
+		o := Overlay{Point: unescape(fields[4])}
+		for opt := range strings.SplitSeq(fields[sep+3], ",") {
+			key, value, _ := strings.Cut(opt, "=")
+			switch key {
+			case "lowerdir":
+				for dir := range strings.SplitSeq(value, ":") {
+					o.Lower = append(o.Lower, unescape(dir))
+				}
+			case "upperdir":
+				o.Upper = unescape(value)
+			case "workdir":
+				o.Work = unescape(value)
+			}
+		}
+		overlays = append(overlays, o)
+	}
+	return overlays, scanner.Err()
+}
+
+// ParseEntries reads every mount from a mountinfo file (see proc(5)), in
+// mount order. Malformed lines are skipped.
+func ParseEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if e, _, ok := parseLine(scanner.Text()); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Parse reads a mountinfo file (see proc(5)). Bind mounts of one device keep
+// the shortest mount point, and the device is read-only only if every mount
+// of it is. Malformed lines are skipped.
+func Parse(r io.Reader) (Table, error) {
+	table := make(Table)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		e, m, ok := parseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		dev := e.Dev
+		prev, seen := table[dev]
+		if !seen {
+			table[dev] = m
+			continue
+		}
+		readOnly := prev.ReadOnly && m.ReadOnly
+		if len(m.Point) < len(prev.Point) {
+			prev = m
+		}
+		prev.ReadOnly = readOnly
+		table[dev] = prev
+	}
+	return table, scanner.Err()
+}
+
+// parseLine parses one mountinfo line:
+//
+//	36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw
+//	id pa maj:min root point   options  [optional...] - fstype source superopts
+func parseLine(line string) (e Entry, m Mount, ok bool) {
+	fields := strings.Fields(line)
+	sep := -1
+	for i, f := range fields {
+		if f == "-" {
+			sep = i
+			break
+		}
+	}
+	if len(fields) < 5 || sep < 0 || sep+1 >= len(fields) {
+		return Entry{}, Mount{}, false
+	}
+
+	majStr, minStr, found := strings.Cut(fields[2], ":")
+	major, errMaj := strconv.ParseUint(majStr, 10, 32)
+	minor, errMin := strconv.ParseUint(minStr, 10, 32)
+	if !found || errMaj != nil || errMin != nil {
+		return Entry{}, Mount{}, false
+	}
+	readOnly := hasOption(fields[5], "ro") || (sep+3 < len(fields) && hasOption(fields[sep+3], "ro"))
+	e = Entry{Dev: mkdev(major, minor), Root: unescape(fields[3]), Point: unescape(fields[4])}
+	return e, Mount{Point: e.Point, FSType: fields[sep+1], ReadOnly: readOnly}, true
+}
+
+// hasOption reports whether a comma-separated mount option list contains opt.
+func hasOption(options, opt string) bool {
+	for o := range strings.SplitSeq(options, ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// mkdev encodes major:minor as Linux's st_dev (glibc gnu_dev_makedev).
+func mkdev(major, minor uint64) uint64 {
+	return (minor & 0xff) | (major&0xfff)<<8 | (minor&^0xff)<<12 | (major&^0xfff)<<32
+}
+
+// unescape decodes the octal escapes (\040 for space, etc.) used in mountinfo paths.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// system is the mount table of the running system, loaded on first use.
+var system = sync.OnceValue(func() Table {
+	f, err := mountinfo()
+	if err != nil {
+		return Table{}
+	}
+	defer func() { _ = f.Close() }()
+	table, err := Parse(f)
+	if err != nil {
+		return Table{}
+	}
+	return table
+})
+
+// systemOverlays are the overlayfs mounts of the running system, loaded on first use.
+var systemOverlays = sync.OnceValue(func() []Overlay {
+	f, err := mountinfo()
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+	overlays, _ := ParseOverlays(f)
+	return overlays
+})
+
+// systemEntries are the mounts of the running system, loaded on first use.
+var systemEntries = sync.OnceValue(func() []Entry {
+	f, err := mountinfo()
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+	entries, _ := ParseEntries(f)
+	return entries
+})
+
+// Entries returns the mounts of the running system, in mount order.
+func Entries() []Entry {
+	return systemEntries()
+}
+
+// Overlays returns the overlayfs mounts on the running system.
+func Overlays() []Overlay {
+	return systemOverlays()
+}
+
+// Lookup returns the mount of a device ID on the running system.
+func Lookup(dev uint64) (Mount, bool) {
+	m, ok := system()[dev]
+	return m, ok
+}
+
+// Describe names a device for messages: "/mnt/data (xfs)", or its number if
+// the device is not in the mount table.
+func Describe(dev uint64) string {
+	if m, ok := Lookup(dev); ok {
+		return fmt.Sprintf("%s (%s)", m.Point, m.FSType)
+	}
+	return fmt.Sprintf("device %d", dev)
+}
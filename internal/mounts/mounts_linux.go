@@ -0,0 +1,11 @@
+package mounts
+
+import (
+	"io"
+	"os"
+)
+
+// mountinfo opens the mount table of the current process's mount namespace.
+func mountinfo() (io.ReadCloser, error) {
+	return os.Open("/proc/self/mountinfo")
+}
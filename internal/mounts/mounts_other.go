@@ -0,0 +1,13 @@
+//go:build !linux
+
+package mounts
+
+import (
+	"errors"
+	"io"
+)
+
+// mountinfo is unsupported on this platform; devices are described by number.
+func mountinfo() (io.ReadCloser, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,115 @@
+package mounts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 8:1 /srv /mnt/bind rw,relatime shared:1 - ext4 /dev/sda1 rw
+24 22 259:65536 / /mnt/my\040disk rw - xfs /dev/nvme0n1p1 rw
+25 22 0:45 / /mnt/nfs rw master:3 - nfs4 server:/export rw
+26 22 8:17 / /mnt/ro ro,relatime - ext4 /dev/sdb1 rw
+27 22 8:33 / /mnt/rosb rw,relatime - ext4 /dev/sdc1 ro,errors=remount-ro
+28 22 8:49 / /mnt/rw rw - ext4 /dev/sdd1 rw
+29 22 8:49 / /mnt/rw/bind ro - ext4 /dev/sdd1 rw
+garbage line
+`
+	table, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	tests := []struct {
+		dev  uint64
+		want Mount
+	}{
+		{mkdev(8, 1), Mount{Point: "/", FSType: "ext4"}}, // Bind mount keeps shortest point
+		{mkdev(259, 65536), Mount{Point: "/mnt/my disk", FSType: "xfs"}},
+		{mkdev(0, 45), Mount{Point: "/mnt/nfs", FSType: "nfs4"}},
+		{mkdev(8, 17), Mount{Point: "/mnt/ro", FSType: "ext4", ReadOnly: true}},
+		{mkdev(8, 33), Mount{Point: "/mnt/rosb", FSType: "ext4", ReadOnly: true}}, // Superblock read-only
+		{mkdev(8, 49), Mount{Point: "/mnt/rw", FSType: "ext4"}},                   // Writable at one mount point
+	}
+	if len(table) != len(tests) {
+		t.Errorf("len(table) = %d, want %d", len(table), len(tests))
+	}
+	for _, tt := range tests {
+		if got := table[tt.dev]; got != tt.want {
+			t.Errorf("table[%#x] = %+v, want %+v", tt.dev, got, tt.want)
+		}
+	}
+}
+
+func TestMkdev(t *testing.T) {
+	// Values from glibc makedev()
+	if got := mkdev(8, 1); got != 0x801 {
+		t.Errorf("mkdev(8, 1) = %#x, want 0x801", got)
+	}
+	if got := mkdev(259, 65536); got != 0x10010300 {
+		t.Errorf("mkdev(259, 65536) = %#x, want 0x10010300", got)
+	}
+}
+
+func TestParseOverlays(t *testing.T) {
+	input := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+30 22 0:50 / /var/lib/docker/overlay2/abc/merged rw,relatime - overlay overlay rw,lowerdir=/l/X:/l/Y,upperdir=/u/diff,workdir=/u/work
+31 22 0:51 / /mnt/ro\040view ro - overlay overlay ro,lowerdir=/l/Z
+`
+	overlays, err := ParseOverlays(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseOverlays() failed: %v", err)
+	}
+	if len(overlays) != 2 {
+		t.Fatalf("len(overlays) = %d, want 2", len(overlays))
+	}
+	if got := overlays[0].Layers(); strings.Join(got, " ") != "/l/X /l/Y /u/diff /u/work" {
+		t.Errorf("overlays[0].Layers() = %v", got)
+	}
+	if o := overlays[1]; o.Point != "/mnt/ro view" || o.Upper != "" || len(o.Layers()) != 1 {
+		t.Errorf("overlays[1] = %+v, want a read-only overlay with one layer", o)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	input := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 8:1 /srv/data /mnt/bind rw,relatime shared:1 - ext4 /dev/sda1 rw
+24 22 8:17 / /mnt/disk rw - xfs /dev/sdb1 rw
+25 22 8:33 / /mnt/disk rw - xfs /dev/sdc1 rw
+`
+	entries, err := ParseEntries(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseEntries() failed: %v", err)
+	}
+	if len(entries) != 4 || entries[1] != (Entry{Dev: mkdev(8, 1), Root: "/srv/data", Point: "/mnt/bind"}) {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	tests := []struct {
+		path string
+		want View
+	}{
+		{"/srv/data/photos", View{mkdev(8, 1), "/srv/data/photos"}},
+		{"/mnt/bind", View{mkdev(8, 1), "/srv/data"}},
+		{"/mnt/bind/photos", View{mkdev(8, 1), "/srv/data/photos"}},
+		{"/mnt/bindings", View{mkdev(8, 1), "/mnt/bindings"}}, // Not below /mnt/bind
+		{"/mnt/disk/a", View{mkdev(8, 33), "/a"}},             // Last mount over the point wins
+	}
+	for _, tt := range tests {
+		if got, ok := Origin(entries, tt.path); !ok || got != tt.want {
+			t.Errorf("Origin(%q) = %+v, %v, want %+v", tt.path, got, ok, tt.want)
+		}
+	}
+	if _, ok := Origin(nil, "/a"); ok {
+		t.Error("Origin() without entries reported ok")
+	}
+
+	data := View{mkdev(8, 1), "/srv/data"}
+	if !data.Contains(View{mkdev(8, 1), "/srv/data/photos"}) || !data.Contains(data) {
+		t.Error("view does not contain itself and its subdirectories")
+	}
+	if data.Contains(View{mkdev(8, 1), "/srv/database"}) || data.Contains(View{mkdev(8, 17), "/srv/data"}) {
+		t.Error("view contains a sibling or another device")
+	}
+}
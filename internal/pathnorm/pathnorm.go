@@ -0,0 +1,63 @@
+// Package pathnorm normalizes the Unicode form of paths before name-based
+// rules compare them.
+//
+// macOS writes names decomposed (NFD: "e" + U+0301) while Linux tools mostly
+// write them composed (NFC: U+00E9), so a tree mirrored between them holds
+// names that look the same but differ byte for byte. Normalizing both the
+// names and the patterns matched against them to one form makes exclude,
+// priority and same-name rules treat such names alike. Paths used to open
+// files are never changed.
+package pathnorm
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Form is a Unicode normalization form applied to paths.
+type Form int
+
+const (
+	None Form = iota // Compare paths byte for byte
+	NFC              // Canonical composition
+	NFD              // Canonical decomposition
+)
+
+// Parse parses a --normalize-paths value: "" or "none", "nfc", or "nfd".
+func Parse(s string) (Form, error) {
+	switch s {
+	case "", "none":
+		return None, nil
+	case "nfc":
+		return NFC, nil
+	case "nfd":
+		return NFD, nil
+	default:
+		return None, fmt.Errorf("unknown form %q (want nfc, nfd or none)", s)
+	}
+}
+
+// Apply returns s in form f.
+func (f Form) Apply(s string) string {
+	switch f {
+	case NFC:
+		return norm.NFC.String(s)
+	case NFD:
+		return norm.NFD.String(s)
+	default:
+		return s
+	}
+}
+
+// ApplyAll returns a copy of ss with each string in form f.
+func (f Form) ApplyAll(ss []string) []string {
+	if f == None || ss == nil {
+		return ss
+	}
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = f.Apply(s)
+	}
+	return out
+}
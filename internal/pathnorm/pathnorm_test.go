@@ -0,0 +1,41 @@
+package pathnorm
+
+import "testing"
+
+const (
+	composed   = "/data/caf\u00e9.txt"  // U+00E9
+	decomposed = "/data/cafe\u0301.txt" // e + U+0301
+)
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]Form{"": None, "none": None, "nfc": NFC, "nfd": NFD} {
+		if got, err := Parse(in); err != nil || got != want {
+			t.Errorf("Parse(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	if _, err := Parse("NFKC"); err == nil {
+		t.Error("Parse(NFKC) succeeded, want error")
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		form Form
+		in   string
+		want string
+	}{
+		{None, decomposed, decomposed},
+		{NFC, decomposed, composed},
+		{NFC, composed, composed},
+		{NFD, composed, decomposed},
+		{NFD, "/plain/ascii", "/plain/ascii"},
+	}
+	for _, tt := range tests {
+		if got := tt.form.Apply(tt.in); got != tt.want {
+			t.Errorf("Form(%d).Apply(%q) = %q, want %q", tt.form, tt.in, got, tt.want)
+		}
+	}
+	if got := NFC.ApplyAll([]string{decomposed}); got[0] != composed {
+		t.Errorf("NFC.ApplyAll() = %q, want %q", got, composed)
+	}
+}
@@ -0,0 +1,94 @@
+// Package pause lets an operator suspend the pipeline's disk I/O and resume it
+// later (dupedog maps this to SIGUSR1 and SIGUSR2) without canceling the run.
+//
+// A Gate travels in the context passed to the stages' RunContext. Stages call
+// Wait before each unit of I/O (listing a directory, reading a block,
+// replacing a file), so a pause takes effect within one unit and in-flight
+// work is never abandoned.
+package pause
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Gate blocks Wait callers while paused. The zero value is running.
+type Gate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // Closed on Resume; nil while running
+}
+
+// Pause makes Wait block until Resume. Returns false if already paused.
+func (g *Gate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	return true
+}
+
+// Resume releases all blocked Wait callers. Returns false if not paused.
+func (g *Gate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	return true
+}
+
+// wait blocks while g is paused, or until ctx is canceled.
+func (g *Gate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying g.
+func NewContext(ctx context.Context, g *Gate) context.Context {
+	return context.WithValue(ctx, contextKey{}, g)
+}
+
+// Wait blocks while the Gate in ctx (if any) is paused. Returns ctx.Err() if
+// ctx is canceled while waiting.
+func Wait(ctx context.Context) error {
+	if g, ok := ctx.Value(contextKey{}).(*Gate); ok {
+		return g.wait(ctx)
+	}
+	return nil
+}
+
+// reader waits on its context's Gate before each Read.
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// NewReader returns a reader that pauses with the Gate in ctx before each
+// Read, and fails with ctx.Err() if ctx is canceled while paused.
+func NewReader(ctx context.Context, r io.Reader) io.Reader {
+	return &reader{ctx: ctx, r: r}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if err := Wait(r.ctx); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,56 @@
+package pause
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGatePauseResume(t *testing.T) {
+	g := &Gate{}
+	ctx := NewContext(context.Background(), g)
+
+	if err := Wait(ctx); err != nil {
+		t.Fatalf("Wait() on a running gate = %v", err)
+	}
+	if !g.Pause() || g.Pause() {
+		t.Fatal("Pause() should succeed once")
+	}
+
+	done := make(chan error)
+	go func() { done <- Wait(ctx) }()
+	select {
+	case <-done:
+		t.Fatal("Wait() returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if !g.Resume() || g.Resume() {
+		t.Fatal("Resume() should succeed once")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Wait() after Resume = %v", err)
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	g := &Gate{}
+	g.Pause()
+	ctx, cancel := context.WithCancel(NewContext(context.Background(), g))
+	cancel()
+
+	if err := Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() = %v, want context.Canceled", err)
+	}
+	if _, err := NewReader(ctx, strings.NewReader("x")).Read(make([]byte, 1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read() = %v, want context.Canceled", err)
+	}
+}
+
+func TestWaitWithoutGate(t *testing.T) {
+	if err := Wait(context.Background()); err != nil {
+		t.Errorf("Wait() without a gate = %v", err)
+	}
+}
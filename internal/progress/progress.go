@@ -1,8 +1,12 @@
+// Package progress reports the progress of pipeline stages to a Reporter.
+// The CLI renders it as a progress bar on stderr (Terminal); embedders such as
+// GUIs and daemons implement Reporter to render their own.
 package progress
 
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
@@ -10,58 +14,144 @@ import (
 
 const updateInterval = 50 * time.Millisecond
 
-// Bar wraps progressbar with enabled/disabled handling.
-// All methods are no-ops when disabled.
+// Counts is a snapshot of one stage's progress.
+type Counts struct {
+	Stage       string // scan, screen, verify, dedupe, or link-farm
+	Items       int64  // Items done (files scanned, candidates, duplicates, targets, links)
+	Total       int64  // Items expected, or -1 if unknown
+	Unit        string // What Items counts, e.g. "files" (empty = unspecified)
+	Bytes       int64  // Bytes scanned, selected, read and hashed, saved, or shared
+	Description string // Human-readable status line, as shown by the CLI
+}
+
+// Reporter receives the progress of pipeline stages. Update is called on
+// every change, possibly from several goroutines at once; Finish is called
+// once when a stage ends.
+type Reporter interface {
+	Update(c Counts)
+	Finish(c Counts)
+}
+
+// Counter is implemented by stage statistics passed to Bar.Describe that can
+// report their counts along with the description.
+type Counter interface {
+	Counts() (items, bytes int64)
+}
+
+// Bar reports the progress of one stage to a Reporter.
+// All methods are no-ops without one.
 type Bar struct {
-	bar *progressbar.ProgressBar
+	r     Reporter
+	stage string
+	total int64
+	unit  string
+}
+
+// New creates a Bar for stage with an unknown total.
+// If r is nil, returns a Bar where all methods are no-ops.
+func New(r Reporter, stage string) *Bar {
+	return &Bar{r: r, stage: stage, total: -1}
+}
+
+// NewCounter creates a Bar for stage that counts completed out of total items
+// of the given unit. A total that is not positive is reported as unknown.
+func NewCounter(r Reporter, stage string, total int64, unit string) *Bar {
+	if total <= 0 {
+		total = -1
+	}
+	return &Bar{r: r, stage: stage, total: total, unit: unit}
+}
+
+// Describe reports s as the current state of the stage.
+func (b *Bar) Describe(s fmt.Stringer) {
+	if b.r != nil {
+		b.r.Update(b.counts(s))
+	}
+}
+
+// Finish reports s as the final state of the stage.
+func (b *Bar) Finish(s fmt.Stringer) {
+	if b.r != nil {
+		b.r.Finish(b.counts(s))
+	}
+}
+
+// counts builds the snapshot for s.
+func (b *Bar) counts(s fmt.Stringer) Counts {
+	c := Counts{Stage: b.stage, Total: b.total, Unit: b.unit, Description: s.String()}
+	if counter, ok := s.(Counter); ok {
+		c.Items, c.Bytes = counter.Counts()
+	}
+	return c
 }
 
-// New creates a progress bar.
-// If enabled=false, returns a Bar where all methods are no-ops.
-// Use total=-1 for spinner mode, or total>0 for determinate progress.
-func New(enabled bool, total int64) *Bar {
+// Terminal renders progress as a bar on stderr: a counter with rate for
+// stages with a known total, a spinner otherwise, and a final "✔" line per
+// stage. It returns nil (no progress) if enabled is false.
+func Terminal(enabled bool) Reporter {
 	if !enabled {
-		return &Bar{}
+		return nil
 	}
+	return &terminal{}
+}
+
+// terminal is the Reporter behind Terminal.
+type terminal struct {
+	mu    sync.Mutex
+	stage string // Stage of bar
+	bar   *progressbar.ProgressBar
+}
+
+// Update implements Reporter.
+func (t *terminal) Update(c Counts) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bar := t.barFor(c)
+	if c.Total > 0 {
+		_ = bar.Set64(c.Items)
+	}
+	bar.Describe(c.Description)
+}
 
+// Finish implements Reporter.
+func (t *terminal) Finish(c Counts) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.barFor(c).Finish()
+	t.bar = nil
+	fmt.Fprintln(os.Stderr, "✔ "+c.Description)
+}
+
+// barFor returns the bar of c's stage, creating it on its first update.
+func (t *terminal) barFor(c Counts) *progressbar.ProgressBar {
+	if t.bar != nil && t.stage == c.Stage {
+		return t.bar
+	}
+	t.stage = c.Stage
 	opts := []progressbar.Option{
 		progressbar.OptionSetWriter(os.Stderr),
 		progressbar.OptionThrottle(updateInterval),
 		progressbar.OptionClearOnFinish(),
 	}
-
-	if total < 0 {
+	if c.Total <= 0 {
 		// Spinner mode
 		opts = append(opts,
 			progressbar.OptionSpinnerType(14),
 			progressbar.OptionSetElapsedTime(false),
 		)
-		return &Bar{bar: progressbar.NewOptions(-1, opts...)}
+		t.bar = progressbar.NewOptions(-1, opts...)
+		return t.bar
 	}
 
-	// Progress bar mode
+	// Counter mode
 	opts = append(opts, progressbar.OptionSetWidth(40))
-	return &Bar{bar: progressbar.NewOptions64(total, opts...)}
-}
-
-// Set sets the progress bar to a specific value.
-func (b *Bar) Set(n uint64) {
-	if b.bar != nil {
-		_ = b.bar.Set64(int64(n))
-	}
-}
-
-// Describe updates the progress bar description.
-func (b *Bar) Describe(s fmt.Stringer) {
-	if b.bar != nil {
-		b.bar.Describe(s.String())
-	}
-}
-
-// Finish completes the progress bar and prints a final message.
-func (b *Bar) Finish(s fmt.Stringer) {
-	if b.bar != nil {
-		_ = b.bar.Finish()
-		fmt.Fprintln(os.Stderr, "✔ "+s.String())
+	if c.Unit != "" {
+		opts = append(opts,
+			progressbar.OptionShowCount(),
+			progressbar.OptionShowIts(),
+			progressbar.OptionSetItsString(c.Unit),
+		)
 	}
+	t.bar = progressbar.NewOptions64(c.Total, opts...)
+	return t.bar
 }
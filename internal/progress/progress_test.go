@@ -0,0 +1,69 @@
+package progress
+
+import (
+	"testing"
+)
+
+// recorder is a Reporter that records every call.
+type recorder struct {
+	updates  []Counts
+	finished []Counts
+}
+
+func (r *recorder) Update(c Counts) { r.updates = append(r.updates, c) }
+func (r *recorder) Finish(c Counts) { r.finished = append(r.finished, c) }
+
+// stats is a stage statistic implementing Counter.
+type stats struct{ items, bytes int64 }
+
+func (s stats) String() string               { return "stats" }
+func (s stats) Counts() (items, bytes int64) { return s.items, s.bytes }
+
+// plain is a stage statistic without counts.
+type plain struct{}
+
+func (plain) String() string { return "plain" }
+
+func TestBarReportsCounts(t *testing.T) {
+	r := &recorder{}
+	bar := NewCounter(r, "dedupe", 10, "files")
+	bar.Describe(stats{3, 300})
+	bar.Finish(stats{10, 1000})
+
+	want := Counts{Stage: "dedupe", Items: 3, Total: 10, Unit: "files", Bytes: 300, Description: "stats"}
+	if len(r.updates) != 1 || r.updates[0] != want {
+		t.Errorf("updates = %+v, want [%+v]", r.updates, want)
+	}
+	want = Counts{Stage: "dedupe", Items: 10, Total: 10, Unit: "files", Bytes: 1000, Description: "stats"}
+	if len(r.finished) != 1 || r.finished[0] != want {
+		t.Errorf("finished = %+v, want [%+v]", r.finished, want)
+	}
+}
+
+func TestBarWithoutCounter(t *testing.T) {
+	r := &recorder{}
+	New(r, "scan").Describe(plain{})
+	NewCounter(r, "verify", 0, "files").Describe(plain{})
+
+	want := []Counts{
+		{Stage: "scan", Total: -1, Description: "plain"},
+		{Stage: "verify", Total: -1, Unit: "files", Description: "plain"},
+	}
+	if len(r.updates) != len(want) {
+		t.Fatalf("updates = %+v, want %+v", r.updates, want)
+	}
+	for i := range want {
+		if r.updates[i] != want[i] {
+			t.Errorf("updates[%d] = %+v, want %+v", i, r.updates[i], want[i])
+		}
+	}
+}
+
+func TestNilReporter(t *testing.T) {
+	if Terminal(false) != nil {
+		t.Error("Terminal(false) != nil")
+	}
+	bar := New(nil, "scan") // Must not panic
+	bar.Describe(plain{})
+	bar.Finish(plain{})
+}
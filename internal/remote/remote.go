@@ -0,0 +1,313 @@
+// Package remote scans and hashes trees on other hosts, so their files can be
+// matched against local ones in one run.
+//
+// A remote root has the form [user@]host:/path. The CLI starts a helper on
+// the host over SSH (dupedog itself, copied there or already installed, run
+// as "dupedog remote-helper") and talks to it over stdin/stdout in JSON
+// lines:
+//
+//	helper → client   {"version":1}                           hello
+//	client → helper   {"scan":{"roots":[...],"minSize":1,...}} once
+//	helper → client   {"file":{...}} or {"error":{...}} ...    then {"done":true}
+//	client → helper   {"hash":"/path"} ...                     then EOF
+//	helper → client   {"digest":{...}} or {"error":{...}} ...  then EOF
+//
+// Only remote files whose size matches a local file are hashed, and remote
+// files are only ever reported: files on different hosts cannot be linked.
+package remote
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/ivoronin/dupedog/internal/pathnorm"
+	"github.com/ivoronin/dupedog/internal/scanner"
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+)
+
+// protocolVersion is bumped when messages or the digest algorithm change;
+// the client refuses helpers of other versions.
+const protocolVersion = 1
+
+// Root is a remote scan root.
+type Root struct {
+	Dest string // [user@]host, as passed to ssh
+	Path string // Absolute path on the host
+}
+
+// String returns the root as [user@]host:/path.
+func (r Root) String() string { return r.Dest + ":" + r.Path }
+
+// rootPattern matches [user@]host:/path. Local paths containing ":" before
+// their first "/" can be given as ./path.
+var rootPattern = regexp.MustCompile(`^((?:[^/:@]+@)?[^/:@]+):(/.*)$`)
+
+// ParseRoot parses s as a remote root.
+func ParseRoot(s string) (Root, bool) {
+	m := rootPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Root{}, false
+	}
+	return Root{Dest: m[1], Path: m[2]}, true
+}
+
+// ScanRequest selects the files the helper scans.
+type ScanRequest struct {
+	Roots     []string      `json:"roots"`
+	MinSize   int64         `json:"minSize"`
+	Excludes  []string      `json:"excludes,omitempty"`
+	Normalize pathnorm.Form `json:"normalize,omitempty"` // Unicode form paths and Excludes are compared in (default: as is)
+	Workers   int           `json:"workers,omitempty"`   // 0 = scanner default
+}
+
+// File is a file found by the helper.
+type File struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Dev  uint64 `json:"dev"`
+	Ino  uint64 `json:"ino"`
+}
+
+// failure is an error the helper reports for one path.
+type failure struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// digest is the composite digest of one file.
+type digest struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+}
+
+// message is one line of the protocol; exactly one field is set.
+type message struct {
+	Version int          `json:"version,omitempty"`
+	Scan    *ScanRequest `json:"scan,omitempty"`
+	File    *File        `json:"file,omitempty"`
+	Error   *failure     `json:"error,omitempty"`
+	Done    bool         `json:"done,omitempty"`
+	Hash    string       `json:"hash,omitempty"`
+	Digest  *digest      `json:"digest,omitempty"`
+}
+
+// Serve runs the helper side of the protocol on r and w.
+func Serve(r io.Reader, w io.Writer, workers int) error {
+	out := &lineWriter{enc: json.NewEncoder(w)}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	if err := out.send(message{Version: protocolVersion}); err != nil {
+		return err
+	}
+
+	var req message
+	if err := dec.Decode(&req); err != nil || req.Scan == nil {
+		return fmt.Errorf("read scan request: %w", cmp.Or(err, errors.New("missing scan")))
+	}
+	files := scanFiles(req.Scan, out)
+	if err := out.send(message{Done: true}); err != nil {
+		return err
+	}
+
+	byPath := make(map[string]*types.FileInfo, len(files))
+	for _, f := range files {
+		byPath[f.Path] = f
+	}
+	sem := types.NewSemaphore(max(workers, 1))
+	var wg sync.WaitGroup
+	for {
+		var m message
+		if err := dec.Decode(&m); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			wg.Wait()
+			return fmt.Errorf("read hash request: %w", err)
+		}
+		f, ok := byPath[m.Hash]
+		if !ok {
+			_ = out.send(message{Error: &failure{Path: m.Hash, Message: "not scanned"}})
+			continue
+		}
+		sem.Acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release()
+			_, d, err := verifier.HashFile(f, nil)
+			if err != nil {
+				_ = out.send(message{Error: &failure{Path: f.Path, Message: err.Error()}})
+				return
+			}
+			_ = out.send(message{Digest: &digest{Path: f.Path, Digest: d}})
+		}()
+	}
+	wg.Wait()
+	return out.err
+}
+
+// scanFiles scans the requested roots, sending each file and error to out.
+func scanFiles(req *ScanRequest, out *lineWriter) []*types.FileInfo {
+	errCh := make(chan *types.Event)
+	done := make(chan struct{})
+	go func() {
+		for e := range errCh {
+			_ = out.send(message{Error: &failure{Path: e.Path, Message: e.Err.Error()}})
+		}
+		close(done)
+	}()
+	files := scanner.New(req.Roots, scanner.Options{
+		MinSize:   req.MinSize,
+		Excludes:  req.Excludes,
+		Normalize: req.Normalize,
+		Workers:   req.Workers,
+	}, errCh).Run()
+	close(errCh)
+	<-done
+
+	for _, f := range files {
+		_ = out.send(message{File: &File{Path: f.Path, Size: f.Size, Dev: f.Dev, Ino: f.Ino}})
+	}
+	return files
+}
+
+// lineWriter sends messages from several goroutines, keeping the first error.
+type lineWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func (w *lineWriter) send(m message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = w.enc.Encode(m)
+	}
+	return w.err
+}
+
+// Session is the client side of a connection to a helper.
+type Session struct {
+	host  string // Prefix of reported paths ([user@]host)
+	dec   *json.Decoder
+	w     io.WriteCloser
+	close func() error // Releases the transport (nil = none)
+}
+
+// NewSession starts the protocol with a helper reading w and writing r.
+// Paths in errors are reported as host:path.
+func NewSession(host string, r io.Reader, w io.WriteCloser) (*Session, error) {
+	s := &Session{host: host, dec: json.NewDecoder(bufio.NewReader(r)), w: w}
+	var hello message
+	if err := s.dec.Decode(&hello); err != nil {
+		return nil, fmt.Errorf("%s: read helper hello: %w", host, err)
+	}
+	if hello.Version != protocolVersion {
+		return nil, fmt.Errorf("%s: helper speaks protocol %d, want %d (use the same dupedog version on both hosts)",
+			host, hello.Version, protocolVersion)
+	}
+	return s, nil
+}
+
+// Scan returns the files under the requested roots. Errors the helper
+// reports for single paths are sent to errCh (if not nil).
+func (s *Session) Scan(req ScanRequest, errCh chan *types.Event) ([]File, error) {
+	if err := json.NewEncoder(s.w).Encode(message{Scan: &req}); err != nil {
+		return nil, fmt.Errorf("%s: send scan request: %w", s.host, err)
+	}
+	var files []File
+	for {
+		var m message
+		if err := s.dec.Decode(&m); err != nil {
+			return files, fmt.Errorf("%s: read scan: %w", s.host, err)
+		}
+		switch {
+		case m.Done:
+			return files, nil
+		case m.File != nil:
+			files = append(files, *m.File)
+		case m.Error != nil:
+			s.sendError(errCh, types.StageScan, m.Error)
+		}
+	}
+}
+
+// Hash returns the digests of files by path, and ends the session's
+// requests. Files that cannot be hashed are reported to errCh and left out.
+func (s *Session) Hash(files []File, errCh chan *types.Event) (map[string]string, error) {
+	// Requests are written while digests are read, so neither side blocks
+	// on a full pipe
+	writeErr := make(chan error, 1)
+	go func() {
+		enc := json.NewEncoder(s.w)
+		var err error
+		for _, f := range files {
+			if err = enc.Encode(message{Hash: f.Path}); err != nil {
+				break
+			}
+		}
+		writeErr <- cmp.Or(err, s.w.Close())
+	}()
+
+	digests := make(map[string]string, len(files))
+	for {
+		var m message
+		err := s.dec.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return digests, fmt.Errorf("%s: read digests: %w", s.host, err)
+		}
+		switch {
+		case m.Digest != nil:
+			digests[m.Digest.Path] = m.Digest.Digest
+		case m.Error != nil:
+			s.sendError(errCh, types.StageVerify, m.Error)
+		}
+	}
+	if err := <-writeErr; err != nil {
+		return digests, fmt.Errorf("%s: send hash requests: %w", s.host, err)
+	}
+	return digests, nil
+}
+
+// Close ends the session and releases its transport.
+func (s *Session) Close() error {
+	_ = s.w.Close()
+	if s.close != nil {
+		return s.close()
+	}
+	return nil
+}
+
+// sendError reports a helper failure to errCh as an error on host:path.
+func (s *Session) sendError(errCh chan *types.Event, stage types.Stage, f *failure) {
+	if errCh != nil {
+		errCh <- &types.Event{Stage: stage, Path: s.host + ":" + f.Path, Err: errors.New(f.Message)}
+	}
+}
+
+// Candidates returns the remote files sharing their size with a local file,
+// one per inode.
+func Candidates(local []*types.FileInfo, files []File) []File {
+	sizes := make(map[int64]bool, len(local))
+	for _, f := range local {
+		sizes[f.Size] = true
+	}
+	seen := make(map[[2]uint64]bool)
+	var candidates []File
+	for _, f := range files {
+		if id := [2]uint64{f.Dev, f.Ino}; sizes[f.Size] && !seen[id] {
+			seen[id] = true
+			candidates = append(candidates, f)
+		}
+	}
+	return candidates
+}
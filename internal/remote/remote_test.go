@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/types"
+	"github.com/ivoronin/dupedog/internal/verifier"
+)
+
+func TestParseRoot(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Root
+		ok   bool
+	}{
+		{"backup:/srv/data", Root{"backup", "/srv/data"}, true},
+		{"root@nas1:/", Root{"root@nas1", "/"}, true},
+		{"/srv/data", Root{}, false},
+		{"./host:/path", Root{}, false},
+		{"host:relative", Root{}, false},
+		{"a@b@c:/x", Root{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseRoot(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseRoot(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a": "same", "b": "same", "c": "other", "tiny": "x"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Helper and client talk over two pipes, as over ssh
+	toHelper, fromClient := io.Pipe()
+	fromHelper, toClient := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		err := Serve(toHelper, toClient, 2)
+		_ = toClient.Close()
+		served <- err
+	}()
+
+	s, err := NewSession("nas1", fromHelper, fromClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan *types.Event, 10)
+	files, err := s.Scan(ScanRequest{Roots: []string{dir}, MinSize: 2}, errCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f.Path))
+	}
+	slices.Sort(names)
+	if want := []string{"a", "b", "c"}; !slices.Equal(names, want) {
+		t.Fatalf("Scan() = %v, want %v", names, want)
+	}
+
+	missing := File{Path: filepath.Join(dir, "missing")}
+	digests, err := s.Hash(append(files, missing), errCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		want, err := verifier.Digest(f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digests[f.Path] != want {
+			t.Errorf("digest of %s = %q, want %q", f.Path, digests[f.Path], want)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Serve() = %v", err)
+	}
+	if len(errCh) != 1 {
+		t.Fatalf("got %d errors, want 1 (unscanned path)", len(errCh))
+	}
+	if e := <-errCh; e.Path != "nas1:"+missing.Path {
+		t.Errorf("error path = %q, want %q", e.Path, "nas1:"+missing.Path)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	local := []*types.FileInfo{{Path: "/l/a", Size: 10}, {Path: "/l/b", Size: 30}}
+	files := []File{
+		{Path: "/r/a", Size: 10, Dev: 1, Ino: 1},
+		{Path: "/r/a-link", Size: 10, Dev: 1, Ino: 1},
+		{Path: "/r/other-dev", Size: 10, Dev: 2, Ino: 1},
+		{Path: "/r/c", Size: 20, Dev: 1, Ino: 2},
+	}
+	var got []string
+	for _, f := range Candidates(local, files) {
+		got = append(got, f.Path)
+	}
+	if want := []string{"/r/a", "/r/other-dev"}; !slices.Equal(got, want) {
+		t.Errorf("Candidates() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// unameOS and unameArch map "uname -sm" output to GOOS and GOARCH.
+var (
+	unameOS   = map[string]string{"Linux": "linux", "Darwin": "darwin", "FreeBSD": "freebsd", "OpenBSD": "openbsd", "NetBSD": "netbsd"}
+	unameArch = map[string]string{
+		"x86_64": "amd64", "amd64": "amd64", "aarch64": "arm64", "arm64": "arm64",
+		"i386": "386", "i686": "386", "armv7l": "arm", "armv6l": "arm", "riscv64": "riscv64", "ppc64le": "ppc64le", "s390x": "s390x",
+	}
+)
+
+// Dial starts a helper on dest over ssh (the command and options in sshCmd)
+// and returns its session. With an empty helper, the running executable is
+// copied to a temporary file on the host, which must have the same OS and
+// architecture, and removed when the session is closed. Otherwise helper is
+// the path of dupedog on the host.
+func Dial(ctx context.Context, sshCmd []string, dest, helper string) (*Session, error) {
+	cleanup := func() {}
+	if helper == "" {
+		shipped, err := ship(ctx, sshCmd, dest)
+		if err != nil {
+			return nil, fmt.Errorf("%s: copy helper: %w", dest, err)
+		}
+		helper = shipped
+		cleanup = func() { _ = sshCommand(context.Background(), sshCmd, dest, "rm -f "+shellQuote(helper)).Run() }
+	}
+
+	cmd := sshCommand(ctx, sshCmd, dest, shellQuote(helper)+" remote-helper")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("%s: start helper: %w", dest, err)
+	}
+	s, err := NewSession(dest, stdout, stdin)
+	if err != nil {
+		_ = stdin.Close()
+		_ = cmd.Wait()
+		cleanup()
+		return nil, err
+	}
+	s.close = func() error {
+		defer cleanup()
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("%s: helper: %w", dest, err)
+		}
+		return nil
+	}
+	return s, nil
+}
+
+// ship copies the running executable to a temporary file on dest and returns
+// its path there.
+func ship(ctx context.Context, sshCmd []string, dest string) (string, error) {
+	out, err := sshCommand(ctx, sshCmd, dest, "uname -sm").Output()
+	if err != nil {
+		return "", fmt.Errorf("uname: %w", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 || unameOS[fields[0]] != runtime.GOOS || unameArch[fields[1]] != runtime.GOARCH {
+		return "", fmt.Errorf("host runs %s, not %s/%s; install dupedog there and pass --remote-helper",
+			strings.TrimSpace(string(out)), runtime.GOOS, runtime.GOARCH)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	cmd := sshCommand(ctx, sshCmd, dest,
+		`f=$(mktemp "${TMPDIR:-/tmp}/dupedog-helper.XXXXXX") && cat > "$f" && chmod 700 "$f" && echo "$f"`)
+	cmd.Stdin = f
+	out, err = cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// sshCommand returns the command running script on dest.
+func sshCommand(ctx context.Context, sshCmd []string, dest, script string) *exec.Cmd {
+	args := append(append([]string(nil), sshCmd[1:]...), dest, script)
+	return exec.CommandContext(ctx, sshCmd[0], args...) //nolint:gosec // ssh command given by the user
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,126 @@
+package report
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ChangeKind classifies how a duplicate group differs between two reports.
+type ChangeKind int
+
+const (
+	GroupAppeared    ChangeKind = iota // Only in the new report
+	GroupDisappeared                   // Only in the old report
+	GroupChanged                       // In both, with different paths
+)
+
+// GroupChange describes one group that differs between two reports.
+// Groups are matched by content (size + digest), membership by path. Groups
+// without a digest (--trust-metadata) are matched by their full path set, so
+// they only appear or disappear.
+type GroupChange struct {
+	Kind    ChangeKind
+	Size    int64
+	Digest  string
+	Added   []string // Paths only in the new report (all paths if appeared)
+	Removed []string // Paths only in the old report (all paths if disappeared)
+}
+
+// String formats the change as a header line followed by indented paths.
+func (c GroupChange) String() string {
+	var b strings.Builder
+	marker := map[ChangeKind]string{GroupAppeared: "+", GroupDisappeared: "-", GroupChanged: "~"}[c.Kind]
+	fmt.Fprintf(&b, "%s %s (%d bytes)\n", marker, cmp.Or(c.Digest, "(no digest)"), c.Size)
+	for _, p := range c.Added {
+		fmt.Fprintf(&b, "    + %s\n", p)
+	}
+	for _, p := range c.Removed {
+		fmt.Fprintf(&b, "    - %s\n", p)
+	}
+	return b.String()
+}
+
+// groupKey identifies a group's content across reports.
+type groupKey struct {
+	size   int64
+	digest string
+	paths  string // Sorted paths joined by NUL if there is no digest
+}
+
+// Diff compares two reports and returns changed groups, sorted by digest and
+// then by paths.
+// Groups with the same content are merged (e.g. split by device boundaries).
+func Diff(oldReport, newReport *Report) []GroupChange {
+	oldGroups, newGroups := pathsByGroup(oldReport), pathsByGroup(newReport)
+
+	var changes []GroupChange
+	for key, oldPaths := range oldGroups {
+		newPaths, ok := newGroups[key]
+		if !ok {
+			changes = append(changes, GroupChange{Kind: GroupDisappeared, Size: key.size, Digest: key.digest,
+				Removed: sortedPaths(oldPaths)})
+			continue
+		}
+		added, removed := setDiff(newPaths, oldPaths), setDiff(oldPaths, newPaths)
+		if len(added) > 0 || len(removed) > 0 {
+			changes = append(changes, GroupChange{Kind: GroupChanged, Size: key.size, Digest: key.digest,
+				Added: added, Removed: removed})
+		}
+	}
+	for key, newPaths := range newGroups {
+		if _, ok := oldGroups[key]; !ok {
+			changes = append(changes, GroupChange{Kind: GroupAppeared, Size: key.size, Digest: key.digest,
+				Added: sortedPaths(newPaths)})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b GroupChange) int {
+		return cmp.Or(strings.Compare(a.Digest, b.Digest),
+			slices.Compare(slices.Concat(a.Added, a.Removed), slices.Concat(b.Added, b.Removed)))
+	})
+	return changes
+}
+
+// pathsByGroup collects the set of paths for each group in a report.
+func pathsByGroup(r *Report) map[groupKey]map[string]struct{} {
+	groups := make(map[groupKey]map[string]struct{})
+	for _, g := range r.Groups {
+		paths := make(map[string]struct{})
+		for _, inode := range g.Inodes {
+			for _, p := range inode.Paths {
+				paths[p] = struct{}{}
+			}
+		}
+		key := groupKey{size: g.Size, digest: g.Digest}
+		if g.Digest == "" {
+			// Equal size says nothing about equal content
+			key.paths = strings.Join(sortedPaths(paths), "\x00")
+		}
+		if groups[key] == nil {
+			groups[key] = make(map[string]struct{})
+		}
+		for p := range paths {
+			groups[key][p] = struct{}{}
+		}
+	}
+	return groups
+}
+
+// setDiff returns sorted paths in a but not in b.
+func setDiff(a, b map[string]struct{}) []string {
+	var out []string
+	for p := range a {
+		if _, ok := b[p]; !ok {
+			out = append(out, p)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// sortedPaths returns the set's paths in sorted order.
+func sortedPaths(set map[string]struct{}) []string {
+	return setDiff(set, nil)
+}
@@ -0,0 +1,88 @@
+package report
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	group := func(digest string, paths ...string) Group {
+		inodes := make([]Inode, len(paths))
+		for i, p := range paths {
+			inodes[i] = Inode{Ino: uint64(i + 1), Paths: []string{p}}
+		}
+		return Group{Size: 10, Digest: digest, Inodes: inodes}
+	}
+
+	oldReport := &Report{Groups: []Group{
+		group("aa", "/a1", "/a2"),        // Unchanged
+		group("bb", "/b1", "/b2"),        // Disappears
+		group("cc", "/c1", "/c2", "/c3"), // Loses /c3, gains /c4
+	}}
+	newReport := &Report{Groups: []Group{
+		group("aa", "/a2", "/a1"),
+		group("cc", "/c1", "/c2", "/c4"),
+		group("dd", "/d1", "/d2"), // Appears
+	}}
+
+	changes := Diff(oldReport, newReport)
+	if len(changes) != 3 {
+		t.Fatalf("Diff() = %v, want 3 changes", changes)
+	}
+
+	tests := []struct {
+		kind    ChangeKind
+		digest  string
+		added   []string
+		removed []string
+	}{
+		{GroupDisappeared, "bb", nil, []string{"/b1", "/b2"}},
+		{GroupChanged, "cc", []string{"/c4"}, []string{"/c3"}},
+		{GroupAppeared, "dd", []string{"/d1", "/d2"}, nil},
+	}
+	for i, tt := range tests {
+		c := changes[i]
+		if c.Kind != tt.kind || c.Digest != tt.digest ||
+			!slices.Equal(c.Added, tt.added) || !slices.Equal(c.Removed, tt.removed) {
+			t.Errorf("changes[%d] = %+v, want %+v", i, c, tt)
+		}
+	}
+}
+
+// TestDiffNoDigest tests that groups without a digest (--trust-metadata) of
+// the same size are not merged into one.
+func TestDiffNoDigest(t *testing.T) {
+	group := func(paths ...string) Group {
+		return Group{Size: 10, Inodes: []Inode{{Ino: 1, Paths: paths[:1]}, {Ino: 2, Paths: paths[1:]}}}
+	}
+	oldReport := &Report{Groups: []Group{group("/a1", "/a2"), group("/b1", "/b2")}}
+	newReport := &Report{Groups: []Group{group("/a2", "/a1"), group("/b1", "/b3")}}
+
+	changes := Diff(oldReport, newReport)
+	if len(changes) != 2 {
+		t.Fatalf("Diff() = %v, want 2 changes", changes)
+	}
+	if c := changes[0]; c.Kind != GroupDisappeared || !slices.Equal(c.Removed, []string{"/b1", "/b2"}) {
+		t.Errorf("changes[0] = %+v, want /b1 and /b2 disappeared", c)
+	}
+	if c := changes[1]; c.Kind != GroupAppeared || !slices.Equal(c.Added, []string{"/b1", "/b3"}) {
+		t.Errorf("changes[1] = %+v, want /b1 and /b3 appeared", c)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	r := &Report{Groups: []Group{{Size: 1, Digest: "aa", Inodes: []Inode{{Paths: []string{"/a", "/b"}}}}}}
+
+	if changes := Diff(r, r); len(changes) != 0 {
+		t.Errorf("Diff() = %v, want no changes", changes)
+	}
+}
+
+func TestGroupChangeString(t *testing.T) {
+	c := GroupChange{Kind: GroupChanged, Size: 10, Digest: "cc", Added: []string{"/c4"}, Removed: []string{"/c3"}}
+	want := "~ cc (10 bytes)\n    + /c4\n    - /c3\n"
+
+	if got := c.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
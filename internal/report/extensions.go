@@ -0,0 +1,61 @@
+package report
+
+import (
+	"cmp"
+	"mime"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Extension is the share of duplicate bytes held by files of one extension.
+type Extension struct {
+	Extension string  `json:"extension"`      // Lowercase with the dot, "" for files without one
+	Type      string  `json:"type,omitempty"` // MIME top-level type (video, image, ...), if known
+	Copies    int     `json:"copies"`         // Redundant copies: inodes beyond the first of each group
+	Bytes     int64   `json:"bytes"`          // Size of the redundant copies
+	Share     float64 `json:"share"`          // Fraction of all duplicate bytes
+}
+
+// AddExtensions breaks the report's duplicate bytes down by file extension,
+// largest first. A group counts under the extension of its first path, with
+// every inode but one counted as redundant.
+func (r *Report) AddExtensions() {
+	byExt := make(map[string]*Extension)
+	var total int64
+	for _, g := range r.Groups {
+		if len(g.Inodes) < 2 || len(g.Inodes[0].Paths) == 0 {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(g.Inodes[0].Paths[0]))
+		e := byExt[ext]
+		if e == nil {
+			e = &Extension{Extension: ext, Type: mimeType(ext)}
+			byExt[ext] = e
+		}
+		e.Copies += len(g.Inodes) - 1
+		e.Bytes += g.Size * int64(len(g.Inodes)-1)
+		total += g.Size * int64(len(g.Inodes)-1)
+	}
+
+	r.Extensions = make([]Extension, 0, len(byExt))
+	for _, e := range byExt {
+		if total > 0 {
+			e.Share = float64(e.Bytes) / float64(total)
+		}
+		r.Extensions = append(r.Extensions, *e)
+	}
+	slices.SortFunc(r.Extensions, func(a, b Extension) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(a.Extension, b.Extension))
+	})
+}
+
+// mimeType returns the top-level MIME type of files with extension ext, e.g.
+// "video" for ".mp4", or "" if unknown.
+func mimeType(ext string) string {
+	if ext == "" {
+		return ""
+	}
+	t, _, _ := strings.Cut(mime.TypeByExtension(ext), "/")
+	return t
+}
@@ -0,0 +1,88 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Imported holds duplicate groups listed by an external tool.
+type Imported struct {
+	Groups    [][]string // Paths of each group, in listed order
+	Originals []string   // Paths the tool marked as originals to keep (may be empty)
+}
+
+// ParseFDupes reads fdupes/jdupes default output: one path per line, groups
+// separated by blank lines. Groups with fewer than two paths are dropped.
+func ParseFDupes(r io.Reader) (*Imported, error) {
+	imp := &Imported{}
+	var group []string
+	flush := func() {
+		if len(group) >= 2 {
+			imp.Groups = append(imp.Groups, group)
+		}
+		group = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20) // Paths up to PATH_MAX and beyond
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			group = append(group, line)
+		} else {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return imp, nil
+}
+
+// rmlintEntry is one element of rmlint's JSON output (rmlint -o json).
+// The array also holds a header and a footer object, which have no type.
+type rmlintEntry struct {
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	Checksum   string `json:"checksum"`
+	IsOriginal bool   `json:"is_original"`
+}
+
+// ParseRmlint reads rmlint's JSON output. Entries of type "duplicate_file"
+// are grouped by digest; other lint types are ignored.
+func ParseRmlint(r io.Reader) (*Imported, error) {
+	var entries []rmlintEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decode rmlint json: %w", err)
+	}
+
+	imp := &Imported{}
+	index := make(map[string]int)
+	for _, e := range entries {
+		if e.Type != "duplicate_file" {
+			continue
+		}
+		i, ok := index[e.Checksum]
+		if !ok {
+			i = len(imp.Groups)
+			index[e.Checksum] = i
+			imp.Groups = append(imp.Groups, nil)
+		}
+		imp.Groups[i] = append(imp.Groups[i], e.Path)
+		if e.IsOriginal {
+			imp.Originals = append(imp.Originals, e.Path)
+		}
+	}
+
+	// Drop groups left with a single path (e.g. others filtered by rmlint)
+	groups := imp.Groups[:0]
+	for _, g := range imp.Groups {
+		if len(g) >= 2 {
+			groups = append(groups, g)
+		}
+	}
+	imp.Groups = groups
+	return imp, nil
+}
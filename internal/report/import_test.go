@@ -0,0 +1,50 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFDupes(t *testing.T) {
+	input := "/data/a\n/data/b\n\n/data/single\n\n/data/c\n/data/d\n/data/e\n"
+
+	imp, err := ParseFDupes(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseFDupes() failed: %v", err)
+	}
+	if len(imp.Groups) != 2 {
+		t.Fatalf("len(Groups) = %d, want 2 (single-path group dropped)", len(imp.Groups))
+	}
+	if strings.Join(imp.Groups[1], ",") != "/data/c,/data/d,/data/e" {
+		t.Errorf("Groups[1] = %v, want [/data/c /data/d /data/e]", imp.Groups[1])
+	}
+	if len(imp.Originals) != 0 {
+		t.Errorf("Originals = %v, want none", imp.Originals)
+	}
+}
+
+func TestParseRmlint(t *testing.T) {
+	input := `[
+{"description": "rmlint json-dump of lint files", "cwd": "/data", "args": "rmlint /data -o json"},
+{"id": 1, "type": "duplicate_file", "checksum": "aaaa", "path": "/data/a", "size": 4, "is_original": true},
+{"id": 2, "type": "duplicate_file", "checksum": "aaaa", "path": "/data/b", "size": 4, "is_original": false},
+{"id": 3, "type": "emptyfile", "checksum": "", "path": "/data/empty", "size": 0},
+{"id": 4, "type": "duplicate_file", "checksum": "bbbb", "path": "/data/lonely", "size": 8, "is_original": true},
+{"aborted": false, "progress": 100, "total_files": 5, "duplicates": 1}
+]`
+
+	imp, err := ParseRmlint(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseRmlint() failed: %v", err)
+	}
+	if len(imp.Groups) != 1 || strings.Join(imp.Groups[0], ",") != "/data/a,/data/b" {
+		t.Errorf("Groups = %v, want [[/data/a /data/b]]", imp.Groups)
+	}
+	if len(imp.Originals) != 2 || imp.Originals[0] != "/data/a" {
+		t.Errorf("Originals = %v, want [/data/a /data/lonely]", imp.Originals)
+	}
+
+	if _, err := ParseRmlint(strings.NewReader("not json")); err == nil {
+		t.Error("ParseRmlint() of invalid input should return error")
+	}
+}
@@ -0,0 +1,243 @@
+// Package report produces machine-readable descriptions of a dupedog run.
+//
+// A report lists every confirmed duplicate group with its size, composite
+// content digest, and all inodes (with every path) that belong to it, plus
+// the replacement performed (or planned, in dry-run) for every target.
+//
+// Supported formats:
+//   - json: dupedog's own schema, intended for jq and scripts
+//   - fdupes: fdupes-style path lists, accepted by "duperemove --fdupes"
+//     (duperemove's SQLite hashfile is not supported)
+//   - rmlint-json: rmlint's JSON schema, for rmlint's handlers and scripts
+//   - treemap-json: directory tree of reclaimable bytes, for treemap tools
+//   - dot: the same tree as a Graphviz digraph
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/mounts"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// formatVersion is incremented when the report schema changes incompatibly.
+const formatVersion = 1
+
+// Format selects the report encoding.
+type Format int
+
+const (
+	FormatJSON    Format = iota // dupedog JSON schema
+	FormatFDupes                // fdupes path lists (duperemove --fdupes input)
+	FormatRmlint                // rmlint JSON schema (rmlint -o json)
+	FormatTreemap               // Directory tree of reclaimable bytes (d3 hierarchy JSON)
+	FormatDot                   // Directory tree of reclaimable bytes (Graphviz)
+)
+
+// ParseFormat parses a --report-format value.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "json":
+		return FormatJSON, nil
+	case "fdupes":
+		return FormatFDupes, nil
+	case "rmlint-json":
+		return FormatRmlint, nil
+	case "treemap-json":
+		return FormatTreemap, nil
+	case "dot":
+		return FormatDot, nil
+	default:
+		return FormatJSON, fmt.Errorf("unknown report format %q (want json, fdupes, rmlint-json, treemap-json, or dot)", s)
+	}
+}
+
+// Report is the top-level JSON document.
+type Report struct {
+	Version int      `json:"version"`
+	DryRun  bool     `json:"dryRun,omitempty"` // Actions were planned, not performed
+	Groups  []Group  `json:"groups"`
+	Actions []Action `json:"actions,omitempty"`
+
+	Extensions []Extension   `json:"extensions,omitempty"` // Duplicate bytes by extension (AddExtensions)
+	Remote     []RemoteGroup `json:"remote,omitempty"`     // Content also found under remote roots
+}
+
+// RemoteGroup is content found both under the local paths and on a remote
+// host. Remote copies are reported only, never replaced.
+type RemoteGroup struct {
+	Size   int64    `json:"size"`
+	Digest string   `json:"digest"` // Composite whole-file digest (hex)
+	Local  []string `json:"local"`
+	Remote []string `json:"remote"` // As [user@]host:/path
+}
+
+// Group describes one set of files with identical content.
+type Group struct {
+	Size    int64   `json:"size"`              // Size of each file in bytes
+	Digest  string  `json:"digest,omitempty"`  // Composite whole-file digest (hex)
+	Sampled bool    `json:"sampled,omitempty"` // Confirmed by sample windows only; Digest covers just those
+	Inodes  []Inode `json:"inodes"`            // Distinct inodes, sorted by first path
+}
+
+// Inode describes one sibling group (all paths sharing dev+ino).
+type Inode struct {
+	Dev    uint64   `json:"dev"`
+	Ino    uint64   `json:"ino"`
+	Nlink  uint32   `json:"nlink"`            // Link count observed at scan time
+	Mount  string   `json:"mount,omitempty"`  // Mount point of Dev, if known
+	FSType string   `json:"fsType,omitempty"` // Filesystem type of Dev, if known
+	Paths  []string `json:"paths"`            // Sorted paths
+}
+
+// Action describes one replacement performed by the deduper.
+type Action struct {
+	Source string `json:"source"`           // Path kept
+	Target string `json:"target"`           // Path replaced
+	Action string `json:"action"`           // hardlink, symlink, or skipped
+	Size   int64  `json:"size"`             // File size in bytes
+	Digest string `json:"digest,omitempty"` // Composite digest of the group
+	Reason string `json:"reason,omitempty"` // Skip reason code (locked, modified, exdev, ...)
+	Error  string `json:"error,omitempty"`  // Skip reason
+}
+
+// New builds a report from confirmed duplicate groups.
+func New(groups types.DuplicateGroups) *Report {
+	r := &Report{Version: formatVersion, Groups: make([]Group, 0, groups.Len())}
+	for _, dg := range groups.Items() {
+		first := dg.First().First()
+		g := Group{Size: first.Size, Digest: first.Digest, Sampled: first.Sampled, Inodes: make([]Inode, 0, dg.Len())}
+		for _, siblings := range dg.Items() {
+			rep := siblings.First()
+			inode := Inode{Dev: rep.Dev, Ino: rep.Ino, Nlink: rep.Nlink}
+			if m, ok := mounts.Lookup(rep.Dev); ok {
+				inode.Mount, inode.FSType = m.Point, m.FSType
+			}
+			for _, f := range siblings.Items() {
+				inode.Paths = append(inode.Paths, f.Path)
+			}
+			g.Inodes = append(g.Inodes, inode)
+		}
+		r.Groups = append(r.Groups, g)
+	}
+	return r
+}
+
+// AddActions records deduper results. Size and digest are taken from the
+// group containing each target. Sampled groups contribute no digest, since it
+// does not cover the whole file and could not be re-checked by VerifyLinks.
+func (r *Report) AddActions(results []*deduper.DedupeResult) {
+	groupOf := make(map[string]*Group)
+	for i := range r.Groups {
+		for _, inode := range r.Groups[i].Inodes {
+			for _, p := range inode.Paths {
+				groupOf[p] = &r.Groups[i]
+			}
+		}
+	}
+
+	for _, res := range results {
+		a := Action{Source: res.Source, Target: res.Target, Action: res.Action.String()}
+		if g := groupOf[res.Target]; g != nil {
+			a.Size = g.Size
+			if !g.Sampled {
+				a.Digest = g.Digest
+			}
+		}
+		if res.Err != nil {
+			a.Reason = res.Reason.String()
+			a.Error = res.Err.Error()
+		}
+		r.Actions = append(r.Actions, a)
+	}
+}
+
+// Read loads a JSON report written by WriteFile.
+func Read(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("decode report: %w", err)
+	}
+	if r.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported report version %d (want %d)", r.Version, formatVersion)
+	}
+	return &r, nil
+}
+
+// WriteFile writes the report in the given format.
+// Path "-" writes to stdout; otherwise the file is replaced atomically.
+func (r *Report) WriteFile(path string, format Format) error {
+	data, err := r.encode(format)
+	if err != nil {
+		return fmt.Errorf("encode report: %w", err)
+	}
+
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create report: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // no-op after successful rename
+
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write report: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write report: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// encode renders the report in the given format.
+func (r *Report) encode(format Format) ([]byte, error) {
+	switch format {
+	case FormatFDupes:
+		return r.encodeFDupes(), nil
+	case FormatRmlint:
+		return r.encodeRmlint()
+	case FormatTreemap:
+		return r.encodeTreemap()
+	case FormatDot:
+		return r.encodeDot(), nil
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// encodeFDupes renders groups as fdupes does: one path per line, groups
+// separated by a blank line. Only the first path of each inode is listed,
+// since hardlinks already share their data blocks.
+func (r *Report) encodeFDupes() []byte {
+	var buf bytes.Buffer
+	for _, g := range r.Groups {
+		for _, inode := range g.Inodes {
+			buf.WriteString(inode.Paths[0])
+			buf.WriteByte('\n')
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,181 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+func TestNewReport(t *testing.T) {
+	a := &types.FileInfo{Path: "/data/a", Size: 100, Dev: 1, Ino: 10, Nlink: 2, Digest: "abcd"}
+	aLink := &types.FileInfo{Path: "/data/a_link", Size: 100, Dev: 1, Ino: 10, Nlink: 2, Digest: "abcd"}
+	b := &types.FileInfo{Path: "/data/b", Size: 100, Dev: 1, Ino: 20, Nlink: 1, Digest: "abcd"}
+
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{b}),
+			types.NewSiblingGroup([]*types.FileInfo{aLink, a}),
+		}),
+	})
+
+	r := New(groups)
+
+	if r.Version != formatVersion {
+		t.Errorf("Version = %d, want %d", r.Version, formatVersion)
+	}
+	if len(r.Groups) != 1 {
+		t.Fatalf("len(Groups) = %d, want 1", len(r.Groups))
+	}
+	g := r.Groups[0]
+	if g.Size != 100 || g.Digest != "abcd" {
+		t.Errorf("Group = {Size: %d, Digest: %q}, want {Size: 100, Digest: \"abcd\"}", g.Size, g.Digest)
+	}
+	if len(g.Inodes) != 2 {
+		t.Fatalf("len(Inodes) = %d, want 2", len(g.Inodes))
+	}
+	// Inodes sorted by first path, paths sorted within inode
+	if g.Inodes[0].Ino != 10 || len(g.Inodes[0].Paths) != 2 || g.Inodes[0].Paths[0] != "/data/a" {
+		t.Errorf("Inodes[0] = %+v, want ino 10 with paths [/data/a /data/a_link]", g.Inodes[0])
+	}
+	if g.Inodes[1].Ino != 20 || g.Inodes[1].Nlink != 1 {
+		t.Errorf("Inodes[1] = %+v, want ino 20 with nlink 1", g.Inodes[1])
+	}
+}
+
+// TestAddExtensions tests that redundant copies are counted under the
+// extension of their group's first path, largest share first.
+func TestAddExtensions(t *testing.T) {
+	inodes := func(paths ...string) []Inode {
+		var in []Inode
+		for _, p := range paths {
+			in = append(in, Inode{Paths: []string{p}})
+		}
+		return in
+	}
+	r := &Report{Groups: []Group{
+		{Size: 300, Inodes: inodes("/a/x.JPG", "/b/x.jpg", "/c/x.jpg")},
+		{Size: 100, Inodes: inodes("/a/y.png", "/b/y.png")},
+		{Size: 100, Inodes: inodes("/a/Makefile", "/b/Makefile")},
+		{Size: 900, Inodes: inodes("/a/single.jpg")},
+	}}
+	r.AddExtensions()
+
+	want := []Extension{
+		{Extension: ".jpg", Type: "image", Copies: 2, Bytes: 600, Share: 0.75},
+		{Extension: "", Copies: 1, Bytes: 100, Share: 0.125},
+		{Extension: ".png", Type: "image", Copies: 1, Bytes: 100, Share: 0.125},
+	}
+	if len(r.Extensions) != len(want) {
+		t.Fatalf("Extensions = %+v, want %+v", r.Extensions, want)
+	}
+	for i := range want {
+		if r.Extensions[i] != want[i] {
+			t.Errorf("Extensions[%d] = %+v, want %+v", i, r.Extensions[i], want[i])
+		}
+	}
+}
+
+func TestSampledGroupActionsOmitDigest(t *testing.T) {
+	a := &types.FileInfo{Path: "/data/a", Size: 100, Ino: 10, Digest: "abcd", Sampled: true}
+	b := &types.FileInfo{Path: "/data/b", Size: 100, Ino: 20, Digest: "abcd", Sampled: true}
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{a}),
+			types.NewSiblingGroup([]*types.FileInfo{b}),
+		}),
+	})
+
+	r := New(groups)
+	r.AddActions([]*deduper.DedupeResult{{Source: a.Path, Target: b.Path, Action: deduper.ActionHardlink}})
+
+	if !r.Groups[0].Sampled {
+		t.Error("Group.Sampled = false, want true")
+	}
+	// A sampled digest is not a whole-file digest; verify-links must not check it
+	if r.Actions[0].Size != 100 || r.Actions[0].Digest != "" {
+		t.Errorf("Action = %+v, want size 100 and no digest", r.Actions[0])
+	}
+}
+
+func TestNewReportEmpty(t *testing.T) {
+	r := New(types.NewDuplicateGroups(nil))
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	// Empty report must still serialize groups as an array, not null
+	if string(data) != `{"version":1,"groups":[]}` {
+		t.Errorf("Marshal() = %s, want empty groups array", data)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	f := &types.FileInfo{Path: "/data/a", Size: 1, Ino: 1, Digest: "ff"}
+	g := &types.FileInfo{Path: "/data/b", Size: 1, Ino: 2, Digest: "ff"}
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{f}),
+			types.NewSiblingGroup([]*types.FileInfo{g}),
+		}),
+	})
+
+	if err := New(groups).WriteFile(path, FormatJSON); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if len(got.Groups) != 1 || got.Groups[0].Digest != "ff" {
+		t.Errorf("round-tripped report = %+v, want one group with digest ff", got)
+	}
+
+	// No temp files left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want 1 (report only)", len(entries))
+	}
+}
+
+func TestEncodeFDupes(t *testing.T) {
+	r := &Report{Groups: []Group{
+		{Size: 10, Inodes: []Inode{
+			{Ino: 1, Paths: []string{"/data/a", "/data/a_link"}},
+			{Ino: 2, Paths: []string{"/data/b"}},
+		}},
+		{Size: 20, Inodes: []Inode{
+			{Ino: 3, Paths: []string{"/data/c"}},
+			{Ino: 4, Paths: []string{"/data/d"}},
+		}},
+	}}
+
+	want := "/data/a\n/data/b\n\n/data/c\n/data/d\n\n"
+	if got := string(r.encodeFDupes()); got != want {
+		t.Errorf("encodeFDupes() = %q, want %q", got, want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for input, want := range map[string]Format{
+		"json": FormatJSON, "fdupes": FormatFDupes, "rmlint-json": FormatRmlint, "treemap-json": FormatTreemap, "dot": FormatDot,
+	} {
+		got, err := ParseFormat(input)
+		if err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %v, %v; want %v, nil", input, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(\"xml\") should return error")
+	}
+}
@@ -0,0 +1,104 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// rmlintHeader is the first element of rmlint's JSON output.
+type rmlintHeader struct {
+	Description  string `json:"description"`
+	Cwd          string `json:"cwd"`
+	Args         string `json:"args"`
+	Progress     int    `json:"progress"`
+	ChecksumType string `json:"checksum_type"`
+}
+
+// rmlintFile is one duplicate_file element of rmlint's JSON output.
+type rmlintFile struct {
+	ID         int    `json:"id"`
+	Type       string `json:"type"`
+	Progress   int    `json:"progress"`
+	Checksum   string `json:"checksum"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Depth      int    `json:"depth"`
+	Inode      uint64 `json:"inode"`
+	DiskID     uint64 `json:"disk_id"`
+	IsOriginal bool   `json:"is_original"`
+}
+
+// rmlintFooter is the last element of rmlint's JSON output.
+type rmlintFooter struct {
+	Aborted       bool  `json:"aborted"`
+	Progress      int   `json:"progress"`
+	TotalFiles    int   `json:"total_files"`
+	Duplicates    int   `json:"duplicates"`
+	DuplicateSets int   `json:"duplicate_sets"`
+	TotalLintSize int64 `json:"total_lint_size"`
+}
+
+// encodeRmlint renders groups in rmlint's JSON schema (rmlint -o json): a
+// header, one duplicate_file entry per inode, and a footer. Like encodeFDupes,
+// only the first path of each inode is listed. The original of each group is
+// the source recorded in the actions, or the group's first inode otherwise.
+func (r *Report) encodeRmlint() ([]byte, error) {
+	sources := make(map[string]bool)
+	for _, a := range r.Actions {
+		sources[a.Source] = true
+	}
+
+	cwd, _ := os.Getwd()
+	elements := []any{rmlintHeader{
+		Description:  "rmlint json-dump of lint files",
+		Cwd:          cwd,
+		Args:         "dupedog",
+		ChecksumType: "dupedog-sha256-composite",
+	}}
+
+	footer := rmlintFooter{Progress: 100}
+	for _, g := range r.Groups {
+		original := originalInode(g, sources)
+		for i, inode := range g.Inodes {
+			footer.TotalFiles++
+			if i != original {
+				footer.Duplicates++
+				footer.TotalLintSize += g.Size
+			}
+			elements = append(elements, rmlintFile{
+				ID:         footer.TotalFiles,
+				Type:       "duplicate_file",
+				Progress:   100,
+				Checksum:   g.Digest,
+				Path:       inode.Paths[0],
+				Size:       g.Size,
+				Depth:      strings.Count(inode.Paths[0], "/"),
+				Inode:      inode.Ino,
+				DiskID:     inode.Dev,
+				IsOriginal: i == original,
+			})
+		}
+		footer.DuplicateSets++
+	}
+	elements = append(elements, footer)
+
+	data, err := json.MarshalIndent(elements, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// originalInode returns the index of the inode holding a recorded source path,
+// or 0 if the group has no recorded source.
+func originalInode(g Group, sources map[string]bool) int {
+	for i, inode := range g.Inodes {
+		for _, p := range inode.Paths {
+			if sources[p] {
+				return i
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ivoronin/dupedog/internal/deduper"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+func TestEncodeRmlintRoundTrip(t *testing.T) {
+	a := &types.FileInfo{Path: "/data/a", Size: 100, Ino: 10, Digest: "abcd"}
+	b := &types.FileInfo{Path: "/data/b", Size: 100, Ino: 20, Digest: "abcd"}
+	bLink := &types.FileInfo{Path: "/data/b_link", Size: 100, Ino: 20, Digest: "abcd"}
+	groups := types.NewDuplicateGroups([]types.DuplicateGroup{
+		types.NewDuplicateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{a}),
+			types.NewSiblingGroup([]*types.FileInfo{b, bLink}),
+		}),
+	})
+
+	r := New(groups)
+	r.AddActions([]*deduper.DedupeResult{{Source: bLink.Path, Target: a.Path, Action: deduper.ActionHardlink}})
+
+	data, err := r.encode(FormatRmlint)
+	if err != nil {
+		t.Fatalf("encode() failed: %v", err)
+	}
+
+	// Our own rmlint importer must read it back: one path per inode,
+	// with the deduper's source inode as the original
+	imp, err := ParseRmlint(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseRmlint() failed: %v", err)
+	}
+	if len(imp.Groups) != 1 || len(imp.Groups[0]) != 2 {
+		t.Fatalf("Groups = %v, want one group of 2 paths", imp.Groups)
+	}
+	if len(imp.Originals) != 1 || imp.Originals[0] != "/data/b" {
+		t.Errorf("Originals = %v, want [/data/b]", imp.Originals)
+	}
+}
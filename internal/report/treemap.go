@@ -0,0 +1,128 @@
+package report
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// dotMinShare is the share of all reclaimable bytes below which directories
+// are left out of the Graphviz graph, to keep huge trees readable.
+const dotMinShare = 0.01
+
+// treeNode is a directory of the savings tree.
+type treeNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Size     int64       `json:"size"` // Reclaimable bytes in this directory and below
+	Self     int64       `json:"self"` // Reclaimable bytes of files directly in this directory
+	Children []*treeNode `json:"children,omitempty"`
+
+	byName map[string]*treeNode
+}
+
+// savingsTree returns the directory tree of reclaimable bytes: each redundant
+// copy (every inode of a group but the original, see originalInode) counts
+// in the directory of its first path and in every directory above it.
+func (r *Report) savingsTree() *treeNode {
+	sources := make(map[string]bool)
+	for _, a := range r.Actions {
+		sources[a.Source] = true
+	}
+
+	root := &treeNode{Name: "/", Path: "/"}
+	for _, g := range r.Groups {
+		original := originalInode(g, sources)
+		for i, inode := range g.Inodes {
+			if i == original {
+				continue
+			}
+			node := root
+			node.Size += g.Size
+			for _, name := range strings.Split(strings.Trim(filepath.Dir(inode.Paths[0]), "/"), "/") {
+				if name == "" {
+					continue
+				}
+				node = node.child(name)
+				node.Size += g.Size
+			}
+			node.Self += g.Size
+		}
+	}
+	root.sort()
+	return root
+}
+
+// child returns the subdirectory name of n, creating it if needed.
+func (n *treeNode) child(name string) *treeNode {
+	if c, ok := n.byName[name]; ok {
+		return c
+	}
+	if n.byName == nil {
+		n.byName = make(map[string]*treeNode)
+	}
+	c := &treeNode{Name: name, Path: filepath.Join(n.Path, name)}
+	n.byName[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// sort orders the children of n and below by size, largest first, then name.
+func (n *treeNode) sort() {
+	slices.SortFunc(n.Children, func(a, b *treeNode) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Name, b.Name))
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// encodeTreemap renders the savings tree as nested JSON objects, the
+// hierarchy format of d3 and most treemap tools (sum "self" for leaf sizes).
+func (r *Report) encodeTreemap() ([]byte, error) {
+	data, err := json.MarshalIndent(r.savingsTree(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// encodeDot renders the savings tree as a Graphviz digraph, one box per
+// directory labeled with its reclaimable bytes. Directories holding less than
+// dotMinShare of the total are left out.
+func (r *Report) encodeDot() []byte {
+	root := r.savingsTree()
+	var buf bytes.Buffer
+	buf.WriteString("digraph savings {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	var walk func(n *treeNode)
+	walk = func(n *treeNode) {
+		_, _ = fmt.Fprintf(&buf, "\t%s [label=\"%s\\n%s\"];\n",
+			dotQuote(n.Path), dotEscape(n.Name), humanize.IBytes(uint64(n.Size)))
+		for _, c := range n.Children {
+			if float64(c.Size) < dotMinShare*float64(root.Size) {
+				continue
+			}
+			_, _ = fmt.Fprintf(&buf, "\t%s -> %s;\n", dotQuote(n.Path), dotQuote(c.Path))
+			walk(c)
+		}
+	}
+	walk(root)
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// dotQuote returns s as a quoted DOT identifier.
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+// dotEscape escapes backslashes and quotes for a quoted DOT string.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
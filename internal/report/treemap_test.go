@@ -0,0 +1,113 @@
+package report
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func treemapReport() *Report {
+	return &Report{
+		Groups: []Group{
+			{Size: 100, Inodes: []Inode{
+				{Ino: 1, Paths: []string{"/data/a/x"}},
+				{Ino: 2, Paths: []string{"/data/b/x", "/data/b/x_link"}},
+				{Ino: 3, Paths: []string{"/data/b/deep/x"}},
+			}},
+			{Size: 1, Inodes: []Inode{
+				{Ino: 4, Paths: []string{"/data/b/tiny"}},
+				{Ino: 5, Paths: []string{"/data/c/tiny"}},
+			}},
+		},
+		// The kept copy of the first group is /data/b/x, not the first inode
+		Actions: []Action{{Source: "/data/b/x", Target: "/data/a/x", Action: "hardlink"}},
+	}
+}
+
+// TestSavingsTree tests that every copy but the original counts in its
+// directory and all directories above it.
+func TestSavingsTree(t *testing.T) {
+	root := treemapReport().savingsTree()
+
+	type node struct {
+		size, self int64
+	}
+	got := make(map[string]node)
+	var walk func(n *treeNode)
+	walk = func(n *treeNode) {
+		got[n.Path] = node{n.Size, n.Self}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	want := map[string]node{
+		"/":            {201, 0},
+		"/data":        {201, 0},
+		"/data/a":      {100, 100},
+		"/data/b":      {100, 0},
+		"/data/b/deep": {100, 100},
+		"/data/c":      {1, 1},
+	}
+	if len(got) != len(want) {
+		t.Errorf("savingsTree() has %d directories, want %d: %v", len(got), len(want), got)
+	}
+	for path, w := range want {
+		if got[path] != w {
+			t.Errorf("%s = %+v, want %+v", path, got[path], w)
+		}
+	}
+	// Largest first, then by name
+	if c := root.Children[0].Children; c[0].Name != "a" || c[1].Name != "b" || c[2].Name != "c" {
+		t.Errorf("children of /data = %s, %s, %s; want a, b, c", c[0].Name, c[1].Name, c[2].Name)
+	}
+}
+
+func TestEncodeTreemap(t *testing.T) {
+	data, err := treemapReport().encode(FormatTreemap)
+	if err != nil {
+		t.Fatalf("encode() failed: %v", err)
+	}
+	var got struct {
+		Name     string `json:"name"`
+		Size     int64  `json:"size"`
+		Children []struct {
+			Name string `json:"name"`
+		} `json:"children"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if got.Name != "/" || got.Size != 201 || len(got.Children) != 1 || got.Children[0].Name != "data" {
+		t.Errorf("treemap = %+v, want / (201 bytes) with child data", got)
+	}
+}
+
+// TestEncodeDot tests that directories below dotMinShare of the total are
+// left out of the graph.
+func TestEncodeDot(t *testing.T) {
+	data, err := treemapReport().encode(FormatDot)
+	if err != nil {
+		t.Fatalf("encode() failed: %v", err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"digraph savings {\n",
+		`"/data/b" [label="b\n100 B"];`,
+		`"/data/b" -> "/data/b/deep";`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("encodeDot() missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "/data/c") {
+		t.Errorf("encodeDot() includes /data/c below the share threshold:\n%s", got)
+	}
+}
+
+func TestDotEscape(t *testing.T) {
+	if got, want := dotQuote(`/a "b"\c`), `"/a \"b\"\\c"`; got != want {
+		t.Errorf("dotQuote() = %s, want %s", got, want)
+	}
+}
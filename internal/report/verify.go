@@ -0,0 +1,113 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Divergence describes a path whose state no longer matches the report.
+type Divergence struct {
+	Path   string
+	Reason string
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s: %s", d.Path, d.Reason)
+}
+
+// DigestFunc computes the composite whole-file digest of a file.
+type DigestFunc func(path string) (string, error)
+
+// VerifyLinks re-checks every performed replacement in the report:
+//   - hardlink targets must still share the source's inode
+//   - symlink targets must still be symlinks resolving to the source
+//   - sources must still match the recorded digest (checked once per source)
+//
+// Skipped actions are ignored. Returns all divergences found.
+func (r *Report) VerifyLinks(digest DigestFunc) []Divergence {
+	var divergences []Divergence
+	checkedSources := make(map[string]bool)
+
+	for _, a := range r.Actions {
+		var reason string
+		switch a.Action {
+		case "hardlink":
+			reason = checkHardlink(a.Source, a.Target)
+		case "symlink":
+			reason = checkSymlink(a.Source, a.Target)
+		default:
+			continue
+		}
+		if reason != "" {
+			divergences = append(divergences, Divergence{Path: a.Target, Reason: reason})
+		}
+
+		if a.Digest == "" || checkedSources[a.Source] {
+			continue
+		}
+		checkedSources[a.Source] = true
+		if reason := checkDigest(digest, a.Source, a.Digest); reason != "" {
+			divergences = append(divergences, Divergence{Path: a.Source, Reason: reason})
+		}
+	}
+	return divergences
+}
+
+// checkHardlink returns a reason if target is no longer a hardlink to source.
+func checkHardlink(source, target string) string {
+	srcInfo, err := os.Lstat(source)
+	if err != nil {
+		return fmt.Sprintf("source unavailable: %v", err)
+	}
+	tgtInfo, err := os.Lstat(target)
+	if err != nil {
+		return fmt.Sprintf("target unavailable: %v", err)
+	}
+	if !sameFile(srcInfo, tgtInfo) {
+		return "no longer hardlinked to " + source
+	}
+	return ""
+}
+
+// checkSymlink returns a reason if target is no longer a symlink resolving to source.
+func checkSymlink(source, target string) string {
+	tgtInfo, err := os.Lstat(target)
+	if err != nil {
+		return fmt.Sprintf("target unavailable: %v", err)
+	}
+	if tgtInfo.Mode()&os.ModeSymlink == 0 {
+		return "no longer a symlink"
+	}
+	resolved, err := os.Stat(target)
+	if err != nil {
+		return fmt.Sprintf("dangling symlink: %v", err)
+	}
+	srcInfo, err := os.Stat(source)
+	if err != nil {
+		return fmt.Sprintf("source unavailable: %v", err)
+	}
+	if !sameFile(srcInfo, resolved) {
+		return "symlink no longer resolves to " + source
+	}
+	return ""
+}
+
+// checkDigest returns a reason if the file's content no longer matches want.
+func checkDigest(digest DigestFunc, path, want string) string {
+	got, err := digest(path)
+	if err != nil {
+		return fmt.Sprintf("cannot hash: %v", err)
+	}
+	if got != want {
+		return "content changed since deduplication"
+	}
+	return ""
+}
+
+// sameFile reports whether two FileInfos refer to the same dev+ino.
+func sameFile(a, b os.FileInfo) bool {
+	sa, okA := a.Sys().(*syscall.Stat_t)
+	sb, okB := b.Sys().(*syscall.Stat_t)
+	return okA && okB && sa.Dev == sb.Dev && sa.Ino == sb.Ino
+}
@@ -0,0 +1,105 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDigest returns a digest derived from file content for testing.
+func fakeDigest(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return "d-" + string(data), nil
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+}
+
+func TestVerifyLinksIntact(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	hard := filepath.Join(dir, "hard")
+	sym := filepath.Join(dir, "sym")
+	writeTestFile(t, src, "x")
+	if err := os.Link(src, hard); err != nil {
+		t.Fatalf("Link() failed: %v", err)
+	}
+	if err := os.Symlink(src, sym); err != nil {
+		t.Fatalf("Symlink() failed: %v", err)
+	}
+
+	r := &Report{Version: formatVersion, Actions: []Action{
+		{Source: src, Target: hard, Action: "hardlink", Digest: "d-x"},
+		{Source: src, Target: sym, Action: "symlink", Digest: "d-x"},
+		{Source: src, Target: filepath.Join(dir, "gone"), Action: "skipped", Error: "busy"},
+	}}
+
+	if got := r.VerifyLinks(fakeDigest); len(got) != 0 {
+		t.Errorf("VerifyLinks() = %v, want no divergences", got)
+	}
+}
+
+func TestVerifyLinksDivergent(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	hard := filepath.Join(dir, "hard")
+	sym := filepath.Join(dir, "sym")
+	writeTestFile(t, src, "changed")
+	writeTestFile(t, hard, "x") // Link broken: independent copy
+	writeTestFile(t, sym, "x")  // Symlink replaced by regular file
+
+	r := &Report{Version: formatVersion, Actions: []Action{
+		{Source: src, Target: hard, Action: "hardlink", Digest: "d-x"},
+		{Source: src, Target: sym, Action: "symlink", Digest: "d-x"},
+	}}
+
+	got := r.VerifyLinks(fakeDigest)
+	// Two broken links plus one changed source (reported once)
+	if len(got) != 3 {
+		t.Fatalf("VerifyLinks() = %v, want 3 divergences", got)
+	}
+	if got[0].Path != hard || !strings.Contains(got[0].Reason, "no longer hardlinked") {
+		t.Errorf("divergence[0] = %v, want broken hardlink", got[0])
+	}
+	if got[1].Path != src || !strings.Contains(got[1].Reason, "content changed") {
+		t.Errorf("divergence[1] = %v, want changed source", got[1])
+	}
+	if got[2].Path != sym || got[2].Reason != "no longer a symlink" {
+		t.Errorf("divergence[2] = %v, want replaced symlink", got[2])
+	}
+}
+
+func TestReadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	r := &Report{Version: formatVersion, Groups: []Group{}, Actions: []Action{
+		{Source: "/a", Target: "/b", Action: "hardlink", Size: 1, Digest: "ff"},
+	}}
+	if err := r.WriteFile(path, FormatJSON); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if len(got.Actions) != 1 || got.Actions[0] != r.Actions[0] {
+		t.Errorf("Read() actions = %+v, want %+v", got.Actions, r.Actions)
+	}
+}
+
+func TestReadRejectsVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	writeTestFile(t, path, `{"version":99,"groups":[]}`)
+
+	if _, err := Read(path); err == nil {
+		t.Error("Read() succeeded, want version error")
+	}
+}
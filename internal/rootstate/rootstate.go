@@ -0,0 +1,88 @@
+// Package rootstate records, for each root a dedupe run modified, when it
+// was last deduplicated, with which policy, and how much it saved, in a
+// state directory with one small JSON file per root (named by a hash of the
+// path). A later run with a different policy on the same tree can then be
+// warned that the two runs may not agree on what to link.
+package rootstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// State is the last run on one root.
+type State struct {
+	Root       string            `json:"root"`
+	Time       time.Time         `json:"time"`
+	Policy     map[string]string `json:"policy"` // Flag name → value
+	Replaced   int64             `json:"replaced"`
+	BytesSaved int64             `json:"bytesSaved"`
+}
+
+// Load returns the state recorded for root in dir, or nil if there is none.
+func Load(dir, root string) (*State, error) {
+	data, err := os.ReadFile(statePath(dir, root))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("read state of %s: %w", root, err)
+	}
+	return &s, nil
+}
+
+// Save records s in dir, replacing the previous state of s.Root atomically.
+func Save(dir string, s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	path := statePath(dir, s.Root)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // No-op after rename
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Conflicts returns the flags whose value in policy differs from the
+// recorded one, sorted. Flags recorded on one side only are not compared.
+func (s *State) Conflicts(policy map[string]string) []string {
+	var flags []string
+	for flag, value := range policy {
+		if recorded, ok := s.Policy[flag]; ok && recorded != value {
+			flags = append(flags, flag)
+		}
+	}
+	slices.Sort(flags)
+	return flags
+}
+
+// statePath returns the state file of root in dir.
+func statePath(dir, root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
@@ -0,0 +1,49 @@
+package rootstate
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	if s, err := Load(dir, "/data"); s != nil || err != nil {
+		t.Fatalf("Load() before Save = %v, %v; want nil, nil", s, err)
+	}
+
+	want := &State{
+		Root:       "/data",
+		Time:       time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Policy:     map[string]string{"action": "hardlink"},
+		Replaced:   3,
+		BytesSaved: 4096,
+	}
+	if err := Save(dir, want); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	got, err := Load(dir, "/data")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if got.Root != want.Root || !got.Time.Equal(want.Time) || got.Policy["action"] != "hardlink" ||
+		got.Replaced != 3 || got.BytesSaved != 4096 {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+	if s, _ := Load(dir, "/other"); s != nil {
+		t.Errorf("Load(/other) = %+v, want nil", s)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	s := &State{Policy: map[string]string{"action": "hardlink", "prefer": "/a", "trust-device-boundaries": "true"}}
+	got := s.Conflicts(map[string]string{"action": "hardlink", "trust-device-boundaries": "false", "symlink-fallback": "false"})
+	// Flags recorded on one side only (prefer, symlink-fallback) are not compared
+	want := []string{"trust-device-boundaries"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Conflicts() = %v, want %v", got, want)
+	}
+	if got := s.Conflicts(s.Policy); len(got) != 0 {
+		t.Errorf("Conflicts(same policy) = %v, want none", got)
+	}
+}
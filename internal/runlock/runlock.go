@@ -0,0 +1,129 @@
+//go:build unix
+
+// Package runlock keeps two dupedog runs from modifying the same tree at the
+// same time, with advisory flock locks on files in a lock directory, one per
+// path (named by a hash of the path).
+//
+// A run locks each of its roots exclusively and every ancestor of a root
+// shared. Runs on the same root, or on a root and a directory below it,
+// conflict; runs on sibling trees do not. Locks are taken in path order, so
+// runs waiting for each other cannot deadlock. Lock files are never removed:
+// removing a file another run has open would let a third run lock a new file
+// of the same name.
+package runlock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// pollInterval is how often a waiting run retries a held lock.
+const pollInterval = 100 * time.Millisecond
+
+// ErrLocked is returned when a path is locked by another run.
+var ErrLocked = errors.New("locked by another dupedog run")
+
+// Lock holds the locks of one run.
+type Lock struct {
+	files []*os.File
+}
+
+// Acquire locks roots (absolute, clean paths) in dir. Without wait, a lock held
+// by another run fails with ErrLocked at once; with wait, Acquire retries until
+// the lock is free or ctx is done, calling onWait once before the first retry.
+func Acquire(ctx context.Context, dir string, roots []string, wait bool, onWait func(path string)) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	modes := lockModes(roots)
+	paths := make([]string, 0, len(modes))
+	for path := range modes {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	l := &Lock{}
+	for _, path := range paths {
+		f, err := lockPath(ctx, dir, path, modes[path], wait, onWait)
+		if err != nil {
+			_ = l.Release()
+			return nil, err
+		}
+		l.files = append(l.files, f)
+	}
+	return l, nil
+}
+
+// lockModes returns the flock mode of every path to lock: LOCK_EX for roots,
+// LOCK_SH for their ancestors.
+func lockModes(roots []string) map[string]int {
+	modes := make(map[string]int)
+	for _, root := range roots {
+		modes[root] = syscall.LOCK_EX
+		for dir := filepath.Dir(root); ; dir = filepath.Dir(dir) {
+			if _, ok := modes[dir]; !ok {
+				modes[dir] = syscall.LOCK_SH
+			}
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	return modes
+}
+
+// lockPath locks the lock file of path with mode.
+func lockPath(ctx context.Context, dir, path string, mode int, wait bool, onWait func(string)) (*os.File, error) {
+	sum := sha256.Sum256([]byte(path))
+	f, err := os.OpenFile(filepath.Join(dir, hex.EncodeToString(sum[:8])+".lock"), os.O_RDONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(ctx, f, path, mode, wait, onWait); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// flock locks f, retrying while another run holds it if wait is set.
+func flock(ctx context.Context, f *os.File, path string, mode int, wait bool, onWait func(string)) error {
+	for waited := false; ; waited = true {
+		err := syscall.Flock(int(f.Fd()), mode|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return err
+		}
+		if !wait {
+			return fmt.Errorf("%s: %w", path, ErrLocked)
+		}
+		if !waited && onWait != nil {
+			onWait(path)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for lock on %s: %w", path, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Release unlocks every path. Safe to call on nil.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	for _, f := range l.files {
+		errs = append(errs, f.Close()) // Closing releases the flock
+	}
+	l.files = nil
+	return errors.Join(errs...)
+}
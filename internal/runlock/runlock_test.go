@@ -0,0 +1,64 @@
+//go:build unix
+
+package runlock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireConflicts(t *testing.T) {
+	dir := t.TempDir()
+	held, err := Acquire(context.Background(), dir, []string{"/data/a"}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = held.Release() }()
+
+	tests := []struct {
+		roots    []string
+		conflict bool
+	}{
+		{[]string{"/data/a"}, true},     // Same root
+		{[]string{"/data"}, true},       // Ancestor of the root
+		{[]string{"/data/a/sub"}, true}, // Below the root
+		{[]string{"/data/b"}, false},    // Sibling
+		{[]string{"/data/b", "/data/a"}, true},
+	}
+	for _, tt := range tests {
+		l, err := Acquire(context.Background(), dir, tt.roots, false, nil)
+		if got := errors.Is(err, ErrLocked); got != tt.conflict {
+			t.Errorf("Acquire(%v) error = %v, want conflict %v", tt.roots, err, tt.conflict)
+		}
+		_ = l.Release()
+	}
+}
+
+func TestAcquireWait(t *testing.T) {
+	dir := t.TempDir()
+	held, err := Acquire(context.Background(), dir, []string{"/data"}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Times out while the lock is held
+	ctx, cancel := context.WithTimeout(context.Background(), 2*pollInterval)
+	defer cancel()
+	var waitedFor []string
+	if _, err := Acquire(ctx, dir, []string{"/data"}, true, func(path string) { waitedFor = append(waitedFor, path) }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() error = %v, want deadline exceeded", err)
+	}
+	if len(waitedFor) != 1 || waitedFor[0] != "/data" {
+		t.Errorf("onWait called with %v, want [/data] once", waitedFor)
+	}
+
+	// Succeeds once the holder releases it
+	time.AfterFunc(pollInterval, func() { _ = held.Release() })
+	l, err := Acquire(context.Background(), dir, []string{"/data"}, true, nil)
+	if err != nil {
+		t.Fatalf("Acquire() after release failed: %v", err)
+	}
+	_ = l.Release()
+}
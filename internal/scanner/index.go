@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// indexVersion is the format version of saved indexes; indexes of other
+// versions are ignored.
+const indexVersion = 2
+
+// racyWindow is how long before the scan started a directory must have last
+// changed to be recorded: a change within the same mtime tick as the listing
+// would otherwise go unnoticed by the next scan.
+const racyWindow = 2 * time.Second
+
+// Index remembers directory listings between scans (--incremental).
+//
+// A directory whose mtime and link count are unchanged since it was recorded
+// has had no entries added, removed, or renamed, so the scan takes its files
+// and subdirectories from the record instead of listing it. Files changed in
+// place do not touch their directory, so recorded files are stat'ed again
+// before the scan returns them and stale metadata never reaches the later
+// phases.
+type Index struct {
+	prev map[string]dirRecord // Loaded from the previous scan (read-only)
+
+	mu    sync.Mutex
+	next  map[string]dirRecord // Recorded by this scan
+	roots []string             // Roots of this scan
+}
+
+// dirRecord is the listing of one directory.
+type dirRecord struct {
+	ModTime int64  // Directory mtime (UnixNano)
+	Nlink   uint64 // Directory link count (tracks subdirectories on most filesystems)
+	Files   []types.FileInfo
+	Subdirs []string
+	Other   nonRegular // Entries skipped by the scan, for its stats
+}
+
+// indexFile is the on-disk form of an Index.
+type indexFile struct {
+	Version int
+	Dirs    map[string]dirRecord
+}
+
+// NewIndex returns an empty index: the scan lists every directory.
+func NewIndex() *Index {
+	return &Index{next: make(map[string]dirRecord)}
+}
+
+// LoadIndex reads the index saved at path. A missing file or an index of
+// another format version gives an empty index.
+func LoadIndex(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewIndex(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var file indexFile
+	if err := gob.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("read index %s: %w", path, err)
+	}
+	x := NewIndex()
+	if file.Version == indexVersion {
+		x.prev = file.Dirs
+	}
+	return x, nil
+}
+
+// Save writes the directories recorded by the scan to path, keeping the
+// records of directories outside its roots. Call it after a complete scan
+// only: directories a canceled scan did not reach would be forgotten.
+func (x *Index) Save(path string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	dirs := make(map[string]dirRecord, len(x.prev)+len(x.next))
+	for dir, rec := range x.prev {
+		if !underRoots(dir, x.roots) {
+			dirs[dir] = rec
+		}
+	}
+	for dir, rec := range x.next {
+		dirs[dir] = rec
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // No-op after rename
+	err = gob.NewEncoder(tmp).Encode(indexFile{Version: indexVersion, Dirs: dirs})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the record of dir if its mtime and link count still match.
+func (x *Index) lookup(dir string, modTime int64, nlink uint64) (dirRecord, bool) {
+	rec, ok := x.prev[dir]
+	return rec, ok && rec.ModTime == modTime && rec.Nlink == nlink
+}
+
+// record remembers the listing of dir for the next scan.
+func (x *Index) record(dir string, rec dirRecord) {
+	x.mu.Lock()
+	x.next[dir] = rec
+	x.mu.Unlock()
+}
+
+// underRoots reports whether path is one of roots or below one.
+func underRoots(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// age sets the mtime of paths to a fixed time in the past, outside racyWindow.
+func age(t *testing.T, paths ...string) {
+	t.Helper()
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, p := range paths {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// scanWithIndex scans root with the index saved at path and saves it back.
+func scanWithIndex(t *testing.T, root, path string) map[string]int64 {
+	t.Helper()
+	index, err := LoadIndex(path)
+	if err != nil {
+		t.Fatalf("LoadIndex() failed: %v", err)
+	}
+	files := New([]string{root}, Options{Index: index, Excludes: []string{"skip"}}, nil).Run()
+	if err := index.Save(path); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	sizes := make(map[string]int64)
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f.Path)
+		sizes[rel] = f.Size
+	}
+	return sizes
+}
+
+// TestIndexReuse tests that unchanged directories are taken from the index,
+// that changed ones are listed again, and that reused files are stat'ed
+// again.
+func TestIndexReuse(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(t.TempDir(), "dirs.idx")
+	static, changed := filepath.Join(root, "static"), filepath.Join(root, "changed")
+	createFile(t, filepath.Join(static, "unique"), 10)
+	createFile(t, filepath.Join(static, "gone"), 15)
+	createFile(t, filepath.Join(static, "shared"), 20)
+	createFile(t, filepath.Join(changed, "shared"), 20)
+	createFile(t, filepath.Join(root, "skip", "excluded"), 30)
+	age(t, static, changed, root)
+
+	if got := scanWithIndex(t, root, path); len(got) != 4 {
+		t.Fatalf("first scan = %v, want 4 files", got)
+	}
+
+	// Adding a file and restoring the mtime hides the change from the index
+	createFile(t, filepath.Join(static, "hidden"), 30)
+	// Removing one does too, but reused files are stat'ed again
+	if err := os.Remove(filepath.Join(static, "gone")); err != nil {
+		t.Fatal(err)
+	}
+	age(t, static)
+	// Changed in place: the directory is untouched
+	createFile(t, filepath.Join(static, "unique"), 12)
+	createFile(t, filepath.Join(static, "shared"), 25)
+	age(t, static)
+	// A new file changes the directory
+	createFile(t, filepath.Join(changed, "new"), 40)
+
+	got := scanWithIndex(t, root, path)
+	want := map[string]int64{
+		"static/unique":  12, // From the index, stat'ed again
+		"static/shared":  25, // From the index, stat'ed again
+		"changed/shared": 20,
+		"changed/new":    40, // Listed again: the directory changed
+	}
+	if len(got) != len(want) {
+		t.Errorf("second scan = %v, want %v", got, want)
+	}
+	for rel, size := range want {
+		if got[rel] != size {
+			t.Errorf("%s = %d, want %d", rel, got[rel], size)
+		}
+	}
+
+	// The changed directory is too recent to be recorded again (racyWindow)
+	index, err := LoadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs []string
+	for dir := range index.prev {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+	if want := []string{root, static}; !slices.Equal(dirs, want) {
+		t.Errorf("recorded dirs = %v, want %v", dirs, want)
+	}
+}
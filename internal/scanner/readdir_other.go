@@ -0,0 +1,19 @@
+//go:build !linux
+
+package scanner
+
+import "os"
+
+// dirReader lists a directory with os.File.ReadDir; large getdents buffers
+// are Linux-only.
+type dirReader struct {
+	f *os.File
+}
+
+func newDirReader(f *os.File) *dirReader { return &dirReader{f: f} }
+
+// Close is a no-op. The directory is closed by the caller.
+func (r *dirReader) Close() {}
+
+// ReadDir returns up to n entries, like os.File.ReadDir(n).
+func (r *dirReader) ReadDir(n int) ([]os.DirEntry, error) { return r.f.ReadDir(n) }
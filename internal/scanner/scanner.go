@@ -68,47 +68,88 @@
 package scanner
 
 import (
+	"cmp"
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/ivoronin/dupedog/internal/pathnorm"
+	"github.com/ivoronin/dupedog/internal/pause"
 	"github.com/ivoronin/dupedog/internal/progress"
 	"github.com/ivoronin/dupedog/internal/types"
 )
 
+// SnapshotExcludes are exclude patterns for filesystem snapshot directories
+// (NetApp/WAFL, snapper, ZFS). Snapshots are immutable copies of live data, so
+// scanning them only inflates candidate counts with files that cannot be linked.
+var SnapshotExcludes = []string{".snapshot", ".snapshots", ".zfs/snapshot"}
+
+// DefaultReaddirBatch is the default number of directory entries listed at a time.
+const DefaultReaddirBatch = 1000
+
 // Scanner discovers files matching filter criteria using parallel directory traversal.
 //
 // The scanner is designed for single-use: create with New(), call Run() once.
 type Scanner struct {
 	// Config (immutable, set by New)
-	paths        []string   // Root paths to scan
-	minSize      int64      // Minimum file size filter (bytes)
-	excludes     []string   // Glob patterns for filename exclusion
-	workers      int        // Max concurrent directory reads
-	showProgress bool       // Whether to display progress bar
-	errCh        chan error // Non-fatal errors (permission denied, etc.)
+	paths        []string          // Root paths to scan
+	minSize      int64             // Minimum file size filter (bytes)
+	minSizeFor   map[string]int64  // Per-path minimum size overrides (absolute path → bytes)
+	excludes     []string          // Glob patterns for filename exclusion (normalized)
+	normalize    pathnorm.Form     // Unicode form of paths matched against excludes
+	workers      int               // Max concurrent directory reads
+	readdirBatch int               // Entries listed per ReadDir call
+	reporter     progress.Reporter // Receives progress (nil = none)
+	index        *Index            // Listings reused between scans (nil = list every directory)
+	errCh        chan *types.Event // Non-fatal errors (permission denied, etc.)
 
 	// Runtime (initialized in Run)
+	ctx       context.Context      // Canceled to stop walking early
 	walkerWg  sync.WaitGroup       // Tracks in-flight walker goroutines
 	walkerSem types.Semaphore      // Limits concurrent directory reads
 	resultCh  chan *types.FileInfo // Fan-in channel: walkers → collector
 	stats     *stats               // Atomic counters for progress tracking
 	bar       *progress.Bar        // Progress display (thread-safe)
+	reusedMu  sync.Mutex
+	reused    map[*types.FileInfo]bool // Files taken from index records, re-stat'ed by refreshReused
 }
 
-// New creates a Scanner for discovering files.
-func New(paths []string, minSize int64, excludes []string, workers int, showProgress bool, errCh chan error) *Scanner {
+// Options configures a Scanner. The zero value scans every file with one
+// directory reader and no progress.
+type Options struct {
+	MinSize      int64             // Minimum file size filter (bytes)
+	MinSizeFor   map[string]int64  // Per-path overrides of MinSize (absolute path → bytes); the longest matching path wins
+	Excludes     []string          // Glob patterns for filename exclusion
+	Normalize    pathnorm.Form     // Unicode form paths and patterns are compared in (default: as is)
+	Workers      int               // Max concurrent directory reads (0 = 1)
+	ReaddirBatch int               // Entries listed per ReadDir call (0 = DefaultReaddirBatch)
+	Reporter     progress.Reporter // Receives progress (nil = none)
+	Index        *Index            // Reuse listings of unchanged directories and record them (nil = list every directory)
+}
+
+// New creates a Scanner for discovering files below paths.
+// Non-fatal errors are sent to errCh.
+func New(paths []string, opts Options, errCh chan *types.Event) *Scanner {
 	return &Scanner{
 		paths:        paths,
-		minSize:      minSize,
-		excludes:     excludes,
-		workers:      workers,
-		showProgress: showProgress,
+		minSize:      opts.MinSize,
+		minSizeFor:   opts.MinSizeFor,
+		excludes:     opts.Normalize.ApplyAll(opts.Excludes),
+		normalize:    opts.Normalize,
+		workers:      max(opts.Workers, 1),
+		readdirBatch: cmp.Or(opts.ReaddirBatch, DefaultReaddirBatch),
+		reporter:     opts.Reporter,
+		index:        opts.Index,
 		errCh:        errCh,
 	}
 }
@@ -123,18 +164,45 @@ func New(paths []string, minSize int64, excludes []string, workers int, showProg
 // all four counters (scannedFiles might be newer than matchedFiles), but this
 // is acceptable for progress display where exactness isn't required.
 type stats struct {
-	scannedFiles atomic.Int64 // Total files discovered (all walkers)
-	matchedFiles atomic.Int64 // Files passing size/exclude filters
-	scannedBytes atomic.Int64 // Total bytes across all scanned files
-	matchedBytes atomic.Int64 // Bytes of matched files only
-	startTime    time.Time    // For elapsed time calculation
+	scannedFiles  atomic.Int64 // Total files discovered (all walkers)
+	matchedFiles  atomic.Int64 // Files passing size/exclude filters
+	scannedBytes  atomic.Int64 // Total bytes across all scanned files
+	matchedBytes  atomic.Int64 // Bytes of matched files only
+	excludedFiles atomic.Int64 // Files matching an exclude pattern
+	excludedBytes atomic.Int64
+	smallFiles    atomic.Int64 // Files below the minimum size
+	smallBytes    atomic.Int64
+	symlinks      atomic.Int64 // Symlinks skipped
+	special       atomic.Int64 // Devices, FIFOs and sockets skipped
+	startTime     time.Time    // For elapsed time calculation
+}
+
+// Counts implements progress.Counter: files and bytes scanned.
+func (s *stats) Counts() (items, bytes int64) {
+	return s.scannedFiles.Load(), s.scannedBytes.Load()
 }
 
 func (s *stats) String() string {
-	return fmt.Sprintf("Scanned %d (%s), matched %d files (%s) in %.1fs",
+	line := fmt.Sprintf("Scanned %d (%s), matched %d files (%s)",
 		s.scannedFiles.Load(), humanize.IBytes(uint64(s.scannedBytes.Load())),
-		s.matchedFiles.Load(), humanize.IBytes(uint64(s.matchedBytes.Load())),
-		time.Since(s.startTime).Seconds())
+		s.matchedFiles.Load(), humanize.IBytes(uint64(s.matchedBytes.Load())))
+	var skipped []string
+	if n := s.smallFiles.Load(); n > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d too small (%s)", n, humanize.IBytes(uint64(s.smallBytes.Load()))))
+	}
+	if n := s.excludedFiles.Load(); n > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d excluded (%s)", n, humanize.IBytes(uint64(s.excludedBytes.Load()))))
+	}
+	if n := s.symlinks.Load(); n > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d symlinks", n))
+	}
+	if n := s.special.Load(); n > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d special files", n))
+	}
+	if len(skipped) > 0 {
+		line += ", skipped " + strings.Join(skipped, ", ")
+	}
+	return line + fmt.Sprintf(" in %.1fs", time.Since(s.startTime).Seconds())
 }
 
 // Run executes the scan and returns matching files.
@@ -150,12 +218,20 @@ func (s *stats) String() string {
 // The buffered channel (1000) prevents walkers from blocking on slow collection,
 // while the WaitGroup ensures we don't close the channel prematurely.
 func (s *Scanner) Run() []*types.FileInfo {
+	return s.RunContext(context.Background())
+}
+
+// RunContext is Run that stops early when ctx is canceled: directories not
+// yet listed are skipped, and the files found so far are returned.
+func (s *Scanner) RunContext(ctx context.Context) []*types.FileInfo {
 	// Initialize runtime fields
+	s.ctx = ctx
 	s.walkerSem = types.NewSemaphore(s.workers)
-	s.bar = progress.New(s.showProgress, -1)
+	s.bar = progress.New(s.reporter, "scan")
 	s.stats = &stats{startTime: time.Now()}
 	s.bar.Describe(s.stats) // Render progress bar immediately
 	s.resultCh = make(chan *types.FileInfo, 1000) // Buffer smooths producer/consumer rates
+	s.reused = make(map[*types.FileInfo]bool)
 
 	// Collector goroutine: single consumer aggregates all walker outputs.
 	// Runs until resultCh is closed, then signals completion via collectorWg.
@@ -174,9 +250,12 @@ func (s *Scanner) Run() []*types.FileInfo {
 	for _, p := range s.paths {
 		absPath, err := filepath.Abs(p)
 		if err != nil {
-			s.sendError(err)
+			s.sendError(types.NewEvent(types.StageScan, p, err))
 			continue
 		}
+		if s.index != nil {
+			s.index.roots = append(s.index.roots, absPath)
+		}
 		s.walkDirectory(absPath)
 	}
 
@@ -185,10 +264,46 @@ func (s *Scanner) Run() []*types.FileInfo {
 	close(s.resultCh)   // Signal collector: no more items coming
 	collectorWg.Wait()  // Collector drained channel
 
+	results = s.refreshReused(results)
 	s.bar.Finish(s.stats)
 	return results
 }
 
+// Stats are the totals of a finished scan. Every scanned file is either
+// matched, excluded, or too small. Files inside excluded directories are not
+// counted, since those directories are not listed.
+type Stats struct {
+	ScannedFiles  int64 // Regular files found
+	ScannedBytes  int64
+	MatchedFiles  int64 // Files passing the size and exclude filters
+	MatchedBytes  int64
+	ExcludedFiles int64 // Files matching an exclude pattern
+	ExcludedBytes int64
+	SmallFiles    int64 // Files not excluded but below the minimum size
+	SmallBytes    int64
+	Symlinks      int64 // Symlinks skipped (not counted as scanned)
+	Special       int64 // Devices, FIFOs and sockets skipped (not counted as scanned)
+}
+
+// Stats returns the totals of the scan. Call it after Run; before, it is zero.
+func (s *Scanner) Stats() Stats {
+	if s.stats == nil {
+		return Stats{}
+	}
+	return Stats{
+		ScannedFiles: s.stats.scannedFiles.Load(),
+		ScannedBytes: s.stats.scannedBytes.Load(),
+		MatchedFiles: s.stats.matchedFiles.Load(),
+		MatchedBytes:  s.stats.matchedBytes.Load(),
+		ExcludedFiles: s.stats.excludedFiles.Load(),
+		ExcludedBytes: s.stats.excludedBytes.Load(),
+		SmallFiles:    s.stats.smallFiles.Load(),
+		SmallBytes:    s.stats.smallBytes.Load(),
+		Symlinks:      s.stats.symlinks.Load(),
+		Special:       s.stats.special.Load(),
+	}
+}
+
 // walkDirectory spawns a goroutine to process one directory and recursively spawn children.
 //
 // Semaphore pattern:
@@ -209,17 +324,31 @@ func (s *Scanner) walkDirectory(dir string) {
 		s.walkerSem.Acquire()
 		defer s.walkerSem.Release()
 
-		files, subdirs, err := s.listDirectory(dir)
+		if pause.Wait(s.ctx) != nil || s.ctx.Err() != nil {
+			return // Canceled: skip the rest of the tree
+		}
+
+		files, subdirs, other, err := s.listOrReuse(dir)
 		if err != nil {
-			s.sendError(err)
+			s.sendError(types.NewEvent(types.StageScan, dir, err))
 			return
 		}
 
 		// Process files: atomic stats + channel send (no locks needed)
+		s.stats.symlinks.Add(other.Symlinks)
+		s.stats.special.Add(other.Special)
+		minSize := s.minSizeOf(dir)
 		for _, f := range files {
 			s.stats.scannedFiles.Add(1)
 			s.stats.scannedBytes.Add(f.Size)
-			if f.Size >= s.minSize && !s.shouldExclude(f.Path) {
+			switch {
+			case s.shouldExclude(f.Path):
+				s.stats.excludedFiles.Add(1)
+				s.stats.excludedBytes.Add(f.Size)
+			case f.Size < minSize:
+				s.stats.smallFiles.Add(1)
+				s.stats.smallBytes.Add(f.Size)
+			default:
 				s.resultCh <- f // May block briefly if channel buffer full
 				s.stats.matchedFiles.Add(1)
 				s.stats.matchedBytes.Add(f.Size)
@@ -229,40 +358,45 @@ func (s *Scanner) walkDirectory(dir string) {
 
 		// Recursive fan-out: spawn walker for each subdirectory
 		for _, sub := range subdirs {
-			s.walkDirectory(sub)
+			if !s.shouldExclude(sub) {
+				s.walkDirectory(sub)
+			}
 		}
 	}()
 }
 
 // listDirectory reads a single directory, returning files and subdirectories.
 //
-// Uses batched ReadDir (1000 entries per batch) to handle large directories efficiently.
+// Uses batched ReadDir (readdirBatch entries per batch) to handle large directories efficiently;
+// on Linux, entries are read with 1 MiB getdents64 calls (see dirReader).
 // This is the ONLY place where directory I/O occurs - protected by walkerSem.
 //
 // Filtering:
 //   - Directories → subdirs (for recursive walking)
 //   - Regular files → files (with metadata via Info())
-//   - Symlinks, devices, etc. → skipped
-func (s *Scanner) listDirectory(dirPath string) (files []*types.FileInfo, subdirs []string, err error) {
+//   - Symlinks, devices, etc. → skipped, counted in other
+func (s *Scanner) listDirectory(dirPath string) (files []*types.FileInfo, subdirs []string, other nonRegular, err error) {
 	dir, err := os.Open(dirPath)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, other, err
 	}
 	defer func() { _ = dir.Close() }()
+	r := newDirReader(dir)
+	defer r.Close()
 
 	// Batch reading: ReadDir(n) returns up to n entries at a time.
 	// This bounds memory usage when listing directories with millions of files.
-	const batchSize = 1000
 	for {
-		entries, err := dir.ReadDir(batchSize)
+		entries, err := r.ReadDir(s.readdirBatch)
 		if len(entries) == 0 {
 			if err != nil && err != io.EOF {
-				return files, subdirs, err
+				return files, subdirs, other, err
 			}
 			break
 		}
 
 		for _, entry := range entries {
+			other.count(entry)
 			f, sub := s.processEntry(dirPath, entry)
 			if f != nil {
 				files = append(files, f)
@@ -273,18 +407,110 @@ func (s *Scanner) listDirectory(dirPath string) (files []*types.FileInfo, subdir
 		}
 	}
 
-	return files, subdirs, nil
+	return files, subdirs, other, nil
+}
+
+// nonRegular counts the directory entries that are neither directories nor
+// regular files.
+type nonRegular struct {
+	Symlinks int64
+	Special  int64 // Devices, FIFOs and sockets
+}
+
+// count adds entry to n if it is neither a directory nor a regular file.
+func (n *nonRegular) count(entry os.DirEntry) {
+	switch t := entry.Type(); {
+	case t&fs.ModeSymlink != 0:
+		n.Symlinks++
+	case !t.IsDir() && !t.IsRegular():
+		n.Special++
+	}
+}
+
+// listOrReuse returns the files and subdirectories of dir: from its index
+// record if the directory is unchanged since, else by listing it. Listings of
+// directories that last changed before the scan started (see racyWindow) are
+// recorded for the next scan.
+func (s *Scanner) listOrReuse(dir string) (files []*types.FileInfo, subdirs []string, other nonRegular, err error) {
+	if s.index == nil {
+		return s.listDirectory(dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, nil, other, err
+	}
+	modTime := info.ModTime().UnixNano()
+	nlink := uint64(info.Sys().(*syscall.Stat_t).Nlink) //nolint:unconvert // platform-dependent type
+
+	if rec, ok := s.index.lookup(dir, modTime, nlink); ok {
+		s.index.record(dir, rec)
+		files = make([]*types.FileInfo, len(rec.Files))
+		s.reusedMu.Lock()
+		for i := range rec.Files {
+			f := rec.Files[i]
+			files[i] = &f
+			s.reused[&f] = true
+		}
+		s.reusedMu.Unlock()
+		return files, rec.Subdirs, rec.Other, nil
+	}
+
+	files, subdirs, other, err = s.listDirectory(dir)
+	if err == nil && info.ModTime().Before(s.stats.startTime.Add(-racyWindow)) {
+		rec := dirRecord{ModTime: modTime, Nlink: nlink, Files: make([]types.FileInfo, len(files)), Subdirs: subdirs, Other: other}
+		for i, f := range files {
+			rec.Files[i] = *f
+		}
+		s.index.record(dir, rec)
+	}
+	return files, subdirs, other, err
+}
+
+// refreshReused stats again the files taken from index records and replaces
+// them with the fresh metadata, since changing a file in place does not touch
+// its directory. Files that vanished, are no longer regular files or no
+// longer pass the size filter are dropped.
+func (s *Scanner) refreshReused(results []*types.FileInfo) []*types.FileInfo {
+	if len(s.reused) == 0 {
+		return results
+	}
+
+	var wg sync.WaitGroup
+	sem := types.NewSemaphore(s.workers)
+	for i, f := range results {
+		if !s.reused[f] {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+			info, err := os.Lstat(f.Path)
+			if err != nil {
+				s.sendError(types.NewEvent(types.StageScan, f.Path, err))
+				results[i] = nil
+				return
+			}
+			fresh := newFileInfo(f.Path, info)
+			if !info.Mode().IsRegular() || fresh.Size < s.minSizeOf(filepath.Dir(f.Path)) {
+				results[i] = nil
+				return
+			}
+			results[i] = fresh
+		}()
+	}
+	wg.Wait()
+	return slices.DeleteFunc(results, func(f *types.FileInfo) bool { return f == nil })
 }
 
 // processEntry processes a single directory entry, returning a file or subdirectory path.
-// Returns (nil, "") for entries that should be skipped (symlinks, devices, excluded items).
+// Returns (nil, "") for entries that should be skipped (symlinks, devices, etc.).
+// Excludes are applied by the caller, so that index records hold full listings.
 func (s *Scanner) processEntry(dirPath string, entry os.DirEntry) (file *types.FileInfo, subdir string) {
 	fullPath := filepath.Join(dirPath, entry.Name())
 
 	if entry.IsDir() {
-		if s.shouldExclude(fullPath) {
-			return nil, ""
-		}
 		return nil, fullPath
 	}
 
@@ -302,23 +528,93 @@ func (s *Scanner) processEntry(dirPath string, entry os.DirEntry) (file *types.F
 	return newFileInfo(fullPath, info), ""
 }
 
-// sendError sends an error to the errors channel if it's not nil.
-func (s *Scanner) sendError(err error) {
+// minSizeOf returns the minimum file size for files directly inside dir:
+// the override for the longest path in minSizeFor containing dir, else minSize.
+func (s *Scanner) minSizeOf(dir string) int64 {
+	minSize, longest := s.minSize, -1
+	for path, size := range s.minSizeFor {
+		if len(path) > longest && (dir == path || strings.HasPrefix(dir, strings.TrimSuffix(path, "/")+"/")) {
+			minSize, longest = size, len(path)
+		}
+	}
+	return minSize
+}
+
+// sendError sends an event to the errors channel if it's not nil.
+func (s *Scanner) sendError(e *types.Event) {
 	if s.errCh != nil {
-		s.errCh <- err
+		s.errCh <- e
 	}
 }
 
 // shouldExclude checks if a path matches any glob exclude pattern.
+//
+// Patterns without "/" are matched against the basename. Patterns with "/" are
+// matched against as many trailing path components as the pattern has, so
+// ".zfs/snapshot" excludes only a "snapshot" directory directly inside ".zfs".
 func (s *Scanner) shouldExclude(path string) bool {
-	if len(s.excludes) == 0 {
-		return false
-	}
+	_, excluded := s.excludedBy(path)
+	return excluded
+}
+
+// excludedBy returns the first exclude pattern matching path.
+func (s *Scanner) excludedBy(path string) (pattern string, excluded bool) {
+	path = s.normalize.Apply(path)
 	base := filepath.Base(path)
 	for _, pattern := range s.excludes {
-		if matched, _ := filepath.Match(pattern, base); matched {
-			return true
+		name := base
+		if strings.Contains(pattern, "/") {
+			name = trailingComponents(path, strings.Count(pattern, "/")+1)
 		}
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// Explain returns why a scan skips the file at path (absolute), or "" if the
+// scan would return it. Used by --explain to trace files that were never scanned.
+func (s *Scanner) Explain(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err.Error()
+	}
+	if !info.Mode().IsRegular() {
+		return "not a regular file (symlinks, devices and sockets are skipped)"
+	}
+
+	root := ""
+	for _, p := range s.paths {
+		if strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") && len(p) > len(root) {
+			root = p
+		}
+	}
+	if root == "" {
+		return "outside the scanned paths"
+	}
+
+	// Excluded directories are not descended into, so check every component below the root
+	rel := strings.TrimPrefix(path, strings.TrimSuffix(root, "/")+"/")
+	dir := strings.TrimSuffix(root, "/")
+	for _, name := range strings.Split(rel, "/") {
+		dir += "/" + name
+		if pattern, excluded := s.excludedBy(dir); excluded {
+			return fmt.Sprintf("%s matches --exclude %q", dir, pattern)
+		}
+	}
+
+	if minSize := s.minSizeOf(filepath.Dir(path)); info.Size() < minSize {
+		return fmt.Sprintf("size %d is below the minimum size %d", info.Size(), minSize)
+	}
+	return ""
+}
+
+// trailingComponents returns the last n "/"-separated components of path.
+func trailingComponents(path string, n int) string {
+	i := len(path)
+	for ; n > 0 && i >= 0; n-- {
+		i = strings.LastIndexByte(path[:i], '/')
 	}
-	return false
+	return path[i+1:]
 }
@@ -3,10 +3,15 @@
 package scanner
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
+
+	"github.com/ivoronin/dupedog/internal/pathnorm"
+	"github.com/ivoronin/dupedog/internal/types"
 )
 
 // =============================================================================
@@ -26,7 +31,7 @@ func TestInvalidGlobPatternUnclosedBracket(t *testing.T) {
 
 	// Run scanner with invalid pattern
 	// Scanner tolerates invalid patterns (no exclusion applied) since CLI validates upfront
-	s := New([]string{root}, 0, []string{"[invalid"}, 2, false, nil)
+	s := New([]string{root}, Options{Excludes: []string{"[invalid"}, Workers: 2}, nil)
 	files := s.Run()
 
 	// Both files should be returned since invalid pattern doesn't match anything
@@ -44,7 +49,7 @@ func TestInvalidGlobPatternTripleAsterisk(t *testing.T) {
 	createFile(t, filepath.Join(root, "file.txt"), 100)
 
 	// *** matches everything, so file should be excluded
-	s := New([]string{root}, 0, []string{"***"}, 2, false, nil)
+	s := New([]string{root}, Options{Excludes: []string{"***"}, Workers: 2}, nil)
 	files := s.Run()
 
 	if len(files) != 0 {
@@ -68,7 +73,7 @@ func TestListDirectoryBasic(t *testing.T) {
 	}
 	createFile(t, filepath.Join(root, "subdir", "file3.txt"), 300)
 
-	s := New([]string{root}, 0, nil, 2, false, nil)
+	s := New([]string{root}, Options{Workers: 2}, nil)
 	files := s.Run()
 
 	if len(files) != 3 {
@@ -97,21 +102,21 @@ func TestSizeFilteringZeroBytes(t *testing.T) {
 	createFile(t, filepath.Join(root, "normal.txt"), 100)
 
 	// Test with minSize=0 (include all)
-	s := New([]string{root}, 0, nil, 2, false, nil)
+	s := New([]string{root}, Options{Workers: 2}, nil)
 	files := s.Run()
 	if len(files) != 3 {
 		t.Errorf("minSize=0: expected 3 files, got %d", len(files))
 	}
 
 	// Test with minSize=1 (exclude zero-byte)
-	s = New([]string{root}, 1, nil, 2, false, nil)
+	s = New([]string{root}, Options{MinSize: 1, Workers: 2}, nil)
 	files = s.Run()
 	if len(files) != 2 {
 		t.Errorf("minSize=1: expected 2 files, got %d", len(files))
 	}
 
 	// Test with minSize=100 (only normal.txt)
-	s = New([]string{root}, 100, nil, 2, false, nil)
+	s = New([]string{root}, Options{MinSize: 100, Workers: 2}, nil)
 	files = s.Run()
 	if len(files) != 1 {
 		t.Errorf("minSize=100: expected 1 file, got %d", len(files))
@@ -128,13 +133,47 @@ func TestSizeFilteringBoundaryValues(t *testing.T) {
 	createFile(t, filepath.Join(root, "size101.txt"), 101)
 
 	// minSize=100 should include 100 and 101
-	s := New([]string{root}, 100, nil, 2, false, nil)
+	s := New([]string{root}, Options{MinSize: 100, Workers: 2}, nil)
 	files := s.Run()
 	if len(files) != 2 {
 		t.Errorf("expected 2 files (>=100), got %d", len(files))
 	}
 }
 
+// TestSizeFilteringPerPath tests that per-path overrides replace the global minSize,
+// with the longest matching path winning.
+func TestSizeFilteringPerPath(t *testing.T) {
+	root := t.TempDir()
+
+	createFile(t, filepath.Join(root, "mail", "msg.eml"), 10)
+	createFile(t, filepath.Join(root, "photos", "small.jpg"), 10)
+	createFile(t, filepath.Join(root, "photos", "big.jpg"), 1000)
+	createFile(t, filepath.Join(root, "photos", "raw", "small.cr2"), 10)
+	createFile(t, filepath.Join(root, "photosets", "small.jpg"), 10)
+
+	minSizeFor := map[string]int64{
+		filepath.Join(root, "photos"):        100,
+		filepath.Join(root, "photos", "raw"): 1,
+	}
+	s := New([]string{root}, Options{MinSize: 1, MinSizeFor: minSizeFor, Workers: 2}, nil)
+	files := s.Run()
+
+	got := make(map[string]bool)
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f.Path)
+		got[rel] = true
+	}
+	want := []string{"mail/msg.eml", "photos/big.jpg", "photos/raw/small.cr2", "photosets/small.jpg"}
+	if len(got) != len(want) {
+		t.Errorf("expected %d files, got %d: %v", len(want), len(got), got)
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("expected %s to match", w)
+		}
+	}
+}
+
 // TestGlobPatternExclusion tests that glob patterns correctly exclude files.
 func TestGlobPatternExclusion(t *testing.T) {
 	root := t.TempDir()
@@ -144,7 +183,7 @@ func TestGlobPatternExclusion(t *testing.T) {
 	createFile(t, filepath.Join(root, "exclude.bak"), 100)
 
 	// Exclude *.tmp and *.bak
-	s := New([]string{root}, 0, []string{"*.tmp", "*.bak"}, 2, false, nil)
+	s := New([]string{root}, Options{Excludes: []string{"*.tmp", "*.bak"}, Workers: 2}, nil)
 	files := s.Run()
 
 	if len(files) != 1 {
@@ -155,6 +194,28 @@ func TestGlobPatternExclusion(t *testing.T) {
 	}
 }
 
+// TestExclusionNormalize tests that exclude patterns match names written in
+// another Unicode form only with Normalize.
+func TestExclusionNormalize(t *testing.T) {
+	root := t.TempDir()
+	createFile(t, filepath.Join(root, "keep.txt"), 100)
+	createFile(t, filepath.Join(root, "cafe\u0301.txt"), 100) // NFD, as written by macOS
+
+	for _, tt := range []struct {
+		form pathnorm.Form
+		want int
+	}{
+		{pathnorm.None, 2},
+		{pathnorm.NFC, 1},
+		{pathnorm.NFD, 1},
+	} {
+		files := New([]string{root}, Options{Excludes: []string{"caf\u00e9.*"}, Normalize: tt.form, Workers: 2}, nil).Run()
+		if len(files) != tt.want {
+			t.Errorf("form %d: expected %d files, got %d", tt.form, tt.want, len(files))
+		}
+	}
+}
+
 // TestDirectoryExclusionGit tests that --exclude .git skips .git directories entirely.
 func TestDirectoryExclusionGit(t *testing.T) {
 	root := t.TempDir()
@@ -178,7 +239,7 @@ func TestDirectoryExclusionGit(t *testing.T) {
 	createFile(t, filepath.Join(objectsDir, "pack"), 200)
 
 	// Scan with --exclude .git
-	s := New([]string{root}, 0, []string{".git"}, 2, false, nil)
+	s := New([]string{root}, Options{Excludes: []string{".git"}, Workers: 2}, nil)
 	files := s.Run()
 
 	// Should only find main.go, not any .git files
@@ -211,8 +272,8 @@ func TestPermissionErrorHandling(t *testing.T) {
 	}
 	defer func() { _ = os.Chmod(unreadable, 0o755) }() // Cleanup
 
-	errCh := make(chan error, 10)
-	s := New([]string{root}, 0, nil, 2, false, errCh)
+	errCh := make(chan *types.Event, 10)
+	s := New([]string{root}, Options{Workers: 2}, errCh)
 	files := s.Run()
 	close(errCh)
 
@@ -243,7 +304,7 @@ func TestZeroBytesFilesHandling(t *testing.T) {
 	createFile(t, filepath.Join(root, "empty1.txt"), 0)
 	createFile(t, filepath.Join(root, "empty2.txt"), 0)
 
-	s := New([]string{root}, 0, nil, 2, false, nil)
+	s := New([]string{root}, Options{Workers: 2}, nil)
 	files := s.Run()
 
 	if len(files) != 2 {
@@ -279,7 +340,7 @@ func TestGlobPatternMatchesBasenameOnly(t *testing.T) {
 	createFile(t, filepath.Join(keepDir, "skipme"), 100)
 
 	// Pattern "skipme" excludes both directories AND files named "skipme"
-	s := New([]string{root}, 0, []string{"skipme"}, 2, false, nil)
+	s := New([]string{root}, Options{Excludes: []string{"skipme"}, Workers: 2}, nil)
 	files := s.Run()
 
 	// Only keepdir/keep.txt should be found
@@ -296,6 +357,50 @@ func TestGlobPatternMatchesBasenameOnly(t *testing.T) {
 	}
 }
 
+// TestGlobPatternWithSlashMatchesTrailingComponents verifies that patterns
+// containing "/" match trailing path components, as used by SnapshotExcludes.
+func TestGlobPatternWithSlashMatchesTrailingComponents(t *testing.T) {
+	root := t.TempDir()
+
+	createFile(t, filepath.Join(root, "live.txt"), 100)
+	createFile(t, filepath.Join(root, ".zfs", "snapshot", "daily", "live.txt"), 100)
+	createFile(t, filepath.Join(root, ".zfs", "shares", "share.txt"), 100)
+	createFile(t, filepath.Join(root, ".snapshot", "hourly.0", "live.txt"), 100)
+	createFile(t, filepath.Join(root, "photos", "snapshot", "pic.jpg"), 100)
+
+	s := New([]string{root}, Options{Excludes: SnapshotExcludes, Workers: 2}, nil)
+	files := s.Run()
+
+	got := make(map[string]bool)
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f.Path)
+		got[rel] = true
+	}
+	want := []string{"live.txt", ".zfs/shares/share.txt", "photos/snapshot/pic.jpg"}
+	if len(got) != len(want) {
+		t.Errorf("expected %d files, got %d: %v", len(want), len(got), got)
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("expected %s to be scanned", w)
+		}
+	}
+}
+
+// TestAbsolutePatternMatchesExactPath verifies that an absolute pattern, as
+// used for overlayfs layers, excludes exactly that directory.
+func TestAbsolutePatternMatchesExactPath(t *testing.T) {
+	root := t.TempDir()
+
+	createFile(t, filepath.Join(root, "layer", "a.txt"), 100)
+	createFile(t, filepath.Join(root, "other", "layer", "b.txt"), 100)
+
+	files := New([]string{root}, Options{Excludes: []string{filepath.Join(root, "layer")}, Workers: 2}, nil).Run()
+	if len(files) != 1 || files[0].Path != filepath.Join(root, "other", "layer", "b.txt") {
+		t.Errorf("expected only other/layer/b.txt to be scanned, got %v", files)
+	}
+}
+
 // TestPathIsFileNotDirectory tests scanner behavior when given a file path instead of directory.
 // Expected: returns 0 files and reports an error (file is not a directory).
 func TestPathIsFileNotDirectory(t *testing.T) {
@@ -303,8 +408,8 @@ func TestPathIsFileNotDirectory(t *testing.T) {
 	filePath := filepath.Join(root, "file.txt")
 	createFile(t, filePath, 100)
 
-	errCh := make(chan error, 10)
-	s := New([]string{filePath}, 0, nil, 2, false, errCh)
+	errCh := make(chan *types.Event, 10)
+	s := New([]string{filePath}, Options{Workers: 2}, errCh)
 	files := s.Run()
 	close(errCh)
 
@@ -328,8 +433,8 @@ func TestNonExistentPathHandling(t *testing.T) {
 	root := t.TempDir()
 	nonExistent := filepath.Join(root, "does-not-exist")
 
-	errCh := make(chan error, 10)
-	s := New([]string{nonExistent}, 0, nil, 2, false, errCh)
+	errCh := make(chan *types.Event, 10)
+	s := New([]string{nonExistent}, Options{Workers: 2}, errCh)
 	files := s.Run()
 	close(errCh)
 
@@ -338,8 +443,11 @@ func TestNonExistentPathHandling(t *testing.T) {
 	}
 
 	var errCount int
-	for range errCh {
+	for e := range errCh {
 		errCount++
+		if e.Stage != types.StageScan || e.Reason != types.ReasonNotFound || e.Path != nonExistent {
+			t.Errorf("event = {%s %s %s}, want {scan notfound %s}", e.Stage, e.Reason, e.Path, nonExistent)
+		}
 	}
 	if errCount == 0 {
 		t.Error("expected error for non-existent path")
@@ -360,7 +468,7 @@ func TestOverlappingPaths(t *testing.T) {
 	createFile(t, filepath.Join(subdir, "file2.txt"), 100)
 
 	// Scan both root and subdir (overlapping)
-	s := New([]string{root, subdir}, 0, nil, 2, false, nil)
+	s := New([]string{root, subdir}, Options{Workers: 2}, nil)
 	files := s.Run()
 
 	// file2.txt will be scanned twice - once from root, once from subdir
@@ -386,7 +494,7 @@ func TestDuplicatePaths(t *testing.T) {
 	createFile(t, filepath.Join(root, "file.txt"), 100)
 
 	// Scan same path twice
-	s := New([]string{root, root}, 0, nil, 2, false, nil)
+	s := New([]string{root, root}, Options{Workers: 2}, nil)
 	files := s.Run()
 
 	// Expected: 2 file entries (same file scanned twice)
@@ -415,7 +523,7 @@ func TestNonRegularFilesSkipped(t *testing.T) {
 		t.Logf("Skipping FIFO test: %v", err)
 	}
 
-	s := New([]string{root}, 0, nil, 2, false, nil)
+	s := New([]string{root}, Options{Workers: 2}, nil)
 	files := s.Run()
 
 	// Should only find regular file
@@ -427,6 +535,59 @@ func TestNonRegularFilesSkipped(t *testing.T) {
 	}
 }
 
+// TestStatsSkipped tests that files are counted by why they were skipped.
+func TestStatsSkipped(t *testing.T) {
+	root := t.TempDir()
+	createFile(t, filepath.Join(root, "match.bin"), 100)
+	createFile(t, filepath.Join(root, "small.bin"), 10)
+	createFile(t, filepath.Join(root, "skip.tmp"), 200)
+	createFile(t, filepath.Join(root, "tiny.tmp"), 5) // Excluded, though also too small
+	if err := os.Symlink("match.bin", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(root, "fifo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "cache"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, filepath.Join(root, "cache", "inside.bin"), 100) // Not listed
+
+	age(t, root)
+
+	// Plain, recording the directory in an index, then reusing the record
+	indexPath := filepath.Join(t.TempDir(), "dirs.idx")
+	for run, incremental := range []bool{false, true, true} {
+		var index *Index
+		if incremental {
+			var err error
+			if index, err = LoadIndex(indexPath); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s := New([]string{root}, Options{MinSize: 50, Excludes: []string{"*.tmp", "cache"}, Workers: 2, Index: index}, nil)
+		s.Run()
+		if index != nil {
+			if err := index.Save(indexPath); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := Stats{
+			ScannedFiles: 4, ScannedBytes: 315,
+			MatchedFiles: 1, MatchedBytes: 100,
+			ExcludedFiles: 2, ExcludedBytes: 205,
+			SmallFiles: 1, SmallBytes: 10,
+			Symlinks: 1, Special: 1,
+		}
+		if got := s.Stats(); got != want {
+			t.Errorf("run %d: Stats() = %+v, want %+v", run, got, want)
+		}
+		if got, want := s.stats.String(), ", skipped 1 too small (10 B), 2 excluded (205 B), 1 symlinks, 1 special files in "; !strings.Contains(got, want) {
+			t.Errorf("run %d: stats line = %q, want it to contain %q", run, got, want)
+		}
+	}
+}
+
 // TestFilenamesWithSpecialChars tests files with special characters in names.
 func TestFilenamesWithSpecialChars(t *testing.T) {
 	root := t.TempDir()
@@ -443,7 +604,7 @@ func TestFilenamesWithSpecialChars(t *testing.T) {
 		createFile(t, filepath.Join(root, name), 100)
 	}
 
-	s := New([]string{root}, 0, nil, 2, false, nil)
+	s := New([]string{root}, Options{Workers: 2}, nil)
 	files := s.Run()
 
 	if len(files) != len(specialNames) {
@@ -451,6 +612,72 @@ func TestFilenamesWithSpecialChars(t *testing.T) {
 	}
 }
 
+// TestReaddirBatch tests that small batches and multiple getdents calls list
+// every entry of a large directory exactly once.
+func TestReaddirBatch(t *testing.T) {
+	root := t.TempDir()
+	const n = 10000 // 100-byte names: about 1.2 MiB of dirents, more than one getdents64 buffer
+	for i := range n {
+		name := fmt.Sprintf("%0100d", i)
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createFile(t, filepath.Join(root, "sub", "nested"), 1)
+	if err := os.Symlink("sub", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := New([]string{root}, Options{Workers: 2, ReaddirBatch: 7}, nil).Run()
+	if len(files) != n+1 {
+		t.Fatalf("scanned %d files, want %d", len(files), n+1)
+	}
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if seen[f.Path] {
+			t.Errorf("%s listed twice", f.Path)
+		}
+		seen[f.Path] = true
+	}
+}
+
+// TestExplain tests the reasons a scan skips a file.
+func TestExplain(t *testing.T) {
+	root := t.TempDir()
+	createFile(t, filepath.Join(root, "big.bin"), 100)
+	createFile(t, filepath.Join(root, "small.bin"), 10)
+	createFile(t, filepath.Join(root, "node_modules", "dep", "big.bin"), 100)
+	createFile(t, filepath.Join(root, "notes.tmp"), 100)
+	if err := os.Symlink("big.bin", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "big.bin")
+	createFile(t, outside, 100)
+
+	s := New([]string{root}, Options{MinSize: 50, Excludes: []string{"node_modules", "*.tmp"}, Workers: 2}, nil)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(root, "big.bin"), ""},
+		{filepath.Join(root, "small.bin"), "size 10 is below the minimum size 50"},
+		{filepath.Join(root, "notes.tmp"), filepath.Join(root, "notes.tmp") + ` matches --exclude "*.tmp"`},
+		{filepath.Join(root, "node_modules", "dep", "big.bin"), filepath.Join(root, "node_modules") + ` matches --exclude "node_modules"`},
+		{filepath.Join(root, "link"), "not a regular file (symlinks, devices and sockets are skipped)"},
+		{outside, "outside the scanned paths"},
+	}
+	for _, tt := range tests {
+		if got := s.Explain(tt.path); got != tt.want {
+			t.Errorf("Explain(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if got := s.Explain(filepath.Join(root, "missing")); got == "" {
+		t.Error("Explain(missing) = \"\", want an error")
+	}
+}
+
 // =============================================================================
 // Helper Functions
 // =============================================================================
@@ -1,7 +1,9 @@
 package scanner
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"syscall"
 
 	"github.com/ivoronin/dupedog/internal/types"
@@ -17,5 +19,23 @@ func newFileInfo(path string, info os.FileInfo) *types.FileInfo {
 		Dev:     uint64(stat.Dev), //nolint:unconvert // platform-dependent type
 		Ino:     stat.Ino,
 		Nlink:   uint32(stat.Nlink),
+		Blocks:  stat.Blocks,
 	}
 }
+
+// Stat returns the FileInfo of a single regular file, as a scan would record it.
+// The path is made absolute, matching scanned paths (and path-keyed cache entries).
+func Stat(path string) (*types.FileInfo, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s: not a regular file", abs)
+	}
+	return newFileInfo(abs, info), nil
+}
@@ -0,0 +1,65 @@
+package screener
+
+import (
+	"path/filepath"
+
+	"github.com/ivoronin/dupedog/internal/pathnorm"
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// metadataKey identifies files that an rsync-style quick check considers equal.
+// Size is not part of the key: candidate groups already share it.
+type metadataKey struct {
+	mtime int64 // Modification time (ns since epoch)
+	name  string
+}
+
+// MatchMetadata treats sibling groups with equal size, mtime, and basename as
+// duplicates WITHOUT reading their content (like rsync's quick check).
+//
+// Each candidate group is split into parts of sibling groups sharing an
+// (mtime, basename) pair: every path of a sibling group counts, so hardlinks
+// under another name still match, and sibling groups matched through a common
+// one end up in the same part. Parts with 2+ sibling groups become duplicate
+// groups. Content is never compared, so results carry no digest. The deduper's pre-link mtime
+// check still guards against files modified after the scan. Basenames are
+// compared in form norm, so copies named on macOS (NFD) match copies named on
+// Linux (NFC).
+func MatchMetadata(candidates types.CandidateGroups, norm pathnorm.Form) types.DuplicateGroups {
+	var duplicates []types.DuplicateGroup
+	for _, cg := range candidates.Items() {
+		items := cg.Items()
+		parent := make([]int, len(items)) // Union-find over sibling group indices
+		find := func(i int) int {
+			for parent[i] != i {
+				parent[i] = parent[parent[i]]
+				i = parent[i]
+			}
+			return i
+		}
+		firstWith := make(map[metadataKey]int)
+		for i, siblings := range items {
+			parent[i] = i
+			for _, f := range siblings.Items() {
+				key := metadataKey{mtime: f.ModTime.UnixNano(), name: norm.Apply(filepath.Base(f.Path))}
+				if j, ok := firstWith[key]; ok {
+					parent[find(i)] = find(j)
+				} else {
+					firstWith[key] = i
+				}
+			}
+		}
+
+		parts := make(map[int][]types.SiblingGroup)
+		for i, siblings := range items {
+			root := find(i)
+			parts[root] = append(parts[root], siblings)
+		}
+		for _, siblings := range parts {
+			if len(siblings) >= 2 {
+				duplicates = append(duplicates, types.NewDuplicateGroup(siblings))
+			}
+		}
+	}
+	return types.NewDuplicateGroups(duplicates)
+}
@@ -41,23 +41,28 @@ import (
 type Screener struct {
 	// Config (immutable, set by New)
 	files                 []*types.FileInfo // Files to screen for duplicates
-	showProgress          bool              // Whether to display progress bar
+	reporter              progress.Reporter // Receives progress (nil = none)
 	trustDeviceBoundaries bool              // If true, use (dev,ino); if false, use ino only
 }
 
-// New creates a Screener for finding duplicate candidates.
-//
-// The trustDeviceBoundaries parameter controls how files are grouped:
-//   - false (default): Group by inode only. Safe for NFS where same file
-//     can appear with different device IDs across mount points.
-//   - true: Group by (device, inode). Assumes each device has independent
-//     inode spaces. WARNING: Unsafe if the same filesystem is mounted at
-//     multiple paths (e.g., NFS mounted twice).
-func New(files []*types.FileInfo, showProgress, trustDeviceBoundaries bool) *Screener {
+// Options configures a Screener.
+type Options struct {
+	// TrustDeviceBoundaries controls how files are grouped:
+	//   - false (default): Group by inode only. Safe for NFS where same file
+	//     can appear with different device IDs across mount points.
+	//   - true: Group by (device, inode). Assumes each device has independent
+	//     inode spaces. WARNING: Unsafe if the same filesystem is mounted at
+	//     multiple paths (e.g., NFS mounted twice).
+	TrustDeviceBoundaries bool
+	Reporter              progress.Reporter // Receives progress (nil = none)
+}
+
+// New creates a Screener for finding duplicate candidates among files.
+func New(files []*types.FileInfo, opts Options) *Screener {
 	return &Screener{
 		files:                 files,
-		showProgress:          showProgress,
-		trustDeviceBoundaries: trustDeviceBoundaries,
+		reporter:              opts.Reporter,
+		trustDeviceBoundaries: opts.TrustDeviceBoundaries,
 	}
 }
 
@@ -68,6 +73,11 @@ type stats struct {
 	startTime      time.Time
 }
 
+// Counts implements progress.Counter: candidate files and their bytes.
+func (s *stats) Counts() (items, bytes int64) {
+	return int64(s.candidateFiles), s.candidateBytes
+}
+
 func (s *stats) String() string {
 	return fmt.Sprintf("Selected %d candidates (%s) in %.1fs",
 		s.candidateFiles, humanize.IBytes(uint64(s.candidateBytes)),
@@ -87,7 +97,7 @@ type devIno struct {
 //  2. Group by inode (or dev+ino if trustDeviceBoundaries) into sibling groups
 //  3. Filter to groups with 2+ unique inodes (potential duplicates)
 func (s *Screener) Run() types.CandidateGroups {
-	bar := progress.New(s.showProgress, -1)
+	bar := progress.New(s.reporter, "screen")
 	st := &stats{startTime: time.Now()}
 
 	// Group files by size
@@ -4,7 +4,9 @@ package screener
 
 import (
 	"testing"
+	"time"
 
+	"github.com/ivoronin/dupedog/internal/pathnorm"
 	"github.com/ivoronin/dupedog/internal/types"
 )
 
@@ -68,7 +70,7 @@ func TestScreenerSizeGrouping(t *testing.T) {
 		{Path: "/c.txt", Size: 200, Dev: 1, Ino: 3}, // Different size
 	}
 
-	s := New(files, false, false)
+	s := New(files, Options{})
 	candidates := s.Run()
 
 	// Only size=100 group has 2+ inodes
@@ -85,7 +87,7 @@ func TestScreenerSingleInodeFiltered(t *testing.T) {
 		{Path: "/b.txt", Size: 100, Dev: 1, Ino: 1}, // same inode
 	}
 
-	s := New(files, false, false)
+	s := New(files, Options{})
 	candidates := s.Run()
 
 	// Single inode = no potential duplicates
@@ -100,7 +102,7 @@ func TestScreenerSingleInodeFiltered(t *testing.T) {
 
 // TestScreenerEmptyInput tests behavior with empty input.
 func TestScreenerEmptyInput(t *testing.T) {
-	s := New([]*types.FileInfo{}, false, false)
+	s := New([]*types.FileInfo{}, Options{})
 	candidates := s.Run()
 
 	if candidates.Len() != 0 {
@@ -116,7 +118,7 @@ func TestScreenerAllUniqueSizes(t *testing.T) {
 		{Path: "/c.txt", Size: 300, Dev: 1, Ino: 3},
 	}
 
-	s := New(files, false, false)
+	s := New(files, Options{})
 	candidates := s.Run()
 
 	// All unique sizes = no duplicates possible
@@ -134,7 +136,7 @@ func TestScreenerAllSameInode(t *testing.T) {
 		{Path: "/c.txt", Size: 100, Dev: 1, Ino: 1},
 	}
 
-	s := New(files, false, false)
+	s := New(files, Options{})
 	candidates := s.Run()
 
 	// Single inode = already deduplicated
@@ -171,7 +173,7 @@ func TestScreenerCrossDeviceSameInode(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := New(files, false, tt.trustDeviceBoundaries)
+			s := New(files, Options{TrustDeviceBoundaries: tt.trustDeviceBoundaries})
 			candidates := s.Run()
 
 			if candidates.Len() != tt.wantCandidates {
@@ -192,7 +194,7 @@ func TestScreenerMixedHardlinksAndDuplicates(t *testing.T) {
 		{Path: "/e.txt", Size: 100, Dev: 1, Ino: 3},
 	}
 
-	s := New(files, false, false)
+	s := New(files, Options{})
 	candidates := s.Run()
 
 	// 3 unique inodes, all size 100 = 1 candidate group
@@ -215,7 +217,7 @@ func TestScreenerPreservesAllPaths(t *testing.T) {
 		{Path: "/d.txt", Size: 100, Dev: 1, Ino: 2},
 	}
 
-	s := New(files, false, false)
+	s := New(files, Options{})
 	candidates := s.Run()
 
 	if candidates.Len() != 1 {
@@ -247,7 +249,7 @@ func TestScreenerLargeSizeGroup(t *testing.T) {
 		})
 	}
 
-	s := New(files, false, false)
+	s := New(files, Options{})
 	candidates := s.Run()
 
 	if candidates.Len() != 1 {
@@ -258,3 +260,70 @@ func TestScreenerLargeSizeGroup(t *testing.T) {
 		t.Errorf("expected 100 sibling groups, got %d", candidates.First().Len())
 	}
 }
+
+// =============================================================================
+// Section 4.3: Metadata Matching (--trust-metadata)
+// =============================================================================
+
+// TestMatchMetadata tests that only equal mtime + basename pairs are matched.
+func TestMatchMetadata(t *testing.T) {
+	t1 := time.Unix(1700000000, 0)
+	t2 := t1.Add(time.Second)
+	files := []*types.FileInfo{
+		{Path: "/mirror1/a.iso", Size: 100, Ino: 1, ModTime: t1},
+		{Path: "/mirror2/a.iso", Size: 100, Ino: 2, ModTime: t1},
+		{Path: "/mirror3/a.iso", Size: 100, Ino: 3, ModTime: t2}, // Different mtime
+		{Path: "/mirror1/b.iso", Size: 100, Ino: 4, ModTime: t1}, // Different name
+	}
+
+	duplicates := MatchMetadata(New(files, Options{}).Run(), pathnorm.None)
+
+	if duplicates.Len() != 1 {
+		t.Fatalf("expected 1 duplicate group, got %d", duplicates.Len())
+	}
+	group := duplicates.First()
+	if group.Len() != 2 || group.Items()[0].First().Ino != 1 || group.Items()[1].First().Ino != 2 {
+		t.Errorf("expected mirror1/a.iso and mirror2/a.iso, got %d sibling groups", group.Len())
+	}
+}
+
+// TestMatchMetadataAllPaths tests that every path of a sibling group is
+// compared, not only the first.
+func TestMatchMetadataAllPaths(t *testing.T) {
+	t1 := time.Unix(1700000000, 0)
+	files := []*types.FileInfo{
+		{Path: "/mirror1/a.iso", Size: 100, Ino: 1, ModTime: t1},
+		{Path: "/mirror1/z.iso", Size: 100, Ino: 1, ModTime: t1}, // Hardlink of a.iso
+		{Path: "/mirror2/z.iso", Size: 100, Ino: 2, ModTime: t1}, // Matches only the hardlink
+		{Path: "/mirror3/c.iso", Size: 100, Ino: 3, ModTime: t1},
+	}
+
+	duplicates := MatchMetadata(New(files, Options{}).Run(), pathnorm.None)
+
+	if duplicates.Len() != 1 || duplicates.First().Len() != 2 {
+		t.Fatalf("expected 1 duplicate group of 2 sibling groups, got %d groups", duplicates.Len())
+	}
+	if group := duplicates.First(); group.Items()[0].First().Ino != 1 || group.Items()[1].First().Ino != 2 {
+		t.Errorf("expected inodes 1 and 2, got %d and %d", group.Items()[0].First().Ino, group.Items()[1].First().Ino)
+	}
+}
+
+// TestMatchMetadataNormalize tests that basenames in different Unicode forms
+// match only when normalized.
+func TestMatchMetadataNormalize(t *testing.T) {
+	t1 := time.Unix(1700000000, 0)
+	files := []*types.FileInfo{
+		{Path: "/linux/caf\u00e9.iso", Size: 100, Ino: 1, ModTime: t1}, // NFC
+		{Path: "/mac/cafe\u0301.iso", Size: 100, Ino: 2, ModTime: t1},  // NFD
+	}
+	candidates := New(files, Options{}).Run()
+
+	if n := MatchMetadata(candidates, pathnorm.None).Len(); n != 0 {
+		t.Errorf("none: expected 0 duplicate groups, got %d", n)
+	}
+	for _, form := range []pathnorm.Form{pathnorm.NFC, pathnorm.NFD} {
+		if n := MatchMetadata(candidates, form).Len(); n != 1 {
+			t.Errorf("form %d: expected 1 duplicate group, got %d", form, n)
+		}
+	}
+}
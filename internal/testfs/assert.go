@@ -12,6 +12,7 @@ import "testing"
 //   - Files exist at all specified paths
 //   - Files in the same File entry share the same inode (hardlinks)
 //   - Files in different File entries have different inodes
+//   - Owner, permissions, and mtime match where the File specifies them
 //   - Symlinks point to the expected targets
 func AssertVolume(t *testing.T, expected Volume, actual ReapVolume) {
 	t.Helper()
@@ -25,12 +26,14 @@ func AssertVolume(t *testing.T, expected Volume, actual ReapVolume) {
 //   - All paths must exist
 //   - All paths must share the same inode (hardlinks)
 //   - Different File entries must have different inodes
+//   - UID, GID, Mode, and Mtime must match if set
 func AssertFiles(t *testing.T, expected []File, actual []ReapFile) {
 	t.Helper()
 
 	pathToInode := buildPathToInodeMap(actual)
 	entryInodes := verifyFileEntries(t, expected, pathToInode)
 	verifyUniqueInodes(t, expected, entryInodes)
+	verifyMetadata(t, expected, actual)
 }
 
 // AssertSymlinks verifies expected symlinks exist with correct targets.
@@ -115,6 +118,41 @@ func verifyFileEntry(t *testing.T, ef File, pathToInode map[string]uint64) (uint
 	return firstInode, true
 }
 
+// verifyMetadata checks the owner, permissions, and mtime of each File entry
+// that specifies them, using its first path.
+func verifyMetadata(t *testing.T, expected []File, actual []ReapFile) {
+	t.Helper()
+
+	pathToFile := make(map[string]ReapFile)
+	for _, rf := range actual {
+		for _, p := range rf.Path {
+			pathToFile[p] = rf
+		}
+	}
+
+	for _, ef := range expected {
+		if len(ef.Path) == 0 {
+			continue
+		}
+		rf, ok := pathToFile[ef.Path[0]]
+		if !ok {
+			continue // Reported by verifyFileEntries
+		}
+		if ef.UID != nil && *ef.UID != rf.UID {
+			t.Errorf("%s: got uid %d, want %d", ef.Path[0], rf.UID, *ef.UID)
+		}
+		if ef.GID != nil && *ef.GID != rf.GID {
+			t.Errorf("%s: got gid %d, want %d", ef.Path[0], rf.GID, *ef.GID)
+		}
+		if ef.Mode != 0 && ef.Mode != rf.Mode {
+			t.Errorf("%s: got mode %v, want %v", ef.Path[0], rf.Mode, ef.Mode)
+		}
+		if !ef.Mtime.IsZero() && !ef.Mtime.Equal(rf.Mtime) {
+			t.Errorf("%s: got mtime %v, want %v", ef.Path[0], rf.Mtime, ef.Mtime)
+		}
+	}
+}
+
 // verifyUniqueInodes checks that different File entries have different inodes.
 func verifyUniqueInodes(t *testing.T, expected []File, entryInodes map[int]uint64) {
 	t.Helper()
@@ -0,0 +1,112 @@
+//go:build e2e
+
+package testfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// cliContainer - Docker-compatible CLI (podman, nerdctl, ...)
+// -----------------------------------------------------------------------------
+
+// cliContainer runs a container through a CLI that accepts Docker's run,
+// exec, and rm syntax.
+type cliContainer struct {
+	runtime     string // CLI name or path
+	containerID string
+}
+
+// newCLIContainer creates and starts a container with the given CLI.
+func newCLIContainer(ctx context.Context, runtime string, spec ContainerSpec) (*cliContainer, error) {
+	if _, err := exec.LookPath(runtime); err != nil {
+		return nil, fmt.Errorf("find %s runtime: %w", runtime, err)
+	}
+
+	args := []string{"run", "--detach", "--rm"}
+	if spec.Privileged {
+		args = append(args, "--privileged")
+	}
+
+	// Sort mount points so parents are mounted before children
+	mountPoints := make([]string, 0, len(spec.Tmpfs))
+	for mountPoint := range spec.Tmpfs {
+		mountPoints = append(mountPoints, mountPoint)
+	}
+	sort.Strings(mountPoints)
+	for _, mountPoint := range mountPoints {
+		args = append(args, "--tmpfs", mountPoint+":"+spec.Tmpfs[mountPoint])
+	}
+	for _, bind := range spec.Binds {
+		args = append(args, "--volume", bind)
+	}
+	args = append(args, spec.Image)
+	args = append(args, spec.Cmd...)
+
+	stdout, stderr, err := runCLI(ctx, runtime, args, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s run: %w: %s", runtime, err, stderr)
+	}
+
+	return &cliContainer{
+		runtime:     runtime,
+		containerID: strings.TrimSpace(stdout),
+	}, nil
+}
+
+// Run implements Container.
+func (c *cliContainer) Run(ctx context.Context, cmd []string, stdin []byte) (stdout, stderr string, exitCode int, err error) {
+	return c.RunAs(ctx, "", cmd, stdin)
+}
+
+// RunAs implements Container.
+func (c *cliContainer) RunAs(ctx context.Context, user string, cmd []string, stdin []byte) (stdout, stderr string, exitCode int, err error) {
+	args := []string{"exec"}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	if stdin != nil {
+		args = append(args, "--interactive")
+	}
+	args = append(args, c.containerID)
+	args = append(args, cmd...)
+
+	stdout, stderr, err = runCLI(ctx, c.runtime, args, stdin)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout, stderr, exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return "", "", 0, fmt.Errorf("%s exec: %w", c.runtime, err)
+	}
+	return stdout, stderr, 0, nil
+}
+
+// Close stops and removes the container.
+func (c *cliContainer) Close(ctx context.Context) error {
+	if c.containerID == "" {
+		return nil
+	}
+	if _, stderr, err := runCLI(ctx, c.runtime, []string{"rm", "--force", c.containerID}, nil); err != nil {
+		return fmt.Errorf("%s rm: %w: %s", c.runtime, err, stderr)
+	}
+	return nil
+}
+
+// runCLI runs the runtime CLI with args, feeding stdin if non-nil.
+func runCLI(ctx context.Context, runtime string, args []string, stdin []byte) (stdout, stderr string, err error) {
+	cmd := exec.CommandContext(ctx, runtime, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &outBuf, &errBuf
+	err = cmd.Run()
+	return outBuf.String(), errBuf.String(), err
+}
@@ -0,0 +1,108 @@
+package testfs
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path"
+)
+
+// -----------------------------------------------------------------------------
+// Generate - Random FileTree specs for property-based tests
+// -----------------------------------------------------------------------------
+
+// Generate returns a random but valid single-volume FileTree mounted at
+// mountPoint, determined entirely by seed.
+//
+// The tree is built from content clusters. Each cluster has one to four
+// copies of the same content, and each copy is a File with one to three
+// hardlinked paths in nested directories. Content mixes pattern, random, and
+// hole chunks of sizes around the verifier's block boundaries, and some
+// clusters are near-duplicates of another that differ in a single chunk, so
+// a pipeline that links them has a bug.
+//
+// Pair it with NewOracle to check the pipeline's safety invariants:
+//
+//	given := testfs.Generate(seed, "/data")
+//	h := testfs.New(t, given)
+//	oracle := testfs.NewOracle(t, h.Root(), given)
+//	// ... run pipeline
+//	oracle.Check()
+func Generate(seed uint64, mountPoint string) FileTree {
+	g := &generator{rng: rand.New(rand.NewPCG(seed, 0))} //nolint:gosec // deterministic test data
+
+	var contents [][]Chunk
+	vol := Volume{MountPoint: mountPoint}
+	for range 1 + g.rng.IntN(8) {
+		chunks := g.chunks()
+		if len(contents) > 0 && g.rng.IntN(3) == 0 {
+			chunks = g.mutate(contents[g.rng.IntN(len(contents))])
+		}
+		contents = append(contents, chunks)
+
+		for range 1 + g.rng.IntN(4) {
+			f := File{Chunks: chunks}
+			for range 1 + g.rng.IntN(3) {
+				f.Path = append(f.Path, g.path())
+			}
+			vol.Files = append(vol.Files, f)
+		}
+	}
+	return FileTree{Volumes: []Volume{vol}}
+}
+
+// generator holds the random source and a counter for unique file names.
+type generator struct {
+	rng   *rand.Rand
+	files int
+}
+
+// chunkSizes are chosen around small sizes and 1MiB, the verifier's head,
+// tail, and block size.
+var chunkSizes = []string{"1", "100", "4095", "4KiB", "64KiB", "1MiB", "1049000"}
+
+// chunks returns one to four random chunks.
+func (g *generator) chunks() []Chunk {
+	chunks := make([]Chunk, 1+g.rng.IntN(4))
+	for i := range chunks {
+		chunks[i] = g.chunk()
+	}
+	return chunks
+}
+
+// chunk returns a pattern, random, or hole chunk of a random size.
+func (g *generator) chunk() Chunk {
+	c := Chunk{Size: chunkSizes[g.rng.IntN(len(chunkSizes))]}
+	switch g.rng.IntN(4) {
+	case 0:
+		c.Hole = true
+	case 1:
+		c.Random, c.Seed = true, g.rng.Uint64N(4)
+	default:
+		c.Pattern = rune('A' + g.rng.IntN(4))
+	}
+	return c
+}
+
+// mutate returns a copy of chunks with one chunk replaced, producing a file
+// of the same or a different size that is not a duplicate (unless the new
+// chunk happens to have the same content, which the oracle accounts for).
+func (g *generator) mutate(chunks []Chunk) []Chunk {
+	mutated := append([]Chunk(nil), chunks...)
+	i := g.rng.IntN(len(mutated))
+	c := g.chunk()
+	if g.rng.IntN(2) == 0 {
+		c.Size = mutated[i].Size // Same size: must be told apart by content
+	}
+	mutated[i] = c
+	return mutated
+}
+
+// path returns a unique file path up to three directories deep.
+func (g *generator) path() string {
+	g.files++
+	dirs := make([]string, g.rng.IntN(4))
+	for i := range dirs {
+		dirs[i] = fmt.Sprintf("d%d", g.rng.IntN(3))
+	}
+	return path.Join(append(dirs, fmt.Sprintf("f%d.bin", g.files))...)
+}
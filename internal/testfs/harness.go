@@ -18,6 +18,7 @@ import (
 // Limitations:
 //   - Cannot test cross-device scenarios (EXDEV errors)
 //   - All "volumes" are directories on the same filesystem
+//   - Volume.FSType is not supported (the test is skipped)
 //   - Use E2E tests with Docker for cross-device testing
 //
 // Usage:
@@ -33,7 +34,7 @@ import (
 //	    },
 //	}
 //	h := testfs.New(t, given)
-//	files := scanner.New([]string{h.Root()}, minSize, nil, 2, false, nil).Run()
+//	files := scanner.New([]string{h.Root()}, scanner.Options{MinSize: minSize, Workers: 2}, nil).Run()
 //	// ... run pipeline
 //	h.Assert(then)
 type Harness struct {
@@ -53,6 +54,12 @@ type Harness struct {
 func New(t *testing.T, given FileTree) *Harness {
 	t.Helper()
 
+	for _, vol := range given.Volumes {
+		if vol.FSType != "" && vol.FSType != "tmpfs" {
+			t.Skipf("volume %s: %s images need the E2E harness", vol.MountPoint, vol.FSType)
+		}
+	}
+
 	root := t.TempDir()
 	h := &Harness{
 		t:     t,
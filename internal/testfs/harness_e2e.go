@@ -9,9 +9,8 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
-
-	"github.com/docker/docker/api/types/container"
 )
 
 // -----------------------------------------------------------------------------
@@ -19,21 +18,41 @@ import (
 // -----------------------------------------------------------------------------
 
 const (
-	// baseImage is the Docker image used for E2E tests.
-	baseImage = "alpine:3.21"
+	// baseImage is the image used for E2E tests.
+	baseImage = "docker.io/library/alpine:3.21"
 
 	// Binary names and paths inside container.
 	binaryName       = "dupedog"
 	helperBinaryName = "testfs-helper"
 	binaryPath       = "/tmp/" + binaryName
 	helperBinaryPath = "/tmp/" + helperBinaryName
+
+	// UnprivilegedUser runs dupedog without root in RunDupedogAs. It has no
+	// /etc/passwd entry, so HOME is "/" and it owns nothing unless fixtures
+	// give it files (File.UID, Dir.UID).
+	UnprivilegedUser = "1000:1000"
+
+	// imageSize is the size of each sparse filesystem image (xfs needs 300MiB).
+	imageSize = "512M"
+
+	// imagePackages provide mkfs for Volume.FSType (and cp --reflink).
+	imagePackages = "e2fsprogs xfsprogs btrfs-progs coreutils"
 )
 
+// mkfsCommands formats an image for each supported Volume.FSType.
+var mkfsCommands = map[string]string{
+	"ext4":  "mkfs.ext4 -q -F",
+	"xfs":   "mkfs.xfs -q -f",
+	"btrfs": "mkfs.btrfs -q -f",
+}
+
 // -----------------------------------------------------------------------------
 // Harness - Public API
 // -----------------------------------------------------------------------------
 
-// Harness provides E2E test infrastructure using Docker containers.
+// Harness provides E2E test infrastructure using containers: Docker by
+// default, or the Docker-compatible CLI named by DUPEDOG_E2E_RUNTIME
+// (e.g. podman).
 //
 // Usage:
 //
@@ -56,14 +75,15 @@ type Harness struct {
 	t          *testing.T
 	ctx        context.Context
 	given      FileTree
-	container  *Container
+	container  Container
 	lastResult *RunResult
 }
 
 // New creates a new Harness with the given FileTree specification.
 //
 // The harness:
-//  1. Starts a Docker container with tmpfs volumes for each Volume in the spec
+//  1. Starts a container with tmpfs volumes for each Volume in the spec
+//     (privileged, with loop-mounted images, if any Volume sets FSType)
 //  2. Bind-mounts pre-built dupedog binaries into the container
 //  3. Creates files, hardlinks, and symlinks according to the spec
 //
@@ -79,14 +99,14 @@ func New(t *testing.T, given FileTree) *Harness {
 		given: given,
 	}
 
-	// Build container config
-	cfg, hostCfg, err := h.buildContainerConfig()
+	// Build container spec
+	spec, err := h.buildContainerSpec()
 	if err != nil {
-		t.Fatalf("failed to build container config: %v", err)
+		t.Fatalf("failed to build container spec: %v", err)
 	}
 
 	// Create container
-	c, err := NewContainer(ctx, cfg, hostCfg)
+	c, err := NewContainer(ctx, spec)
 	if err != nil {
 		t.Fatalf("failed to create container: %v", err)
 	}
@@ -97,6 +117,13 @@ func New(t *testing.T, given FileTree) *Harness {
 		h.Cleanup()
 	})
 
+	// Mount filesystem images
+	if spec.Privileged {
+		if err := h.mountVolumes(); err != nil {
+			t.Fatalf("failed to mount volumes: %v", err)
+		}
+	}
+
 	// Setup files according to spec
 	if err := h.sowFileTree(); err != nil {
 		t.Fatalf("failed to setup files: %v", err)
@@ -115,9 +142,16 @@ func New(t *testing.T, given FileTree) *Harness {
 // The result (exit code, stdout, stderr) is stored for later assertion.
 func (h *Harness) RunDupedog(args ...string) *RunResult {
 	h.t.Helper()
+	return h.RunDupedogAs("", args...)
+}
+
+// RunDupedogAs is RunDupedog as the given user ("uid[:gid]", e.g.
+// UnprivilegedUser; "" = root), to exercise permission-denied paths.
+func (h *Harness) RunDupedogAs(user string, args ...string) *RunResult {
+	h.t.Helper()
 
 	cmd := append([]string{binaryPath}, args...)
-	stdout, stderr, exitCode, err := h.container.Run(h.ctx, cmd, nil)
+	stdout, stderr, exitCode, err := h.container.RunAs(h.ctx, user, cmd, nil)
 	if err != nil {
 		h.t.Fatalf("failed to run dupedog: %v", err)
 	}
@@ -130,6 +164,18 @@ func (h *Harness) RunDupedog(args ...string) *RunResult {
 	return h.lastResult
 }
 
+// Exec runs an arbitrary command inside the container, e.g. to prepare state
+// the FileTree cannot express. Fails the test if the command cannot be run.
+func (h *Harness) Exec(cmd ...string) *RunResult {
+	h.t.Helper()
+
+	stdout, stderr, exitCode, err := h.container.Run(h.ctx, cmd, nil)
+	if err != nil {
+		h.t.Fatalf("failed to run %v: %v", cmd, err)
+	}
+	return &RunResult{ExitCode: exitCode, Stdout: stdout, Stderr: stderr}
+}
+
 // Assert verifies the filesystem state matches the expected FileTree.
 //
 // Checks:
@@ -171,12 +217,12 @@ func (h *Harness) Cleanup() {
 // Container Configuration
 // -----------------------------------------------------------------------------
 
-// buildContainerConfig creates Docker container and host configs for E2E tests.
-func (h *Harness) buildContainerConfig() (*container.Config, *container.HostConfig, error) {
+// buildContainerSpec creates the container spec for E2E tests.
+func (h *Harness) buildContainerSpec() (ContainerSpec, error) {
 	// Get binary directory from environment
 	binDir := os.Getenv("DUPEDOG_E2E_BINDIR")
 	if binDir == "" {
-		return nil, nil, fmt.Errorf("DUPEDOG_E2E_BINDIR not set - run via 'make test-e2e'")
+		return ContainerSpec{}, fmt.Errorf("DUPEDOG_E2E_BINDIR not set - run via 'make test-e2e'")
 	}
 
 	// Extract mount paths from volumes
@@ -188,10 +234,14 @@ func (h *Harness) buildContainerConfig() (*container.Config, *container.HostConf
 	// Sort mount paths so parents come before children
 	sort.Strings(mountPaths)
 
-	// Build tmpfs mounts
+	// Build tmpfs mounts, unless images are needed: then every volume is
+	// mounted in order by mountVolumes, so tmpfs and images can nest
 	tmpfs := make(map[string]string)
-	for _, path := range mountPaths {
-		tmpfs[path] = "size=100m"
+	privileged := h.usesImages()
+	if !privileged {
+		for _, path := range mountPaths {
+			tmpfs[path] = "size=100m"
+		}
 	}
 
 	// Build bind mounts for binaries (read-only)
@@ -200,18 +250,60 @@ func (h *Harness) buildContainerConfig() (*container.Config, *container.HostConf
 		fmt.Sprintf("%s:%s:ro", filepath.Join(binDir, helperBinaryName), helperBinaryPath),
 	}
 
-	cfg := &container.Config{
-		Image: baseImage,
-		Cmd:   []string{"sleep", "infinity"},
+	return ContainerSpec{
+		Image:      baseImage,
+		Cmd:        []string{"sleep", "infinity"},
+		Tmpfs:      tmpfs,
+		Binds:      binds,
+		Privileged: privileged,
+	}, nil
+}
+
+// usesImages reports whether any volume is on a filesystem image.
+func (h *Harness) usesImages() bool {
+	for _, v := range h.given.Volumes {
+		if v.FSType != "" && v.FSType != "tmpfs" {
+			return true
+		}
 	}
+	return false
+}
 
-	hostCfg := &container.HostConfig{
-		Binds:      binds,
-		Tmpfs:      tmpfs,
-		AutoRemove: true,
+// mountVolumes installs mkfs tools and mounts every volume inside the
+// container, parents before children: tmpfs volumes directly, others as
+// loop-mounted images in /tmp.
+func (h *Harness) mountVolumes() error {
+	volumes := append([]Volume(nil), h.given.Volumes...)
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].MountPoint < volumes[j].MountPoint })
+
+	script := []string{"set -e", "apk add --no-cache -q " + imagePackages}
+	for i, v := range volumes {
+		script = append(script, "mkdir -p "+v.MountPoint)
+		if v.FSType == "" || v.FSType == "tmpfs" {
+			script = append(script, "mount -t tmpfs -o size=100m tmpfs "+v.MountPoint)
+			continue
+		}
+		mkfs, ok := mkfsCommands[v.FSType]
+		if !ok {
+			return fmt.Errorf("volume %s: unsupported filesystem %q", v.MountPoint, v.FSType)
+		}
+		image := fmt.Sprintf("/tmp/volume%d.img", i)
+		script = append(script,
+			"truncate -s "+imageSize+" "+image,
+			mkfs+" "+image,
+			"mount -o loop "+image+" "+v.MountPoint,
+		)
 	}
 
-	return cfg, hostCfg, nil
+	cmd := []string{"sh", "-c", strings.Join(script, "\n")}
+	stdout, stderr, exitCode, err := h.container.Run(h.ctx, cmd, nil)
+	if err != nil {
+		return fmt.Errorf("run mount script: %w", err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("mount script failed (exit %d): %s%s", exitCode, stdout, stderr)
+	}
+	return nil
 }
 
 // -----------------------------------------------------------------------------
@@ -3,10 +3,13 @@
 package testfs
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
 	"syscall"
 	"testing"
+	"time"
 )
 
 // TestSowCreatesFilesCorrectly verifies that SowFileTree creates files with correct sizes and content.
@@ -385,3 +388,268 @@ func TestFileTotalSize(t *testing.T) {
 		})
 	}
 }
+
+// TestSowRandomChunks verifies that Random chunks are deterministic per seed
+// and not uniform.
+func TestSowRandomChunks(t *testing.T) {
+	root := t.TempDir()
+
+	spec := FileTree{
+		Volumes: []Volume{
+			{
+				MountPoint: "/vol1",
+				Files: []File{
+					{Path: []string{"a.bin"}, Chunks: []Chunk{{Random: true, Seed: 1, Size: "3MiB"}}},
+					{Path: []string{"b.bin"}, Chunks: []Chunk{{Random: true, Seed: 1, Size: "3MiB"}}},
+					{Path: []string{"c.bin"}, Chunks: []Chunk{{Random: true, Seed: 2, Size: "3MiB"}}},
+					{Path: []string{"prefix.bin"}, Chunks: []Chunk{{Random: true, Seed: 1, Size: "1000"}, {Pattern: 'Z', Size: "10"}}},
+				},
+			},
+		},
+	}
+
+	if err := SowFileTree(root, spec); err != nil {
+		t.Fatalf("SowFileTree failed: %v", err)
+	}
+
+	read := func(name string) []byte {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(root, "vol1", name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		return content
+	}
+	a, b, c, prefix := read("a.bin"), read("b.bin"), read("c.bin"), read("prefix.bin")
+
+	if len(a) != 3<<20 {
+		t.Errorf("a.bin size: got %d, want %d", len(a), 3<<20)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("chunks with the same seed should have the same content")
+	}
+	if bytes.Equal(a, c) {
+		t.Error("chunks with different seeds should differ")
+	}
+	// The random stream continues across the 1MiB write buffer boundary.
+	if bytes.Equal(a[:1<<20], a[1<<20:2<<20]) {
+		t.Error("random content should not repeat every buffer")
+	}
+	if !bytes.Equal(prefix[:1000], a[:1000]) || !bytes.Equal(prefix[1000:], bytes.Repeat([]byte{'Z'}, 10)) {
+		t.Error("a shorter chunk should be a prefix of the same seed's stream")
+	}
+	if bytes.Count(a[:4096], a[:1]) == 4096 {
+		t.Error("random content should not be uniform")
+	}
+}
+
+// TestSowHoleChunks verifies that Hole chunks read as zeros and, where the
+// filesystem supports it, allocate no blocks.
+func TestSowHoleChunks(t *testing.T) {
+	root := t.TempDir()
+
+	spec := FileTree{
+		Volumes: []Volume{
+			{
+				MountPoint: "/vol1",
+				Files: []File{
+					{Path: []string{"sparse.bin"}, Chunks: []Chunk{
+						{Pattern: 'A', Size: "4KiB"},
+						{Hole: true, Size: "4MiB"},
+						{Pattern: 'B', Size: "4KiB"},
+						{Hole: true, Size: "1MiB"}, // Trailing hole extends the file
+					}},
+				},
+			},
+		},
+	}
+
+	if err := SowFileTree(root, spec); err != nil {
+		t.Fatalf("SowFileTree failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(root, "vol1", "sparse.bin"))
+	if err != nil {
+		t.Fatalf("failed to read sparse.bin: %v", err)
+	}
+	const want = 8<<10 + 5<<20
+	if len(content) != want {
+		t.Fatalf("sparse.bin size: got %d, want %d", len(content), want)
+	}
+	if content[0] != 'A' || content[4<<10+4<<20] != 'B' {
+		t.Error("data chunks should surround the hole")
+	}
+	if !bytes.Equal(content[4<<10:4<<10+4<<20], make([]byte, 4<<20)) || content[want-1] != 0 {
+		t.Error("holes should read as zeros")
+	}
+
+	reaped, err := ReapPaths(root, []string{"/vol1"})
+	if err != nil {
+		t.Fatalf("ReapPaths failed: %v", err)
+	}
+	rf := reaped.Volumes[0].Files[0]
+	if rf.Size != want {
+		t.Errorf("reaped size: got %d, want %d", rf.Size, want)
+	}
+	if rf.Allocated >= rf.Size {
+		t.Skipf("filesystem does not support holes (allocated %d of %d bytes)", rf.Allocated, rf.Size)
+	}
+	if rf.Allocated > 1<<20 {
+		t.Errorf("reaped allocated size: got %d, want at most the data chunks' blocks", rf.Allocated)
+	}
+}
+
+// TestSowMetadata verifies that owner, permissions, and mtime are applied by
+// SowFileTree and checked by Assert.
+func TestSowMetadata(t *testing.T) {
+	root := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	uid, gid := os.Getuid(), os.Getgid() // Chown to others needs root
+
+	spec := FileTree{
+		Volumes: []Volume{
+			{
+				MountPoint: "/vol1",
+				Files: []File{
+					{
+						Path:   []string{"a.txt", "link.txt"},
+						Chunks: []Chunk{{Pattern: 'A', Size: "100"}},
+						UID:    ID(uid), GID: ID(gid), Mode: 0o600, Mtime: mtime,
+					},
+				},
+			},
+		},
+	}
+
+	if err := SowFileTree(root, spec); err != nil {
+		t.Fatalf("SowFileTree failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(root, "vol1", "link.txt"))
+	if err != nil {
+		t.Fatalf("failed to stat link.txt: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode: got %v, want %v", info.Mode().Perm(), os.FileMode(0o600))
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("mtime: got %v, want %v", info.ModTime(), mtime)
+	}
+
+	h := &Harness{t: t, root: root, given: spec}
+	h.Assert(spec)
+
+	for name, wrong := range map[string]File{
+		"uid":   {Path: []string{"a.txt"}, UID: ID(uid + 1)},
+		"gid":   {Path: []string{"a.txt"}, GID: ID(gid + 1)},
+		"mode":  {Path: []string{"a.txt"}, Mode: 0o644},
+		"mtime": {Path: []string{"a.txt"}, Mtime: mtime.Add(time.Second)},
+	} {
+		mockT := &testing.T{}
+		mockH := &Harness{t: mockT, root: root, given: spec}
+		mockH.Assert(FileTree{Volumes: []Volume{{MountPoint: "/vol1", Files: []File{wrong}}}})
+		if !mockT.Failed() {
+			t.Errorf("Assert should have failed on a %s mismatch", name)
+		}
+	}
+}
+
+// TestGenerateDeterministic verifies that Generate depends only on its seed
+// and produces sowable trees.
+func TestGenerateDeterministic(t *testing.T) {
+	a, b := Generate(42, "/data"), Generate(42, "/data")
+	if !reflect.DeepEqual(a, b) {
+		t.Error("Generate should return the same tree for the same seed")
+	}
+	if reflect.DeepEqual(a, Generate(43, "/data")) {
+		t.Error("Generate should return different trees for different seeds")
+	}
+
+	if err := SowFileTree(t.TempDir(), a); err != nil {
+		t.Fatalf("SowFileTree failed: %v", err)
+	}
+}
+
+// TestOracleDetectsUnsafeLink verifies that the oracle fails when files with
+// different content are linked.
+func TestOracleDetectsUnsafeLink(t *testing.T) {
+	root := t.TempDir()
+	spec := FileTree{
+		Volumes: []Volume{
+			{
+				MountPoint: "/vol1",
+				Files: []File{
+					{Path: []string{"a.txt"}, Chunks: []Chunk{{Pattern: 'A', Size: "100"}}},
+					{Path: []string{"b.txt"}, Chunks: []Chunk{{Pattern: 'A', Size: "100"}}},
+					{Path: []string{"c.txt"}, Chunks: []Chunk{{Pattern: 'C', Size: "100"}}},
+				},
+			},
+		},
+	}
+	if err := SowFileTree(root, spec); err != nil {
+		t.Fatalf("SowFileTree failed: %v", err)
+	}
+
+	relink := func(source, target string) {
+		t.Helper()
+		dir := filepath.Join(root, "vol1")
+		if err := os.Remove(filepath.Join(dir, target)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Link(filepath.Join(dir, source), filepath.Join(dir, target)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Linking identical files is safe
+	oracle := NewOracle(t, root, spec)
+	relink("a.txt", "b.txt")
+	oracle.Check()
+
+	// Linking different files is not
+	mockT := &testing.T{}
+	oracle = NewOracle(mockT, root, spec)
+	relink("a.txt", "c.txt")
+	oracle.Check()
+	if !mockT.Failed() {
+		t.Error("Check should have failed when files with different content are linked")
+	}
+}
+
+// TestSowDirs verifies that Dirs set directory permissions after the
+// directory's files are created.
+func TestSowDirs(t *testing.T) {
+	root := t.TempDir()
+	spec := FileTree{
+		Volumes: []Volume{
+			{
+				MountPoint: "/vol1",
+				Files: []File{
+					{Path: []string{"locked/a.txt"}, Chunks: []Chunk{{Pattern: 'A', Size: "100"}}},
+				},
+				Dirs: []Dir{
+					{Path: "locked", UID: ID(os.Getuid()), Mode: 0o555},
+					{Path: "empty", Mode: 0o700},
+				},
+			},
+		},
+	}
+
+	if err := SowFileTree(root, spec); err != nil {
+		t.Fatalf("SowFileTree failed: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(root, "vol1", "locked"), 0o755) })
+
+	for dir, want := range map[string]os.FileMode{"locked": 0o555, "empty": 0o700} {
+		info, err := os.Stat(filepath.Join(root, "vol1", dir))
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", dir, err)
+		}
+		if !info.IsDir() || info.Mode().Perm() != want {
+			t.Errorf("%s: got %v, want directory with mode %v", dir, info.Mode(), want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "vol1", "locked", "a.txt")); err != nil {
+		t.Errorf("file in locked dir should exist: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build unix
+
+package testfs
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dustin/go-humanize"
+)
+
+// -----------------------------------------------------------------------------
+// Oracle - Safety invariants for property-based tests
+// -----------------------------------------------------------------------------
+
+// Oracle checks that a pipeline run over a sown FileTree was safe.
+//
+// Invariants checked by Check:
+//   - Every path still exists as a regular file with its original content
+//   - Paths that were hardlinked are still hardlinked
+//   - Paths sharing an inode have the same content
+//   - Allocated space did not grow (savings >= 0)
+type Oracle struct {
+	t         *testing.T
+	root      string
+	given     FileTree
+	digests   map[string][sha256.Size]byte // Expected content digest by "<mount point>/<path>"
+	allocated int64                        // Allocated bytes before the run
+}
+
+// NewOracle records the expected state of given, sown under root, before the
+// pipeline runs.
+func NewOracle(t *testing.T, root string, given FileTree) *Oracle {
+	t.Helper()
+
+	o := &Oracle{t: t, root: root, given: given, digests: make(map[string][sha256.Size]byte)}
+	for _, vol := range given.Volumes {
+		for _, f := range vol.Files {
+			digest, err := ContentDigest(f.Chunks)
+			if err != nil {
+				t.Fatalf("content digest of %v: %v", f.Path, err)
+			}
+			for _, p := range f.Path {
+				o.digests[filepath.Join(vol.MountPoint, p)] = digest
+			}
+		}
+	}
+	o.allocated = o.allocatedBytes()
+	return o
+}
+
+// Check verifies the invariants against the current filesystem state.
+func (o *Oracle) Check() {
+	o.t.Helper()
+
+	actual := o.reap()
+	for i, vol := range o.given.Volumes {
+		pathToInode := buildPathToInodeMap(actual.Volumes[i].Files)
+		for _, f := range vol.Files {
+			verifyFileEntry(o.t, f, pathToInode) // Exists, hardlinks kept
+		}
+		for _, rf := range actual.Volumes[i].Files {
+			o.checkInode(vol.MountPoint, rf)
+		}
+		for _, sym := range actual.Volumes[i].Symlinks {
+			o.t.Errorf("%s: replaced by a symlink to %s", filepath.Join(vol.MountPoint, sym.Path), sym.Target)
+		}
+	}
+
+	if after := o.allocatedBytes(); after > o.allocated {
+		o.t.Errorf("allocated space grew from %d to %d bytes", o.allocated, after)
+	}
+}
+
+// checkInode verifies that every path of an inode has the inode's content.
+func (o *Oracle) checkInode(mountPoint string, rf ReapFile) {
+	o.t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(o.root, mountPoint, rf.Path[0]))
+	if err != nil {
+		o.t.Errorf("read %s: %v", rf.Path[0], err)
+		return
+	}
+	digest := sha256.Sum256(content)
+	for _, p := range rf.Path {
+		logical := filepath.Join(mountPoint, p)
+		want, ok := o.digests[logical]
+		if !ok {
+			o.t.Errorf("%s: unexpected file", logical)
+			continue
+		}
+		if digest != want {
+			o.t.Errorf("%s: content changed (shares inode %d with %v)", logical, rf.Inode, rf.Path)
+		}
+	}
+}
+
+// reap captures the state of every given volume.
+func (o *Oracle) reap() *ReapResult {
+	o.t.Helper()
+
+	var mountPoints []string
+	for _, vol := range o.given.Volumes {
+		mountPoints = append(mountPoints, vol.MountPoint)
+	}
+	actual, err := ReapPaths(o.root, mountPoints)
+	if err != nil {
+		o.t.Fatalf("reap: %v", err)
+	}
+	return actual
+}
+
+// allocatedBytes sums the allocated size of every inode once.
+func (o *Oracle) allocatedBytes() int64 {
+	o.t.Helper()
+
+	var total int64
+	for _, vol := range o.reap().Volumes {
+		for _, rf := range vol.Files {
+			total += rf.Allocated
+		}
+	}
+	return total
+}
+
+// ContentDigest returns the SHA-256 of the content chunks describe, with
+// holes read as zeros.
+func ContentDigest(chunks []Chunk) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for _, c := range chunks {
+		size, err := humanize.ParseBytes(c.Size)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		if err := streamChunk(h, c, size); err != nil {
+			return [sha256.Size]byte{}, err
+		}
+	}
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest, nil
+}
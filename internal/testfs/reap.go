@@ -109,10 +109,15 @@ func reapPath(rootPath, logicalPath string) (ReapVolume, error) {
 			existing.Path = append(existing.Path, relPath)
 		} else {
 			rf := &ReapFile{
-				Path:  []string{relPath},
-				Inode: inode,
-				Nlink: nlink,
-				Size:  info.Size(),
+				Path:      []string{relPath},
+				Inode:     inode,
+				Nlink:     nlink,
+				Size:      info.Size(),
+				Allocated: int64(stat.Blocks) * 512, //nolint:unconvert // platform-dependent type
+				UID:       int(stat.Uid),
+				GID:       int(stat.Gid),
+				Mode:      info.Mode().Perm(),
+				Mtime:     info.ModTime(),
 			}
 			inodeToFile[inode] = rf
 		}
@@ -2,11 +2,14 @@ package testfs
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/dustin/go-humanize"
 )
@@ -53,7 +56,12 @@ func sowVolume(root string, vol Volume) error {
 		return err
 	}
 
-	return sowSymlinks(volPath, vol.Symlinks)
+	if err := sowSymlinks(volPath, vol.Symlinks); err != nil {
+		return err
+	}
+
+	// Last, so restrictive modes don't block creating entries inside
+	return sowDirs(volPath, vol.Dirs)
 }
 
 // resolveVolumePath determines the actual filesystem path for a volume.
@@ -85,6 +93,10 @@ func sowFile(volPath string, f File) error {
 		return fmt.Errorf("create %s: %w", firstPath, err)
 	}
 
+	if err := setMetadata(firstPath, f.UID, f.GID, f.Mode, f.Mtime); err != nil {
+		return fmt.Errorf("set metadata of %s: %w", firstPath, err)
+	}
+
 	for _, p := range f.Path[1:] {
 		linkPath := filepath.Join(volPath, p)
 		if err := createHardlink(firstPath, linkPath); err != nil {
@@ -94,6 +106,48 @@ func sowFile(volPath string, f File) error {
 	return nil
 }
 
+// sowDirs creates directories and applies their owner and permissions.
+func sowDirs(volPath string, dirs []Dir) error {
+	for _, d := range dirs {
+		dirPath := filepath.Join(volPath, d.Path)
+		if err := os.MkdirAll(dirPath, 0o755); err != nil {
+			return fmt.Errorf("create dir %s: %w", dirPath, err)
+		}
+		if err := setMetadata(dirPath, d.UID, d.GID, d.Mode, time.Time{}); err != nil {
+			return fmt.Errorf("set metadata of %s: %w", dirPath, err)
+		}
+	}
+	return nil
+}
+
+// setMetadata applies the owner, permissions, and mtime that are set.
+// The owner is changed first, since chown clears setuid/setgid bits.
+func setMetadata(path string, uid, gid *int, mode os.FileMode, mtime time.Time) error {
+	if uid != nil || gid != nil {
+		u, g := -1, -1
+		if uid != nil {
+			u = *uid
+		}
+		if gid != nil {
+			g = *gid
+		}
+		if err := os.Chown(path, u, g); err != nil {
+			return err
+		}
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if !mtime.IsZero() {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // writeChunkedFile streams content directly to disk.
 // Efficiently handles both tiny (100B) and huge (1GiB) chunks.
 func writeChunkedFile(path string, chunks []Chunk) (err error) {
@@ -115,26 +169,50 @@ func writeChunkedFile(path string, chunks []Chunk) (err error) {
 			return err
 		}
 	}
-	return nil
+
+	// Extend the file over a trailing hole
+	end, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return f.Truncate(end)
 }
 
 // writeChunk writes a single chunk to the file using streaming.
 func writeChunk(f *os.File, c Chunk) error {
-	const maxBufSize = 1 << 20 // 1MiB max buffer
-
 	size, err := humanize.ParseBytes(c.Size)
 	if err != nil {
 		return fmt.Errorf("parse chunk size %q: %w", c.Size, err)
 	}
 
+	if c.Hole {
+		_, err := f.Seek(int64(size), io.SeekCurrent)
+		return err
+	}
+	return streamChunk(f, c, size)
+}
+
+// streamChunk writes the size bytes of chunk c to w. A hole is written as the
+// zeros it reads as.
+func streamChunk(w io.Writer, c Chunk, size uint64) error {
+	const maxBufSize = 1 << 20 // 1MiB max buffer
+
 	// Use smaller buffer for small chunks
 	bufSize := int(size)
 	if bufSize > maxBufSize {
 		bufSize = maxBufSize
 	}
 
-	// Create pattern-filled buffer
-	buf := bytes.Repeat([]byte{byte(c.Pattern)}, bufSize)
+	// Create pattern-filled buffer, or a random stream refilling it
+	pattern := byte(c.Pattern)
+	if c.Hole {
+		pattern = 0
+	}
+	buf := bytes.Repeat([]byte{pattern}, bufSize)
+	var rng *rand.ChaCha8
+	if c.Random && !c.Hole {
+		rng = newChunkRand(c.Seed)
+	}
 
 	// Stream write
 	remaining := int64(size)
@@ -143,7 +221,10 @@ func writeChunk(f *os.File, c Chunk) error {
 		if remaining < toWrite {
 			toWrite = remaining
 		}
-		if _, err := f.Write(buf[:toWrite]); err != nil {
+		if rng != nil {
+			_, _ = rng.Read(buf[:toWrite])
+		}
+		if _, err := w.Write(buf[:toWrite]); err != nil {
 			return err
 		}
 		remaining -= toWrite
@@ -151,6 +232,13 @@ func writeChunk(f *os.File, c Chunk) error {
 	return nil
 }
 
+// newChunkRand returns the pseudo-random stream for a Random chunk's seed.
+func newChunkRand(seed uint64) *rand.ChaCha8 {
+	var key [32]byte
+	binary.LittleEndian.PutUint64(key[:], seed)
+	return rand.NewChaCha8(key)
+}
+
 // sowSymlinks creates symlinks in a volume.
 func sowSymlinks(volPath string, symlinks []Symlink) error {
 	for _, sym := range symlinks {
@@ -2,7 +2,7 @@
 //
 // It supports two modes:
 //   - Integration tests: TempDirHarness creates files in t.TempDir()
-//   - E2E tests: DockerHarness uses Docker containers with tmpfs mounts
+//   - E2E tests: DockerHarness uses containers (Docker or podman) with tmpfs mounts
 //
 // The E2E mode enables cross-device deduplication testing where each
 // tmpfs mount appears as a separate filesystem with distinct device IDs.
@@ -58,12 +58,22 @@
 //	| Volumes        | Creates mounts     | Scope for assertions     |
 //	| File.Path      | Create file/links  | Assert same inode        |
 //	| File.Chunks    | Generate content   | Ignored                  |
+//	| Chunk.Hole     | Leave a hole       | Ignored                  |
+//	| File.UID/GID   | Chown (if set)     | Assert owner (if set)    |
+//	| File.Mode      | Chmod (if set)     | Assert perms (if set)    |
+//	| File.Mtime     | Set mtime (if set) | Assert mtime (if set)    |
+//	| Dir            | Chown/chmod dir    | Ignored                  |
 //	| Symlink.Path   | Create symlink     | Assert is symlink        |
 //	| Symlink.Target | Symlink target     | Assert symlink target    |
 //	| ExitCode       | Ignored            | Assert matches           |
 package testfs
 
-import "github.com/dustin/go-humanize"
+import (
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
 
 // -----------------------------------------------------------------------------
 // FileTree Specification Types
@@ -88,11 +98,34 @@ type Volume struct {
 	// Nested mounts are supported (e.g., "/data/subdir" inside "/data").
 	MountPoint string `json:"mountPoint"`
 
+	// FSType is the volume's filesystem: "" (tmpfs), or "ext4", "xfs", or
+	// "btrfs" on a loop-mounted image, for reflinks, EMLINK limits, and other
+	// per-filesystem behavior. Images need a privileged container and are
+	// supported by the E2E harness only.
+	FSType string `json:"fsType,omitempty"`
+
 	// Files in this volume (regular files, possibly hardlinked).
 	Files []File `json:"files,omitempty"`
 
 	// Symlinks in this volume.
 	Symlinks []Symlink `json:"symlinks,omitempty"`
+
+	// Dirs sets the owner and permissions of directories, e.g. to deny an
+	// unprivileged user write access. Applied after Files and Symlinks.
+	Dirs []Dir `json:"dirs,omitempty"`
+}
+
+// Dir sets the owner and permissions of a directory (setup only).
+// Directories are otherwise created implicitly from file paths, owned by the
+// creating user with mode 0755.
+type Dir struct {
+	// Path is relative to the volume mount point ("." for the volume itself).
+	Path string `json:"path"`
+
+	// UID, GID, and Mode as in File (nil/0 = unchanged).
+	UID  *int        `json:"uid,omitempty"`
+	GID  *int        `json:"gid,omitempty"`
+	Mode os.FileMode `json:"mode,omitempty"`
 }
 
 // File defines a regular file, possibly with hardlinks.
@@ -104,8 +137,10 @@ type Volume struct {
 // In verification context:
 //   - All paths must exist
 //   - All paths must share the same inode
+//   - Owner, permissions, and mtime must match where specified
 //
-// Content is specified via Chunks - each chunk fills a region with its pattern byte.
+// Content is specified via Chunks - each chunk fills a region with its pattern byte
+// or with pseudo-random bytes from its seed.
 // Same chunks = same content = duplicates detected.
 type File struct {
 	// Path contains one or more paths (relative to volume).
@@ -114,17 +149,52 @@ type File struct {
 	Path []string `json:"path"`
 
 	// Chunks specifies file content as a sequence of filled regions.
-	// Each chunk fills its size with the pattern byte.
+	// Each chunk fills its size with the pattern byte (or random bytes).
 	// Use IEC units for sizes: "1KiB", "1MiB", "1GiB".
 	Chunks []Chunk `json:"chunks,omitempty"`
+
+	// UID and GID of the owner (nil = unset: the creating user, not checked).
+	// Changing them to other users requires root. Use ID to take a literal's address.
+	UID *int `json:"uid,omitempty"`
+	GID *int `json:"gid,omitempty"`
+
+	// Mode holds the permission bits, e.g. 0o600 (0 = unset: 0644 minus umask,
+	// not checked).
+	Mode os.FileMode `json:"mode,omitempty"`
+
+	// Mtime is the modification time (zero = unset: creation time, not checked).
+	Mtime time.Time `json:"mtime,omitzero"`
+}
+
+// ID returns a pointer to id, for File.UID and File.GID.
+func ID(id int) *int {
+	return &id
 }
 
-// Chunk defines a region of file content filled with a pattern byte.
+// Chunk defines a region of file content filled with a pattern byte, with
+// deterministic pseudo-random bytes when Random is set, or left as a hole
+// when Hole is set.
 type Chunk struct {
 	// Pattern is the fill byte for this chunk region.
 	// Example: 'A' fills the region with 0x41 bytes.
+	// Ignored when Random is set.
 	Pattern rune `json:"pattern"`
 
+	// Random fills the region with pseudo-random bytes generated from Seed
+	// instead of Pattern. Non-repeating content catches offset mistakes that
+	// uniform bytes hide.
+	Random bool `json:"random,omitempty"`
+
+	// Seed selects the random stream. Chunks with the same Seed and Size have
+	// the same content; a chunk that is a prefix of another with the same
+	// Seed matches its first Size bytes.
+	Seed uint64 `json:"seed,omitempty"`
+
+	// Hole skips the region without writing, making the file sparse: it
+	// reads as zeros but allocates no blocks on filesystems that support
+	// holes. Pattern and Random are ignored.
+	Hole bool `json:"hole,omitempty"`
+
 	// Size in IEC units (1024-based): "1KiB", "1MiB", "1GiB".
 	// Parsed via go-humanize for precise alignment with verifier boundaries.
 	Size string `json:"size"`
@@ -186,10 +256,16 @@ type ReapVolume struct {
 
 // ReapFile contains file metadata including inode for hardlink verification.
 type ReapFile struct {
-	Path  []string `json:"path"`  // All paths sharing this inode
-	Inode uint64   `json:"inode"` // Inode number
-	Nlink uint64   `json:"nlink"` // Link count
-	Size  int64    `json:"size"`  // File size in bytes
+	Path      []string `json:"path"`      // All paths sharing this inode
+	Inode     uint64   `json:"inode"`     // Inode number
+	Nlink     uint64   `json:"nlink"`     // Link count
+	Size      int64    `json:"size"`      // File size in bytes
+	Allocated int64    `json:"allocated"` // Allocated bytes (less than Size for sparse files)
+
+	UID   int         `json:"uid"`   // Owner user ID
+	GID   int         `json:"gid"`   // Owner group ID
+	Mode  os.FileMode `json:"mode"`  // Permission bits
+	Mtime time.Time   `json:"mtime"` // Modification time
 }
 
 // ReapSymlink contains symlink metadata.
@@ -0,0 +1,165 @@
+package types
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// Stage identifies the pipeline stage that reported an event.
+type Stage int
+
+const (
+	StageScan     Stage = iota // Walking directories and stat'ing files
+	StageVerify                // Hashing candidate files
+	StageDedupe                // Replacing duplicates with links
+	StageLinkFarm              // Building a link-farm tree
+	StageImport                // Re-stat'ing paths listed by another tool
+	StageArchive               // Reading archives for members duplicating loose files
+)
+
+// String returns the lowercase stage name used in error listings.
+func (s Stage) String() string {
+	switch s {
+	case StageScan:
+		return "scan"
+	case StageVerify:
+		return "verify"
+	case StageDedupe:
+		return "dedupe"
+	case StageLinkFarm:
+		return "link-farm"
+	case StageImport:
+		return "import"
+	case StageArchive:
+		return "archive"
+	default:
+		return "unknown"
+	}
+}
+
+// Reason classifies why a file was skipped or could not be processed.
+type Reason int
+
+const (
+	ReasonOther        Reason = iota // Anything not listed below
+	ReasonPermission                 // EACCES / EPERM
+	ReasonNotFound                   // File vanished (ENOENT)
+	ReasonIO                         // Read or device error (EIO)
+	ReasonLocked                     // Locked by another process
+	ReasonModified                   // Changed since the scan
+	ReasonCrossDevice                // Hardlink across devices (EXDEV)
+	ReasonTooManyLinks               // Link count limit reached (EMLINK)
+	ReasonProtected                  // Matched --protect
+	ReasonHook                       // Rejected by --pre-hook or --post-hook failed
+	ReasonReadOnly                   // On a read-only filesystem (EROFS)
+	ReasonImmutable                  // Immutable or append-only attribute set
+)
+
+// String returns the reason code used in reports and error listings.
+func (r Reason) String() string {
+	switch r {
+	case ReasonPermission:
+		return "perm"
+	case ReasonNotFound:
+		return "notfound"
+	case ReasonIO:
+		return "io"
+	case ReasonLocked:
+		return "locked"
+	case ReasonModified:
+		return "modified"
+	case ReasonCrossDevice:
+		return "exdev"
+	case ReasonTooManyLinks:
+		return "emlink"
+	case ReasonProtected:
+		return "protected"
+	case ReasonHook:
+		return "hook"
+	case ReasonReadOnly:
+		return "erofs"
+	case ReasonImmutable:
+		return "immutable"
+	default:
+		return "other"
+	}
+}
+
+// Sentinel errors for the skip causes callers most often branch on. An Event
+// matches the sentinel of its Reason with errors.Is, whatever error it wraps
+// (e.g. a raw EXDEV matches ErrCrossDevice); errors.As with *Event then
+// recovers the path and stage.
+var (
+	ErrFileLocked        = errors.New("file in use (locked by another process)")
+	ErrModifiedSinceScan = errors.New("file modified since scan")
+	ErrCrossDevice       = errors.New("cannot hardlink across device boundaries")
+	ErrMaxLinks          = errors.New("too many links")
+)
+
+// reasonErrs maps reasons to their sentinel errors.
+var reasonErrs = map[Reason]error{
+	ReasonLocked:       ErrFileLocked,
+	ReasonModified:     ErrModifiedSinceScan,
+	ReasonCrossDevice:  ErrCrossDevice,
+	ReasonTooManyLinks: ErrMaxLinks,
+}
+
+// ReasonOf classifies an error by its sentinel or errno. Errors that are not
+// recognized yield ReasonOther.
+func ReasonOf(err error) Reason {
+	for reason, sentinel := range reasonErrs {
+		if errors.Is(err, sentinel) {
+			return reason
+		}
+	}
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return ReasonPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return ReasonNotFound
+	case errors.Is(err, syscall.EIO):
+		return ReasonIO
+	case errors.Is(err, syscall.EXDEV):
+		return ReasonCrossDevice
+	case errors.Is(err, syscall.EMLINK):
+		return ReasonTooManyLinks
+	case errors.Is(err, syscall.EROFS):
+		return ReasonReadOnly
+	default:
+		return ReasonOther
+	}
+}
+
+// Event is a non-fatal problem with one file, sent by pipeline stages on
+// their event channel. It implements error.
+type Event struct {
+	Stage  Stage
+	Path   string // File or directory concerned ("" if none)
+	Reason Reason
+	Err    error
+}
+
+// NewEvent creates an event, classifying err with ReasonOf.
+func NewEvent(stage Stage, path string, err error) *Event {
+	return &Event{Stage: stage, Path: path, Reason: ReasonOf(err), Err: err}
+}
+
+// Error returns "path: err", or just err's message without a path. Paths
+// already present in err (e.g. *fs.PathError) are not repeated.
+func (e *Event) Error() string {
+	var pathErr *fs.PathError
+	if e.Path == "" || (errors.As(e.Err, &pathErr) && pathErr.Path == e.Path) {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Event) Unwrap() error { return e.Err }
+
+// Is reports whether target is the sentinel error of e's Reason.
+func (e *Event) Is(target error) bool {
+	sentinel, ok := reasonErrs[e.Reason]
+	return ok && target == sentinel
+}
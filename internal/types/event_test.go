@@ -0,0 +1,74 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+func TestReasonOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Reason
+	}{
+		{&fs.PathError{Op: "open", Path: "/a", Err: syscall.EACCES}, ReasonPermission},
+		{&fs.PathError{Op: "open", Path: "/a", Err: syscall.ENOENT}, ReasonNotFound},
+		{fmt.Errorf("read: %w", syscall.EIO), ReasonIO},
+		{&fs.PathError{Op: "link", Path: "/a", Err: syscall.EXDEV}, ReasonCrossDevice},
+		{syscall.EMLINK, ReasonTooManyLinks},
+		{&fs.PathError{Op: "rename", Path: "/a", Err: syscall.EROFS}, ReasonReadOnly},
+		{errors.New("something else"), ReasonOther},
+	}
+	for _, tt := range tests {
+		if got := ReasonOf(tt.err); got != tt.want {
+			t.Errorf("ReasonOf(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestEventError(t *testing.T) {
+	pathErr := &fs.PathError{Op: "open", Path: "/a", Err: syscall.EACCES}
+	tests := []struct {
+		e    *Event
+		want string
+	}{
+		{NewEvent(StageScan, "/a", pathErr), "open /a: permission denied"}, // Path not repeated
+		{NewEvent(StageVerify, "/b", pathErr), "/b: open /a: permission denied"},
+		{NewEvent(StageVerify, "", errors.New("x")), "x"},
+	}
+	for _, tt := range tests {
+		if got := tt.e.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+	if !errors.Is(tests[0].e, syscall.EACCES) {
+		t.Error("Event does not unwrap to its error")
+	}
+}
+
+func TestEventIs(t *testing.T) {
+	tests := []struct {
+		e    *Event
+		want error
+	}{
+		{NewEvent(StageDedupe, "/a", ErrFileLocked), ErrFileLocked},
+		{NewEvent(StageDedupe, "/a", fmt.Errorf("%w: details", ErrCrossDevice)), ErrCrossDevice},
+		{NewEvent(StageDedupe, "/a", &fs.PathError{Op: "link", Path: "/a", Err: syscall.EXDEV}), ErrCrossDevice},
+		{NewEvent(StageLinkFarm, "/a", syscall.EMLINK), ErrMaxLinks},
+		{&Event{Stage: StageDedupe, Path: "/a", Reason: ReasonModified, Err: errors.New("changed")}, ErrModifiedSinceScan},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.e, tt.want) {
+			t.Errorf("errors.Is(%v, %v) = false, want true", tt.e, tt.want)
+		}
+		var e *Event
+		if err := fmt.Errorf("wrapped: %w", tt.e); !errors.As(err, &e) || e.Path != "/a" {
+			t.Errorf("errors.As(%v) did not recover the event path", err)
+		}
+	}
+	if errors.Is(NewEvent(StageScan, "/a", syscall.EACCES), ErrFileLocked) {
+		t.Error("permission event matches ErrFileLocked")
+	}
+}
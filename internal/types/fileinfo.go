@@ -15,6 +15,21 @@ type FileInfo struct {
 	Dev     uint64
 	Ino     uint64
 	Nlink   uint32
+	Blocks  int64 // Allocated 512-byte blocks (st_blocks)
+
+	// Digest is the composite whole-file content digest (hex), recorded by the
+	// verifier once the file is confirmed as a duplicate. Empty until then.
+	Digest string
+
+	// Sampled is set when the verifier confirmed the file by comparing sample
+	// windows only (--sample-verify): Digest then covers just the bytes read.
+	Sampled bool
+}
+
+// DiskUsage returns the bytes actually allocated on disk. Unlike Size it
+// excludes holes in sparse files and reflects transparent compression.
+func (f *FileInfo) DiskUsage() int64 {
+	return f.Blocks * 512
 }
 
 // Sorted is an ordered collection that maintains sort order by a key function.
@@ -98,6 +113,16 @@ func NewDuplicateGroups(groups []DuplicateGroup) DuplicateGroups {
 	})
 }
 
+// ReclaimableBytes sums the allocated size of every sibling group but the
+// first, i.e. the disk space freed if all but one copy were replaced.
+func ReclaimableBytes(group DuplicateGroup) int64 {
+	var total int64
+	for _, siblings := range group.Items()[1:] {
+		total += siblings.First().DiskUsage()
+	}
+	return total
+}
+
 // Semaphore implements a counting semaphore using a buffered channel.
 // It limits concurrent access to a resource by blocking when the limit is reached.
 type Semaphore chan struct{}
@@ -0,0 +1,90 @@
+package verifier
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// DigestSet is a set of content digests (hex-encoded): composite digests as in
+// reports, or plain SHA-256 sums of whole files as sha256sum prints them.
+type DigestSet map[string]struct{}
+
+// Contains reports whether digest is in the set. A nil set contains nothing.
+func (s DigestSet) Contains(digest string) bool {
+	_, ok := s[digest]
+	return ok
+}
+
+// Eligible reports whether a confirmed group with this digest may be
+// deduplicated: it must not be in ignore and, if only is non-nil, must be in only.
+func Eligible(digest string, ignore, only DigestSet) bool {
+	if ignore.Contains(digest) {
+		return false
+	}
+	return only == nil || only.Contains(digest)
+}
+
+// ContentEligible reports whether a confirmed group whose representative file
+// is f may be deduplicated, as Eligible does, matching the sets against both
+// the group's composite digest and the plain SHA-256 of f. The plain sum takes
+// one more full read of f, done only if ignore or only is set. Sampled groups
+// are matched by the plain sum only: their composite digest covers part of the
+// content. A file that cannot be read in full is not eligible.
+func ContentEligible(ctx context.Context, f *types.FileInfo, digest string, ignore, only DigestSet) (bool, error) {
+	if ignore == nil && only == nil {
+		return true, nil
+	}
+	if !f.Sampled && ignore.Contains(digest) {
+		return false, nil
+	}
+	sum, n, err := hashRange(ctx, f.Path, 0, f.Size)
+	if err == nil && n != f.Size {
+		err = fmt.Errorf("file shrank while hashing: %w", io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return false, err
+	}
+	if !f.Sampled && Eligible(digest, nil, only) {
+		return !ignore.Contains(sum), nil
+	}
+	return Eligible(sum, ignore, only), nil
+}
+
+// LoadDigestSet reads digests from a file, one per line.
+//
+// Only the first whitespace-separated field of each line is used, so
+// "digest path" listings, such as sha256sum output, work as-is. Blank lines
+// and lines starting with '#' are ignored.
+func LoadDigestSet(path string) (DigestSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	set := make(DigestSet)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		digest := strings.ToLower(fields[0])
+		if raw, err := hex.DecodeString(digest); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: invalid digest %q", path, lineNo, fields[0])
+		}
+		set[digest] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
@@ -0,0 +1,102 @@
+package verifier
+
+import (
+	"io"
+	"os"
+
+	"github.com/ivoronin/dupedog/internal/types"
+)
+
+// Elimination describes where progressive verification tells a file apart
+// from all of its candidate peers.
+type Elimination struct {
+	Range  RangeHash // First range no remaining peer matches
+	Peer   string    // Peer that matched longest
+	Offset int64     // First byte at which f and Peer differ
+}
+
+// Explain replays the verifier's range comparison of f against peers (other
+// inodes of the same size) and returns the range where the last peer drops
+// out. Returns nil if some peer matches every range, i.e. f is a duplicate.
+//
+// Ranges are always compared in full, without the cache or --sample-verify.
+func Explain(f *types.FileInfo, peers []*types.FileInfo) (*Elimination, error) {
+	ranges, _, err := HashFile(f, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := make([][]RangeHash, 0, len(peers))
+	names := make([]string, 0, len(peers))
+	for _, p := range peers {
+		r, _, err := HashFile(p, nil)
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, r)
+		names = append(names, p.Path)
+	}
+
+	for i, r := range ranges {
+		var matched [][]RangeHash
+		var matchedNames []string
+		for j, pr := range remaining {
+			if i < len(pr) && pr[i].Hash == r.Hash {
+				matched = append(matched, pr)
+				matchedNames = append(matchedNames, names[j])
+			}
+		}
+		if len(matched) == 0 {
+			if len(names) == 0 {
+				return &Elimination{Range: r, Offset: -1}, nil
+			}
+			offset, err := firstDifference(f.Path, names[0], r.Start, r.Size)
+			if err != nil {
+				return nil, err
+			}
+			return &Elimination{Range: r, Peer: names[0], Offset: offset}, nil
+		}
+		remaining, names = matched, matchedNames
+	}
+	return nil, nil
+}
+
+// firstDifference returns the offset of the first byte in [start, start+size)
+// that differs between the files at a and b, or -1 if the range is identical.
+func firstDifference(a, b string, start, size int64) (int64, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = fa.Close() }()
+	fb, err := os.Open(b)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = fb.Close() }()
+
+	bufA, bufB := make([]byte, blockSize), make([]byte, blockSize)
+	for off := start; off < start+size; off += blockSize {
+		n := min(blockSize, start+size-off)
+		na, errA := fa.ReadAt(bufA[:n], off)
+		nb, errB := fb.ReadAt(bufB[:n], off)
+		for i := range min(na, nb) {
+			if bufA[i] != bufB[i] {
+				return off + int64(i), nil
+			}
+		}
+		if na != nb {
+			return off + int64(min(na, nb)), nil
+		}
+		if errA != nil && errA != io.EOF {
+			return 0, errA
+		}
+		if errB != nil && errB != io.EOF {
+			return 0, errB
+		}
+		if na < int(n) {
+			break
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,15 @@
+//go:build linux || freebsd
+
+package verifier
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// willNeed asks the kernel to start reading [off, off+n) of f in the
+// background. It is only a hint: errors are ignored.
+func willNeed(f *os.File, off, n int64) {
+	_ = unix.Fadvise(int(f.Fd()), off, n, unix.FADV_WILLNEED)
+}
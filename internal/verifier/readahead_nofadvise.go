@@ -0,0 +1,9 @@
+//go:build !(linux || freebsd)
+
+package verifier
+
+import "os"
+
+// willNeed is unsupported on this platform; reads rely on the kernel's own
+// read-ahead.
+func willNeed(*os.File, int64, int64) {}
@@ -0,0 +1,95 @@
+package verifier
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// zeros is a shared source of zero bytes for hole regions.
+var zeros = make([]byte, blockSize)
+
+// readAheadWindow is how far ahead of the read position the kernel is asked
+// to prefetch data (posix_fadvise WILLNEED) in ranges longer than it, so the
+// next window is fetched while the current one is hashed.
+const readAheadWindow = 8 << 20
+
+// sparseReader reads a byte range of a file, producing zeros for holes
+// without reading them from disk.
+//
+// Holes are located with SEEK_DATA/SEEK_HOLE. Since a hole reads as zeros,
+// a hole and an equally long run of written zeros hash identically. Where
+// hole detection is unavailable, the whole range is read as data.
+type sparseReader struct {
+	f         *os.File
+	pos       int64 // Next offset to produce
+	end       int64 // End of the requested range (capped at file size)
+	holeEnd   int64 // pos < holeEnd → produce zeros
+	dataEnd   int64 // pos < dataEnd → read from file
+	noSparse  bool  // Hole detection unavailable; read everything
+	hinted    int64 // Prefetch was requested up to here (readAhead)
+	readAhead bool  // Range is longer than readAheadWindow
+}
+
+// newSparseReader returns a reader for [start, start+size) of f.
+func newSparseReader(f *os.File, start, size int64) (*sparseReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	end := min(start+size, info.Size())
+	return &sparseReader{f: f, pos: start, end: end, hinted: start, readAhead: end-start > readAheadWindow}, nil
+}
+
+func (r *sparseReader) Read(p []byte) (int, error) {
+	if r.pos >= r.end {
+		return 0, io.EOF
+	}
+	if r.pos >= r.holeEnd && r.pos >= r.dataEnd {
+		r.locate()
+	}
+
+	if r.pos < r.holeEnd {
+		n := copy(p, zeros[:min(int64(len(zeros)), r.holeEnd-r.pos)])
+		r.pos += int64(n)
+		return n, nil
+	}
+
+	if r.readAhead && r.pos+readAheadWindow > r.hinted && r.hinted < r.end {
+		n := min(readAheadWindow, r.end-r.hinted)
+		willNeed(r.f, r.hinted, n)
+		r.hinted += n
+	}
+	n, err := r.f.ReadAt(p[:min(int64(len(p)), r.dataEnd-r.pos)], r.pos)
+	r.pos += int64(n)
+	if errors.Is(err, io.EOF) && n > 0 {
+		err = nil // Short read: file shrank; reported on next call
+	}
+	return n, err
+}
+
+// locate finds the hole or data segment starting at pos.
+func (r *sparseReader) locate() {
+	if r.noSparse {
+		r.dataEnd = r.end
+		return
+	}
+
+	dataStart, err := seekData(r.f, r.pos)
+	switch {
+	case errors.Is(err, syscall.ENXIO):
+		r.holeEnd = r.end // No data after pos: trailing hole
+	case err != nil:
+		r.noSparse = true // Unsupported: read everything as data
+		r.dataEnd = r.end
+	case dataStart > r.pos:
+		r.holeEnd = min(dataStart, r.end)
+	default:
+		holeStart, err := seekHole(r.f, r.pos)
+		if err != nil {
+			holeStart = r.end
+		}
+		r.dataEnd = min(holeStart, r.end)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd)
+
+package verifier
+
+import (
+	"errors"
+	"os"
+)
+
+// seekData is unsupported on this platform; files are read as fully allocated.
+func seekData(*os.File, int64) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// seekHole is unsupported on this platform; files are read as fully allocated.
+func seekHole(*os.File, int64) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
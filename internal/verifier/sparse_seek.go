@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package verifier
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// seekData returns the offset of the first data byte at or after off.
+func seekData(f *os.File, off int64) (int64, error) {
+	return f.Seek(off, unix.SEEK_DATA)
+}
+
+// seekHole returns the offset of the first hole at or after off
+// (end of file counts as a hole).
+func seekHole(f *os.File, off int64) (int64, error) {
+	return f.Seek(off, unix.SEEK_HOLE)
+}
@@ -75,6 +75,17 @@
 //	File Size > 2MB:      HEAD → TAIL → CHUNK[0] → [CHUNK[1]...] → done
 //	                      Chunks cover [1MB, fileSize-1MB), avoiding overlap with probes
 //
+// # Sample Verification
+//
+// With sample verification enabled, files at or above the threshold are not
+// read in full: after HEAD and TAIL, only N windows of probeSize at
+// pseudo-random offsets are compared instead of every chunk. Offsets are
+// derived from the file size, so every file in a group (and every run) reads
+// the same windows. Such groups are flagged with FileInfo.Sampled; their
+// digest covers only the bytes read.
+//
+//	Sampled (≥ threshold): HEAD → TAIL → WINDOW[0] → ... → WINDOW[N-1] → done
+//
 // # Why This Design?
 //
 //   - Progressive hashing minimizes I/O for non-duplicates (eliminated early)
@@ -82,21 +93,28 @@
 //   - Semaphore controls concurrent file reads (prevents fd exhaustion)
 //   - Fixed worker pool bounds goroutine count
 //   - Job spawning handles arbitrary file sizes with chunked verification
+//   - Range hashes are chained into a whole-file digest at no extra I/O cost
 //   - Buffered channels smooth producer/consumer rate differences
 package verifier
 
 import (
+	"cmp"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/ivoronin/dupedog/internal/cache"
+	"github.com/ivoronin/dupedog/internal/pause"
 	"github.com/ivoronin/dupedog/internal/progress"
 	"github.com/ivoronin/dupedog/internal/types"
 )
@@ -121,6 +139,7 @@ type job struct {
 	start      int64                // Byte offset to read
 	size       int64                // Number of bytes to read
 	totalBytes int64                // Cumulative bytes read INCLUDING this job
+	digest     []byte               // Composite digest of all ranges BEFORE this job
 }
 
 // stats tracks verification progress.
@@ -132,27 +151,42 @@ type stats struct {
 	confirmedCandidates atomic.Int64  // number of confirmed duplicates
 	confirmedBytes      atomic.Uint64 // bytes in confirmed duplicates
 	confirmedSets       atomic.Int64  // number of confirmed duplicate sets
+	sampledSets         atomic.Int64  // confirmed sets verified by sampling only
+	sampledBytes        atomic.Uint64 // bytes of sampled sets that were never compared
 	startTime           time.Time
 }
 
+// Counts implements progress.Counter: duplicates confirmed, and bytes read or
+// taken from the cache.
+func (s *stats) Counts() (items, bytes int64) {
+	return s.confirmedCandidates.Load(), int64(s.verifiedBytes.Load() + s.cachedBytes.Load())
+}
+
 func (s *stats) String() string {
 	elapsed := time.Since(s.startTime).Truncate(time.Millisecond)
 	verified := s.verifiedBytes.Load()
 	skipped := s.skippedBytes.Load()
 	cached := s.cachedBytes.Load()
-	total := verified + skipped + cached
+	sampled := s.sampledBytes.Load()
+	total := verified + skipped + cached + sampled
 	pct := 0.0
 	if s.totalCandidateBytes > 0 {
 		pct = float64(total) / float64(s.totalCandidateBytes) * 100
 	}
+	var line string
 	if cached > 0 {
-		return fmt.Sprintf("Verified %s + cached %s + skipped %s out of %s (%.0f%%), confirmed %d duplicates (%s) in %d sets in %v",
+		line = fmt.Sprintf("Verified %s + cached %s + skipped %s out of %s (%.0f%%), confirmed %d duplicates (%s) in %d sets in %v",
 			fmtBytes(verified), fmtBytes(cached), fmtBytes(skipped), fmtBytes(s.totalCandidateBytes),
 			pct, s.confirmedCandidates.Load(), fmtBytes(s.confirmedBytes.Load()), s.confirmedSets.Load(), elapsed)
+	} else {
+		line = fmt.Sprintf("Verified %s + skipped %s out of %s (%.0f%%), confirmed %d duplicates (%s) in %d sets in %v",
+			fmtBytes(verified), fmtBytes(skipped), fmtBytes(s.totalCandidateBytes),
+			pct, s.confirmedCandidates.Load(), fmtBytes(s.confirmedBytes.Load()), s.confirmedSets.Load(), elapsed)
+	}
+	if sets := s.sampledSets.Load(); sets > 0 {
+		line += fmt.Sprintf(" (%d sets SAMPLED, %s never compared)", sets, fmtBytes(sampled))
 	}
-	return fmt.Sprintf("Verified %s + skipped %s out of %s (%.0f%%), confirmed %d duplicates (%s) in %d sets in %v",
-		fmtBytes(verified), fmtBytes(skipped), fmtBytes(s.totalCandidateBytes),
-		pct, s.confirmedCandidates.Load(), fmtBytes(s.confirmedBytes.Load()), s.confirmedSets.Load(), elapsed)
+	return line
 }
 
 // Verifier confirms duplicates among candidate groups using progressive hashing.
@@ -162,29 +196,63 @@ type Verifier struct {
 	// Config (immutable, set by New)
 	groups       types.CandidateGroups // Input: candidate groups from screener
 	workers      int                   // Max concurrent file reads
-	showProgress bool                  // Whether to display progress bar
-	errCh        chan error            // Non-fatal errors (permission denied, etc.)
-	cache        *cache.Cache      // Optional hash cache (nil = disabled)
+	reporter     progress.Reporter     // Receives progress (nil = none)
+	verbosity    int                   // 2: print cache hits, 3: and hash decisions
+	errCh        chan *types.Event     // Non-fatal errors (permission denied, etc.)
+	cache        *cache.Cache          // Optional hash cache (nil = disabled)
+	ignore       DigestSet             // Digests never reported as duplicates (nil = none)
+	only         DigestSet             // If non-nil, only these digests are reported
+	sampleAbove  int64                 // Files this large are sample-verified (0 = never)
+	sampleCount  int                   // Windows compared per sample-verified file
+	largestFirst bool                  // Queue groups by descending file size instead of path
 
 	// Runtime (initialized in Run)
+	ctx       context.Context           // Canceled to stop hashing early
 	jobCh     chan job                  // Jobs to process
 	resultsCh chan types.DuplicateGroup // Output: confirmed duplicate groups
 	workerSem types.Semaphore           // Limits concurrent file reads
+	logMu     sync.Mutex                // Serializes verbose output
 	pending   sync.WaitGroup            // Tracks pending jobs
 	workerWg  sync.WaitGroup            // Tracks worker goroutines
 	bar       *progress.Bar             // Progress display (thread-safe)
 	stats     *stats                    // Progress tracking
 }
 
+// Options configures a Verifier.
+type Options struct {
+	Workers      int               // Max concurrent file reads (0 = 1)
+	Cache        *cache.Cache      // Hash cache (nil = disabled)
+	Ignore       DigestSet         // Digests never reported as duplicates (nil = none)
+	Only         DigestSet         // If non-nil, only these digests are reported
+	SampleAbove  int64             // Files this large are sample-verified (0 = never)
+	SampleCount  int               // Windows compared per sample-verified file
+	LargestFirst bool              // Hash groups of the largest files first instead of by path
+	Verbosity    int               // 2: print ranges taken from the cache, 3: and what each compared range decided
+	Reporter     progress.Reporter // Receives progress (nil = none)
+}
+
 // New creates a Verifier for confirming duplicates among candidate groups.
-// Use cache.Open("") for disabled cache; nil will panic.
-func New(groups types.CandidateGroups, workers int, showProgress bool, errCh chan error, hashCache *cache.Cache) *Verifier {
+// Non-fatal errors are sent to errCh. Groups whose digest is in Ignore, or not
+// in a non-nil Only, are dropped after verification. Files of at least
+// SampleAbove bytes are compared by SampleCount random windows after HEAD and
+// TAIL instead of in full.
+func New(groups types.CandidateGroups, opts Options, errCh chan *types.Event) *Verifier {
+	hashCache := opts.Cache
+	if hashCache == nil {
+		hashCache, _ = cache.Open("", 0, 0, cache.KeyPath, nil) // Disabled; cannot fail
+	}
 	return &Verifier{
 		groups:       groups,
-		workers:      workers,
-		showProgress: showProgress,
+		workers:      max(opts.Workers, 1),
+		reporter:     opts.Reporter,
+		verbosity:    opts.Verbosity,
 		errCh:        errCh,
 		cache:        hashCache,
+		ignore:       opts.Ignore,
+		only:         opts.Only,
+		sampleAbove:  opts.SampleAbove,
+		sampleCount:  opts.SampleCount,
+		largestFirst: opts.LargestFirst,
 	}
 }
 
@@ -203,6 +271,14 @@ func New(groups types.CandidateGroups, workers int, showProgress bool, errCh cha
 //   - < 1MB: CHUNK[0] → done  (single chunk covers whole file)
 //   - ≥ 1MB: HEAD → TAIL → CHUNK[0] → [CHUNK[1] → ...] → done
 func (v *Verifier) Run() types.DuplicateGroups {
+	return v.RunContext(context.Background())
+}
+
+// RunContext is Run that stops early when ctx is canceled: files not yet
+// hashed are dropped like unreadable ones, so only groups confirmed in full
+// before cancellation are returned.
+func (v *Verifier) RunContext(ctx context.Context) types.DuplicateGroups {
+	v.ctx = ctx
 	if v.groups.Len() == 0 {
 		return types.NewDuplicateGroups(nil)
 	}
@@ -218,7 +294,7 @@ func (v *Verifier) Run() types.DuplicateGroups {
 	v.jobCh = make(chan job, 1000)
 	v.resultsCh = make(chan types.DuplicateGroup, 100)
 	v.workerSem = types.NewSemaphore(v.workers)
-	v.bar = progress.New(v.showProgress, -1) // Spinner mode
+	v.bar = progress.New(v.reporter, "verify") // Spinner mode
 	v.stats = &stats{totalCandidateBytes: totalCandidateBytes, startTime: time.Now()}
 	v.bar.Describe(v.stats) // Render progress bar immediately
 
@@ -236,8 +312,8 @@ func (v *Verifier) Run() types.DuplicateGroups {
 	// Queue initial jobs (one per candidate group)
 	v.pending.Add(v.groups.Len())
 	go func() {
-		for _, candidateGroup := range v.groups.Items() {
-			j, _ := nextJob(nil, candidateGroup)
+		for _, candidateGroup := range v.queueOrder() {
+			j, _ := v.advance(nil, candidateGroup)
 			v.jobCh <- j
 		}
 	}()
@@ -260,7 +336,7 @@ func (v *Verifier) Run() types.DuplicateGroups {
 		duplicates = append(duplicates, group)
 		// Track confirmed duplicate stats (exclude original - only count files to be replaced)
 		v.stats.confirmedCandidates.Add(int64(group.Len() - 1))
-		v.stats.confirmedBytes.Add(uint64(group.First().First().Size) * uint64(group.Len()-1))
+		v.stats.confirmedBytes.Add(uint64(types.ReclaimableBytes(group)))
 		v.stats.confirmedSets.Add(1)
 		v.bar.Describe(v.stats)
 	}
@@ -269,99 +345,264 @@ func (v *Verifier) Run() types.DuplicateGroups {
 	return types.NewDuplicateGroups(duplicates)
 }
 
-// hashResult pairs a sibling group with its computed hash for aggregation.
-type hashResult struct {
-	hash     string
-	siblings types.SiblingGroup
+// queueOrder returns the candidate groups in the order their first jobs are
+// queued: by path, or with largestFirst by descending file size, so an
+// interrupted run has confirmed the largest duplicates.
+func (v *Verifier) queueOrder() []types.CandidateGroup {
+	if !v.largestFirst {
+		return v.groups.Items()
+	}
+	groups := slices.Clone(v.groups.Items())
+	slices.SortStableFunc(groups, func(a, b types.CandidateGroup) int {
+		return cmp.Compare(b.First().First().Size, a.First().First().Size)
+	})
+	return groups
+}
+
+// Stats are the totals of a finished verification.
+type Stats struct {
+	CandidateBytes int64 // Bytes of all candidate files
+	VerifiedBytes  int64 // Bytes read and hashed
+	CachedBytes    int64 // Bytes whose hashes came from the cache
+	SkippedBytes   int64 // Bytes never read thanks to early elimination
+	SampledBytes   int64 // Bytes of sampled sets that were never compared
+	ConfirmedFiles int64 // Duplicates confirmed, excluding one copy per set
+	ConfirmedBytes int64 // Allocated bytes of those duplicates
+	ConfirmedSets  int64
 }
 
-// verifyFilesInJob verifies sibling groups in a job with semaphore-limited concurrency.
+// Stats returns the totals of the verification. Call it after Run; before,
+// or if there was nothing to verify, it is zero.
+func (v *Verifier) Stats() Stats {
+	if v.stats == nil {
+		return Stats{}
+	}
+	return Stats{
+		CandidateBytes: int64(v.stats.totalCandidateBytes),
+		VerifiedBytes:  int64(v.stats.verifiedBytes.Load()),
+		CachedBytes:    int64(v.stats.cachedBytes.Load()),
+		SkippedBytes:   int64(v.stats.skippedBytes.Load()),
+		SampledBytes:   int64(v.stats.sampledBytes.Load()),
+		ConfirmedFiles: v.stats.confirmedCandidates.Load(),
+		ConfirmedBytes: int64(v.stats.confirmedBytes.Load()),
+		ConfirmedSets:  v.stats.confirmedSets.Load(),
+	}
+}
+
+// verifyFilesInJob verifies sibling groups in a job with bounded concurrency.
 //
-// Spawns a goroutine per sibling group, limited by semaphore to prevent fd exhaustion.
-// Hashes only ONE representative file per sibling group (same inode = identical content).
-// Returns sibling groups grouped by their hash - groups with 2+ siblings are potential duplicates.
+// At most workers goroutines per job take sibling groups in turn, and the
+// shared semaphore limits file reads across jobs to prevent fd exhaustion, so
+// a candidate group with thousands of members costs a few goroutines, not one
+// per member. Hashes only ONE representative file per sibling group (same
+// inode = identical content). Returns sibling groups grouped by their hash -
+// groups with 2+ siblings are potential duplicates.
 func (v *Verifier) verifyFilesInJob(j job) map[string][]types.SiblingGroup {
-	results := make(chan hashResult, j.siblings.Len())
+	items := j.siblings.Items()
+	hashes := make([]string, len(items)) // "" = not hashed
+	var next atomic.Int64
 	var wg sync.WaitGroup
 
-	for _, siblings := range j.siblings.Items() {
+	for range min(v.workers, len(items)) {
 		wg.Add(1)
-		go func(sibs types.SiblingGroup) {
+		go func() {
 			defer wg.Done()
-			v.workerSem.Acquire()
-			defer v.workerSem.Release()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(items) {
+					return
+				}
+				v.workerSem.Acquire()
+				hashes[i] = v.hashSiblings(j, items[i])
+				v.workerSem.Release()
+			}
+		}()
+	}
+	wg.Wait()
 
-			// Hash only the first file - all siblings are hardlinks with identical content
-			rep := sibs.First()
+	byHash := make(map[string][]types.SiblingGroup)
+	for i, hash := range hashes {
+		if hash != "" {
+			byHash[hash] = append(byHash[hash], items[i])
+		}
+	}
+	return byHash
+}
 
-			// Try cache first
-			cachedHash, err := v.cache.Lookup(rep, j.start, j.size)
-			if err != nil {
-				v.sendError(fmt.Errorf("cache lookup %s: %w", rep.Path, err))
-				// Continue with hash computation on cache error
-			}
-			if cachedHash != nil {
-				v.stats.cachedBytes.Add(uint64(j.size))
-				v.bar.Describe(v.stats)
-				results <- hashResult{hex.EncodeToString(cachedHash), sibs}
-				return
-			}
+// hashSiblings returns the hash of the job's range in a sibling group, or ""
+// if it cannot be hashed.
+func (v *Verifier) hashSiblings(j job, sibs types.SiblingGroup) string {
+	if v.ctx.Err() != nil {
+		return "" // Canceled: drop the file, its group cannot be confirmed
+	}
 
-			// Cache miss - compute hash
-			hash, n, err := hashRange(rep.Path, j.start, j.size)
-			if err != nil {
-				v.sendError(fmt.Errorf("%s: %w", rep.Path, err))
-				return
-			}
+	// Hash only the first file - all siblings are hardlinks with identical content
+	rep := sibs.First()
 
-			hashBytes, _ := hex.DecodeString(hash)
-			if err := v.cache.Store(rep, j.start, j.size, hashBytes); err != nil {
-				v.sendError(fmt.Errorf("cache store %s: %w", rep.Path, err))
-			}
-			v.stats.verifiedBytes.Add(uint64(n))
-			v.bar.Describe(v.stats)
+	// Try cache first
+	cachedHash, err := v.cache.Lookup(rep, j.start, j.size)
+	if err != nil {
+		v.sendError(&types.Event{Stage: types.StageVerify, Path: rep.Path, Err: fmt.Errorf("cache lookup: %w", err)})
+		// Continue with hash computation on cache error
+	}
+	if cachedHash != nil {
+		v.logf(2, "cache hit: %s (%s)", rep.Path, byteRange(j.start, j.size))
+		v.stats.cachedBytes.Add(uint64(j.size))
+		v.bar.Describe(v.stats)
+		return hex.EncodeToString(cachedHash)
+	}
 
-			results <- hashResult{hash, sibs}
-		}(siblings)
+	// Cache miss - compute hash
+	hash, n, err := hashRange(v.ctx, rep.Path, j.start, j.size)
+	if err != nil {
+		v.sendError(hashEvent(rep.Path, err))
+		return ""
 	}
-	wg.Wait()
-	close(results)
 
-	// Collect raw slices first (map iteration order is non-deterministic)
-	byHash := make(map[string][]types.SiblingGroup)
-	for r := range results {
-		byHash[r.hash] = append(byHash[r.hash], r.siblings)
+	hashBytes, _ := hex.DecodeString(hash)
+	if err := v.cache.Store(rep, j.start, j.size, hashBytes); err != nil {
+		v.sendError(&types.Event{Stage: types.StageVerify, Path: rep.Path, Err: fmt.Errorf("cache store: %w", err)})
 	}
-	return byHash
+	v.stats.verifiedBytes.Add(uint64(n))
+	v.bar.Describe(v.stats)
+	return hash
 }
 
 // processJob verifies sibling groups, splits by hash, and routes results.
 //
 // For each hash group with 2+ sibling groups:
-//   - If verification complete → send to results channel (confirmed duplicates)
+//   - If verification complete → send to results channel (confirmed duplicates),
+//     unless the digest is filtered out (see eligible)
 //   - If more ranges needed → queue next job (pending.Add + queue send)
 func (v *Verifier) processJob(j job) {
 	defer v.pending.Done()
 
-	for _, rawSiblings := range v.verifyFilesInJob(j) {
+	for hash, rawSiblings := range v.verifyFilesInJob(j) {
 		// Convert raw slice to sorted CandidateGroup
 		candidateGroup := types.NewCandidateGroup(rawSiblings)
 		if candidateGroup.Len() < 2 {
 			// Eliminated early - track bytes we avoided reading
 			fileSize := candidateGroup.First().First().Size
+			v.logf(3, "unique: %s differs from every candidate in %s", candidateGroup.First().First().Path, byteRange(j.start, j.size))
 			v.stats.skippedBytes.Add(uint64(fileSize - j.totalBytes))
 			v.bar.Describe(v.stats)
 			continue
 		}
-		if next, done := nextJob(&j, candidateGroup); done {
+		digest := chainDigest(j.digest, hash)
+		if next, done := v.advance(&j, candidateGroup); done {
+			encoded := hex.EncodeToString(digest)
+			unread := candidateGroup.First().First().Size - j.totalBytes
+			if unread > 0 {
+				markSampled(candidateGroup) // Before eligible, which reads sampled files in full
+			}
+			if !v.eligible(candidateGroup.First().First(), encoded) {
+				v.logf(3, "filtered: %d files with digest %s (--ignore-hash-file / --only-hash-file)", candidateGroup.Len(), encoded)
+				continue
+			}
+			v.logf(3, "confirmed: %d files matching %s, digest %s", candidateGroup.Len(), candidateGroup.First().First().Path, encoded)
+			recordDigest(candidateGroup, encoded)
+			if unread > 0 {
+				v.stats.sampledSets.Add(1)
+				v.stats.sampledBytes.Add(uint64(unread) * uint64(candidateGroup.Len()))
+			}
 			v.resultsCh <- types.NewDuplicateGroup(candidateGroup.Items())
 		} else {
+			next.digest = digest
+			v.logf(3, "match: %d files matching %s agree in %s, comparing %s next",
+				candidateGroup.Len(), candidateGroup.First().First().Path, byteRange(j.start, j.size), byteRange(next.start, next.size))
 			v.pending.Add(1)
 			v.jobCh <- next // Need more verification
 		}
 	}
 }
 
+// eligible reports whether a confirmed group with representative rep and this
+// digest may be deduplicated (see ContentEligible). Read failures are reported
+// and make the group ineligible.
+func (v *Verifier) eligible(rep *types.FileInfo, digest string) bool {
+	ok, err := ContentEligible(v.ctx, rep, digest, v.ignore, v.only)
+	if err != nil {
+		v.sendError(hashEvent(rep.Path, err))
+	}
+	return ok
+}
+
+// chainDigest folds a range hash into the composite digest of preceding ranges.
+//
+// The composite digest is a hash chain over the raw (32-byte) SHA-256 range
+// hashes h0, h1, ... in verification order (HEAD, TAIL, CHUNK[0], ...):
+// D0 = SHA-256(h0), Dn = SHA-256(Dn-1 || hn); the last Dn is the digest.
+// Once every byte has been verified it fingerprints the whole file without a
+// second read. It is NOT equal to a plain SHA-256 of the file content.
+func chainDigest(prev []byte, rangeHash string) []byte {
+	raw, _ := hex.DecodeString(rangeHash)
+	hasher := sha256.New()
+	hasher.Write(prev)
+	hasher.Write(raw)
+	return hasher.Sum(nil)
+}
+
+// recordDigest stores the composite digest on every file of a confirmed group.
+// All sibling groups share identical content, so they share one digest.
+func recordDigest(candidateGroup types.CandidateGroup, digest string) {
+	for _, siblings := range candidateGroup.Items() {
+		for _, f := range siblings.Items() {
+			f.Digest = digest
+		}
+	}
+}
+
+// markSampled flags every file of a group confirmed by sample verification.
+func markSampled(candidateGroup types.CandidateGroup) {
+	for _, siblings := range candidateGroup.Items() {
+		for _, f := range siblings.Items() {
+			f.Sampled = true
+		}
+	}
+}
+
+// advance returns the next job like nextJob, switching to sample windows after
+// HEAD and TAIL for files eligible for sample verification.
+func (v *Verifier) advance(prev *job, candidateGroup types.CandidateGroup) (next job, done bool) {
+	fileSize := candidateGroup.First().First().Size
+	if prev != nil && prev.totalBytes >= 2*probeSize && v.sampleAbove > 0 && fileSize >= v.sampleAbove &&
+		fileSize-2*probeSize > int64(v.sampleCount)*probeSize {
+		return nextSampleJob(prev, candidateGroup, v.sampleCount)
+	}
+	return nextJob(prev, candidateGroup)
+}
+
+// nextSampleJob returns the next sample window after HEAD and TAIL, or
+// done=true once all n windows have been compared.
+//
+// The window index follows from totalBytes, since every window is probeSize.
+func nextSampleJob(prev *job, candidateGroup types.CandidateGroup, n int) (next job, done bool) {
+	fileSize := candidateGroup.First().First().Size
+	k := int((prev.totalBytes - 2*probeSize) / probeSize)
+	if k >= n {
+		return job{}, true
+	}
+	start := sampleOffsets(fileSize, n)[k]
+	return job{siblings: candidateGroup, start: start, size: probeSize, totalBytes: prev.totalBytes + probeSize}, false
+}
+
+// sampleOffsets returns n sorted, non-overlapping window offsets within
+// [probeSize, fileSize-probeSize), i.e. between HEAD and TAIL.
+//
+// The middle is split into n equal strata with one window placed at a
+// pseudo-random position in each, seeded by fileSize: all files in a
+// candidate group share a size, so they are compared at the same offsets.
+func sampleOffsets(fileSize int64, n int) []int64 {
+	rng := rand.New(rand.NewPCG(uint64(fileSize), uint64(n))) //nolint:gosec // sampling, not security
+	middle := fileSize - 2*probeSize
+	stratum := middle / int64(n)
+	offsets := make([]int64, n)
+	for i := range offsets {
+		offsets[i] = probeSize + int64(i)*stratum + rng.Int64N(stratum-probeSize+1)
+	}
+	return offsets
+}
+
 // nextJob returns the next verification job, or done=true if verification is complete.
 //
 // RULE: Never read the same byte twice.
@@ -408,31 +649,145 @@ func nextJob(prev *job, candidateGroup types.CandidateGroup) (next job, done boo
 	return job{siblings: candidateGroup, start: start, size: size, totalBytes: prev.totalBytes + size}, false
 }
 
-// sendError sends an error to the errors channel if it's not nil.
-func (v *Verifier) sendError(err error) {
+// hashEvent classifies a hashing failure; a file that shrank was modified.
+func hashEvent(path string, err error) *types.Event {
+	e := types.NewEvent(types.StageVerify, path, err)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		e.Reason = types.ReasonModified
+	}
+	return e
+}
+
+// logf prints a verbose line to stdout if verbosity is at least level,
+// clearing the progress line first.
+func (v *Verifier) logf(level int, format string, args ...any) {
+	if v.verbosity < level {
+		return
+	}
+	v.logMu.Lock()
+	defer v.logMu.Unlock()
+	fmt.Fprintf(os.Stderr, "\r\033[K")
+	_, _ = fmt.Fprintf(os.Stdout, format+"\n", args...)
+}
+
+// byteRange formats the range of size bytes at start for verbose output.
+func byteRange(start, size int64) string {
+	return fmt.Sprintf("bytes %d-%d", start, start+size-1)
+}
+
+// sendError sends an event to the errors channel if it's not nil.
+func (v *Verifier) sendError(e *types.Event) {
 	if v.errCh != nil {
-		v.errCh <- err
+		v.errCh <- e
 	}
 }
 
+// Digest computes the composite whole-file digest of a single file, using the
+// same range sequence as Run. The result matches FileInfo.Digest recorded for
+// a confirmed duplicate with identical content.
+func Digest(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	_, digest, err := HashFile(&types.FileInfo{Path: path, Size: info.Size()}, nil)
+	return digest, err
+}
+
+// RangeHash is the hash of one byte range, as compared by the verifier.
+type RangeHash struct {
+	Name   string // "head", "tail", or "chunk[N]"
+	Start  int64  // Byte offset
+	Size   int64  // Number of bytes
+	Hash   string // SHA-256 (hex)
+	Cached bool   // Taken from the cache rather than read
+}
+
+// HashFile computes the range hashes of f in the order Run compares them,
+// and the composite digest over all of them.
+//
+// If hashCache is non-nil, ranges are looked up in it first and computed
+// hashes are stored, so hashing files ahead of a run warms the cache.
+func HashFile(f *types.FileInfo, hashCache *cache.Cache) (ranges []RangeHash, digest string, err error) {
+	group := types.NewCandidateGroup([]types.SiblingGroup{types.NewSiblingGroup([]*types.FileInfo{f})})
+
+	var chained []byte
+	j, _ := nextJob(nil, group)
+	for i := 0; ; i++ {
+		r := RangeHash{Name: rangeName(i), Start: j.start, Size: j.size}
+		if r.Hash, r.Cached, err = hashRangeCached(f, j.start, j.size, hashCache); err != nil {
+			return ranges, "", err
+		}
+		ranges = append(ranges, r)
+		chained = chainDigest(chained, r.Hash)
+
+		next, done := nextJob(&j, group)
+		if done {
+			return ranges, hex.EncodeToString(chained), nil
+		}
+		j = next
+	}
+}
+
+// rangeName names the i-th range of the verification sequence.
+func rangeName(i int) string {
+	switch i {
+	case 0:
+		return "head"
+	case 1:
+		return "tail"
+	default:
+		return fmt.Sprintf("chunk[%d]", i-2)
+	}
+}
+
+// hashRangeCached hashes a range of f through hashCache (if non-nil).
+// A short read means the file shrank since it was stat'ed.
+func hashRangeCached(f *types.FileInfo, start, size int64, hashCache *cache.Cache) (hash string, cached bool, err error) {
+	if hashCache != nil {
+		if raw, err := hashCache.Lookup(f, start, size); err == nil && raw != nil {
+			return hex.EncodeToString(raw), true, nil
+		}
+	}
+
+	hash, n, err := hashRange(context.Background(), f.Path, start, size)
+	if err != nil {
+		return "", false, err
+	}
+	if n != size {
+		return "", false, fmt.Errorf("file shrank while hashing: %w", io.ErrUnexpectedEOF)
+	}
+
+	if hashCache != nil {
+		raw, _ := hex.DecodeString(hash)
+		if err := hashCache.Store(f, start, size, raw); err != nil {
+			return "", false, fmt.Errorf("cache store: %w", err)
+		}
+	}
+	return hash, false, nil
+}
+
 // hashRange hashes a specific byte range of a file.
 //
 // Returns the SHA-256 hash (hex-encoded), bytes actually read, and any error.
-// Uses blockSize buffer for efficient I/O.
-func hashRange(path string, start, size int64) (hash string, n int64, err error) {
+// Uses blockSize buffer for efficient I/O. Holes in sparse files are hashed
+// as zeros without being read (see sparseReader). Reads pause while the
+// pause.Gate in ctx is paused.
+func hashRange(ctx context.Context, path string, start, size int64) (hash string, n int64, err error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return "", 0, err
 	}
 	defer func() { _ = f.Close() }()
 
-	if _, err := f.Seek(start, io.SeekStart); err != nil {
+	r, err := newSparseReader(f, start, size)
+	if err != nil {
 		return "", 0, err
 	}
 
 	hasher := sha256.New()
 	buf := make([]byte, blockSize)
-	n, err = io.CopyBuffer(hasher, io.LimitReader(f, size), buf)
+	n, err = io.CopyBuffer(hasher, pause.NewReader(ctx, r), buf)
 	if err != nil {
 		return "", n, err
 	}
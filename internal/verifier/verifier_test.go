@@ -3,18 +3,21 @@
 package verifier
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"syscall"
+	"strings"
 	"testing"
 
 	"github.com/ivoronin/dupedog/internal/cache"
 	"github.com/ivoronin/dupedog/internal/types"
 )
 
-// noCache is a disabled cache for tests (cache.Open("") returns no-op cache).
-var noCache, _ = cache.Open("")
-
 // =============================================================================
 // Section 5.1: Core Verifier Tests
 // =============================================================================
@@ -123,7 +126,7 @@ func TestHashRange(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	hash, n, err := hashRange(path, 0, int64(len(content)))
+	hash, n, err := hashRange(context.Background(), path, 0, int64(len(content)))
 	if err != nil {
 		t.Fatalf("hashRange failed: %v", err)
 	}
@@ -150,7 +153,7 @@ func TestHashRangePartial(t *testing.T) {
 	}
 
 	// Hash only "hello"
-	hash, n, err := hashRange(path, 0, 5)
+	hash, n, err := hashRange(context.Background(), path, 0, 5)
 	if err != nil {
 		t.Fatalf("hashRange failed: %v", err)
 	}
@@ -166,6 +169,105 @@ func TestHashRangePartial(t *testing.T) {
 	}
 }
 
+// TestHashRangeSparse tests that holes hash identically to written zeros.
+func TestHashRangeSparse(t *testing.T) {
+	root := t.TempDir()
+	const size = 4 * blockSize
+
+	// Sparse: data at the start and in the middle, holes elsewhere
+	sparse := filepath.Join(root, "sparse")
+	f, err := os.Create(sparse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("head"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("middle"), 2*blockSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	// Dense: same content with zeros written out
+	content := make([]byte, size)
+	copy(content, "head")
+	copy(content[2*blockSize:], "middle")
+	dense := filepath.Join(root, "dense")
+	if err := os.WriteFile(dense, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := []struct{ start, size int64 }{
+		{0, size},
+		{1, blockSize},
+		{blockSize + 7, 2 * blockSize},
+		{3 * blockSize, blockSize},
+	}
+	for _, r := range ranges {
+		wantHash, wantN, err := hashRange(context.Background(), dense, r.start, r.size)
+		if err != nil {
+			t.Fatalf("hashRange(dense) failed: %v", err)
+		}
+		gotHash, gotN, err := hashRange(context.Background(), sparse, r.start, r.size)
+		if err != nil {
+			t.Fatalf("hashRange(sparse) failed: %v", err)
+		}
+		if gotHash != wantHash || gotN != wantN {
+			t.Errorf("range [%d, +%d): sparse = (%s, %d), dense = (%s, %d)",
+				r.start, r.size, gotHash, gotN, wantHash, wantN)
+		}
+	}
+}
+
+// TestHashRangeReadAhead tests that ranges longer than the read-ahead window
+// hash correctly and request prefetch up to, but not beyond, their end.
+func TestHashRangeReadAhead(t *testing.T) {
+	root := t.TempDir()
+	content := make([]byte, 2*readAheadWindow+readAheadWindow/2)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	path := filepath.Join(root, "large")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	start, size := int64(7), int64(len(content)-7)
+	sum := sha256.Sum256(content[start:])
+	hash, n, err := hashRange(context.Background(), path, start, size)
+	if err != nil {
+		t.Fatalf("hashRange failed: %v", err)
+	}
+	if hash != hex.EncodeToString(sum[:]) || n != size {
+		t.Errorf("hashRange = (%s, %d), want (%x, %d)", hash, n, sum, size)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	r, err := newSparseReader(f, start, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, blockSize)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			break
+		}
+		if r.hinted < min(r.pos+readAheadWindow/2, r.end) || r.hinted > r.end {
+			t.Fatalf("at %d: prefetch requested up to %d, want ahead of the read and within %d", r.pos, r.hinted, r.end)
+		}
+	}
+	if r.hinted != r.end {
+		t.Errorf("prefetch requested up to %d, want %d", r.hinted, r.end)
+	}
+}
+
 // =============================================================================
 // Section 5.2: Verifier Boundary Conditions (CRITICAL)
 // =============================================================================
@@ -200,7 +302,7 @@ func TestVerifierSmallFiles(t *testing.T) {
 		}),
 	})
 
-	v := New(groups, 2, false, nil, noCache)
+	v := New(groups, Options{Workers: 2}, nil)
 	duplicates := v.Run()
 
 	if duplicates.Len() != 1 {
@@ -208,6 +310,31 @@ func TestVerifierSmallFiles(t *testing.T) {
 	}
 }
 
+// TestVerifierRunContextCanceled tests that a canceled run confirms nothing.
+func TestVerifierRunContextCanceled(t *testing.T) {
+	root := t.TempDir()
+	path1 := filepath.Join(root, "a.txt")
+	path2 := filepath.Join(root, "b.txt")
+	for _, p := range []string{path1, path2} {
+		if err := os.WriteFile(p, []byte("same content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups := types.NewCandidateGroups([]types.CandidateGroup{
+		types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, path1)}),
+			types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, path2)}),
+		}),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if duplicates := New(groups, Options{Workers: 2}, nil).RunContext(ctx); duplicates.Len() != 0 {
+		t.Errorf("canceled run confirmed %d groups, want 0", duplicates.Len())
+	}
+}
+
 // TestVerifierDifferentContent tests that different content yields no duplicates.
 func TestVerifierDifferentContent(t *testing.T) {
 	root := t.TempDir()
@@ -245,7 +372,7 @@ func TestVerifierDifferentContent(t *testing.T) {
 		}),
 	})
 
-	v := New(groups, 2, false, nil, noCache)
+	v := New(groups, Options{Workers: 2}, nil)
 	duplicates := v.Run()
 
 	if duplicates.Len() != 0 {
@@ -276,7 +403,7 @@ func TestVerifierEmptyFiles(t *testing.T) {
 		}),
 	})
 
-	v := New(groups, 2, false, nil, noCache)
+	v := New(groups, Options{Workers: 2}, nil)
 	duplicates := v.Run()
 
 	// Empty files should be considered duplicates (same content: nothing)
@@ -314,7 +441,7 @@ func TestVerifierExactlyProbeSize(t *testing.T) {
 		}),
 	})
 
-	v := New(groups, 2, false, nil, noCache)
+	v := New(groups, Options{Workers: 2}, nil)
 	duplicates := v.Run()
 
 	if duplicates.Len() != 1 {
@@ -357,7 +484,7 @@ func TestVerifierSiblingGroupOptimization(t *testing.T) {
 		}),
 	})
 
-	v := New(groups, 2, false, nil, noCache)
+	v := New(groups, Options{Workers: 2}, nil)
 	duplicates := v.Run()
 
 	if duplicates.Len() != 1 {
@@ -387,7 +514,7 @@ func TestVerifierSiblingGroupOptimization(t *testing.T) {
 
 // TestVerifierEmptyInput tests behavior with no candidate groups.
 func TestVerifierEmptyInput(t *testing.T) {
-	v := New(types.NewCandidateGroups(nil), 2, false, nil, noCache)
+	v := New(types.NewCandidateGroups(nil), Options{Workers: 2}, nil)
 	duplicates := v.Run()
 
 	if duplicates.Len() != 0 {
@@ -418,7 +545,7 @@ func TestVerifierUnreadableFile(t *testing.T) {
 	info1 := getFileInfo(t, path1)
 	info2 := getFileInfo(t, path2)
 
-	errCh := make(chan error, 10)
+	errCh := make(chan *types.Event, 10)
 	groups := types.NewCandidateGroups([]types.CandidateGroup{
 		types.NewCandidateGroup([]types.SiblingGroup{
 			types.NewSiblingGroup([]*types.FileInfo{info1}),
@@ -426,7 +553,7 @@ func TestVerifierUnreadableFile(t *testing.T) {
 		}),
 	})
 
-	v := New(groups, 2, false, errCh, noCache)
+	v := New(groups, Options{Workers: 2}, errCh)
 	duplicates := v.Run()
 	close(errCh)
 
@@ -468,7 +595,7 @@ func TestVerifierFileDeleted(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	errCh := make(chan error, 10)
+	errCh := make(chan *types.Event, 10)
 	groups := types.NewCandidateGroups([]types.CandidateGroup{
 		types.NewCandidateGroup([]types.SiblingGroup{
 			types.NewSiblingGroup([]*types.FileInfo{info1}),
@@ -476,7 +603,7 @@ func TestVerifierFileDeleted(t *testing.T) {
 		}),
 	})
 
-	v := New(groups, 2, false, errCh, noCache)
+	v := New(groups, Options{Workers: 2}, errCh)
 	duplicates := v.Run()
 	close(errCh)
 
@@ -543,7 +670,7 @@ func TestVerifierMultipleCandidateGroups(t *testing.T) {
 		}),
 	})
 
-	v := New(groups, 2, false, nil, noCache)
+	v := New(groups, Options{Workers: 2}, nil)
 	duplicates := v.Run()
 
 	if duplicates.Len() != 2 {
@@ -551,6 +678,511 @@ func TestVerifierMultipleCandidateGroups(t *testing.T) {
 	}
 }
 
+// TestVerifierLargeGroup tests that a candidate group with many more members
+// than workers is split by content, with every member hashed once.
+func TestVerifierLargeGroup(t *testing.T) {
+	root := t.TempDir()
+
+	// 300 files of 100 bytes: even indexes share content A, odd ones content B
+	var siblings []types.SiblingGroup
+	for i := range 300 {
+		content := make([]byte, 100)
+		content[0] = 'A' + byte(i%2)
+		path := filepath.Join(root, fmt.Sprintf("f%03d", i))
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		siblings = append(siblings, types.NewSiblingGroup([]*types.FileInfo{getFileInfo(t, path)}))
+	}
+	group := types.NewCandidateGroup(siblings)
+
+	v := New(types.NewCandidateGroups([]types.CandidateGroup{group}), Options{Workers: 3}, nil)
+	duplicates := v.Run()
+	if duplicates.Len() != 2 {
+		t.Fatalf("expected 2 duplicate groups, got %d", duplicates.Len())
+	}
+	for _, d := range duplicates.Items() {
+		if d.Len() != 150 {
+			t.Errorf("duplicate group of %s has %d members, want 150", d.First().First().Path, d.Len())
+		}
+	}
+	if got := v.Stats().VerifiedBytes; got != 300*100 {
+		t.Errorf("verified %d bytes, want %d", got, 300*100)
+	}
+}
+
+// TestSampleOffsets tests that sample windows are deterministic, ordered,
+// non-overlapping, and stay between HEAD and TAIL.
+func TestSampleOffsets(t *testing.T) {
+	const fileSize = 100*probeSize + 12345
+	offsets := sampleOffsets(fileSize, 8)
+	if len(offsets) != 8 {
+		t.Fatalf("got %d offsets, want 8", len(offsets))
+	}
+	for i, off := range offsets {
+		if off < probeSize || off+probeSize > fileSize-probeSize {
+			t.Errorf("window %d at %d outside [%d, %d)", i, off, probeSize, fileSize-probeSize)
+		}
+		if i > 0 && off < offsets[i-1]+probeSize {
+			t.Errorf("window %d at %d overlaps window at %d", i, off, offsets[i-1])
+		}
+	}
+	if again := sampleOffsets(fileSize, 8); again[3] != offsets[3] {
+		t.Error("sampleOffsets is not deterministic for the same size")
+	}
+}
+
+// TestVerifierSampleVerify tests that files above the threshold are compared by
+// sample windows only: differences outside the windows go unnoticed, and the
+// confirmed group is flagged as sampled.
+func TestVerifierSampleVerify(t *testing.T) {
+	root := t.TempDir()
+
+	size := int64(8 * probeSize)
+	offsets := sampleOffsets(size, 2)
+	contentA := make([]byte, size)
+	contentB := make([]byte, size)
+	// Differ between the two windows: invisible to sampling
+	contentB[(offsets[0]+probeSize+offsets[1])/2] = 'B'
+	contentC := make([]byte, size)
+	contentC[offsets[1]+1] = 'C' // Inside a window: detected
+
+	var infos []*types.FileInfo
+	for i, content := range [][]byte{contentA, contentB, contentC} {
+		path := filepath.Join(root, string(rune('a'+i)))
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, getFileInfo(t, path))
+	}
+	var siblings []types.SiblingGroup
+	for _, info := range infos {
+		siblings = append(siblings, types.NewSiblingGroup([]*types.FileInfo{info}))
+	}
+	newGroups := func() types.CandidateGroups {
+		return types.NewCandidateGroups([]types.CandidateGroup{types.NewCandidateGroup(siblings)})
+	}
+
+	duplicates := New(newGroups(), Options{Workers: 2, SampleAbove: size, SampleCount: 2}, nil).Run()
+	if duplicates.Len() != 1 || duplicates.First().Len() != 2 {
+		t.Fatalf("expected a and b sampled as duplicates, got %d groups", duplicates.Len())
+	}
+	for _, info := range infos[:2] {
+		if !info.Sampled {
+			t.Errorf("%s not flagged as sampled", info.Path)
+		}
+	}
+
+	// Above the file size: full verification tells a and b apart
+	infos[0].Sampled, infos[1].Sampled = false, false
+	if duplicates := New(newGroups(), Options{Workers: 2, SampleAbove: size + 1, SampleCount: 2}, nil).Run(); duplicates.Len() != 0 {
+		t.Errorf("expected no duplicates with full verification, got %d groups", duplicates.Len())
+	}
+	if infos[0].Sampled {
+		t.Error("fully verified file flagged as sampled")
+	}
+}
+
+// TestSampledDigestFilters tests that sampled groups are matched against
+// --ignore-hash-file / --only-hash-file by the SHA-256 of their full content,
+// not by their partial composite digest.
+func TestSampledDigestFilters(t *testing.T) {
+	root := t.TempDir()
+
+	size := int64(8 * probeSize)
+	content := make([]byte, size)
+	content[size/2] = 'x'
+	var infos []*types.FileInfo
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, getFileInfo(t, path))
+	}
+	newGroups := func() types.CandidateGroups {
+		for _, info := range infos {
+			info.Sampled = false
+		}
+		return types.NewCandidateGroups([]types.CandidateGroup{types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{infos[0]}),
+			types.NewSiblingGroup([]*types.FileInfo{infos[1]}),
+		})})
+	}
+	sum := sha256.Sum256(content)
+	full := DigestSet{hex.EncodeToString(sum[:]): {}}
+	opts := Options{Workers: 2, SampleAbove: size, SampleCount: 2}
+
+	duplicates := New(newGroups(), opts, nil).Run()
+	if duplicates.Len() != 1 || !infos[0].Sampled {
+		t.Fatalf("expected one sampled group, got %d groups", duplicates.Len())
+	}
+	partial := DigestSet{infos[0].Digest: {}}
+
+	opts.Ignore = full
+	if duplicates := New(newGroups(), opts, nil).Run(); duplicates.Len() != 0 {
+		t.Errorf("ignored content SHA-256: expected no groups, got %d", duplicates.Len())
+	}
+	opts.Ignore, opts.Only = nil, partial
+	if duplicates := New(newGroups(), opts, nil).Run(); duplicates.Len() != 0 {
+		t.Errorf("partial digest allowed: expected no groups, got %d", duplicates.Len())
+	}
+	opts.Only = full
+	if duplicates := New(newGroups(), opts, nil).Run(); duplicates.Len() != 1 {
+		t.Errorf("allowed content SHA-256: expected 1 group, got %d", duplicates.Len())
+	}
+}
+
+// TestVerifierRecordsDigest tests that confirmed duplicates get a composite digest
+// that is shared within a group and differs between groups with different content.
+func TestVerifierRecordsDigest(t *testing.T) {
+	root := t.TempDir()
+
+	// Larger than 2*probeSize so HEAD, TAIL and a CHUNK all feed the digest
+	size := 2*probeSize + 100
+	contentA := make([]byte, size)
+	contentB := make([]byte, size)
+	contentB[probeSize+50] = 'B' // Differs only in the middle chunk
+
+	var infos []*types.FileInfo
+	for i, content := range [][]byte{contentA, contentA, contentB, contentB} {
+		path := filepath.Join(root, string(rune('a'+i)))
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, getFileInfo(t, path))
+	}
+
+	var siblings []types.SiblingGroup
+	for _, info := range infos {
+		siblings = append(siblings, types.NewSiblingGroup([]*types.FileInfo{info}))
+	}
+	groups := types.NewCandidateGroups([]types.CandidateGroup{types.NewCandidateGroup(siblings)})
+
+	duplicates := New(groups, Options{Workers: 2}, nil).Run()
+	if duplicates.Len() != 2 {
+		t.Fatalf("expected 2 duplicate groups, got %d", duplicates.Len())
+	}
+
+	for _, info := range infos {
+		if len(info.Digest) != 64 {
+			t.Errorf("%s: Digest = %q, want 64 hex chars", info.Path, info.Digest)
+		}
+	}
+	if infos[0].Digest != infos[1].Digest || infos[2].Digest != infos[3].Digest {
+		t.Error("duplicates within a group have different digests")
+	}
+	if infos[0].Digest == infos[2].Digest {
+		t.Error("groups with different content share a digest")
+	}
+}
+
+// TestDigestMatchesRun tests that Digest reproduces the digest recorded by Run.
+func TestDigestMatchesRun(t *testing.T) {
+	root := t.TempDir()
+
+	content := make([]byte, 2*probeSize+100)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	path1 := filepath.Join(root, "a")
+	path2 := filepath.Join(root, "b")
+	for _, p := range []string{path1, path2} {
+		if err := os.WriteFile(p, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info1 := getFileInfo(t, path1)
+	info2 := getFileInfo(t, path2)
+
+	groups := types.NewCandidateGroups([]types.CandidateGroup{
+		types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{info1}),
+			types.NewSiblingGroup([]*types.FileInfo{info2}),
+		}),
+	})
+	New(groups, Options{Workers: 2}, nil).Run()
+
+	got, err := Digest(path1)
+	if err != nil {
+		t.Fatalf("Digest() failed: %v", err)
+	}
+	if got != info1.Digest {
+		t.Errorf("Digest() = %s, want %s (recorded by Run)", got, info1.Digest)
+	}
+
+	if _, err := Digest(filepath.Join(root, "missing")); err == nil {
+		t.Error("Digest() of missing file should return error")
+	}
+}
+
+// TestHashFileRangesAndCache tests that HashFile reports ranges in verification
+// order with Run's digest, and that a second pass is served from the cache.
+func TestHashFileRangesAndCache(t *testing.T) {
+	root := t.TempDir()
+
+	path := filepath.Join(root, "a")
+	if err := os.WriteFile(path, make([]byte, 2*probeSize+100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info := getFileInfo(t, path)
+
+	cachePath := filepath.Join(root, "cache.db")
+	hashCache, err := cache.Open(cachePath, 0, 0, cache.KeyPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranges, digest, err := HashFile(info, hashCache)
+	if err != nil {
+		t.Fatalf("HashFile() failed: %v", err)
+	}
+	var names []string
+	for _, r := range ranges {
+		names = append(names, r.Name)
+		if r.Cached {
+			t.Errorf("range %s cached on first pass", r.Name)
+		}
+	}
+	if strings.Join(names, ",") != "head,tail,chunk[0]" {
+		t.Errorf("ranges = %v, want [head tail chunk[0]]", names)
+	}
+	if want, _ := Digest(path); digest != want {
+		t.Errorf("HashFile() digest = %s, want %s", digest, want)
+	}
+
+	// Stored hashes become visible to the next run once this one closes
+	if err := hashCache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if hashCache, err = cache.Open(cachePath, 0, 0, cache.KeyPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = hashCache.Close() }()
+
+	ranges, _, err = HashFile(info, hashCache)
+	if err != nil {
+		t.Fatalf("HashFile() failed: %v", err)
+	}
+	for _, r := range ranges {
+		if !r.Cached {
+			t.Errorf("range %s not cached on second pass", r.Name)
+		}
+	}
+}
+
+// TestIgnoreDigests verifies that groups with ignored digests are dropped.
+func TestIgnoreDigests(t *testing.T) {
+	root := t.TempDir()
+
+	var infos []*types.FileInfo
+	for _, name := range []string{"keep1", "keep2", "legal1", "legal2"} {
+		path := filepath.Join(root, name)
+		content := []byte(name[:len(name)-1]) // Pairs share content
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, getFileInfo(t, path))
+	}
+
+	groups := types.NewCandidateGroups([]types.CandidateGroup{
+		types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{infos[0]}),
+			types.NewSiblingGroup([]*types.FileInfo{infos[1]}),
+		}),
+		types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{infos[2]}),
+			types.NewSiblingGroup([]*types.FileInfo{infos[3]}),
+		}),
+	})
+
+	legalDigest, err := Digest(infos[2].Path)
+	if err != nil {
+		t.Fatalf("Digest() failed: %v", err)
+	}
+
+	duplicates := New(groups, Options{Workers: 2, Ignore: DigestSet{legalDigest: {}}}, nil).Run()
+
+	if duplicates.Len() != 1 {
+		t.Fatalf("expected 1 duplicate group, got %d", duplicates.Len())
+	}
+	if got := duplicates.First().First().First().Path; got != infos[0].Path {
+		t.Errorf("remaining group starts with %s, want %s", got, infos[0].Path)
+	}
+}
+
+// TestIgnorePlainSHA256 verifies that groups are also dropped when the
+// plain SHA-256 of their content is ignored, as sha256sum lists it.
+func TestIgnorePlainSHA256(t *testing.T) {
+	root := t.TempDir()
+
+	var infos []*types.FileInfo
+	for _, name := range []string{"keep1", "keep2", "legal1", "legal2"} {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte(name[:len(name)-1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, getFileInfo(t, path))
+	}
+	groups := types.NewCandidateGroups([]types.CandidateGroup{
+		types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{infos[0]}),
+			types.NewSiblingGroup([]*types.FileInfo{infos[1]}),
+		}),
+		types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{infos[2]}),
+			types.NewSiblingGroup([]*types.FileInfo{infos[3]}),
+		}),
+	})
+
+	sum := sha256.Sum256([]byte("legal"))
+	duplicates := New(groups, Options{Workers: 2, Ignore: DigestSet{hex.EncodeToString(sum[:]): {}}}, nil).Run()
+
+	if duplicates.Len() != 1 || duplicates.First().First().First().Path != infos[0].Path {
+		t.Errorf("expected only the keep group, got %d groups", duplicates.Len())
+	}
+}
+
+// TestOnlyDigests verifies that a non-nil allowlist keeps only listed digests.
+func TestOnlyDigests(t *testing.T) {
+	root := t.TempDir()
+
+	var infos []*types.FileInfo
+	for _, name := range []string{"a1", "a2", "b1", "b2"} {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte(name[:1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, getFileInfo(t, path))
+	}
+	newGroups := func() types.CandidateGroups {
+		return types.NewCandidateGroups([]types.CandidateGroup{
+			types.NewCandidateGroup([]types.SiblingGroup{
+				types.NewSiblingGroup([]*types.FileInfo{infos[0]}),
+				types.NewSiblingGroup([]*types.FileInfo{infos[1]}),
+			}),
+			types.NewCandidateGroup([]types.SiblingGroup{
+				types.NewSiblingGroup([]*types.FileInfo{infos[2]}),
+				types.NewSiblingGroup([]*types.FileInfo{infos[3]}),
+			}),
+		})
+	}
+
+	bDigest, err := Digest(infos[2].Path)
+	if err != nil {
+		t.Fatalf("Digest() failed: %v", err)
+	}
+
+	duplicates := New(newGroups(), Options{Workers: 2, Only: DigestSet{bDigest: {}}}, nil).Run()
+	if duplicates.Len() != 1 || duplicates.First().First().First().Path != infos[2].Path {
+		t.Errorf("expected only the listed group, got %d groups", duplicates.Len())
+	}
+
+	// Plain SHA-256 of the content, as another system would list it
+	sum := sha256.Sum256([]byte("b"))
+	duplicates = New(newGroups(), Options{Workers: 2, Only: DigestSet{hex.EncodeToString(sum[:]): {}}}, nil).Run()
+	if duplicates.Len() != 1 || duplicates.First().First().First().Path != infos[2].Path {
+		t.Errorf("expected only the group with the listed SHA-256, got %d groups", duplicates.Len())
+	}
+
+	// Empty allowlist: nothing is eligible
+	duplicates = New(newGroups(), Options{Workers: 2, Only: DigestSet{}}, nil).Run()
+	if duplicates.Len() != 0 {
+		t.Errorf("expected 0 groups with empty allowlist, got %d", duplicates.Len())
+	}
+}
+
+func TestLoadDigestSet(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	path := filepath.Join(t.TempDir(), "digests")
+	content := "# compliance holds\n\n" + strings.ToUpper(digest) + "  /legal/contract.pdf\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := LoadDigestSet(path)
+	if err != nil {
+		t.Fatalf("LoadDigestSet() failed: %v", err)
+	}
+	if len(set) != 1 || !set.Contains(digest) {
+		t.Errorf("LoadDigestSet() = %v, want {%s}", set, digest)
+	}
+
+	if err := os.WriteFile(path, []byte("not-a-digest\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDigestSet(path); err == nil {
+		t.Error("LoadDigestSet() should reject invalid digests")
+	}
+}
+
+// TestExplain tests that Explain reports the range and offset where the
+// longest-matching peer drops out, and nil for a duplicate.
+func TestExplain(t *testing.T) {
+	root := t.TempDir()
+
+	content := make([]byte, 3*probeSize)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	write := func(name string, edit func([]byte)) *types.FileInfo {
+		data := append([]byte(nil), content...)
+		edit(data)
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return getFileInfo(t, path)
+	}
+	a := write("a", func([]byte) {})
+	copyA := write("copy", func([]byte) {})
+	middle := write("middle", func(b []byte) { b[probeSize+5]++ })
+	tail := write("tail", func(b []byte) { b[len(b)-1]++ })
+
+	elim, err := Explain(a, []*types.FileInfo{tail, middle})
+	if err != nil {
+		t.Fatalf("Explain() failed: %v", err)
+	}
+	if elim == nil {
+		t.Fatal("Explain() = nil, want elimination")
+	}
+	if elim.Range.Name != "chunk[0]" || elim.Peer != middle.Path || elim.Offset != probeSize+5 {
+		t.Errorf("Explain() = %s vs %s at %d, want chunk[0] vs %s at %d",
+			elim.Range.Name, elim.Peer, elim.Offset, middle.Path, probeSize+5)
+	}
+
+	elim, err = Explain(a, []*types.FileInfo{tail, copyA})
+	if err != nil || elim != nil {
+		t.Errorf("Explain() with identical peer = %v, %v; want nil, nil", elim, err)
+	}
+}
+
+// TestQueueOrderLargestFirst tests that largestFirst queues groups of larger
+// files first, and that the default keeps path order.
+func TestQueueOrderLargestFirst(t *testing.T) {
+	group := func(path string, size int64) types.CandidateGroup {
+		return types.NewCandidateGroup([]types.SiblingGroup{
+			types.NewSiblingGroup([]*types.FileInfo{{Path: path + "1", Size: size}}),
+			types.NewSiblingGroup([]*types.FileInfo{{Path: path + "2", Size: size}}),
+		})
+	}
+	groups := types.NewCandidateGroups([]types.CandidateGroup{group("/a", 10), group("/b", 30), group("/c", 20)})
+
+	order := func(largestFirst bool) []string {
+		var paths []string
+		for _, g := range New(groups, Options{Workers: 2, LargestFirst: largestFirst}, nil).queueOrder() {
+			paths = append(paths, g.First().First().Path)
+		}
+		return paths
+	}
+	if got, want := order(false), []string{"/a1", "/b1", "/c1"}; !slices.Equal(got, want) {
+		t.Errorf("queueOrder() = %v, want %v", got, want)
+	}
+	if got, want := order(true), []string{"/b1", "/c1", "/a1"}; !slices.Equal(got, want) {
+		t.Errorf("queueOrder() with largestFirst = %v, want %v", got, want)
+	}
+}
+
 // =============================================================================
 // Helper Functions
 // =============================================================================
@@ -569,5 +1201,6 @@ func getFileInfo(t *testing.T, path string) *types.FileInfo {
 		Dev:     uint64(stat.Dev), //nolint:unconvert // platform-dependent type
 		Ino:     stat.Ino,
 		Nlink:   uint32(stat.Nlink),
+		Blocks:  stat.Blocks,
 	}
 }